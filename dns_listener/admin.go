@@ -0,0 +1,62 @@
+package dns_listener
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FlushCache removes the cached answers of name for every type and class,
+// or every cached answer when name is empty, and returns the number of
+// entries removed
+func (d *DNSListener) FlushCache(name string) (int, error) {
+	if name == "" {
+		return d.cache.Clear(), nil
+	}
+	prefix, err := cacheKeyPrefix(name)
+	if err != nil {
+		return 0, err
+	}
+	return d.cache.DeletePrefix(prefix), nil
+}
+
+// requireAdmin rejects requests that do not carry ADMIN_TOKEN as a bearer
+// token
+func (d *DNSListener) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.config.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheFlushHandler serves FlushCache for POST /cache/flush, optionally
+// with ?name=example.com
+func (d *DNSListener) cacheFlushHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		n, err := d.FlushCache(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if name == "" {
+			d.logger.Write("Cache flushed by admin request")
+		} else {
+			d.logger.Write("Cache entries of " + name + " flushed by admin request")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"flushed": n})
+	})
+}
@@ -0,0 +1,90 @@
+package dns_listener
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestCacheFlushEndpoint(t *testing.T) {
+	d := newTestListener(t, &config.Config{AdminToken: "secret"})
+	ts := httptest.NewServer(d.newHealthServer().Handler())
+	defer ts.Close()
+
+	queries := map[string][]byte{
+		"example.com A":     buildTestQuery("example.com", protocol.TypeA),
+		"example.com AAAA":  buildTestQuery("EXAMPLE.com", protocol.TypeAAAA),
+		"www.example.com A": buildTestQuery("www.example.com", protocol.TypeA),
+		"example.org A":     buildTestQuery("example.org", protocol.TypeA),
+	}
+	for _, query := range queries {
+		d.cache.Set(cacheKeyFromQuery(query), d.createResponse(query), time.Hour)
+	}
+
+	flush := func(method, query, token string) (int, map[string]int) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+"/cache/flush"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]int
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, _ := flush(http.MethodPost, "", ""); status != http.StatusUnauthorized {
+		t.Errorf("flush without token status = %d, want 401", status)
+	}
+	if status, _ := flush(http.MethodPost, "", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("flush with wrong token status = %d, want 401", status)
+	}
+	if status, _ := flush(http.MethodGet, "", "secret"); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET flush status = %d, want 405", status)
+	}
+	if status, _ := flush(http.MethodPost, "?name=a..b", "secret"); status != http.StatusBadRequest {
+		t.Errorf("flush of a malformed name status = %d, want 400", status)
+	}
+
+	status, body := flush(http.MethodPost, "?name=Example.COM.", "secret")
+	if status != http.StatusOK || body["flushed"] != 2 {
+		t.Fatalf("flush by name = %d %v, want 200 and 2 entries", status, body)
+	}
+	for desc, query := range queries {
+		_, cached := d.cache.Get(cacheKeyFromQuery(query))
+		if want := desc == "www.example.com A" || desc == "example.org A"; cached != want {
+			t.Errorf("%s cached = %v, want %v", desc, cached, want)
+		}
+	}
+
+	if status, body = flush(http.MethodPost, "", "secret"); status != http.StatusOK || body["flushed"] != 2 {
+		t.Errorf("full flush = %d %v, want 200 and the 2 remaining entries", status, body)
+	}
+	if size := d.cache.Stats().Size; size != 0 {
+		t.Errorf("cache size after full flush = %d, want 0", size)
+	}
+}
+
+func TestCacheFlushDisabledWithoutToken(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	ts := httptest.NewServer(d.newHealthServer().Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/cache/flush", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("flush without ADMIN_TOKEN status = %d, want 404", resp.StatusCode)
+	}
+}
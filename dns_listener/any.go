@@ -0,0 +1,39 @@
+package dns_listener
+
+import (
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// anyHINFOTTL is the TTL of the synthesized HINFO answer; RFC 8482
+// suggests a long one so clients do not keep asking
+const anyHINFOTTL = 3600
+
+// anyHINFOData is the HINFO RDATA of RFC 8482 section 4.2: CPU "RFC8482"
+// and an empty OS string
+var anyHINFOData = []byte("\x07RFC8482\x00")
+
+// answerAny answers QTYPE=ANY queries according to the configured
+// AnyResponse mode. It reports false when the query should be resolved
+// normally.
+func (d *DNSListener) answerAny(query []byte) ([]byte, bool) {
+	if d.config.AnyResponse == config.AnyResponsePass {
+		return nil, false
+	}
+
+	q, err := protocol.ReadQuestion(query)
+	if err != nil || q.Type != protocol.TypeANY {
+		return nil, false
+	}
+
+	if d.config.AnyResponse == config.AnyResponseRefuse {
+		return d.errorResponse(query, protocol.RCodeRefused), true
+	}
+
+	b := protocol.NewResponseBuilder(query, d.responseOptions())
+	if b == nil {
+		return nil, false
+	}
+	b.AddAnswer(q.Name, protocol.TypeHINFO, protocol.ClassIN, anyHINFOTTL, anyHINFOData)
+	return d.capTTLs(b.Bytes()), true
+}
@@ -0,0 +1,57 @@
+package dns_listener
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestAnyResponse(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	query := buildTestQuery("example.com", protocol.TypeANY)
+
+	t.Run("hinfo", func(t *testing.T) {
+		d := newTestListener(t, &config.Config{AnyResponse: config.AnyResponseHINFO})
+		response, err := d.HandleRequest(query, addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		if rcode := protocol.RCode(response[3] & 0x0F); rcode != protocol.RCodeNoError {
+			t.Fatalf("rcode = %v, want NOERROR", rcode)
+		}
+		if an := binary.BigEndian.Uint16(response[6:8]); an != 1 {
+			t.Fatalf("answer count = %d, want 1", an)
+		}
+
+		// The answer follows the question with a compressed owner name
+		answer := response[len(query):]
+		if rrType := protocol.DNSType(binary.BigEndian.Uint16(answer[2:4])); rrType != protocol.TypeHINFO {
+			t.Errorf("answer type = %v, want HINFO", rrType)
+		}
+		if rdata := answer[12:]; !bytes.Equal(rdata, []byte("\x07RFC8482\x00")) {
+			t.Errorf("rdata = %q, want CPU RFC8482 and empty OS", rdata)
+		}
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		d := newTestListener(t, &config.Config{AnyResponse: config.AnyResponseRefuse})
+		response, err := d.HandleRequest(query, addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		if rcode := protocol.RCode(response[3] & 0x0F); rcode != protocol.RCodeRefused {
+			t.Errorf("rcode = %v, want REFUSED", rcode)
+		}
+	})
+
+	t.Run("other types unaffected", func(t *testing.T) {
+		d := newTestListener(t, &config.Config{AnyResponse: config.AnyResponseHINFO})
+		if rcode := queryRCode(t, d, "example.com"); rcode != protocol.RCodeNoError {
+			t.Errorf("A rcode = %v, want NOERROR", rcode)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// Package blocklist matches query names against a list of blocked domains.
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// List is an immutable set of blocked names. Plain entries block exactly
+// that name; entries of the form *.ads.example block every name below
+// ads.example.
+type List struct {
+	exact  map[string]struct{}
+	suffix map[string]struct{}
+}
+
+// Parse reads a blocklist with one domain per line. Blank lines and lines
+// starting with # are ignored, as is a leading IP address so that
+// hosts-style lists ("0.0.0.0 ads.example") can be used as is.
+func Parse(r io.Reader) (*List, error) {
+	l := &List{
+		exact:  make(map[string]struct{}),
+		suffix: make(map[string]struct{}),
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("line %d: expected a single domain, got %q", lineNum, line)
+		}
+
+		name := normalize(fields[0])
+		if name == "" || name == "*" {
+			return nil, fmt.Errorf("line %d: empty domain %q", lineNum, fields[0])
+		}
+		if suffix, ok := strings.CutPrefix(name, "*."); ok {
+			l.suffix[suffix] = struct{}{}
+			continue
+		}
+		l.exact[name] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Match reports whether name is blocked
+func (l *List) Match(name string) bool {
+	if l == nil {
+		return false
+	}
+
+	name = normalize(name)
+	if _, ok := l.exact[name]; ok {
+		return true
+	}
+	for i := strings.IndexByte(name, '.'); i >= 0; {
+		name = name[i+1:]
+		if _, ok := l.suffix[name]; ok {
+			return true
+		}
+		i = strings.IndexByte(name, '.')
+	}
+	return false
+}
+
+// Len returns the number of entries
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.exact) + len(l.suffix)
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
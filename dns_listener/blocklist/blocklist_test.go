@@ -0,0 +1,77 @@
+package blocklist
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	list, err := Parse(strings.NewReader(`
+# ads
+ads.example
+*.tracker.example   # all subdomains
+0.0.0.0 Malware.Example.
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if list.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", list.Len())
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"ads.example", true},
+		{"ADS.example.", true},
+		{"sub.ads.example", false},
+		{"a.tracker.example", true},
+		{"a.b.tracker.example", true},
+		{"tracker.example", false},
+		{"malware.example", true},
+		{"example.org", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := list.Match(tt.name); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"two names.example here", "*."} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", input)
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 100000; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(&sb, "*.tracker%d.example\n", i)
+		} else {
+			fmt.Fprintf(&sb, "ads%d.example\n", i)
+		}
+	}
+	list, err := Parse(strings.NewReader(sb.String()))
+	if err != nil {
+		b.Fatalf("Parse() error = %v", err)
+	}
+
+	names := []string{
+		"ads99999.example",
+		"a.b.tracker50000.example",
+		"www.example.org",
+		"deep.sub.domain.not-listed.example",
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list.Match(names[i%len(names)])
+	}
+}
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"io"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,29 +13,37 @@ type basicCacheItem struct {
 	expiration time.Time
 	size       int64
 	hits       int64
+	inserted   time.Time
 }
 
 type BasicCache struct {
 	mu              sync.RWMutex
 	items           map[string]*basicCacheItem
 	maxSize         int64
+	maxEntries      int
 	currentSize     int64
 	defaultTTL      time.Duration
 	cleanupInterval time.Duration
+	staleWindow     time.Duration
 	stats           Stats
 	evictions       uint64
+	onEvict         func(string, int64, EvictReason)
+	cleaner         cleaner
 }
 
 func New(cfg Config) Cache {
 	c := &BasicCache{
 		items:           make(map[string]*basicCacheItem),
 		maxSize:         cfg.MaxSize,
+		maxEntries:      cfg.MaxEntries,
 		defaultTTL:      cfg.DefaultTTL,
 		cleanupInterval: cfg.CleanupInterval,
+		staleWindow:     cfg.StaleWindow,
+		onEvict:         cfg.OnEvict,
 	}
 
 	if cfg.CleanupInterval > 0 {
-		go c.startCleanup()
+		c.cleaner.start(cfg.CleanupInterval, c.Cleanup)
 	}
 
 	return c
@@ -45,54 +55,93 @@ func (c *BasicCache) Get(key string) ([]byte, bool) {
 
 	item, exists := c.items[key]
 	if !exists || time.Now().After(item.expiration) {
-		c.stats.Misses++
+		atomic.AddInt64(&c.stats.Misses, 1)
 		return nil, false
 	}
 
-	c.stats.Hits++
-	item.hits++
+	atomic.AddInt64(&c.stats.Hits, 1)
+	atomic.AddInt64(&item.hits, 1)
 	return item.value, true
 }
 
-func (c *BasicCache) Set(key string, value []byte, ttl time.Duration) {
+// GetStale returns entries up to StaleWindow past their expiration,
+// reporting whether the returned value has expired
+func (c *BasicCache) GetStale(key string) ([]byte, bool, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, exists := c.items[key]
+	now := time.Now()
+	if !exists || now.After(item.expiration.Add(c.staleWindow)) {
+		atomic.AddInt64(&c.stats.Misses, 1)
+		return nil, false, false
+	}
+
+	atomic.AddInt64(&c.stats.Hits, 1)
+	atomic.AddInt64(&item.hits, 1)
+	return item.value, now.After(item.expiration), true
+}
+
+func (c *BasicCache) Entry(key string) (*EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, exists := c.items[key]
+	if !exists {
+		return nil, false
+	}
+	return &EntryInfo{
+		Inserted: item.inserted,
+		Hits:     atomic.LoadInt64(&item.hits),
+		Size:     item.size,
+		TTL:      time.Until(item.expiration),
+	}, true
+}
+
+// SetDefaultTTL replaces the TTL of entries set without one
+func (c *BasicCache) SetDefaultTTL(ttl time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.defaultTTL = ttl
+}
+
+func (c *BasicCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
 
 	if ttl <= 0 {
 		ttl = c.defaultTTL
 	}
 
+	// The replaced value no longer counts against the budget and must not
+	// be picked for eviction
 	size := int64(len(value))
 	if oldItem, exists := c.items[key]; exists {
 		c.currentSize -= oldItem.size
+		delete(c.items, key)
 	}
-	c.currentSize += size
 
-	// If we're at capacity, evict the oldest entry
-	if int64(len(c.items)) >= c.maxSize {
-		var oldestKey string
-		var oldestTime time.Time
-		for k, v := range c.items {
-			if oldestTime.IsZero() || v.expiration.Before(oldestTime) {
-				oldestTime = v.expiration
-				oldestKey = k
-			}
-		}
-		if oldestKey != "" {
-			delete(c.items, oldestKey)
-			atomic.AddUint64(&c.evictions, 1)
-			atomic.AddInt64(&c.stats.Evictions, 1)
+	// Make room within MaxSize bytes, and MaxEntries entries when set,
+	// dropping expired entries before live ones
+	evicted := c.removeExpired()
+	for c.currentSize+size > c.maxSize || c.maxEntries > 0 && len(c.items) >= c.maxEntries {
+		e, ok := c.evictOldest()
+		if !ok {
+			break
 		}
+		evicted = append(evicted, e)
 	}
+	c.currentSize += size
 
+	now := time.Now()
 	c.items[key] = &basicCacheItem{
 		value:      value,
-		expiration: time.Now().Add(ttl),
+		expiration: now.Add(ttl),
 		size:       size,
 		hits:       0,
+		inserted:   now,
 	}
-
-	c.cleanup()
+	c.mu.Unlock()
+	notifyEvict(c.onEvict, evicted...)
 }
 
 func (c *BasicCache) Delete(key string) {
@@ -105,6 +154,31 @@ func (c *BasicCache) Delete(key string) {
 	}
 }
 
+func (c *BasicCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.items)
+	c.items = make(map[string]*basicCacheItem)
+	c.currentSize = 0
+	return n
+}
+
+func (c *BasicCache) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for key, item := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.currentSize -= item.size
+			delete(c.items, key)
+			n++
+		}
+	}
+	return n
+}
+
 func (c *BasicCache) Stats() Stats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -112,43 +186,58 @@ func (c *BasicCache) Stats() Stats {
 	return Stats{
 		Size:          len(c.items),
 		BytesInMemory: uint64(c.currentSize),
-		Hits:          c.stats.Hits,
-		Misses:        c.stats.Misses,
-		Evictions:     c.stats.Evictions,
+		Hits:          atomic.LoadInt64(&c.stats.Hits),
+		Misses:        atomic.LoadInt64(&c.stats.Misses),
+		Evictions:     atomic.LoadInt64(&c.stats.Evictions),
 	}
 }
 
 func (c *BasicCache) Cleanup() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.cleanup()
+	evicted := c.cleanup()
+	c.mu.Unlock()
+	notifyEvict(c.onEvict, evicted...)
+}
+
+// cleanup drops the entries past the stale window and then the oldest ones
+// until the cache fits in maxSize. The caller holds c.mu and reports the
+// returned evictions once it is released.
+func (c *BasicCache) cleanup() []eviction {
+	evicted := c.removeExpired()
+	for c.currentSize > c.maxSize {
+		e, ok := c.evictOldest()
+		if !ok {
+			break
+		}
+		evicted = append(evicted, e)
+	}
+	return evicted
 }
 
-func (c *BasicCache) cleanup() {
+// removeExpired drops the entries past the stale window. The caller holds
+// c.mu.
+func (c *BasicCache) removeExpired() []eviction {
+	var evicted []eviction
 	now := time.Now()
 	for key, item := range c.items {
-		if now.After(item.expiration) {
+		if now.After(item.expiration.Add(c.staleWindow)) {
 			c.currentSize -= item.size
 			delete(c.items, key)
-			c.stats.Evictions++
 			atomic.AddUint64(&c.evictions, 1)
 			atomic.AddInt64(&c.stats.Evictions, 1)
+			evicted = append(evicted, eviction{key, item.size, EvictExpired})
 		}
 	}
-
-	for c.currentSize > c.maxSize {
-		c.evictOldest()
-	}
+	return evicted
 }
 
-func (c *BasicCache) startCleanup() {
-	ticker := time.NewTicker(c.cleanupInterval)
-	for range ticker.C {
-		c.Cleanup()
-	}
+// Close stops the cleanup goroutine and waits for it to exit
+func (c *BasicCache) Close() {
+	c.cleaner.stop()
 }
 
-func (c *BasicCache) evictOldest() {
+// evictOldest removes the entry expiring first. The caller holds c.mu.
+func (c *BasicCache) evictOldest() (eviction, bool) {
 	var oldestKey string
 	var oldestTime time.Time
 
@@ -159,7 +248,32 @@ func (c *BasicCache) evictOldest() {
 		}
 	}
 
-	if oldestKey != "" {
-		c.Delete(oldestKey)
+	if oldestKey == "" {
+		return eviction{}, false
+	}
+	item := c.items[oldestKey]
+	c.currentSize -= item.size
+	delete(c.items, oldestKey)
+	atomic.AddUint64(&c.evictions, 1)
+	atomic.AddInt64(&c.stats.Evictions, 1)
+	return eviction{oldestKey, item.size, EvictCapacity}, true
+}
+
+// Dump writes the unexpired entries to w
+func (c *BasicCache) Dump(w io.Writer) error {
+	now := time.Now()
+	c.mu.RLock()
+	entries := make([]dumpEntry, 0, len(c.items))
+	for key, item := range c.items {
+		if ttl := item.expiration.Sub(now); ttl > 0 {
+			entries = append(entries, dumpEntry{Key: key, Value: item.value, TTL: ttl})
+		}
 	}
+	c.mu.RUnlock()
+	return writeDump(w, entries)
+}
+
+// Load adds the unexpired entries of a dump
+func (c *BasicCache) Load(r io.Reader) error {
+	return readDump(r, c.Set)
 }
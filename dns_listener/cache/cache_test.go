@@ -1,6 +1,10 @@
 package cache
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -30,3 +34,493 @@ func TestCache(t *testing.T) {
 		t.Errorf("Stats().Hits = %d, want 1", stats.Hits)
 	}
 }
+
+func TestBasicCacheGetStale(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CleanupInterval = 0
+	cfg.StaleWindow = time.Hour
+	c := New(cfg).(StaleCache)
+
+	c.Set("fresh", []byte("a"), time.Hour)
+	c.Set("expired", []byte("b"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	c.Cleanup()
+
+	if v, stale, ok := c.GetStale("fresh"); !ok || stale || string(v) != "a" {
+		t.Errorf("GetStale(fresh) = %q, %v, %v, want a, false, true", v, stale, ok)
+	}
+	if v, stale, ok := c.GetStale("expired"); !ok || !stale || string(v) != "b" {
+		t.Errorf("GetStale(expired) = %q, %v, %v, want b, true, true", v, stale, ok)
+	}
+	if _, ok := c.Get("expired"); ok {
+		t.Error("Get(expired) ok = true, want miss past expiration")
+	}
+	if _, _, ok := c.GetStale("missing"); ok {
+		t.Error("GetStale(missing) ok = true")
+	}
+}
+
+func TestShardedCleanupAllShards(t *testing.T) {
+	for _, workers := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CleanupConcurrency = workers
+			c := NewSharded(cfg, 16).(*ShardedCache)
+
+			for i := 0; i < 1000; i++ {
+				c.Set(fmt.Sprintf("expired-%d", i), []byte("x"), time.Nanosecond)
+				c.Set(fmt.Sprintf("live-%d", i), []byte("x"), time.Hour)
+			}
+			time.Sleep(time.Millisecond)
+
+			c.Cleanup()
+
+			for i, shard := range c.shards {
+				for key := range shard.items {
+					if key[:4] != "live" {
+						t.Errorf("shard %d still holds expired key %s", i, key)
+					}
+				}
+			}
+			if stats := c.Stats(); stats.Size != 1000 || stats.Evictions != 1000 {
+				t.Errorf("Stats() size = %d, evictions = %d, want 1000, 1000", stats.Size, stats.Evictions)
+			}
+		})
+	}
+}
+
+func BenchmarkShardedCleanup(b *testing.B) {
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.CleanupConcurrency = workers
+			c := NewSharded(cfg, 64).(*ShardedCache)
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for j := 0; j < 200000; j++ {
+					c.Set(fmt.Sprintf("key-%d", j), []byte("value"), time.Nanosecond)
+				}
+				time.Sleep(time.Millisecond)
+				b.StartTimer()
+
+				c.Cleanup()
+			}
+		})
+	}
+}
+
+func TestEntryInfo(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CleanupInterval = 0
+	backends := map[string]Cache{
+		"basic":   New(cfg),
+		"lru":     NewLRU(cfg),
+		"sharded": NewSharded(cfg, 4),
+	}
+
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			before := time.Now()
+			c.Set("key", []byte("value"), time.Minute)
+
+			for i := 0; i < 3; i++ {
+				if _, ok := c.Get("key"); !ok {
+					t.Fatalf("Get() miss on fresh entry")
+				}
+			}
+
+			info, ok := c.Entry("key")
+			if !ok {
+				t.Fatal("Entry() ok = false for cached key")
+			}
+			if info.Hits != 3 {
+				t.Errorf("Hits = %d, want 3", info.Hits)
+			}
+			if info.Size != 5 {
+				t.Errorf("Size = %d, want 5", info.Size)
+			}
+			if info.Inserted.Before(before) || info.Inserted.After(time.Now()) {
+				t.Errorf("Inserted = %v, want between %v and now", info.Inserted, before)
+			}
+			if info.TTL <= 0 || info.TTL > time.Minute {
+				t.Errorf("TTL = %v, want within (0, 1m]", info.TTL)
+			}
+
+			// Inspecting is not a hit
+			if info, _ := c.Entry("key"); info.Hits != 3 {
+				t.Errorf("Hits = %d after Entry(), want 3", info.Hits)
+			}
+			if stats := c.Stats(); stats.Hits != 3 {
+				t.Errorf("Stats().Hits = %d, want 3", stats.Hits)
+			}
+			if _, ok := c.Entry("missing"); ok {
+				t.Error("Entry(missing) ok = true")
+			}
+		})
+	}
+}
+
+func TestSetDefaultTTL(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CleanupInterval = 0
+	backends := map[string]Cache{
+		"basic":   New(cfg),
+		"lru":     NewLRU(cfg),
+		"sharded": NewSharded(cfg, 4),
+	}
+
+	for name, c := range backends {
+		t.Run(name, func(t *testing.T) {
+			setter, ok := c.(TTLSetter)
+			if !ok {
+				t.Fatal("cache does not implement TTLSetter")
+			}
+			setter.SetDefaultTTL(time.Minute)
+			c.Set("key", []byte("value"), 0)
+
+			info, ok := c.Entry("key")
+			if !ok {
+				t.Fatal("Entry() ok = false for cached key")
+			}
+			if info.TTL <= 0 || info.TTL > time.Minute {
+				t.Errorf("TTL = %v, want the new 1m default", info.TTL)
+			}
+		})
+	}
+}
+
+func TestNewFromConfigBackends(t *testing.T) {
+	tests := []struct {
+		backend string
+		want    string
+	}{
+		{"", "*cache.BasicCache"},
+		{BackendBasic, "*cache.BasicCache"},
+		{BackendLRU, "*cache.LRUCache"},
+		{BackendSharded, "*cache.ShardedCache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CleanupInterval = 0
+			cfg.Shards = 4
+			var c Cache = NewFromConfig(cfg, tt.backend)
+			if got := fmt.Sprintf("%T", c); got != tt.want {
+				t.Fatalf("NewFromConfig(%q) = %s, want %s", tt.backend, got, tt.want)
+			}
+
+			c.Set("kept", []byte("value"), time.Hour)
+			c.Set("expired", []byte("old"), time.Nanosecond)
+			c.Set("deleted", []byte("gone"), time.Hour)
+			c.Delete("deleted")
+			time.Sleep(time.Millisecond)
+			c.Cleanup()
+
+			if v, ok := c.Get("kept"); !ok || string(v) != "value" {
+				t.Errorf("Get(kept) = %q, %v, want value, true", v, ok)
+			}
+			for _, key := range []string{"expired", "deleted", "missing"} {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("Get(%s) ok = true", key)
+				}
+			}
+			if info, ok := c.Entry("kept"); !ok || info.TTL <= 0 {
+				t.Errorf("Entry(kept) = %+v, %v, want a live entry", info, ok)
+			}
+			if stats := c.Stats(); stats.Size != 1 || stats.Hits != 1 {
+				t.Errorf("Stats() = %+v, want one entry and one hit", stats)
+			}
+		})
+	}
+
+	if sc := NewFromConfig(DefaultConfig(), BackendSharded).(*ShardedCache); sc.numShards != 32 {
+		t.Errorf("default shards = %d, want 32", sc.numShards)
+	}
+}
+
+func TestClearAndDeletePrefix(t *testing.T) {
+	for _, backend := range []string{BackendBasic, BackendLRU, BackendSharded} {
+		t.Run(backend, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CleanupInterval = 0
+			cfg.Shards = 4
+			c := NewFromConfig(cfg, backend)
+
+			for _, key := range []string{"example.com|A", "example.com|AAAA", "example.org|A", "www.example.com|A"} {
+				c.Set(key, []byte(key), time.Hour)
+			}
+
+			if n := c.DeletePrefix("example.com|"); n != 2 {
+				t.Errorf("DeletePrefix() = %d, want 2", n)
+			}
+			for _, key := range []string{"example.com|A", "example.com|AAAA"} {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("Get(%s) ok = true after DeletePrefix", key)
+				}
+			}
+			for _, key := range []string{"example.org|A", "www.example.com|A"} {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%s) ok = false, want it kept", key)
+				}
+			}
+			if stats := c.Stats(); stats.Size != 2 || stats.BytesInMemory != uint64(len("example.org|A")+len("www.example.com|A")) {
+				t.Errorf("Stats() = %+v, want the two remaining entries", stats)
+			}
+
+			if n := c.Clear(); n != 2 {
+				t.Errorf("Clear() = %d, want 2", n)
+			}
+			if stats := c.Stats(); stats.Size != 0 || stats.BytesInMemory != 0 {
+				t.Errorf("Stats() after Clear = %+v, want an empty cache", stats)
+			}
+			c.Set("after", []byte("value"), time.Hour)
+			if _, ok := c.Get("after"); !ok {
+				t.Error("Get() after Clear and Set missed")
+			}
+		})
+	}
+}
+
+func TestShardedEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  EvictionPolicy
+		survive []int // keys k0..k14 expected in the cache
+	}{
+		{"fifo", FIFO, []int{5, 6, 7, 8, 9, 10, 11, 12, 13, 14}},
+		{"lfu", LFU, []int{0, 1, 2, 3, 4, 10, 11, 12, 13, 14}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MaxSize = 10
+			cfg.CleanupInterval = 0
+			cfg.EvictionPolicy = tt.policy
+			c := NewSharded(cfg, 4)
+
+			for i := 0; i < 10; i++ {
+				c.Set(fmt.Sprintf("k%d", i), []byte("x"), time.Hour)
+			}
+			// Under LFU the first half is kept by its hits
+			for i := 0; i < 5; i++ {
+				c.Get(fmt.Sprintf("k%d", i))
+			}
+			for i := 10; i < 15; i++ {
+				c.Set(fmt.Sprintf("k%d", i), []byte("x"), time.Hour)
+			}
+
+			want := make(map[int]bool)
+			for _, i := range tt.survive {
+				want[i] = true
+			}
+			for i := 0; i < 15; i++ {
+				if info, ok := c.Entry(fmt.Sprintf("k%d", i)); ok != want[i] {
+					t.Errorf("k%d cached = %v (%+v), want %v", i, ok, info, want[i])
+				}
+			}
+			if stats := c.Stats(); stats.BytesInMemory != 10 || stats.Evictions != 5 {
+				t.Errorf("Stats() bytes = %d, evictions = %d, want 10, 5", stats.BytesInMemory, stats.Evictions)
+			}
+		})
+	}
+}
+
+func BenchmarkShardedEviction(b *testing.B) {
+	for name, policy := range map[string]EvictionPolicy{"lfu": LFU, "fifo": FIFO} {
+		b.Run(name, func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.MaxSize = 1000 * 5
+			cfg.CleanupInterval = 0
+			cfg.EvictionPolicy = policy
+			c := NewSharded(cfg, 16)
+
+			for i := 0; i < b.N; i++ {
+				c.Set(fmt.Sprintf("key-%d", i), []byte("value"), time.Hour)
+			}
+			if stats := c.Stats(); stats.BytesInMemory > uint64(cfg.MaxSize) {
+				b.Fatalf("cache holds %d bytes, above MaxSize %d", stats.BytesInMemory, cfg.MaxSize)
+			}
+		})
+	}
+}
+
+func TestDumpLoad(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CleanupInterval = 0
+	backends := map[string]func() Persistable{
+		"basic":   func() Persistable { return New(cfg).(Persistable) },
+		"sharded": func() Persistable { return NewSharded(cfg, 4).(Persistable) },
+	}
+
+	for name, newCache := range backends {
+		t.Run(name, func(t *testing.T) {
+			c := newCache()
+			c.Set("kept", []byte("value"), time.Hour)
+			c.Set("expired", []byte("old"), time.Nanosecond)
+			time.Sleep(time.Millisecond)
+
+			var buf bytes.Buffer
+			if err := c.Dump(&buf); err != nil {
+				t.Fatalf("Dump() error = %v", err)
+			}
+
+			restored := newCache()
+			if err := restored.Load(&buf); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if v, ok := restored.Get("kept"); !ok || string(v) != "value" {
+				t.Errorf("Get(kept) = %q, %v, want value, true", v, ok)
+			}
+			if info, ok := restored.Entry("kept"); !ok || info.TTL <= 0 || info.TTL > time.Hour {
+				t.Errorf("Entry(kept) TTL = %v, want within (0, 1h]", info.TTL)
+			}
+			if _, ok := restored.Entry("expired"); ok {
+				t.Error("expired entry was restored")
+			}
+
+			if err := restored.Load(strings.NewReader("not a dump")); err == nil {
+				t.Error("Load() of garbage succeeded")
+			}
+		})
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	for _, backend := range []string{BackendBasic, BackendLRU, BackendSharded} {
+		t.Run(backend, func(t *testing.T) {
+			var mu sync.Mutex
+			reasons := map[EvictReason]int{}
+			var c Cache
+			cfg := Config{
+				MaxSize:    64,
+				DefaultTTL: time.Hour,
+				Shards:     4,
+				OnEvict: func(key string, size int64, reason EvictReason) {
+					// Runs outside the cache locks, so reading the cache
+					// here must not deadlock
+					c.Stats()
+					if size != 16 {
+						t.Errorf("OnEvict(%s) size = %d, want 16", key, size)
+					}
+					mu.Lock()
+					reasons[reason]++
+					mu.Unlock()
+				},
+			}
+			c = NewFromConfig(cfg, backend)
+
+			// Ten 16 byte values overflow the 64 byte cache by six
+			for i := 0; i < 10; i++ {
+				c.Set(fmt.Sprintf("key%d", i), bytes.Repeat([]byte{'v'}, 16), 0)
+			}
+			// Deleting makes room, so the next entry can only expire
+			c.Delete("key9")
+			c.Set("expired", bytes.Repeat([]byte{'x'}, 16), time.Nanosecond)
+			time.Sleep(time.Millisecond)
+			c.Cleanup()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if reasons[EvictCapacity] < 6 {
+				t.Errorf("capacity evictions = %d, want at least 6", reasons[EvictCapacity])
+			}
+			if reasons[EvictExpired] != 1 {
+				t.Errorf("expired evictions = %d, want 1", reasons[EvictExpired])
+			}
+		})
+	}
+}
+
+func TestCloseStopsCleanup(t *testing.T) {
+	for _, backend := range []string{BackendBasic, BackendLRU, BackendSharded} {
+		t.Run(backend, func(t *testing.T) {
+			var cleaned sync.WaitGroup
+			cleaned.Add(1)
+			var mu sync.Mutex
+			var expired []string
+			c := NewFromConfig(Config{
+				MaxSize:         1024,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: 5 * time.Millisecond,
+				OnEvict: func(key string, size int64, reason EvictReason) {
+					mu.Lock()
+					defer mu.Unlock()
+					expired = append(expired, key)
+					if key == "before" {
+						cleaned.Done()
+					}
+				},
+			}, backend)
+
+			// The cleanup goroutine runs until Close
+			c.Set("before", []byte("v"), time.Nanosecond)
+			cleaned.Wait()
+
+			closed := make(chan struct{})
+			go func() {
+				c.Close()
+				c.Close()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatal("Close() did not return, the cleanup goroutine is still running")
+			}
+
+			c.Set("after", []byte("v"), time.Nanosecond)
+			time.Sleep(25 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if len(expired) != 1 {
+				t.Errorf("expired = %v after Close, want only the entry cleaned before", expired)
+			}
+		})
+	}
+}
+
+func TestBasicCacheByteBudget(t *testing.T) {
+	c := New(Config{MaxSize: 100, DefaultTTL: time.Hour})
+
+	// Ten 30 byte values: only three fit in 100 bytes, although the entry
+	// count stays far below MaxSize
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("key%d", i), bytes.Repeat([]byte{'v'}, 30), time.Duration(i+1)*time.Minute)
+	}
+
+	stats := c.Stats()
+	if stats.Size != 3 || stats.BytesInMemory != 90 || stats.Evictions != 7 {
+		t.Errorf("Stats() = %+v, want 3 entries, 90 bytes and 7 evictions", stats)
+	}
+	// The entries expiring first are evicted
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Get(fmt.Sprintf("key%d", i)); ok != (i >= 7) {
+			t.Errorf("Get(key%d) ok = %v, want %v", i, ok, i >= 7)
+		}
+	}
+
+	// Replacing an entry frees its old value first
+	c.Set("key9", bytes.Repeat([]byte{'v'}, 40), time.Hour)
+	if stats := c.Stats(); stats.Size != 3 || stats.BytesInMemory != 100 {
+		t.Errorf("after replacing, Stats() = %+v, want 3 entries and 100 bytes", stats)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	for _, backend := range []string{BackendBasic, BackendLRU, BackendSharded} {
+		t.Run(backend, func(t *testing.T) {
+			c := NewFromConfig(Config{MaxSize: 1 << 20, MaxEntries: 4, DefaultTTL: time.Hour, Shards: 4}, backend)
+			for i := 0; i < 10; i++ {
+				c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0)
+			}
+			c.Set("key9", []byte("replaced"), 0)
+			if stats := c.Stats(); stats.Size != 4 {
+				t.Errorf("Stats().Size = %d, want 4", stats.Size)
+			}
+			if v, ok := c.Get("key9"); !ok || string(v) != "replaced" {
+				t.Errorf("Get(key9) = %q, %v, want replaced, true", v, ok)
+			}
+		})
+	}
+}
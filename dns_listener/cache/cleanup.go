@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// cleaner runs the periodic Cleanup of a cache until it is stopped
+type cleaner struct {
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// start calls cleanup every interval in a new goroutine
+func (cl *cleaner) start(interval time.Duration, cleanup func()) {
+	cl.done = make(chan struct{})
+	cl.wg.Add(1)
+	go func() {
+		defer cl.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cleanup()
+			case <-cl.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop ends the goroutine of start, if any, and waits for it to exit.
+// Only the first call has an effect.
+func (cl *cleaner) stop() {
+	cl.once.Do(func() {
+		if cl.done != nil {
+			close(cl.done)
+		}
+		cl.wg.Wait()
+	})
+}
@@ -0,0 +1,22 @@
+package cache
+
+// Cache backends selectable by name
+const (
+	BackendBasic   = "basic"
+	BackendLRU     = "lru"
+	BackendSharded = "sharded"
+)
+
+// NewFromConfig returns a cache of the named backend. An empty or unknown
+// name selects the basic cache, the only backend that supports
+// GetStale.
+func NewFromConfig(cfg Config, backend string) Cache {
+	switch backend {
+	case BackendLRU:
+		return NewLRU(cfg)
+	case BackendSharded:
+		return NewSharded(cfg, cfg.Shards)
+	default:
+		return New(cfg)
+	}
+}
@@ -10,14 +10,68 @@ type EvictionPolicy int
 const (
 	LRU EvictionPolicy = iota
 	LFU
+	FIFO
 )
 
+// EvictReason tells why an entry was dropped without being deleted
+type EvictReason int
+
+const (
+	// EvictExpired entries outlived their TTL (and the stale window)
+	EvictExpired EvictReason = iota
+	// EvictCapacity entries were dropped to stay within MaxSize
+	EvictCapacity
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	default:
+		return fmt.Sprintf("EvictReason(%d)", int(r))
+	}
+}
+
 type Cache interface {
 	Get(key string) ([]byte, bool)
 	Set(key string, value []byte, ttl time.Duration)
 	Delete(key string)
+	// Clear removes every entry and DeletePrefix those whose key starts
+	// with prefix. Both return the number of entries removed.
+	Clear() int
+	DeletePrefix(prefix string) int
 	Cleanup()
 	Stats() Stats
+	// Entry returns metadata about key without counting as a hit or
+	// affecting eviction order
+	Entry(key string) (*EntryInfo, bool)
+	// Close stops the periodic cleanup. The cache stays usable, but expired
+	// entries are then only dropped on access or by calling Cleanup.
+	Close()
+}
+
+// EntryInfo describes a cached entry. TTL is the time left until
+// expiration and is negative for expired entries not yet cleaned up.
+type EntryInfo struct {
+	Inserted time.Time
+	Hits     int64
+	Size     int64
+	TTL      time.Duration
+}
+
+// StaleCache is a Cache that keeps entries for a grace period after they
+// expire. GetStale reports such entries as stale instead of missing.
+type StaleCache interface {
+	Cache
+	GetStale(key string) (value []byte, stale bool, ok bool)
+}
+
+// TTLSetter is a Cache whose default TTL, used by Set for a zero ttl, can
+// change while it is in use
+type TTLSetter interface {
+	SetDefaultTTL(ttl time.Duration)
 }
 
 type Stats struct {
@@ -29,10 +83,41 @@ type Stats struct {
 }
 
 type Config struct {
-	MaxSize         int64
+	MaxSize         int64 // byte budget of the cached values
 	DefaultTTL      time.Duration
 	CleanupInterval time.Duration
 	EvictionPolicy  EvictionPolicy
+	// MaxEntries additionally caps the number of entries; zero means no cap
+	MaxEntries int
+	// CleanupConcurrency bounds the number of shards cleaned in parallel;
+	// zero uses GOMAXPROCS
+	CleanupConcurrency int
+	// StaleWindow keeps expired entries available to GetStale for this long
+	StaleWindow time.Duration
+	// Shards is the number of shards of the sharded backend, rounded up to
+	// a power of two; zero uses 32
+	Shards int
+	// OnEvict, when set, is called for every entry dropped on expiration
+	// or under MaxSize pressure. It runs outside the cache locks, so it may
+	// log or use the cache itself.
+	OnEvict func(key string, size int64, reason EvictReason)
+}
+
+// eviction is an entry removed under a lock, reported to OnEvict once the
+// lock is released
+type eviction struct {
+	key    string
+	size   int64
+	reason EvictReason
+}
+
+func notifyEvict(hook func(string, int64, EvictReason), evicted ...eviction) {
+	if hook == nil {
+		return
+	}
+	for _, e := range evicted {
+		hook(e.key, e.size, e.reason)
+	}
 }
 
 func DefaultConfig() Config {
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"container/list"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,22 +21,31 @@ type LRUCache struct {
 		bytes     int64
 		size      int64
 	}
+	cleaner cleaner
 }
 
 type entry struct {
-	key     string
-	value   []byte
-	size    int64
-	expires time.Time
-	element *list.Element
+	key      string
+	value    []byte
+	size     int64
+	expires  time.Time
+	inserted time.Time
+	hits     uint64
+	element  *list.Element
 }
 
 func NewLRU(config Config) Cache {
-	return &LRUCache{
+	c := &LRUCache{
 		items:     make(map[string]*entry),
 		evictList: list.New(),
 		config:    config,
 	}
+
+	if config.CleanupInterval > 0 {
+		c.cleaner.start(config.CleanupInterval, c.Cleanup)
+	}
+
+	return c
 }
 
 func (c *LRUCache) Get(key string) ([]byte, bool) {
@@ -58,13 +68,36 @@ func (c *LRUCache) Get(key string) ([]byte, bool) {
 	c.evictList.MoveToFront(entry.element)
 	c.mu.Unlock()
 
+	atomic.AddUint64(&entry.hits, 1)
 	atomic.AddUint64(&c.stats.hits, 1)
 	return entry.value, true
 }
 
-func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+func (c *LRUCache) Entry(key string) (*EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ent, exists := c.items[key]
+	if !exists {
+		return nil, false
+	}
+	return &EntryInfo{
+		Inserted: ent.inserted,
+		Hits:     int64(atomic.LoadUint64(&ent.hits)),
+		Size:     ent.size,
+		TTL:      time.Until(ent.expires),
+	}, true
+}
+
+// SetDefaultTTL replaces the TTL of entries set without one
+func (c *LRUCache) SetDefaultTTL(ttl time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.config.DefaultTTL = ttl
+}
+
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
 
 	if ttl == 0 {
 		ttl = c.config.DefaultTTL
@@ -74,16 +107,20 @@ func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
 		c.removeElement(existing.element)
 	}
 
+	var evicted []eviction
 	valueSize := int64(len(value))
-	for atomic.LoadInt64(&c.stats.bytes)+valueSize > int64(c.config.MaxSize) && c.evictList.Len() > 0 {
-		c.removeOldest()
+	for c.evictList.Len() > 0 && (atomic.LoadInt64(&c.stats.bytes)+valueSize > c.config.MaxSize ||
+		c.config.MaxEntries > 0 && len(c.items) >= c.config.MaxEntries) {
+		evicted = append(evicted, c.removeOldest())
 	}
 
+	now := time.Now()
 	ent := &entry{
-		key:     key,
-		value:   value,
-		size:    valueSize,
-		expires: time.Now().Add(ttl),
+		key:      key,
+		value:    value,
+		size:     valueSize,
+		expires:  now.Add(ttl),
+		inserted: now,
 	}
 	ent.element = c.evictList.PushFront(ent)
 	c.items[key] = ent
@@ -91,6 +128,9 @@ func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
 
 	// Update size tracking
 	atomic.StoreInt64(&c.stats.size, int64(len(c.items)))
+	c.mu.Unlock()
+
+	notifyEvict(c.config.OnEvict, evicted...)
 }
 
 func (c *LRUCache) Delete(key string) {
@@ -101,18 +141,49 @@ func (c *LRUCache) Delete(key string) {
 	}
 }
 
+func (c *LRUCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.items)
+	c.items = make(map[string]*entry)
+	c.evictList.Init()
+	atomic.StoreInt64(&c.stats.size, 0)
+	atomic.StoreInt64(&c.stats.bytes, 0)
+	return n
+}
+
+func (c *LRUCache) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for key, ent := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.evictList.Remove(ent.element)
+			delete(c.items, key)
+			atomic.AddInt64(&c.stats.bytes, -ent.size)
+			n++
+		}
+	}
+	atomic.StoreInt64(&c.stats.size, int64(len(c.items)))
+	return n
+}
+
 func (c *LRUCache) removeElement(e *list.Element) {
 	c.evictList.Remove(e)
 	ent := e.Value.(*entry)
 	delete(c.items, ent.key)
+	atomic.StoreInt64(&c.stats.size, int64(len(c.items)))
 	atomic.AddInt64(&c.stats.bytes, -ent.size)
 	atomic.AddUint64(&c.stats.evictions, 1)
 }
 
-func (c *LRUCache) removeOldest() {
-	if ele := c.evictList.Back(); ele != nil {
-		c.removeElement(ele)
-	}
+// removeOldest removes the least recently used entry, which must exist
+func (c *LRUCache) removeOldest() eviction {
+	ent := c.evictList.Back().Value.(*entry)
+	c.removeElement(ent.element)
+	return eviction{ent.key, ent.size, EvictCapacity}
 }
 
 func (c *LRUCache) Size() int {
@@ -122,22 +193,23 @@ func (c *LRUCache) Size() int {
 }
 
 func (c *LRUCache) Cleanup() {
+	var evicted []eviction
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	now := time.Now()
 	for _, ent := range c.items {
 		if now.After(ent.expires) {
 			c.removeElement(ent.element)
+			evicted = append(evicted, eviction{ent.key, ent.size, EvictExpired})
 		}
 	}
+	c.mu.Unlock()
+
+	notifyEvict(c.config.OnEvict, evicted...)
 }
 
-func (c *LRUCache) startCleanup() {
-	ticker := time.NewTicker(c.config.CleanupInterval)
-	for range ticker.C {
-		c.Cleanup()
-	}
+// Close stops the cleanup goroutine and waits for it to exit
+func (c *LRUCache) Close() {
+	c.cleaner.stop()
 }
 
 func (c *LRUCache) Stats() Stats {
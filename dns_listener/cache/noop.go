@@ -0,0 +1,22 @@
+package cache
+
+import "time"
+
+// NoopCache is a Cache that stores nothing. It is used when caching is
+// disabled so that callers need no special cases.
+type NoopCache struct{}
+
+// NewNoop creates a cache that never holds entries
+func NewNoop() Cache {
+	return NoopCache{}
+}
+
+func (NoopCache) Get(key string) ([]byte, bool)                   { return nil, false }
+func (NoopCache) Set(key string, value []byte, ttl time.Duration) {}
+func (NoopCache) Delete(key string)                               {}
+func (NoopCache) Clear() int                                      { return 0 }
+func (NoopCache) DeletePrefix(prefix string) int                  { return 0 }
+func (NoopCache) Cleanup()                                        {}
+func (NoopCache) Stats() Stats                                    { return Stats{} }
+func (NoopCache) Entry(key string) (*EntryInfo, bool)             { return nil, false }
+func (NoopCache) Close()                                          {}
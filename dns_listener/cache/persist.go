@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"encoding/gob"
+	"io"
+	"time"
+)
+
+// Persistable is a Cache whose live entries can be saved and restored,
+// so a restarted server does not begin with an empty cache
+type Persistable interface {
+	Cache
+	// Dump writes every unexpired entry with its remaining TTL to w
+	Dump(w io.Writer) error
+	// Load adds the entries of a dump read from r. Entries that expired
+	// since the dump are skipped.
+	Load(r io.Reader) error
+}
+
+// dump is the gob encoded form of a cache. TTLs are relative to Saved.
+type dump struct {
+	Saved   time.Time
+	Entries []dumpEntry
+}
+
+type dumpEntry struct {
+	Key   string
+	Value []byte
+	TTL   time.Duration
+}
+
+func writeDump(w io.Writer, entries []dumpEntry) error {
+	return gob.NewEncoder(w).Encode(dump{Saved: time.Now(), Entries: entries})
+}
+
+// readDump calls set for each entry of the dump in r that has not expired
+// yet, with the TTL it has left
+func readDump(r io.Reader, set func(key string, value []byte, ttl time.Duration)) error {
+	var d dump
+	if err := gob.NewDecoder(r).Decode(&d); err != nil {
+		return err
+	}
+	elapsed := time.Since(d.Saved)
+	for _, e := range d.Entries {
+		if ttl := e.TTL - elapsed; ttl > 0 {
+			set(e.Key, e.Value, ttl)
+		}
+	}
+	return nil
+}
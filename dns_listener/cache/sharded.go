@@ -2,6 +2,9 @@ package cache
 
 import (
 	"hash/fnv"
+	"io"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,12 +15,15 @@ type ShardedCache struct {
 	numShards int
 	mask      uint32
 	config    Config
+	ttl       atomic.Int64 // default TTL, replaceable through SetDefaultTTL
+	seq       uint64       // insertion counter ordering items for FIFO eviction
 	stats     struct {
 		hits      uint64
 		misses    uint64
 		evictions uint64
 		bytes     int64
 	}
+	cleaner cleaner
 }
 
 type cacheShard struct {
@@ -30,6 +36,8 @@ type cacheItem struct {
 	expiration time.Time
 	size       int64
 	hits       uint64
+	inserted   time.Time
+	seq        uint64
 }
 
 func NewSharded(config Config, shards int) Cache {
@@ -44,6 +52,7 @@ func NewSharded(config Config, shards int) Cache {
 		mask:      uint32(shards - 1),
 		config:    config,
 	}
+	sc.ttl.Store(int64(config.DefaultTTL))
 
 	for i := 0; i < shards; i++ {
 		sc.shards[i] = &cacheShard{
@@ -51,6 +60,10 @@ func NewSharded(config Config, shards int) Cache {
 		}
 	}
 
+	if config.CleanupInterval > 0 {
+		sc.cleaner.start(config.CleanupInterval, sc.Cleanup)
+	}
+
 	return sc
 }
 
@@ -104,6 +117,7 @@ func (sc *ShardedCache) Get(key string) ([]byte, bool) {
 		atomic.AddUint64(&sc.stats.evictions, 1)
 		atomic.AddInt64(&sc.stats.bytes, -item.size)
 		shard.Unlock()
+		notifyEvict(sc.config.OnEvict, eviction{key, item.size, EvictExpired})
 		return nil, false
 	}
 
@@ -112,30 +126,58 @@ func (sc *ShardedCache) Get(key string) ([]byte, bool) {
 	return item.value, true
 }
 
+func (sc *ShardedCache) Entry(key string) (*EntryInfo, bool) {
+	shard := sc.getShard(key)
+	shard.RLock()
+	defer shard.RUnlock()
+
+	item, exists := shard.items[key]
+	if !exists {
+		return nil, false
+	}
+	return &EntryInfo{
+		Inserted: item.inserted,
+		Hits:     int64(atomic.LoadUint64(&item.hits)),
+		Size:     item.size,
+		TTL:      time.Until(item.expiration),
+	}, true
+}
+
+// SetDefaultTTL replaces the TTL of entries set without one
+func (sc *ShardedCache) SetDefaultTTL(ttl time.Duration) {
+	sc.ttl.Store(int64(ttl))
+}
+
 func (sc *ShardedCache) Set(key string, value []byte, ttl time.Duration) {
 	if ttl == 0 {
-		ttl = sc.config.DefaultTTL
+		ttl = time.Duration(sc.ttl.Load())
+	}
+
+	// Make room before taking the shard lock, as eviction locks shards
+	// itself
+	valueSize := int64(len(value))
+	for atomic.LoadInt64(&sc.stats.bytes)+valueSize > sc.config.MaxSize || sc.overEntries(key) {
+		if !sc.evict() {
+			break
+		}
 	}
 
 	shard := sc.getShard(key)
 	shard.Lock()
 	defer shard.Unlock()
 
-	// Check size before adding
-	valueSize := int64(len(value))
-	if atomic.LoadInt64(&sc.stats.bytes)+valueSize > int64(sc.config.MaxSize) {
-		sc.evict()
-	}
-
 	// Update or add item
 	if existing, exists := shard.items[key]; exists {
 		atomic.AddInt64(&sc.stats.bytes, -existing.size)
 	}
 
+	now := time.Now()
 	shard.items[key] = &cacheItem{
 		value:      value,
-		expiration: time.Now().Add(ttl),
+		expiration: now.Add(ttl),
 		size:       valueSize,
+		inserted:   now,
+		seq:        atomic.AddUint64(&sc.seq, 1),
 	}
 	atomic.AddInt64(&sc.stats.bytes, valueSize)
 }
@@ -150,6 +192,45 @@ func (sc *ShardedCache) Delete(key string) {
 	shard.Unlock()
 }
 
+func (sc *ShardedCache) Clear() int {
+	return sc.deleteMatching(func(string) bool { return true })
+}
+
+func (sc *ShardedCache) DeletePrefix(prefix string) int {
+	return sc.deleteMatching(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// deleteMatching removes the items whose key matches, one shard at a time
+func (sc *ShardedCache) deleteMatching(match func(key string) bool) int {
+	n := 0
+	for _, shard := range sc.shards {
+		var freed int64
+		shard.Lock()
+		for key, item := range shard.items {
+			if match(key) {
+				freed += item.size
+				delete(shard.items, key)
+				n++
+			}
+		}
+		shard.Unlock()
+		atomic.AddInt64(&sc.stats.bytes, -freed)
+	}
+	return n
+}
+
+// overEntries reports whether adding key would exceed MaxEntries
+func (sc *ShardedCache) overEntries(key string) bool {
+	if sc.config.MaxEntries <= 0 {
+		return false
+	}
+	shard := sc.getShard(key)
+	shard.RLock()
+	_, exists := shard.items[key]
+	shard.RUnlock()
+	return !exists && sc.Size() >= sc.config.MaxEntries
+}
+
 func (sc *ShardedCache) Size() int {
 	var size int
 	for _, shard := range sc.shards {
@@ -160,26 +241,66 @@ func (sc *ShardedCache) Size() int {
 	return size
 }
 
+// Cleanup removes expired items. Shards are cleaned by a bounded pool of
+// workers so that each shard lock is only held for its own sweep.
 func (sc *ShardedCache) Cleanup() {
 	now := time.Now()
-	for _, shard := range sc.shards {
-		shard.Lock()
-		for key, item := range shard.items {
-			if now.After(item.expiration) {
-				atomic.AddInt64(&sc.stats.bytes, -item.size)
-				delete(shard.items, key)
-				atomic.AddUint64(&sc.stats.evictions, 1)
-			}
+
+	workers := sc.config.CleanupConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(sc.shards) {
+		workers = len(sc.shards)
+	}
+	if workers <= 1 {
+		for _, shard := range sc.shards {
+			sc.cleanupShard(shard, now)
 		}
-		shard.Unlock()
+		return
+	}
+
+	shards := make(chan *cacheShard)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shard := range shards {
+				sc.cleanupShard(shard, now)
+			}
+		}()
+	}
+	for _, shard := range sc.shards {
+		shards <- shard
 	}
+	close(shards)
+	wg.Wait()
 }
 
-func (sc *ShardedCache) startCleanup() {
-	ticker := time.NewTicker(sc.config.CleanupInterval)
-	for range ticker.C {
-		sc.Cleanup()
+func (sc *ShardedCache) cleanupShard(shard *cacheShard, now time.Time) {
+	var freed int64
+	var evicted []eviction
+
+	shard.Lock()
+	for key, item := range shard.items {
+		if now.After(item.expiration) {
+			freed += item.size
+			delete(shard.items, key)
+			evicted = append(evicted, eviction{key, item.size, EvictExpired})
+		}
 	}
+	shard.Unlock()
+
+	// Update the shared counters once per shard to avoid contention
+	atomic.AddInt64(&sc.stats.bytes, -freed)
+	atomic.AddUint64(&sc.stats.evictions, uint64(len(evicted)))
+	notifyEvict(sc.config.OnEvict, evicted...)
+}
+
+// Close stops the cleanup goroutine and waits for it to exit
+func (sc *ShardedCache) Close() {
+	sc.cleaner.stop()
 }
 
 func (sc *ShardedCache) Stats() Stats {
@@ -198,18 +319,20 @@ func (sc *ShardedCache) Stats() Stats {
 	return stats
 }
 
-func (sc *ShardedCache) evict() {
+// evict removes one item according to the eviction policy. It reports
+// whether there was an item to remove.
+func (sc *ShardedCache) evict() bool {
 	switch sc.config.EvictionPolicy {
 	case LRU:
-		sc.evictLRU()
+		return sc.evictLRU()
 	case LFU:
-		sc.evictLFU()
+		return sc.evictLFU()
 	default:
-		sc.evictFIFO() // Default to FIFO if policy not specified
+		return sc.evictFIFO() // Default to FIFO if policy not specified
 	}
 }
 
-func (sc *ShardedCache) evictLRU() {
+func (sc *ShardedCache) evictLRU() bool {
 	var maxShard *cacheShard
 	maxItems := 0
 
@@ -222,24 +345,92 @@ func (sc *ShardedCache) evictLRU() {
 		shard.RUnlock()
 	}
 
-	if maxShard != nil {
-		maxShard.Lock()
-		for key, item := range maxShard.items {
-			atomic.AddInt64(&sc.stats.bytes, -item.size)
-			delete(maxShard.items, key)
-			atomic.AddUint64(&sc.stats.evictions, 1)
-			break // Just remove one item
+	if maxShard == nil {
+		return false
+	}
+	var evicted []eviction
+	maxShard.Lock()
+	for key, item := range maxShard.items {
+		atomic.AddInt64(&sc.stats.bytes, -item.size)
+		delete(maxShard.items, key)
+		atomic.AddUint64(&sc.stats.evictions, 1)
+		evicted = append(evicted, eviction{key, item.size, EvictCapacity})
+		break // Just remove one item
+	}
+	maxShard.Unlock()
+	notifyEvict(sc.config.OnEvict, evicted...)
+	return true
+}
+
+// evictLFU removes the item with the fewest hits, the oldest among equals
+func (sc *ShardedCache) evictLFU() bool {
+	return sc.evictFirst(func(a, b *cacheItem) bool {
+		ha, hb := atomic.LoadUint64(&a.hits), atomic.LoadUint64(&b.hits)
+		if ha != hb {
+			return ha < hb
 		}
-		maxShard.Unlock()
+		return a.seq < b.seq
+	})
+}
+
+// evictFIFO removes the item inserted first
+func (sc *ShardedCache) evictFIFO() bool {
+	return sc.evictFirst(func(a, b *cacheItem) bool {
+		return a.seq < b.seq
+	})
+}
+
+// evictFirst scans all shards and removes the item ordered first by
+// before. It reports whether there was an item to remove.
+func (sc *ShardedCache) evictFirst(before func(a, b *cacheItem) bool) bool {
+	var victimShard *cacheShard
+	var victimKey string
+	var victim *cacheItem
+	for _, shard := range sc.shards {
+		shard.RLock()
+		for key, item := range shard.items {
+			if victim == nil || before(item, victim) {
+				victimShard, victimKey, victim = shard, key, item
+			}
+		}
+		shard.RUnlock()
+	}
+	if victim == nil {
+		return false
 	}
+
+	victimShard.Lock()
+	// The item may have been replaced or removed since the scan
+	removed := victimShard.items[victimKey] == victim
+	if removed {
+		delete(victimShard.items, victimKey)
+		atomic.AddInt64(&sc.stats.bytes, -victim.size)
+		atomic.AddUint64(&sc.stats.evictions, 1)
+	}
+	victimShard.Unlock()
+	if removed {
+		notifyEvict(sc.config.OnEvict, eviction{victimKey, victim.size, EvictCapacity})
+	}
+	return true
 }
 
-func (sc *ShardedCache) evictLFU() {
-	// Similar to LRU but based on hit count
-	// Implementation omitted for brevity
+// Dump writes the unexpired entries of all shards to w
+func (sc *ShardedCache) Dump(w io.Writer) error {
+	now := time.Now()
+	var entries []dumpEntry
+	for _, shard := range sc.shards {
+		shard.RLock()
+		for key, item := range shard.items {
+			if ttl := item.expiration.Sub(now); ttl > 0 {
+				entries = append(entries, dumpEntry{Key: key, Value: item.value, TTL: ttl})
+			}
+		}
+		shard.RUnlock()
+	}
+	return writeDump(w, entries)
 }
 
-func (sc *ShardedCache) evictFIFO() {
-	// Similar to LRU but simpler removal
-	// Implementation omitted for brevity
+// Load adds the unexpired entries of a dump
+func (sc *ShardedCache) Load(r io.Reader) error {
+	return readDump(r, sc.Set)
 }
@@ -0,0 +1,54 @@
+package dns_listener
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// ANSI colors for console output; pass them to colorize rather than
+// writing them directly
+const (
+	colorReset  = "\033[0m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+)
+
+// colorCodes removes the codes colorize adds
+var colorCodes = strings.NewReplacer(colorReset, "", colorGreen, "", colorYellow, "", colorCyan, "")
+
+// stdoutIsTerminal reports whether stdout is a terminal. It is a variable
+// so it can be replaced in tests.
+var stdoutIsTerminal = sync.OnceValue(func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+})
+
+// useColor reports whether console output is colored. A non-empty
+// NO_COLOR turns colors off (https://no-color.org), FORCE_COLOR turns them
+// on when stdout is not a terminal, e.g. under a log collector that
+// renders them.
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("FORCE_COLOR"); force != "" && force != "0" && force != "false" {
+		return true
+	}
+	return stdoutIsTerminal()
+}
+
+// colorize wraps s in the ANSI color code when console output is colored
+func colorize(s, code string) string {
+	if !useColor() {
+		return s
+	}
+	return code + s + colorReset
+}
+
+// stripColors removes the color codes from s, for console output that is
+// written to the log instead
+func stripColors(s string) string {
+	return colorCodes.Replace(s)
+}
@@ -0,0 +1,53 @@
+package dns_listener
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+)
+
+func TestColorize(t *testing.T) {
+	defer func(isTerminal func() bool) { stdoutIsTerminal = isTerminal }(stdoutIsTerminal)
+
+	tests := []struct {
+		name       string
+		terminal   bool
+		noColor    string
+		forceColor string
+		want       bool
+	}{
+		{"terminal", true, "", "", true},
+		{"redirected", false, "", "", false},
+		{"NO_COLOR", true, "1", "", false},
+		{"FORCE_COLOR", false, "", "1", true},
+		{"FORCE_COLOR=0", false, "", "0", false},
+		{"NO_COLOR wins", true, "1", "1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdoutIsTerminal = func() bool { return tt.terminal }
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("FORCE_COLOR", tt.forceColor)
+
+			got := colorize("text", colorGreen)
+			if colored := got != "text"; colored != tt.want {
+				t.Errorf("colorize() = %q, want colored %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoColorStats(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	t.Setenv("FORCE_COLOR", "1")
+	d := newTestListener(t, &config.Config{})
+
+	stats := d.formatRuntimeStats()
+	if !strings.Contains(stats, "=== Runtime Statistics ===") {
+		t.Fatalf("stats = %q, want the statistics block", stats)
+	}
+	if strings.Contains(stats, "\033[") {
+		t.Errorf("stats contain escape codes with NO_COLOR set:\n%q", stats)
+	}
+}
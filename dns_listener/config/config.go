@@ -1,33 +1,164 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/rules"
+)
+
+const (
+	envDNSPort             = "DNS_PORT"
+	envWorkerCount         = "WORKER_COUNT"
+	envRateLimit           = "RATE_LIMIT"
+	envRateBurst           = "RATE_BURST"
+	envCacheTTL            = "CACHE_TTL"
+	envCacheCleanup        = "CACHE_CLEANUP"
+	envCacheMinTTL         = "CACHE_MIN_TTL"
+	envCacheMaxTTL         = "CACHE_MAX_TTL"
+	envHealthPort          = "HEALTH_CHECK_PORT"
+	envAdminToken          = "ADMIN_TOKEN"
+	envLogsDir             = "LOGS_DIR"
+	envLogFile             = "LOG_FILE"
+	envDebug               = "DEBUG"
+	envLogMaxSize          = "LOG_MAX_SIZE"
+	envLogMaxBackups       = "LOG_MAX_BACKUPS"
+	envLogMaxAge           = "LOG_MAX_AGE"
+	envLogOutputs          = "LOG_OUTPUTS"
+	envLogFormat           = "LOG_FORMAT"
+	envDisableCompression  = "DISABLE_COMPRESSION"
+	envBlocklistURL        = "BLOCKLIST_URL"
+	envBlocklistFile       = "BLOCKLIST_FILE"
+	envBlocklistSinkhole   = "BLOCKLIST_SINKHOLE"
+	envZoneFile            = "ZONE_FILE"
+	envZoneURL             = "ZONE_URL"
+	envRewriteRules        = "REWRITE_RULES"
+	envHostsFile           = "HOSTS_FILE"
+	envHostsTTL            = "HOSTS_TTL"
+	envStubResponseIP      = "STUB_RESPONSE_IP"
+	envStubResponseIPv6    = "STUB_RESPONSE_IPV6"
+	envStubResponseTTL     = "STUB_RESPONSE_TTL"
+	envSourceRefresh       = "SOURCE_REFRESH_INTERVAL"
+	envQuiet               = "QUIET"
+	envStatsInterval       = "STATS_INTERVAL"
+	envStatsOutput         = "STATS_OUTPUT"
+	envOTLPEndpoint        = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envRateLimitMaxKeys    = "RATE_LIMIT_MAX_KEYS"
+	envRateLimitCIDR       = "RATE_LIMIT_CIDR"
+	envRateLimitResponse   = "RATE_LIMIT_RESPONSE"
+	envRateLimitAllowlist  = "RATE_LIMIT_ALLOWLIST"
+	envRateLimitAlgorithm  = "RATE_LIMIT_ALGORITHM"
+	envRateLimitWindow     = "RATE_LIMIT_WINDOW"
+	envShedThreshold       = "SHED_THRESHOLD"
+	envMaxAnswerTTL        = "MAX_ANSWER_TTL"
+	envCacheEnabled        = "CACHE_ENABLED"
+	envStaleRevalidate     = "STALE_WHILE_REVALIDATE"
+	envMaxUpstreamInflight = "MAX_UPSTREAM_INFLIGHT"
+	envDedupWindow         = "DEDUP_WINDOW"
+	envQnameRedaction      = "QNAME_REDACTION"
+	envAnyResponse         = "ANY_RESPONSE"
+	envECSEnabled          = "ECS_ENABLED"
+	envECSPrefixV4         = "ECS_PREFIX_V4"
+	envECSPrefixV6         = "ECS_PREFIX_V6"
+	envTCPIdleTimeout      = "TCP_IDLE_TIMEOUT"
+	envQueueWait           = "QUEUE_WAIT"
+	envUpstreamDNS         = "UPSTREAM_DNS"
+	envUpstreamTimeout     = "UPSTREAM_TIMEOUT"
+	envUpstreamStrategy    = "UPSTREAM_STRATEGY"
+	envEDNSMaxUDP          = "EDNS_MAX_UDP"
+	envMaxQuestions        = "MAX_QUESTIONS"
+	envMaxQuerySize        = "MAX_QUERY_SIZE"
+	envCacheBackend        = "CACHE_BACKEND"
+	envCacheShards         = "CACHE_SHARDS"
+	envCacheFile           = "CACHE_FILE"
+	envConfigFile          = "CONFIG_FILE"
+	envTLSCertFile         = "TLS_CERT_FILE"
+	envTLSKeyFile          = "TLS_KEY_FILE"
+	envDoTPort             = "DOT_PORT"
+	envDoHPort             = "DOH_PORT"
+	envBindAddress         = "BIND_ADDRESS"
+
+	// envPrefixVar names the variable holding the optional prefix that is
+	// applied to every other variable (e.g. NSCHECKER_ -> NSCHECKER_DEBUG).
+	envPrefixVar = "ENV_PREFIX"
+)
+
+// Query name redaction modes for the access log
+const (
+	RedactNone     = ""
+	RedactHash     = "hash"
+	RedactTruncate = "truncate"
+)
+
+// Cache backends selectable through CACHE_BACKEND
+const (
+	CacheBackendBasic   = "basic"
+	CacheBackendLRU     = "lru"
+	CacheBackendSharded = "sharded"
+)
+
+// shardedWorkerCount is the worker count from which the sharded cache is
+// the default backend, as lock contention on a single map starts to show
+const shardedWorkerCount = 16
+
+// maxTTL is the largest TTL RFC 2181 allows, 2^31 - 1 seconds
+const maxTTL = (1<<31 - 1) * time.Second
+
+// Log outputs selectable through LOG_OUTPUTS
+const (
+	LogOutputFile   = "file"
+	LogOutputStdout = "stdout"
+	LogOutputSyslog = "syslog"
+)
+
+// Access log formats selectable through LOG_FORMAT; empty means text
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Answers to rate limited queries selectable through RATE_LIMIT_RESPONSE;
+// empty means drop
+const (
+	RateLimitDrop    = "drop"
+	RateLimitRefused = "refused"
+)
+
+// Rate limiting algorithms selectable through RATE_LIMIT_ALGORITHM; empty
+// means token
+const (
+	RateLimitToken   = "token"
+	RateLimitSliding = "sliding"
+)
+
+// Orders upstreams are tried in, selectable through UPSTREAM_STRATEGY;
+// empty means failover
+const (
+	UpstreamFailover   = "failover"
+	UpstreamRoundRobin = "roundrobin"
 )
 
+// Handling of QTYPE=ANY queries. AnyResponsePass resolves them like any
+// other type; the other modes avoid amplification per RFC 8482.
 const (
-	envDNSPort       = "DNS_PORT"
-	envWorkerCount   = "WORKER_COUNT"
-	envRateLimit     = "RATE_LIMIT"
-	envRateBurst     = "RATE_BURST"
-	envCacheTTL      = "CACHE_TTL"
-	envCacheCleanup  = "CACHE_CLEANUP"
-	envHealthPort    = "HEALTH_CHECK_PORT"
-	envLogsDir       = "LOGS_DIR"
-	envLogFile       = "LOG_FILE"
-	envDebug         = "DEBUG"
-	envLogMaxSize    = "LOG_MAX_SIZE"
-	envLogMaxBackups = "LOG_MAX_BACKUPS"
-	envLogMaxAge     = "LOG_MAX_AGE"
+	AnyResponsePass   = ""
+	AnyResponseRefuse = "refuse"
+	AnyResponseHINFO  = "hinfo"
 )
 
 // Default values
 const (
 	DefaultDNSPort         = "25353"
 	DefaultHealthPort      = "8088"
+	DefaultDoTPort         = "853"
+	DefaultBindAddress     = "0.0.0.0"
 	DefaultMaxWorkers      = "4"
 	DefaultCacheTTL        = "30m"
 	DefaultCleanupInterval = "1m"
@@ -38,6 +169,24 @@ const (
 	DefaultLogMaxSize      = 10 // MB
 	DefaultLogMaxBackups   = 3  // files
 	DefaultLogMaxAge       = 30 // days
+	DefaultSourceRefresh   = "5m"
+	DefaultECSPrefixV4     = 24
+	DefaultECSPrefixV6     = 56
+	DefaultTCPIdleTimeout  = 10 * time.Second
+	DefaultUpstreamTimeout = 2 * time.Second
+	DefaultHostsTTL        = 5 * time.Minute
+	DefaultEDNSMaxUDP      = 1232 // bytes, the DNS flag day 2020 recommendation
+	DefaultMaxQuestions    = 2
+	DefaultMaxQuerySize    = 4096 // bytes
+	DefaultStatsInterval   = 30 * time.Second
+)
+
+// Destinations of the periodic runtime statistics selectable through
+// STATS_OUTPUT; empty means stdout
+const (
+	StatsOutputStdout = "stdout"
+	StatsOutputLog    = "log"
+	StatsOutputNone   = "none"
 )
 
 type Config struct {
@@ -45,20 +194,106 @@ type Config struct {
 	WorkerCount          int
 	CacheTTL             time.Duration
 	CacheCleanupInterval time.Duration
+	CacheMinTTL          time.Duration // Floor for the answer TTL used as cache lifetime
+	CacheMaxTTL          time.Duration // Ceiling for the answer TTL used as cache lifetime, 0 uses CacheTTL
 	LogsDir              string
 	LogPath              string
 	RateLimit            float64
 	RateBurst            int
 	HealthPort           string
+	AdminToken           string // Bearer token for the admin endpoints on the health port; empty disables them
 	Debug                bool
-	LogMaxSize           int // Maximum size in megabytes before rotation
-	LogMaxBackups        int // Maximum number of old log files to retain
-	LogMaxAge            int // Maximum days to retain old log files
+	LogMaxSize           int           // Maximum size in megabytes before rotation
+	LogMaxBackups        int           // Maximum number of old log files to retain
+	LogMaxAge            int           // Maximum days to retain old log files
+	LogOutputs           []string      // Log sinks: "file", "stdout", "syslog"; empty means file only
+	LogFormat            string        // Access log format: "text" or "json"; empty means text
+	DisableCompression   bool          // Write fully expanded names in responses
+	BlocklistURL         string        // HTTP(S) URL of a blocklist
+	BlocklistFile        string        // Path of a blocklist, instead of BlocklistURL
+	BlocklistSinkhole    string        // Address blocked names resolve to; empty answers NXDOMAIN
+	ZoneFile             string        // Path of a zone file to serve
+	ZoneURL              string        // HTTP(S) URL of a zone file to serve
+	RewriteRules         string        // Comma separated pattern=address rules answered before the cache
+	HostsFile            string        // Path of a hosts file whose A and AAAA records are answered before the cache
+	HostsTTL             time.Duration // TTL of answers from the hosts file, 0 uses DefaultHostsTTL
+	StubResponseIP       string        // IPv4 address of the synthetic A answer given without an upstream; empty uses 127.0.0.1
+	StubResponseIPv6     string        // IPv6 address of the synthetic AAAA answer; empty uses ::1
+	StubResponseTTL      time.Duration // TTL of the synthetic answers, 0 uses 5m
+	SourceRefresh        time.Duration // Refresh interval for blocklist and zone sources, 0 disables
+	Quiet                bool          // Suppress the startup banner and configuration box
+	StatsInterval        time.Duration // Interval of the periodic runtime statistics, 0 disables
+	StatsOutput          string        // Periodic runtime statistics go to "stdout", the "log" or "none"; empty means stdout
+	OTLPEndpoint         string        // Base URL of an OTLP/HTTP collector request spans are exported to; empty disables
+	RateLimitMaxKeys     int           // Clients tracked by the rate limiter, 0 uses the limiter default
+	RateLimitCIDR        string        // Prefix lengths clients are rate limited by, e.g. "24,64"; empty limits each address
+	RateLimitResponse    string        // Rate limited queries: "drop" or "refused"; empty means drop
+	RateLimitAllowlist   string        // Comma separated CIDRs of sources that are never rate limited
+	RateLimitAlgorithm   string        // "token" bucket or "sliding" window; empty means token
+	RateLimitWindow      time.Duration // Window the sliding algorithm counts requests over, 0 uses 1s
+	ShedThreshold        int           // Request channel utilization (percent) above which cache misses are refused, 0 disables
+	MaxAnswerTTL         time.Duration // Ceiling for TTLs written into responses, 0 disables
+	CacheDisabled        bool          // Answer every query without the response cache
+	StaleWhileRevalidate time.Duration // Serve expired entries this long while refreshing them, 0 disables
+	MaxUpstreamInflight  int           // Cap on concurrent upstream queries, 0 disables
+	DedupWindow          time.Duration // Retransmits within this window share the first query's answer, 0 disables
+	QnameRedaction       string        // Access log query name redaction: "", "hash" or "truncate"
+	AnyResponse          string        // ANY query handling: "", "refuse" or "hinfo"
+	ECSEnabled           bool          // Attach an EDNS client subnet to forwarded queries
+	ECSPrefixV4          int           // Client subnet prefix length for IPv4 sources
+	ECSPrefixV6          int           // Client subnet prefix length for IPv6 sources
+	TCPIdleTimeout       time.Duration // Time a TCP client has to send each query, 0 disables
+	QueueWait            time.Duration // Time a request waits for room in the full worker queue before it is dropped, 0 drops at once
+	UpstreamDNS          string        // Comma separated host:port resolvers that cache misses are forwarded to
+	UpstreamStrategy     string        // Order upstreams are tried in: "failover" or "roundrobin"; empty means failover
+	UpstreamTimeout      time.Duration // Time to wait for the upstream resolver's answer
+	EDNSMaxUDP           int           // Largest UDP response sent to EDNS clients, 0 uses DefaultEDNSMaxUDP
+	MaxQuestions         int           // Queries with a larger QDCOUNT are dropped, 0 uses DefaultMaxQuestions
+	MaxQuerySize         int           // Queries of more bytes are dropped, 0 uses DefaultMaxQuerySize
+	CacheBackend         string        // Cache implementation: "basic", "lru" or "sharded"; empty uses basic
+	CacheShards          int           // Shard count of the sharded cache, 0 uses the cache default
+	CacheFile            string        // Path the cache is saved to on shutdown and loaded from on startup
+	TLSCertFile          string        // PEM certificate for DNS over TLS; with TLSKeyFile enables the listener
+	TLSKeyFile           string        // PEM private key for DNS over TLS
+	DoTPort              string        // DNS over TLS port, empty uses DefaultDoTPort
+	DoHPort              string        // DNS over HTTPS port, empty disables the endpoint
+	BindAddress          string        // IP the DNS listeners bind to; empty or "::" binds all IPv4 and IPv6 addresses
 }
 
 // Add a flag for testing mode
 var isTesting = false
 
+// envPrefix overrides ENV_PREFIX when set through SetEnvPrefix
+var envPrefix string
+
+// SetEnvPrefix sets the prefix tried before the bare variable name when
+// reading the environment. An empty prefix falls back to ENV_PREFIX.
+func SetEnvPrefix(prefix string) {
+	envPrefix = prefix
+}
+
+// EnvPrefix returns the active environment variable prefix
+func EnvPrefix() string {
+	if envPrefix != "" {
+		return envPrefix
+	}
+	return os.Getenv(envPrefixVar)
+}
+
+// Getenv reads key from the environment, or from the file last read by
+// LoadFromFile, which takes precedence. When a prefix is configured the
+// prefixed variable wins; the bare name is kept as a fallback for
+// compatibility with existing deployments.
+func Getenv(key string) string {
+	if prefix := EnvPrefix(); prefix != "" {
+		if value, ok := lookupEnv(prefix + key); ok {
+			return value
+		}
+	}
+	value, _ := lookupEnv(key)
+	return value
+}
+
 // SetTestMode enables or disables testing mode (disables logging)
 func SetTestMode(enabled bool) {
 	isTesting = enabled
@@ -89,6 +324,17 @@ func DefaultConfig() *Config {
 		LogMaxBackups:        DefaultLogMaxBackups,
 		LogMaxAge:            DefaultLogMaxAge,
 		Debug:                false, // Add default Debug value
+		SourceRefresh:        5 * time.Minute,
+		StatsInterval:        DefaultStatsInterval,
+		ECSPrefixV4:          DefaultECSPrefixV4,
+		ECSPrefixV6:          DefaultECSPrefixV6,
+		TCPIdleTimeout:       DefaultTCPIdleTimeout,
+		UpstreamTimeout:      DefaultUpstreamTimeout,
+		EDNSMaxUDP:           DefaultEDNSMaxUDP,
+		MaxQuestions:         DefaultMaxQuestions,
+		MaxQuerySize:         DefaultMaxQuerySize,
+		DoTPort:              DefaultDoTPort,
+		BindAddress:          DefaultBindAddress,
 	}
 
 	// Ensure log directory exists
@@ -106,28 +352,85 @@ func LoadFromEnv() *Config {
 	cfg.WorkerCount = getEnvAsInt(envWorkerCount, cfg.WorkerCount)
 	cfg.RateLimit = getEnvAsFloat(envRateLimit, cfg.RateLimit)
 	cfg.RateBurst = getEnvAsInt(envRateBurst, cfg.RateBurst)
+	cfg.RateLimitMaxKeys = getEnvAsInt(envRateLimitMaxKeys, cfg.RateLimitMaxKeys)
+	cfg.RateLimitCIDR = getEnvOrDefault(envRateLimitCIDR, cfg.RateLimitCIDR)
+	cfg.RateLimitResponse = getEnvOrDefault(envRateLimitResponse, cfg.RateLimitResponse)
+	cfg.RateLimitAllowlist = getEnvOrDefault(envRateLimitAllowlist, cfg.RateLimitAllowlist)
+	cfg.RateLimitAlgorithm = getEnvOrDefault(envRateLimitAlgorithm, cfg.RateLimitAlgorithm)
+	if window := Getenv(envRateLimitWindow); window != "" {
+		if duration, err := time.ParseDuration(window); err == nil {
+			cfg.RateLimitWindow = duration
+		}
+	}
+	cfg.ShedThreshold = getEnvAsInt(envShedThreshold, cfg.ShedThreshold)
+	cfg.MaxUpstreamInflight = getEnvAsInt(envMaxUpstreamInflight, cfg.MaxUpstreamInflight)
+
+	cfg.CacheDisabled = !getEnvAsBool(envCacheEnabled, !cfg.CacheDisabled)
 
-	if ttl := os.Getenv(envCacheTTL); ttl != "" {
+	if ttl := Getenv(envCacheTTL); ttl != "" {
 		if duration, err := time.ParseDuration(ttl); err == nil {
 			cfg.CacheTTL = duration
 		}
 	}
 
-	if cleanup := os.Getenv(envCacheCleanup); cleanup != "" {
+	if cleanup := Getenv(envCacheCleanup); cleanup != "" {
 		if duration, err := time.ParseDuration(cleanup); err == nil {
 			cfg.CacheCleanupInterval = duration
 		}
 	}
 
+	if minTTL := Getenv(envCacheMinTTL); minTTL != "" {
+		if duration, err := time.ParseDuration(minTTL); err == nil {
+			cfg.CacheMinTTL = duration
+		}
+	}
+
+	if maxTTL := Getenv(envCacheMaxTTL); maxTTL != "" {
+		if duration, err := time.ParseDuration(maxTTL); err == nil {
+			cfg.CacheMaxTTL = duration
+		}
+	}
+
+	if window := Getenv(envStaleRevalidate); window != "" {
+		if duration, err := time.ParseDuration(window); err == nil {
+			cfg.StaleWhileRevalidate = duration
+		}
+	}
+
+	// Without an explicit backend, busy servers get the sharded cache
+	// unless they serve stale entries, which only the basic cache keeps
+	cfg.CacheBackend = getEnvOrDefault(envCacheBackend, cfg.CacheBackend)
+	if cfg.CacheBackend == "" {
+		cfg.CacheBackend = CacheBackendBasic
+		if cfg.WorkerCount >= shardedWorkerCount && cfg.StaleWhileRevalidate == 0 {
+			cfg.CacheBackend = CacheBackendSharded
+		}
+	}
+	cfg.CacheShards = getEnvAsInt(envCacheShards, cfg.CacheShards)
+	cfg.CacheFile = getEnvOrDefault(envCacheFile, cfg.CacheFile)
+
+	if window := Getenv(envDedupWindow); window != "" {
+		if duration, err := time.ParseDuration(window); err == nil {
+			cfg.DedupWindow = duration
+		}
+	}
+
+	if maxTTL := Getenv(envMaxAnswerTTL); maxTTL != "" {
+		if duration, err := time.ParseDuration(maxTTL); err == nil {
+			cfg.MaxAnswerTTL = duration
+		}
+	}
+
 	cfg.HealthPort = getEnvOrDefault(envHealthPort, cfg.HealthPort)
+	cfg.AdminToken = Getenv(envAdminToken)
 
 	// Handle log configuration
-	if dir := os.Getenv(envLogsDir); dir != "" {
+	if dir := Getenv(envLogsDir); dir != "" {
 		cfg.LogsDir = dir
 		cfg.LogPath = filepath.Join(dir, filepath.Base(cfg.LogPath))
 	}
 
-	if file := os.Getenv(envLogFile); file != "" {
+	if file := Getenv(envLogFile); file != "" {
 		cfg.LogPath = filepath.Join(cfg.LogsDir, file)
 	}
 
@@ -135,24 +438,158 @@ func LoadFromEnv() *Config {
 	cfg.LogMaxSize = getEnvAsInt(envLogMaxSize, cfg.LogMaxSize)
 	cfg.LogMaxBackups = getEnvAsInt(envLogMaxBackups, cfg.LogMaxBackups)
 	cfg.LogMaxAge = getEnvAsInt(envLogMaxAge, cfg.LogMaxAge)
+	if outputs := Getenv(envLogOutputs); outputs != "" {
+		cfg.LogOutputs = splitList(outputs)
+	}
+	cfg.LogFormat = getEnvOrDefault(envLogFormat, cfg.LogFormat)
 
 	// Add Debug field loading
 	cfg.Debug = getEnvAsBool(envDebug, cfg.Debug)
+	cfg.Quiet = getEnvAsBool(envQuiet, cfg.Quiet)
+	if interval := Getenv(envStatsInterval); interval != "" {
+		if duration, err := time.ParseDuration(interval); err == nil {
+			cfg.StatsInterval = duration
+		}
+	}
+	cfg.StatsOutput = getEnvOrDefault(envStatsOutput, cfg.StatsOutput)
+	cfg.OTLPEndpoint = getEnvOrDefault(envOTLPEndpoint, cfg.OTLPEndpoint)
+
+	cfg.QnameRedaction = getEnvOrDefault(envQnameRedaction, cfg.QnameRedaction)
+	cfg.AnyResponse = getEnvOrDefault(envAnyResponse, cfg.AnyResponse)
+
+	// EDNS client subnet
+	cfg.ECSEnabled = getEnvAsBool(envECSEnabled, cfg.ECSEnabled)
+	cfg.ECSPrefixV4 = getEnvAsInt(envECSPrefixV4, cfg.ECSPrefixV4)
+	cfg.ECSPrefixV6 = getEnvAsInt(envECSPrefixV6, cfg.ECSPrefixV6)
+	cfg.EDNSMaxUDP = getEnvAsInt(envEDNSMaxUDP, cfg.EDNSMaxUDP)
+	cfg.MaxQuestions = getEnvAsInt(envMaxQuestions, cfg.MaxQuestions)
+	cfg.MaxQuerySize = getEnvAsInt(envMaxQuerySize, cfg.MaxQuerySize)
+
+	cfg.DisableCompression = getEnvAsBool(envDisableCompression, cfg.DisableCompression)
+	if timeout := Getenv(envTCPIdleTimeout); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			cfg.TCPIdleTimeout = duration
+		}
+	}
+	if wait := Getenv(envQueueWait); wait != "" {
+		if duration, err := time.ParseDuration(wait); err == nil {
+			cfg.QueueWait = duration
+		}
+	}
+
+	// Upstream resolver
+	cfg.UpstreamDNS = getEnvOrDefault(envUpstreamDNS, cfg.UpstreamDNS)
+	cfg.UpstreamStrategy = getEnvOrDefault(envUpstreamStrategy, cfg.UpstreamStrategy)
+	if timeout := Getenv(envUpstreamTimeout); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			cfg.UpstreamTimeout = duration
+		}
+	}
+
+	// DNS over TLS
+	cfg.TLSCertFile = getEnvOrDefault(envTLSCertFile, cfg.TLSCertFile)
+	cfg.TLSKeyFile = getEnvOrDefault(envTLSKeyFile, cfg.TLSKeyFile)
+	cfg.DoTPort = getEnvOrDefault(envDoTPort, cfg.DoTPort)
+	cfg.DoHPort = getEnvOrDefault(envDoHPort, cfg.DoHPort)
+	cfg.BindAddress = getEnvOrDefault(envBindAddress, cfg.BindAddress)
+
+	// Blocklist and zone sources
+	cfg.BlocklistURL = getEnvOrDefault(envBlocklistURL, cfg.BlocklistURL)
+	cfg.BlocklistFile = getEnvOrDefault(envBlocklistFile, cfg.BlocklistFile)
+	cfg.BlocklistSinkhole = getEnvOrDefault(envBlocklistSinkhole, cfg.BlocklistSinkhole)
+	cfg.ZoneFile = getEnvOrDefault(envZoneFile, cfg.ZoneFile)
+	cfg.ZoneURL = getEnvOrDefault(envZoneURL, cfg.ZoneURL)
+	cfg.RewriteRules = getEnvOrDefault(envRewriteRules, cfg.RewriteRules)
+	cfg.HostsFile = getEnvOrDefault(envHostsFile, cfg.HostsFile)
+	if ttl := Getenv(envHostsTTL); ttl != "" {
+		if duration, err := time.ParseDuration(ttl); err == nil {
+			cfg.HostsTTL = duration
+		}
+	}
+	cfg.StubResponseIP = getEnvOrDefault(envStubResponseIP, cfg.StubResponseIP)
+	cfg.StubResponseIPv6 = getEnvOrDefault(envStubResponseIPv6, cfg.StubResponseIPv6)
+	if ttl := Getenv(envStubResponseTTL); ttl != "" {
+		if duration, err := time.ParseDuration(ttl); err == nil {
+			cfg.StubResponseTTL = duration
+		}
+	}
+	if refresh := Getenv(envSourceRefresh); refresh != "" {
+		if duration, err := time.ParseDuration(refresh); err == nil {
+			cfg.SourceRefresh = duration
+		}
+	}
 
 	// Remove any logging code here
 	return cfg
 }
 
+// ParseRateLimitCIDR parses the IPv4 and IPv6 prefix lengths of
+// RATE_LIMIT_CIDR, e.g. "24,64" or "/24,/64". A single value only groups
+// IPv4 clients. Empty keeps one bucket per address (32 and 128).
+func ParseRateLimitCIDR(value string) (prefix4, prefix6 int, err error) {
+	prefix4, prefix6 = 32, 128
+	parts := splitList(value)
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("must be an IPv4 and an optional IPv6 prefix length, e.g. 24,64")
+	}
+	for i, part := range parts {
+		bits, err := strconv.Atoi(strings.TrimPrefix(part, "/"))
+		if i == 0 {
+			if err != nil || bits < 1 || bits > 32 {
+				return 0, 0, fmt.Errorf("IPv4 prefix length must be between 1 and 32, got %q", part)
+			}
+			prefix4 = bits
+		} else {
+			if err != nil || bits < 1 || bits > 128 {
+				return 0, 0, fmt.Errorf("IPv6 prefix length must be between 1 and 128, got %q", part)
+			}
+			prefix6 = bits
+		}
+	}
+	return prefix4, prefix6, nil
+}
+
+// ParseAllowlist parses the comma separated CIDRs of RATE_LIMIT_ALLOWLIST,
+// e.g. "10.0.0.0/8,2001:db8::/32"
+func ParseAllowlist(value string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range splitList(value) {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// UpstreamAddrs splits the comma separated resolvers of UPSTREAM_DNS
+func UpstreamAddrs(value string) []string {
+	return splitList(value)
+}
+
 // Helper functions
+
+// splitList splits a comma separated value, dropping blank items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
 func getEnvAsInt(key string, defaultValue int) int {
-	strValue := os.Getenv(key)
+	strValue := Getenv(key)
 	if strValue == "" {
 		return defaultValue
 	}
@@ -163,7 +600,7 @@ func getEnvAsInt(key string, defaultValue int) int {
 }
 
 func getEnvAsFloat(key string, defaultValue float64) float64 {
-	strValue := os.Getenv(key)
+	strValue := Getenv(key)
 	if strValue == "" {
 		return defaultValue
 	}
@@ -174,7 +611,7 @@ func getEnvAsFloat(key string, defaultValue float64) float64 {
 }
 
 func getEnvAsBool(key string, defaultValue bool) bool {
-	strValue := os.Getenv(key)
+	strValue := Getenv(key)
 	if strValue == "" {
 		return defaultValue
 	}
@@ -185,6 +622,12 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return value
 }
 
+// isHTTPURL reports whether raw is an absolute http or https URL
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 // Add new validation functions
 func checkPortConflict(port string) error {
 	p, err := strconv.Atoi(port)
@@ -275,6 +718,44 @@ func ValidateConfig(config *Config) error {
 		}
 	}
 
+	// DNS over TLS needs a certificate and key that load, and a port of
+	// its own
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+			errors = append(errors, NewConfigError("TLSCertFile", config.TLSCertFile,
+				"TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+		} else if _, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			errors = append(errors, NewConfigError("TLSCertFile", config.TLSCertFile, err.Error()))
+		}
+
+		dotPort := config.DoTPort
+		if dotPort == "" {
+			dotPort = DefaultDoTPort
+		}
+		if dotPort == config.Port || dotPort == config.HealthPort {
+			errors = append(errors, NewConfigError("DoTPort", dotPort,
+				"DNS over TLS port cannot be the same as the DNS or health check port"))
+		} else if err := portChecker.IsPortAvailable(dotPort); err != nil {
+			errors = append(errors, NewConfigError("DoTPort", dotPort, err.Error()))
+		}
+	}
+
+	// DNS over HTTPS gets a port of its own
+	if config.DoHPort != "" {
+		if config.DoHPort == config.Port || config.DoHPort == config.HealthPort ||
+			(config.TLSCertFile != "" && config.DoHPort == config.DoTPort) {
+			errors = append(errors, NewConfigError("DoHPort", config.DoHPort,
+				"DNS over HTTPS port cannot be the same as the DNS, health check or DNS over TLS port"))
+		} else if err := portChecker.IsPortAvailable(config.DoHPort); err != nil {
+			errors = append(errors, NewConfigError("DoHPort", config.DoHPort, err.Error()))
+		}
+	}
+
+	if config.BindAddress != "" && net.ParseIP(config.BindAddress) == nil {
+		errors = append(errors, NewConfigError("BindAddress", config.BindAddress,
+			"must be an IP address, or empty to listen on all addresses"))
+	}
+
 	// Worker count validation
 	if config.WorkerCount < 1 || config.WorkerCount > 128 {
 		errors = append(errors, NewConfigError("WorkerCount",
@@ -294,18 +775,205 @@ func ValidateConfig(config *Config) error {
 			fmt.Sprintf("cannot be greater than rate limit (%.0f)", config.RateLimit)))
 	}
 
-	// Cache settings validation
-	if config.CacheTTL <= 0 {
-		errors = append(errors, ErrInvalidTTL(config.CacheTTL.String()))
+	if config.RateLimitMaxKeys < 0 {
+		errors = append(errors, NewConfigError("RateLimitMaxKeys", config.RateLimitMaxKeys, "must not be negative"))
+	}
+	if _, _, err := ParseRateLimitCIDR(config.RateLimitCIDR); err != nil {
+		errors = append(errors, NewConfigError("RateLimitCIDR", config.RateLimitCIDR, err.Error()))
+	}
+	if _, err := ParseAllowlist(config.RateLimitAllowlist); err != nil {
+		errors = append(errors, NewConfigError("RateLimitAllowlist", config.RateLimitAllowlist, err.Error()))
+	}
+	switch config.RateLimitResponse {
+	case "", RateLimitDrop, RateLimitRefused:
+	default:
+		errors = append(errors, NewConfigError("RateLimitResponse", config.RateLimitResponse, "must be drop or refused"))
+	}
+	switch config.RateLimitAlgorithm {
+	case "", RateLimitToken, RateLimitSliding:
+	default:
+		errors = append(errors, NewConfigError("RateLimitAlgorithm", config.RateLimitAlgorithm, "must be token or sliding"))
+	}
+	if config.RateLimitWindow < 0 {
+		errors = append(errors, NewConfigError("RateLimitWindow", config.RateLimitWindow, "must not be negative"))
+	}
+
+	if config.ShedThreshold < 0 || config.ShedThreshold > 100 {
+		errors = append(errors, NewConfigError("ShedThreshold", config.ShedThreshold, "must be between 0 and 100"))
+	}
+
+	if config.MaxUpstreamInflight < 0 {
+		errors = append(errors, NewConfigError("MaxUpstreamInflight", config.MaxUpstreamInflight, "must not be negative"))
+	}
+
+	// Cache settings validation; TTL and cleanup are unused without a cache
+	if config.CacheDisabled {
+		if config.CacheTTL < 0 {
+			errors = append(errors, ErrInvalidTTL(config.CacheTTL.String()))
+		}
+	} else {
+		if config.CacheTTL <= 0 {
+			errors = append(errors, ErrInvalidTTL(config.CacheTTL.String()))
+		}
+		if config.CacheCleanupInterval > config.CacheTTL {
+			errors = append(errors, ErrInvalidCleanup(config.CacheCleanupInterval.String()))
+		}
+	}
+
+	switch config.CacheBackend {
+	case "", CacheBackendBasic:
+	case CacheBackendLRU, CacheBackendSharded:
+		if config.StaleWhileRevalidate > 0 {
+			errors = append(errors, NewConfigError("CacheBackend", config.CacheBackend, "must be basic to serve stale entries"))
+		}
+	default:
+		errors = append(errors, NewConfigError("CacheBackend", config.CacheBackend, "must be basic, lru or sharded"))
+	}
+	if config.CacheFile != "" && config.CacheBackend == CacheBackendLRU {
+		errors = append(errors, NewConfigError("CacheFile", config.CacheFile, "cannot be used with the lru cache backend"))
+	}
+	if config.CacheShards < 0 {
+		errors = append(errors, NewConfigError("CacheShards", config.CacheShards, "must not be negative"))
+	}
+
+	if config.StaleWhileRevalidate < 0 {
+		errors = append(errors, NewConfigError("StaleWhileRevalidate", config.StaleWhileRevalidate, "must not be negative"))
 	}
-	if config.CacheCleanupInterval > config.CacheTTL {
-		errors = append(errors, ErrInvalidCleanup(config.CacheCleanupInterval.String()))
+
+	if config.CacheMinTTL < 0 {
+		errors = append(errors, NewConfigError("CacheMinTTL", config.CacheMinTTL, "must not be negative"))
+	}
+	if config.CacheMaxTTL < 0 {
+		errors = append(errors, NewConfigError("CacheMaxTTL", config.CacheMaxTTL, "must not be negative"))
+	} else if config.CacheMaxTTL > 0 && config.CacheMinTTL > config.CacheMaxTTL {
+		errors = append(errors, NewConfigError("CacheMinTTL", config.CacheMinTTL, "must not exceed CacheMaxTTL"))
+	}
+
+	if config.TCPIdleTimeout < 0 {
+		errors = append(errors, NewConfigError("TCPIdleTimeout", config.TCPIdleTimeout, "must not be negative"))
+	}
+	if config.QueueWait < 0 {
+		errors = append(errors, NewConfigError("QueueWait", config.QueueWait, "must not be negative"))
+	}
+
+	if config.UpstreamDNS != "" {
+		for _, addr := range UpstreamAddrs(config.UpstreamDNS) {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				errors = append(errors, NewConfigError("UpstreamDNS", addr, "must be host:port"))
+			}
+		}
+		if config.UpstreamTimeout <= 0 {
+			errors = append(errors, NewConfigError("UpstreamTimeout", config.UpstreamTimeout, "must be positive"))
+		}
+	}
+
+	switch config.UpstreamStrategy {
+	case "", UpstreamFailover, UpstreamRoundRobin:
+	default:
+		errors = append(errors, NewConfigError("UpstreamStrategy", config.UpstreamStrategy, "must be failover or roundrobin"))
+	}
+
+	if config.DedupWindow < 0 {
+		errors = append(errors, NewConfigError("DedupWindow", config.DedupWindow, "must not be negative"))
+	}
+
+	if config.MaxAnswerTTL < 0 {
+		errors = append(errors, NewConfigError("MaxAnswerTTL", config.MaxAnswerTTL, "must be positive"))
+	}
+
+	switch config.QnameRedaction {
+	case RedactNone, RedactHash, RedactTruncate:
+	default:
+		errors = append(errors, NewConfigError("QnameRedaction", config.QnameRedaction, "must be hash or truncate"))
+	}
+
+	switch config.AnyResponse {
+	case AnyResponsePass, AnyResponseRefuse, AnyResponseHINFO:
+	default:
+		errors = append(errors, NewConfigError("AnyResponse", config.AnyResponse, "must be refuse or hinfo"))
+	}
+
+	if config.ECSPrefixV4 < 0 || config.ECSPrefixV4 > 32 {
+		errors = append(errors, NewConfigError("ECSPrefixV4", config.ECSPrefixV4, "must be between 0 and 32"))
+	}
+	if config.ECSPrefixV6 < 0 || config.ECSPrefixV6 > 128 {
+		errors = append(errors, NewConfigError("ECSPrefixV6", config.ECSPrefixV6, "must be between 0 and 128"))
+	}
+
+	if config.EDNSMaxUDP != 0 && (config.EDNSMaxUDP < 512 || config.EDNSMaxUDP > 65535) {
+		errors = append(errors, NewConfigError("EDNSMaxUDP", config.EDNSMaxUDP, "must be between 512 and 65535"))
+	}
+	if config.MaxQuestions < 0 || config.MaxQuestions > 65535 {
+		errors = append(errors, NewConfigError("MaxQuestions", config.MaxQuestions, "must be between 1 and 65535"))
+	}
+	if config.MaxQuerySize != 0 && (config.MaxQuerySize < 12 || config.MaxQuerySize > 65535) {
+		errors = append(errors, NewConfigError("MaxQuerySize", config.MaxQuerySize, "must be between 12 and 65535"))
 	}
 
 	// Log settings validation
 	if config.LogMaxSize < 1 || config.LogMaxSize > 1024 {
 		errors = append(errors, ErrInvalidLogSize(config.LogMaxSize))
 	}
+	for _, output := range config.LogOutputs {
+		switch output {
+		case LogOutputFile, LogOutputStdout, LogOutputSyslog:
+		default:
+			errors = append(errors, NewConfigError("LogOutputs", output, "must be file, stdout or syslog"))
+		}
+	}
+	switch config.LogFormat {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		errors = append(errors, NewConfigError("LogFormat", config.LogFormat, "must be text or json"))
+	}
+
+	// Blocklist and zone sources
+	if config.BlocklistURL != "" && !isHTTPURL(config.BlocklistURL) {
+		errors = append(errors, NewConfigError("BlocklistURL", config.BlocklistURL, "must be an http or https URL"))
+	}
+	if config.BlocklistFile != "" && config.BlocklistURL != "" {
+		errors = append(errors, NewConfigError("BlocklistURL", config.BlocklistURL, "cannot be combined with BlocklistFile"))
+	}
+	if config.BlocklistSinkhole != "" && net.ParseIP(config.BlocklistSinkhole) == nil {
+		errors = append(errors, NewConfigError("BlocklistSinkhole", config.BlocklistSinkhole, "must be an IP address"))
+	}
+	if config.ZoneURL != "" && !isHTTPURL(config.ZoneURL) {
+		errors = append(errors, NewConfigError("ZoneURL", config.ZoneURL, "must be an http or https URL"))
+	}
+	if config.ZoneFile != "" && config.ZoneURL != "" {
+		errors = append(errors, NewConfigError("ZoneURL", config.ZoneURL, "cannot be combined with ZoneFile"))
+	}
+	if config.SourceRefresh < 0 {
+		errors = append(errors, NewConfigError("SourceRefresh", config.SourceRefresh, "must not be negative"))
+	}
+	if config.StatsInterval < 0 {
+		errors = append(errors, NewConfigError("StatsInterval", config.StatsInterval, "must not be negative"))
+	}
+	switch config.StatsOutput {
+	case "", StatsOutputStdout, StatsOutputLog, StatsOutputNone:
+	default:
+		errors = append(errors, NewConfigError("StatsOutput", config.StatsOutput, "must be stdout, log or none"))
+	}
+	if config.OTLPEndpoint != "" && !isHTTPURL(config.OTLPEndpoint) {
+		errors = append(errors, NewConfigError("OTLPEndpoint", config.OTLPEndpoint, "must be an http or https URL"))
+	}
+	if _, err := rules.Parse(config.RewriteRules); err != nil {
+		errors = append(errors, NewConfigError("RewriteRules", config.RewriteRules, err.Error()))
+	}
+	if config.HostsTTL < 0 || config.HostsTTL > maxTTL {
+		errors = append(errors, NewConfigError("HostsTTL", config.HostsTTL,
+			fmt.Sprintf("must be between 0 and %v", maxTTL)))
+	}
+	if ip := net.ParseIP(config.StubResponseIP); config.StubResponseIP != "" && (ip == nil || ip.To4() == nil) {
+		errors = append(errors, NewConfigError("StubResponseIP", config.StubResponseIP, "must be an IPv4 address"))
+	}
+	if ip := net.ParseIP(config.StubResponseIPv6); config.StubResponseIPv6 != "" && (ip == nil || ip.To4() != nil) {
+		errors = append(errors, NewConfigError("StubResponseIPv6", config.StubResponseIPv6, "must be an IPv6 address"))
+	}
+	if config.StubResponseTTL < 0 || config.StubResponseTTL > maxTTL {
+		errors = append(errors, NewConfigError("StubResponseTTL", config.StubResponseTTL,
+			fmt.Sprintf("must be between 0 and %v", maxTTL)))
+	}
 
 	// Remove logging and just return the error if any
 	if len(errors) > 0 {
@@ -13,7 +13,7 @@ for all settings. It supports configuration for:
 
 Example usage:
 
-	cfg := config.LoadFromEnv()
+	cfg := config.Load()
 	if err := config.ValidateConfig(cfg); err != nil {
 	    log.Fatalf("Invalid configuration: %v", err)
 	}
@@ -21,17 +21,76 @@ Example usage:
 Environment Variables:
 
 	DNS_PORT          - DNS server port (default: 25353)
-	WORKER_COUNT      - Number of workers (default: 4)
+	WORKER_COUNT      - Number of workers answering queries concurrently; more wait in a queue of 20 per worker (default: 4)
 	RATE_LIMIT        - Rate limit per second (default: 100000)
 	RATE_BURST        - Rate limit burst (default: 1000)
-	CACHE_TTL         - Cache time-to-live (default: 30m)
+	RATE_LIMIT_MAX_KEYS - Clients tracked by the rate limiter before evicting the least recent (default: 65536)
+	RATE_LIMIT_CIDR   - IPv4 and IPv6 prefix lengths clients share a bucket by, e.g. 24,64 (default: none, per address)
+	RATE_LIMIT_RESPONSE - Answer to rate limited queries: drop or refused (default: drop)
+	RATE_LIMIT_ALLOWLIST - Comma separated CIDRs that are never rate limited, e.g. 10.0.0.0/8 (default: none)
+	RATE_LIMIT_ALGORITHM - token bucket, allowing RATE_BURST, or sliding window with a strict cap (default: token)
+	RATE_LIMIT_WINDOW - Window the sliding algorithm allows RATE_LIMIT per second over (default: 1s)
+	SHED_THRESHOLD    - Channel utilization in percent above which cache misses are refused (default: 0, disabled)
+	CACHE_TTL         - Cache time-to-live for responses without answers (default: 30m)
 	CACHE_CLEANUP     - Cache cleanup interval (default: 1m)
+	CACHE_MIN_TTL     - Shortest time an answer is cached, raising lower record TTLs (default: 0)
+	CACHE_MAX_TTL     - Longest time an answer is cached, lowering higher record TTLs (default: CACHE_TTL)
+	STALE_WHILE_REVALIDATE - Serve expired entries this long while refreshing them (default: 0, disabled)
+	CACHE_ENABLED     - Cache responses; false answers every query statelessly (default: true)
+	CACHE_BACKEND     - Cache implementation: basic, lru or sharded (default: sharded from 16 workers without STALE_WHILE_REVALIDATE, else basic)
+	CACHE_SHARDS      - Shard count of the sharded cache, rounded up to a power of two (default: 32)
+	CACHE_FILE        - File the cache is saved to on shutdown and restored from on startup (default: none)
+	MAX_UPSTREAM_INFLIGHT - Cap on concurrent upstream queries; excess misses get SERVFAIL (default: 0, unlimited)
+	DEDUP_WINDOW      - Retransmits within this window share one resolution, e.g. 2s (default: 0, disabled)
+	MAX_ANSWER_TTL    - Ceiling for TTLs in responses, e.g. 1h (default: none)
 	HEALTH_CHECK_PORT - Health check port (default: 8088)
+	ADMIN_TOKEN       - Bearer token enabling the admin endpoints, e.g. POST /cache/flush, on the health port (default: none, disabled)
 	LOGS_DIR         - Log directory (default: ./logs)
 	LOG_FILE         - Log file name (default: dns_listener.log)
 	LOG_MAX_SIZE     - Maximum log file size in MB (default: 10)
-	LOG_MAX_BACKups  - Maximum number of old log files (default: 3)
+	LOG_MAX_BACKUPS  - Maximum number of old log files (default: 3)
 	LOG_MAX_AGE      - Maximum age of old log files in days (default: 30)
+	LOG_OUTPUTS      - Comma separated log sinks: file, stdout, syslog (default: file)
+	LOG_FORMAT       - Access log format: text or json, one object per line (default: text)
 	DEBUG            - Enable debug mode (default: false)
+	QNAME_REDACTION  - Hide query names in the access log: hash or truncate (default: none)
+	ANY_RESPONSE     - Answer ANY queries minimally: refuse or hinfo (default: resolve them)
+	QUIET            - Suppress the startup banner and configuration box (default: false)
+	STATS_INTERVAL   - Interval of the periodic runtime statistics, 0 disables (default: 30s)
+	STATS_OUTPUT     - Where the periodic runtime statistics go: stdout, log or none (default: stdout)
+	OTEL_EXPORTER_OTLP_ENDPOINT - OTLP/HTTP collector base URL request spans are exported to (default: none)
+	DISABLE_COMPRESSION - Write fully expanded names in responses (default: false)
+	TCP_IDLE_TIMEOUT - Time a TCP client has to send each query, 0 disables (default: 10s)
+	QUEUE_WAIT       - Time a request waits for room in the full worker queue before it is dropped (default: 0, drop at once)
+	BLOCKLIST_URL    - HTTP(S) URL of a blocklist answered with NXDOMAIN (default: none)
+	BLOCKLIST_FILE   - Blocklist file, instead of BLOCKLIST_URL (default: none)
+	BLOCKLIST_SINKHOLE - Address blocked names resolve to instead of NXDOMAIN (default: none)
+	ZONE_FILE        - Zone file to answer from (default: none)
+	ZONE_URL         - HTTP(S) URL of a zone file, instead of ZONE_FILE (default: none)
+	REWRITE_RULES    - Comma separated pattern=address answers, e.g. *.lan=10.0.0.1 (default: none)
+	HOSTS_FILE       - Hosts file of "IP name [name...]" lines answered for A and AAAA queries (default: none)
+	HOSTS_TTL        - TTL of answers from the hosts file (default: 5m)
+	STUB_RESPONSE_IP - IPv4 address of the synthetic A answer given without an upstream (default: 127.0.0.1)
+	STUB_RESPONSE_IPV6 - IPv6 address of the synthetic AAAA answer; other types get no answer (default: ::1)
+	STUB_RESPONSE_TTL - TTL of the synthetic answer (default: 5m)
+	UPSTREAM_DNS     - Comma separated host:port resolvers that cache misses are forwarded to (default: none, answer locally)
+	UPSTREAM_STRATEGY - Order upstreams are tried in: failover or roundrobin (default: failover)
+	UPSTREAM_TIMEOUT - Time to wait for the upstream resolver (default: 2s)
+	ECS_ENABLED      - Attach an EDNS client subnet to forwarded queries (default: false)
+	ECS_PREFIX_V4    - Client subnet prefix length for IPv4 clients (default: 24)
+	ECS_PREFIX_V6    - Client subnet prefix length for IPv6 clients (default: 56)
+	EDNS_MAX_UDP     - Largest UDP response in bytes for clients advertising EDNS (default: 1232)
+	MAX_QUESTIONS    - Queries with more questions are dropped unanswered (default: 2)
+	MAX_QUERY_SIZE   - Queries larger than this many bytes are dropped unanswered (default: 4096)
+	TLS_CERT_FILE    - PEM certificate; with TLS_KEY_FILE enables DNS over TLS (default: none)
+	TLS_KEY_FILE     - PEM private key for DNS over TLS (default: none)
+	DOT_PORT         - DNS over TLS port (default: 853)
+	DOH_PORT         - DNS over HTTPS port serving /dns-query, over HTTPS with TLS_CERT_FILE (default: none, disabled)
+	BIND_ADDRESS     - IP the DNS, DoT and DoH listeners bind to; :: binds all IPv4 and IPv6 addresses (default: 0.0.0.0)
+	SOURCE_REFRESH_INTERVAL - Blocklist and zone refresh interval, 0 disables (default: 5m)
+	CONFIG_FILE      - KEY=VALUE file whose settings take precedence over the environment,
+	                   re-read on SIGHUP (default: none)
+	ENV_PREFIX       - Optional prefix for all variables above, e.g. NSCHECKER_
+	                   reads NSCHECKER_DEBUG before DEBUG (default: none)
 */
 package config
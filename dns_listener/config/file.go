@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// fileEnv holds the variables read by LoadFromFile
+var fileEnv atomic.Pointer[map[string]string]
+
+// lookupEnv looks name up in the configuration file, then in the process
+// environment
+func lookupEnv(name string) (string, bool) {
+	if values := fileEnv.Load(); values != nil {
+		if value, ok := (*values)[name]; ok {
+			return value, true
+		}
+	}
+	return os.LookupEnv(name)
+}
+
+// Load reads the configuration from the file named by CONFIG_FILE, if set,
+// else from the environment
+func Load() (*Config, error) {
+	if path := os.Getenv(envConfigFile); path != "" {
+		return LoadFromFile(path)
+	}
+	return LoadFromEnv(), nil
+}
+
+// LoadFromFile reads KEY=VALUE lines from path, in the format of
+// .env.example, and loads the configuration like LoadFromEnv with them
+// taking precedence over the environment. The values also stay visible
+// through Getenv until the next call.
+func LoadFromFile(path string) (*Config, error) {
+	values, err := readEnvFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fileEnv.Store(&values)
+	return LoadFromEnv(), nil
+}
+
+// readEnvFile parses an env file. Blank lines and # comments are skipped,
+// an export prefix and quotes around values are dropped.
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open config file: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: want KEY=VALUE", path, n)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		} else if i := strings.Index(value, "\t#"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	return values, nil
+}
+
+// reloadImmutable are the fields a running listener holds on to, such as
+// its listening ports, which ValidateReload does not check
+var reloadImmutable = map[string]bool{
+	"Port":       true,
+	"HealthPort": true,
+	"DoTPort":    true,
+	"DoHPort":    true,
+}
+
+// ValidateReload validates config as a replacement for a running one.
+// Unlike ValidateConfig it skips the port checks, as the running listener
+// holds those ports and they cannot change without a restart.
+func ValidateReload(config *Config) error {
+	err := ValidateConfig(config)
+	validation, ok := err.(*ValidationError)
+	if !ok {
+		return err
+	}
+	var errors []error
+	for _, e := range validation.Errors {
+		if ce, ok := e.(*ConfigError); ok && reloadImmutable[ce.Field] {
+			continue
+		}
+		errors = append(errors, e)
+	}
+	if len(errors) > 0 {
+		return &ValidationError{Errors: errors}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeEnvFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ns-checker.env")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fileEnv.Store(nil) })
+	return path
+}
+
+func TestLoadFromFile(t *testing.T) {
+	cleanEnvironment()
+	defer cleanEnvironment()
+	os.Setenv("RATE_LIMIT", "500")
+	os.Setenv("RATE_BURST", "50")
+
+	path := writeEnvFile(t, `# Rate limits
+RATE_LIMIT=2000          # overrides the environment
+export CACHE_TTL=10m
+QNAME_REDACTION="hash"
+
+DEBUG='true'
+`)
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if cfg.RateLimit != 2000 {
+		t.Errorf("RateLimit = %v, want 2000 from the file", cfg.RateLimit)
+	}
+	if cfg.RateBurst != 50 {
+		t.Errorf("RateBurst = %v, want 50 from the environment", cfg.RateBurst)
+	}
+	if cfg.CacheTTL != 10*time.Minute {
+		t.Errorf("CacheTTL = %v, want 10m", cfg.CacheTTL)
+	}
+	if cfg.QnameRedaction != RedactHash || !cfg.Debug {
+		t.Errorf("QnameRedaction = %q, Debug = %v, want unquoted hash and true", cfg.QnameRedaction, cfg.Debug)
+	}
+	if got := Getenv("DEBUG"); got != "true" {
+		t.Errorf("Getenv(DEBUG) = %q, want the file's value", got)
+	}
+
+	// Load follows CONFIG_FILE
+	os.Setenv("CONFIG_FILE", path)
+	if cfg, err := Load(); err != nil || cfg.RateLimit != 2000 {
+		t.Errorf("Load() = %v, %v, want the file's rate limit", cfg, err)
+	}
+}
+
+func TestLoadFromFileErrors(t *testing.T) {
+	if _, err := LoadFromFile(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("LoadFromFile() of a missing file succeeded")
+	}
+	if _, err := LoadFromFile(writeEnvFile(t, "RATE_LIMIT 2000\n")); err == nil {
+		t.Error("LoadFromFile() of a line without = succeeded")
+	}
+}
+
+func TestValidateReload(t *testing.T) {
+	// A running listener holds its port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	cfg := &Config{
+		Port:                 port,
+		WorkerCount:          4,
+		RateLimit:            1000,
+		RateBurst:            100,
+		CacheTTL:             time.Minute,
+		CacheCleanupInterval: time.Minute,
+		LogPath:              "./test.log",
+		LogMaxSize:           10,
+	}
+	if err := ValidateConfig(cfg); !hasFieldError(err, "Port") {
+		t.Fatalf("ValidateConfig() = %v, want the port in use reported", err)
+	}
+	if err := ValidateReload(cfg); err != nil {
+		t.Errorf("ValidateReload() = %v, want port checks skipped", err)
+	}
+
+	cfg.RateBurst = 2000
+	if err := ValidateReload(cfg); !hasFieldError(err, "RateBurst") {
+		t.Errorf("ValidateReload() = %v, want RateBurst error", err)
+	}
+}
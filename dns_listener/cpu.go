@@ -0,0 +1,74 @@
+package dns_listener
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is where the CPU controller files of the process are mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// numCPU and cpuQuota are variables so tests can simulate a container that
+// is limited to fewer CPUs than the host has
+var (
+	numCPU   = runtime.NumCPU
+	cpuQuota = func() (float64, bool) { return readCgroupQuota(cgroupRoot) }
+)
+
+// readCgroupQuota returns the CPU limit set by a cgroup v2 cpu.max or a
+// cgroup v1 CFS quota under root. It reports false when there is none.
+func readCgroupQuota(root string) (float64, bool) {
+	if data, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return quotaRatio(fields[0], fields[1])
+	}
+
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	return quotaRatio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func quotaRatio(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
+
+// availableCPUs returns the CPUs the process may use: the container quota
+// rounded up when it is below the host core count, otherwise NumCPU
+func availableCPUs() int {
+	cpus := numCPU()
+	if quota, ok := cpuQuota(); ok {
+		if limit := int(math.Ceil(quota)); limit < cpus {
+			cpus = max(1, limit)
+		}
+	}
+	return cpus
+}
+
+// applyCPUQuota lowers GOMAXPROCS to the container quota so the scheduler
+// does not run more threads than the CPU time it is granted
+func applyCPUQuota() {
+	if cpus := availableCPUs(); cpus < runtime.GOMAXPROCS(0) {
+		runtime.GOMAXPROCS(cpus)
+	}
+}
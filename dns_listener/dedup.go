@@ -0,0 +1,73 @@
+package dns_listener
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// dedupGroup lets retransmitted queries share the resolution started by
+// the first copy. A call stays joinable for window after it starts, or
+// with a zero window only while it runs.
+type dedupGroup struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*dedupCall
+}
+
+type dedupCall struct {
+	done chan struct{}
+	resp []byte
+	err  error
+}
+
+func newDedupGroup(window time.Duration) *dedupGroup {
+	return &dedupGroup{
+		window: window,
+		calls:  make(map[string]*dedupCall),
+	}
+}
+
+// do runs fn once per key within the window; duplicates wait for and
+// return the same result, reported as shared
+func (g *dedupGroup) do(key string, fn func() ([]byte, error)) (resp []byte, err error, shared bool) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.resp, c.err, true
+	}
+	c := &dedupCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	if g.window > 0 {
+		time.AfterFunc(g.window, func() { g.forget(key, c) })
+	}
+
+	c.resp, c.err = fn()
+	if g.window <= 0 {
+		g.forget(key, c)
+	}
+	close(c.done)
+	return c.resp, c.err, false
+}
+
+// forget makes key start a new call unless a newer one replaced c
+func (g *dedupGroup) forget(key string, c *dedupCall) {
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+}
+
+// dedupKey identifies a retransmission: same client, transaction ID and
+// question
+func dedupKey(query []byte, addr net.Addr) string {
+	if len(query) < 2 {
+		return ""
+	}
+	return addr.String() + "|" + string(query[:2]) + "|" + cacheKeyFromQuery(query)
+}
@@ -0,0 +1,122 @@
+package dns_listener
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestRetransmitSharesResolution(t *testing.T) {
+	var resolutions int32
+	slow := func(q *protocol.ParsedMessage, resp []byte) []byte {
+		atomic.AddInt32(&resolutions, 1)
+		time.Sleep(50 * time.Millisecond)
+		return resp
+	}
+	d := newTestListener(t, &config.Config{DedupWindow: time.Second})
+	d.hooks = append(d.hooks, slow)
+
+	query := buildTestQuery("retransmit.example", protocol.TypeA)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	var wg sync.WaitGroup
+	responses := make([][]byte, 2)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := d.HandleRequest(query, addr, "udp")
+			if err != nil {
+				t.Errorf("HandleRequest() error = %v", err)
+			}
+			responses[i] = resp
+		}(i)
+		// The retransmit arrives while the first copy is still resolving
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&resolutions); n != 1 {
+		t.Errorf("resolutions = %d, want 1", n)
+	}
+	for i, resp := range responses {
+		if len(resp) == 0 {
+			t.Errorf("copy %d got no response", i)
+		}
+	}
+
+	// A different client with the same transaction is resolved separately
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 12345}
+	if _, err := d.HandleRequest(query, other, "udp"); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&resolutions); n != 2 {
+		t.Errorf("resolutions = %d after another client, want 2", n)
+	}
+}
+
+func TestCacheMissesShareUpstreamQuery(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	var upstreamCalls int32
+	release := make(chan struct{})
+	d.resolve = func(query []byte) []byte {
+		atomic.AddInt32(&upstreamCalls, 1)
+		<-release
+		return d.createResponse(query)
+	}
+
+	const clients = 8
+	var wg sync.WaitGroup
+	responses := make([][]byte, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := buildTestQuery("storm.example", protocol.TypeA)
+			query[0], query[1] = 0x10, byte(i)
+			addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, byte(i+1)), Port: 5353}
+			resp, err := d.HandleRequest(query, addr, "udp")
+			if err != nil {
+				t.Errorf("client %d: HandleRequest() error = %v", i, err)
+			}
+			responses[i] = resp
+		}(i)
+	}
+	// Let every query join the resolution before it completes
+	deadline := time.Now().Add(time.Second)
+	for d.metrics.GetCacheMisses() < clients && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&upstreamCalls); n != 1 {
+		t.Errorf("upstream calls = %d, want 1", n)
+	}
+	if n := d.metrics.GetCoalescedRequests(); n != clients-1 {
+		t.Errorf("coalesced requests = %d, want %d", n, clients-1)
+	}
+	for i, resp := range responses {
+		if len(resp) < 12 || resp[0] != 0x10 || resp[1] != byte(i) {
+			t.Errorf("client %d got response %x, want its own ID", i, resp)
+			continue
+		}
+		if answers := resp[7]; answers != 1 {
+			t.Errorf("client %d got %d answers, want 1", i, answers)
+		}
+	}
+
+	// Once answered the name is resolved again only after the cache
+	// entry expires
+	d.cache.Clear()
+	d.HandleRequest(buildTestQuery("storm.example", protocol.TypeA), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}, "udp")
+	if n := atomic.LoadInt32(&upstreamCalls); n != 2 {
+		t.Errorf("upstream calls after the first resolution = %d, want 2", n)
+	}
+}
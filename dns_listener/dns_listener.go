@@ -3,46 +3,81 @@ package dns_listener
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/exiguus/ns-checker/dns_listener/blocklist"
 	"github.com/exiguus/ns-checker/dns_listener/cache"
 	"github.com/exiguus/ns-checker/dns_listener/config"
 	dnserr "github.com/exiguus/ns-checker/dns_listener/errors"
 	"github.com/exiguus/ns-checker/dns_listener/health"
+	"github.com/exiguus/ns-checker/dns_listener/hosts"
 	"github.com/exiguus/ns-checker/dns_listener/metrics"
 	"github.com/exiguus/ns-checker/dns_listener/network"
 	"github.com/exiguus/ns-checker/dns_listener/perf"
 	"github.com/exiguus/ns-checker/dns_listener/processor"
 	"github.com/exiguus/ns-checker/dns_listener/protocol"
 	"github.com/exiguus/ns-checker/dns_listener/ratelimit"
+	"github.com/exiguus/ns-checker/dns_listener/reload"
+	"github.com/exiguus/ns-checker/dns_listener/rules"
 	"github.com/exiguus/ns-checker/dns_listener/tracing"
 	"github.com/exiguus/ns-checker/dns_listener/types"
 	"github.com/exiguus/ns-checker/dns_listener/validator"
+	"github.com/exiguus/ns-checker/dns_listener/zone"
 )
 
 type DNSListener struct {
-	port        string
-	metrics     *metrics.Collector
-	config      *config.Config
-	cache       cache.Cache
-	logger      Logger
-	rateLimiter *ratelimit.RateLimiter
-	validator   validator.MessageValidator
-	bufPool     sync.Pool
-	stopChan    chan struct{}
-	wg          sync.WaitGroup
-	processor   *processor.Processor
-	requestCh   chan types.Request
-	tracer      *tracing.Tracer
-	perfMon     *perf.Monitor
-	healthMon   *health.HealthMonitor
-}
-
-func NewDNSListener(cfg *config.Config) (*DNSListener, error) {
+	port         string
+	metrics      *metrics.Collector
+	config       *config.Config
+	cache        cache.Cache
+	logger       Logger
+	rateLimiter  ratelimit.Limiter
+	validator    validator.MessageValidator
+	bufPool      sync.Pool
+	stopChan     chan struct{} // closed by Shutdown
+	shutdownOnce sync.Once
+	shutdownErr  error
+	wg           sync.WaitGroup
+	processor    *processor.Processor
+	requestCh    chan types.Request
+	tracer       *tracing.Tracer
+	perfMon      *perf.Monitor
+	healthMon    *health.HealthMonitor
+	health       *health.Server        // nil without a health port
+	otlp         *tracing.OTLPExporter // nil without OTEL_EXPORTER_OTLP_ENDPOINT
+	doh          *http.Server          // nil without DOH_PORT
+	server       atomic.Pointer[network.Server]
+	live         atomic.Pointer[liveSettings] // replaced by a configuration reload
+	started      atomic.Bool                  // set once Start has the workers running
+	startTime    time.Time
+	reloader     *reload.Reloader
+	blocklist    reload.Value[blocklist.List]
+	zone         reload.Value[zone.Zone]
+	hosts        reload.Value[hosts.HostMap]
+	rules        *rules.Set
+	hasSources   bool
+	logErr       atomic.Pointer[error] // result of the last log directory probe
+
+	revalidating sync.Map // cache keys with a background refresh in flight
+	hooks        []ResponseHook
+	dedup        *dedupGroup // nil unless DedupWindow is set
+	inflight     *dedupGroup // cache misses being resolved, by cache key
+	upstream     *upstreamLimiter
+	resolve      func(query []byte) []byte // answers cache misses
+	resolver     protocol.Resolver         // upstream for cache misses, nil answers locally
+	closeOnce    sync.Once
+}
+
+func NewDNSListener(cfg *config.Config, opts ...Option) (*DNSListener, error) {
 	parsedPort, err := network.ParsePort(cfg.Port)
 	if err != nil {
 		return nil, err
@@ -51,33 +86,49 @@ func NewDNSListener(cfg *config.Config) (*DNSListener, error) {
 	// Update port in config with parsed value
 	cfg.Port = fmt.Sprintf("%d", parsedPort)
 
-	logger, err := NewFileLogger(cfg.LogPath)
+	rewriteRules, err := rules.Parse(cfg.RewriteRules)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create logger: %w", err)
+		return nil, fmt.Errorf("invalid rewrite rules: %w", err)
 	}
 
-	// Ensure config has valid TTL
-	if cfg.CacheTTL == 0 {
-		cfg.CacheTTL = 30 * time.Minute
+	prefix4, prefix6, err := config.ParseRateLimitCIDR(cfg.RateLimitCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limit CIDR: %w", err)
 	}
-	if cfg.CacheCleanupInterval == 0 {
-		cfg.CacheCleanupInterval = time.Minute
+	allowlist, err := config.ParseAllowlist(cfg.RateLimitAllowlist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limit allowlist: %w", err)
 	}
 
-	ttlSeconds := int(cfg.CacheTTL.Seconds())
-	if ttlSeconds <= 0 {
-		ttlSeconds = 1800 // Default to 30 minutes if invalid
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
 
-	// Initialize cache with proper configuration
-	cacheConfig := cache.Config{
-		MaxSize:         1024 * 1024 * 100,
-		DefaultTTL:      cfg.CacheTTL,
-		CleanupInterval: cfg.CacheCleanupInterval,
-	}
+	var cacheImpl cache.Cache
+	if cfg.CacheDisabled {
+		// Stateless mode: every query takes the full resolve path
+		cacheImpl = cache.NewNoop()
+	} else {
+		// Ensure config has valid TTL
+		if cfg.CacheTTL == 0 {
+			cfg.CacheTTL = 30 * time.Minute
+		}
+		if cfg.CacheCleanupInterval == 0 {
+			cfg.CacheCleanupInterval = time.Minute
+		}
 
-	// Use New instead of NewBasicCache to match the interface
-	cacheImpl := cache.New(cacheConfig)
+		// Initialize cache with proper configuration
+		cacheConfig := cache.Config{
+			MaxSize:         1024 * 1024 * 100,
+			DefaultTTL:      cfg.CacheTTL,
+			CleanupInterval: cfg.CacheCleanupInterval,
+			StaleWindow:     cfg.StaleWhileRevalidate,
+			Shards:          cfg.CacheShards,
+			OnEvict:         logger.CacheEvicted,
+		}
+		cacheImpl = cache.NewFromConfig(cacheConfig, cfg.CacheBackend)
+	}
 
 	listener := &DNSListener{
 		port:        cfg.Port,
@@ -85,27 +136,86 @@ func NewDNSListener(cfg *config.Config) (*DNSListener, error) {
 		config:      cfg,
 		cache:       cacheImpl,
 		logger:      logger,
-		rateLimiter: ratelimit.New(cfg.RateLimit, cfg.RateBurst),
-		validator:   validator.New(),
+		rateLimiter: newRateLimiter(cfg, prefix4, prefix6),
+		validator:   newValidator(cfg),
 		bufPool:     sync.Pool{New: func() interface{} { return make([]byte, types.DefaultBufferSize) }},
 		stopChan:    make(chan struct{}),
 		requestCh:   make(chan types.Request, cfg.WorkerCount*20),
 		tracer:      tracing.New(),
 		perfMon:     perf.New(time.Second),
 		healthMon:   health.NewMonitor(time.Second),
+		startTime:   time.Now(),
+		reloader:    reload.New(),
+		rules:       rewriteRules,
+	}
+	listener.rateLimiter.SetAllowlist(allowlist)
+	listener.setLive(cfg)
+	listener.resolve = listener.createResponse
+	if cfg.UpstreamDNS != "" {
+		listener.resolver = protocol.NewUpstreamPool(config.UpstreamAddrs(cfg.UpstreamDNS), cfg.UpstreamTimeout, cfg.UpstreamStrategy)
+		listener.resolve = listener.forward
+	}
+	listener.upstream = newUpstreamLimiter(cfg.MaxUpstreamInflight, upstreamQueueWait)
+	if cfg.DedupWindow > 0 {
+		listener.dedup = newDedupGroup(cfg.DedupWindow)
+	}
+	listener.inflight = newDedupGroup(0)
+	if cfg.OTLPEndpoint != "" {
+		listener.otlp = tracing.NewOTLPExporter(cfg.OTLPEndpoint, spanService, 0, func(err error) {
+			logger.Write(fmt.Sprintf("Span export failed: %v\n", err))
+		})
+		listener.tracer.SetExporter(listener.otlp)
+	}
+	for _, opt := range opts {
+		opt(listener)
+	}
+	listener.reloader.OnError = func(name string, err error) {
+		logger.Write(fmt.Sprintf("Reload of %s failed, keeping previous data: %v\n", name, err))
 	}
 
-	// Initialize processor after listener is created
+	listener.loadCache()
+
+	// Load blocklist, zone and hosts file before serving; a failed load is logged and
+	// retried on the next refresh
+	if listener.hasSources = listener.registerSources(); listener.hasSources {
+		listener.reloader.Reload()
+	}
+
+	// The workers take queries from the request channel, so its backlog
+	// is what overload shedding measures
 	procConfig := processor.ProcessorConfig{
-		Workers:    cfg.WorkerCount,
-		Timeout:    30 * time.Second,
-		BufferSize: cfg.WorkerCount * 20,
+		Workers:   cfg.WorkerCount,
+		Timeout:   30 * time.Second,
+		Queue:     listener.requestCh,
+		QueueWait: cfg.QueueWait,
 	}
-	listener.processor = processor.New(procConfig, listener, metrics.NewCollector())
+	listener.processor = processor.New(procConfig, listener, listener.metrics)
 
 	return listener, nil
 }
 
+// newValidator creates the query validator with the caps of cfg, using the
+// defaults for those left at 0
+func newValidator(cfg *config.Config) *validator.DNSValidator {
+	maxQuestions, maxQuerySize := cfg.MaxQuestions, cfg.MaxQuerySize
+	if maxQuestions == 0 {
+		maxQuestions = config.DefaultMaxQuestions
+	}
+	if maxQuerySize == 0 {
+		maxQuerySize = config.DefaultMaxQuerySize
+	}
+	return validator.New(maxQuestions, maxQuerySize)
+}
+
+// newRateLimiter creates the limiter of cfg.RateLimitAlgorithm, keying
+// clients by the given prefix lengths
+func newRateLimiter(cfg *config.Config, prefix4, prefix6 int) ratelimit.Limiter {
+	if cfg.RateLimitAlgorithm == config.RateLimitSliding {
+		return ratelimit.NewSlidingWindow(cfg.RateLimit, cfg.RateLimitWindow, cfg.RateLimitMaxKeys, prefix4, prefix6)
+	}
+	return ratelimit.NewWithPrefix(cfg.RateLimit, cfg.RateBurst, cfg.RateLimitMaxKeys, prefix4, prefix6)
+}
+
 func (d *DNSListener) GetPort() string {
 	return d.port
 }
@@ -115,121 +225,353 @@ func (d *DNSListener) GetMetrics() metrics.MetricsCollector {
 }
 
 func (d *DNSListener) HandleRequest(data []byte, addr net.Addr, protocolType string) ([]byte, error) {
+	if d.dedup == nil {
+		return d.handle(data, addr, protocolType)
+	}
+	// Retransmits of an in-flight query share its answer
+	response, err, _ := d.dedup.do(dedupKey(data, addr), func() ([]byte, error) {
+		return d.handle(data, addr, protocolType)
+	})
+	return response, err
+}
+
+func (d *DNSListener) handle(data []byte, addr net.Addr, protocolType string) ([]byte, error) {
+	ctx := d.tracer.StartTrace(context.Background())
+	defer d.finishTrace(ctx, data, addr, protocolType)
+	response, err := d.handleTraced(ctx, data, addr, protocolType)
+	if err == nil && isUDP(protocolType) {
+		response = d.fitUDP(data, response)
+	}
+	return response, err
+}
+
+// handleTraced resolves a query, recording each decision as an event on
+// the trace carried by ctx
+func (d *DNSListener) handleTraced(ctx context.Context, data []byte, addr net.Addr, protocolType string) (response []byte, err error) {
 	start := time.Now()
 	defer func() {
 		d.perfMon.RecordResponseTime(time.Since(start))
 	}()
 
+	d.tracer.AddEvent(ctx, "request_start", nil)
+
 	if !d.rateLimiter.Allow(addr.String()) {
 		d.metrics.RecordError()
+		d.tracer.AddEvent(ctx, "rate_limited", nil)
+		// Refusing lets the client fail fast instead of waiting to time out
+		if d.config.RateLimitResponse == config.RateLimitRefused {
+			if response := protocol.CreateRefusedResponse(data); response != nil {
+				return response, nil
+			}
+		}
 		return nil, dnserr.NewValidationError("HandleRequest", "rate limit exceeded", nil)
 	}
 
-	ctx := d.tracer.StartTrace(context.Background())
-	d.tracer.AddEvent(ctx, "request_start", nil)
-
-	d.logger.LogRequest(protocolType, addr.String(), data, nil)
+	// Logged once answered, so the entry carries the response and any
+	// error; UDP truncation happens afterwards
+	defer func() {
+		d.logger.LogRequest(protocolType, addr.String(), d.redactQuery(data), response, err)
+	}()
 
 	d.metrics.RecordRequest()
 
-	if cachedResponse := d.checkCache(data); cachedResponse != nil {
+	if response, ok := d.answerAny(data); ok {
+		d.logger.Write(fmt.Sprintf("Answered ANY from %s minimally\n", addr.String()))
+		d.tracer.AddEvent(ctx, "any_answer", nil)
+		d.tracer.AddEvent(ctx, "request_complete", nil)
+		return d.applyHooks(data, response), nil
+	}
+
+	if response, layer, ok := d.resolveLocal(data); ok {
+		d.logger.Write(fmt.Sprintf("Answered %s from %s\n", addr.String(), layer))
+		d.tracer.AddEvent(ctx, layer+"_answer", nil)
+		d.tracer.AddEvent(ctx, "request_complete", nil)
+		return d.applyHooks(data, response), nil
+	}
+
+	if cachedResponse, age := d.checkCache(data); cachedResponse != nil {
 		d.metrics.RecordCacheHit()
 		d.logger.Write(fmt.Sprintf("Cache hit for %s\n", addr.String()))
 		d.tracer.AddEvent(ctx, "cache_hit", nil)
 		d.tracer.AddEvent(ctx, "request_complete", nil)
 
-		// Create fresh response instead of using cached one
-		response := protocol.CreateDNSResponse(data, addr.String())
+		response := matchEDNS(data, d.fromCache(data, cachedResponse, age))
 		if response != nil {
-			return response, nil
+			return d.applyHooks(data, response), nil
 		}
 	}
 	d.metrics.RecordCacheMiss()
+	d.tracer.AddEvent(ctx, "cache_miss", nil)
 
 	if err := d.validator.ValidateQuery(data); err != nil {
 		d.metrics.RecordError()
 		d.logger.Write(fmt.Sprintf("Validation error for %s: %v\n", addr.String(), err))
 		d.tracer.AddEvent(ctx, "validation_error", err)
 		d.tracer.AddEvent(ctx, "request_complete", nil)
+		if errors.Is(err, validator.ErrMultipleQuestions) {
+			return d.applyHooks(data, d.errorResponse(data, protocol.RCodeFormErr)), nil
+		}
 		return nil, dnserr.NewValidationError("HandleRequest", "invalid query", err)
 	}
 
-	response := protocol.CreateDNSResponse(data, addr.String())
+	// Under overload keep serving cache hits and refuse the expensive misses
+	if d.overloaded() {
+		d.metrics.RecordShed()
+		d.tracer.AddEvent(ctx, "shed", nil)
+		d.tracer.AddEvent(ctx, "request_complete", nil)
+		return d.applyHooks(data, d.errorResponse(data, protocol.RCodeRefused)), nil
+	}
+
+	response, ok := d.resolveCoalesced(data, addr)
+	if !ok {
+		d.metrics.RecordError()
+		d.logger.Write(fmt.Sprintf("Upstream saturated, SERVFAIL for %s\n", addr.String()))
+		d.tracer.AddEvent(ctx, "upstream_saturated", nil)
+		d.tracer.AddEvent(ctx, "request_complete", nil)
+		return d.applyHooks(data, d.errorResponse(data, protocol.RCodeServFail)), nil
+	}
+	// Resolution failures are answered with SERVFAIL so clients can tell
+	// them apart from an empty answer
 	if response == nil {
 		err := dnserr.NewInternalError("HandleRequest", "failed to create response", nil)
 		d.metrics.RecordError()
 		d.logger.Write(fmt.Sprintf("Response creation error for %s: %v\n", addr.String(), err))
 		d.tracer.AddEvent(ctx, "response_creation_error", err)
 		d.tracer.AddEvent(ctx, "request_complete", nil)
-		return nil, err
+		return d.applyHooks(data, d.errorResponse(data, protocol.RCodeServFail)), nil
 	}
 
 	if err := d.validator.ValidateResponse(response); err != nil {
 		d.metrics.RecordError()
+		d.logger.Write(fmt.Sprintf("Invalid response for %s, SERVFAIL: %v\n", addr.String(), err))
 		d.tracer.AddEvent(ctx, "response_validation_error", err)
 		d.tracer.AddEvent(ctx, "request_complete", nil)
-		return nil, dnserr.NewValidationError("HandleRequest", "invalid response", err)
+		return d.applyHooks(data, d.errorResponse(data, protocol.RCodeServFail)), nil
 	}
 
 	d.logger.Write(fmt.Sprintf("Created response for %s (%d bytes)\n", addr.String(), len(response)))
 
 	d.updateCache(data, response)
+	d.tracer.AddEvent(ctx, "resolver_answer", nil)
 	d.tracer.AddEvent(ctx, "request_complete", nil)
-	return response, nil
+	return d.applyHooks(data, matchEDNS(data, response)), nil
 }
 
-func (d *DNSListener) handleRequest(conn net.Conn, protocol string, clientAddr net.Addr) {
-	req := types.Request{
-		Conn:       conn,
-		Protocol:   protocol,
-		ClientAddr: clientAddr,
+// dispatch answers a query from the network server through the processor
+// workers. A query dropped because the queue is full is answered with
+// SERVFAIL right away.
+func (d *DNSListener) dispatch(data []byte, addr net.Addr, protocolType string) ([]byte, error) {
+	response, err := d.processor.HandleRequest(data, addr, protocolType)
+	if errors.Is(err, processor.ErrQueueFull) {
+		d.logger.Write(fmt.Sprintf("Dropped request from %s: %v\n", addr, err))
+		if response := protocol.CreateErrorResponse(data, protocol.RCodeServFail); response != nil {
+			return response, nil
+		}
 	}
-	d.processor.Process(req)
+	return response, err
 }
 
-func (d *DNSListener) sendResponse(conn net.Conn, response []byte) error {
-	_, err := conn.Write(response)
-	return err
+// createResponse builds the stub answer honouring the configured encoding
+func (d *DNSListener) createResponse(query []byte) []byte {
+	return d.capTTLs(protocol.CreateResponse(query, d.responseOptions()))
+}
+
+// capTTLs lowers TTLs in response to MaxAnswerTTL when configured
+func (d *DNSListener) capTTLs(response []byte) []byte {
+	if d.config.MaxAnswerTTL > 0 && response != nil {
+		protocol.ClampTTLs(response, uint32(d.config.MaxAnswerTTL/time.Second))
+	}
+	return response
+}
+
+// errorResponse builds an answerless response carrying rcode
+func (d *DNSListener) errorResponse(query []byte, rcode protocol.RCode) []byte {
+	return protocol.CreateErrorResponseWithOptions(query, rcode, d.responseOptions())
 }
 
-func (d *DNSListener) checkCache(query []byte) []byte {
+func (d *DNSListener) responseOptions() protocol.ResponseOptions {
+	return protocol.ResponseOptions{
+		DisableCompression: d.config.DisableCompression,
+		RecursionAvailable: d.recursionAvailable(),
+		StubIP:             net.ParseIP(d.config.StubResponseIP),
+		StubIPv6:           net.ParseIP(d.config.StubResponseIPv6),
+		StubTTL:            uint32(d.config.StubResponseTTL / time.Second),
+	}
+}
+
+// recursionAvailable reports whether queries without a local answer are
+// resolved upstream. Sink and zone modes answer on their own and must not
+// advertise RA.
+func (d *DNSListener) recursionAvailable() bool {
+	return d.mode() == "forward"
+}
+
+// checkCache returns the cached response for query and how long ago it
+// was stored, or nil on a miss
+func (d *DNSListener) checkCache(query []byte) ([]byte, time.Duration) {
+	if d.config.CacheDisabled {
+		return nil, 0
+	}
 	key := cacheKeyFromQuery(query)
 
-	if response, ok := d.cache.Get(key); ok {
-		return response
+	var response []byte
+	if sc, ok := d.cache.(cache.StaleCache); ok && d.config.StaleWhileRevalidate > 0 {
+		cached, stale, ok := sc.GetStale(key)
+		if !ok {
+			return nil, 0
+		}
+		if stale {
+			d.revalidate(key, query)
+		}
+		response = cached
+	} else if cached, ok := d.cache.Get(key); ok {
+		response = cached
+	} else {
+		return nil, 0
 	}
-	return nil
+
+	var age time.Duration
+	if info, ok := d.cache.Entry(key); ok {
+		age = time.Since(info.Inserted)
+	}
+	return response, age
+}
+
+// revalidate refreshes the cache entry for key in the background. Only one
+// refresh per key runs at a time; callers keep serving the stale entry.
+func (d *DNSListener) revalidate(key string, query []byte) {
+	if _, busy := d.revalidating.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	// The query buffer belongs to the caller
+	query = append([]byte(nil), query...)
+
+	go func() {
+		defer d.revalidating.Delete(key)
+
+		response, ok := d.resolveUpstream(query)
+		if !ok || response == nil || d.validator.ValidateResponse(response) != nil {
+			return
+		}
+		d.updateCache(query, response)
+		d.metrics.RecordRevalidation()
+	}()
 }
 
 func (d *DNSListener) updateCache(query, response []byte) {
+	// Answers scoped to a client subnet are only good for that subnet
+	if d.config.CacheDisabled || !cacheable(response) || scopedAnswer(response) {
+		return
+	}
+	// Answers with a zero TTL must not be reused
+	ttl := d.cacheTTL(response)
+	if ttl <= 0 {
+		return
+	}
 	key := cacheKeyFromQuery(query)
-	d.cache.Set(key, response, d.config.CacheTTL)
+	d.cache.Set(key, response, ttl)
+}
+
+// cacheTTL returns how long response may be cached: its smallest answer
+// TTL bounded by CacheMinTTL and CacheMaxTTL, or CacheTTL for responses
+// without answers. CacheMaxTTL defaults to CacheTTL.
+func (d *DNSListener) cacheTTL(response []byte) time.Duration {
+	live := d.live.Load()
+	ttl, ok := protocol.MinAnswerTTL(response)
+	if !ok {
+		return live.cacheTTL
+	}
+	maxTTL := live.cacheMaxTTL
+	if maxTTL <= 0 {
+		maxTTL = live.cacheTTL
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	if ttl < live.cacheMinTTL {
+		ttl = live.cacheMinTTL
+	}
+	return ttl
 }
 
+// cacheKeyFromQuery returns the cache key of the single question of query:
+// its name in wire format with ASCII letters lowercased, as names compare
+// case-insensitively, followed by QTYPE and QCLASS, hex encoded. Queries
+// without exactly one well-formed question get a key of the whole message
+// with a prefix no question key has.
 func cacheKeyFromQuery(query []byte) string {
-	if len(query) < 12 {
-		return hex.EncodeToString(query)
+	if key, ok := questionKey(query); ok {
+		return hex.EncodeToString(key)
+	}
+	return "malformed:" + hex.EncodeToString(query)
+}
+
+// cacheKeyPrefix returns the prefix shared by the cache keys of name for
+// every type and class
+func cacheKeyPrefix(name string) (string, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return "", errors.New("empty name")
+	}
+	wire := make([]byte, 0, len(name)+2)
+	for _, label := range strings.Split(strings.ToLower(name), ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("name %q: label length must be 1 to 63", name)
+		}
+		wire = append(wire, byte(len(label)))
+		wire = append(wire, label...)
+	}
+	wire = append(wire, 0)
+	if len(wire) > 255 {
+		return "", fmt.Errorf("name %q: longer than 255 bytes", name)
+	}
+	return hex.EncodeToString(wire), nil
+}
+
+// questionKey builds the canonical question of cacheKeyFromQuery
+func questionKey(query []byte) ([]byte, bool) {
+	if len(query) < 12 || query[4] != 0 || query[5] != 1 {
+		return nil, false
 	}
 
 	pos := 12
-	questionCount := int(query[4])<<8 | int(query[5])
-
-	// Skip questions to find end of question section
-	for i := 0; i < questionCount && pos < len(query); i++ {
-		// Skip name
-		for pos < len(query) {
-			length := int(query[pos])
-			if length == 0 {
-				pos++
-				break
-			}
-			pos += length + 1
+	for {
+		if pos >= len(query) {
+			return nil, false
+		}
+		length := int(query[pos])
+		if length == 0 {
+			break
+		}
+		// Pointers and reserved label types do not belong in a question
+		if length > 63 || pos+1+length > len(query) {
+			return nil, false
+		}
+		pos += 1 + length
+	}
+	end := pos + 1 + 4 // root label, QTYPE and QCLASS
+	if end > len(query) {
+		return nil, false
+	}
+
+	key := make([]byte, end-12)
+	copy(key, query[12:end])
+	// Length bytes are at most 63 and so never in the A-Z range
+	for i, c := range key[:len(key)-4] {
+		if 'A' <= c && c <= 'Z' {
+			key[i] = c + 'a' - 'A'
 		}
-		pos += 4 // Skip QTYPE and QCLASS
 	}
+	return key, true
+}
 
-	// Use only question section for cache key
-	return hex.EncodeToString(query[12:pos])
+// ratio returns part/total, or 0 without a total, so that the statistics of
+// an idle listener read 0 instead of NaN or Inf
+func ratio(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total
 }
 
 func formatDuration(d time.Duration) string {
@@ -324,26 +666,87 @@ func (d *DNSListener) getChannelStats() struct {
 	}
 }
 
-func (d *DNSListener) monitorStats() {
-	ticker := time.NewTicker(30 * time.Second)
-	startTime := time.Now()
-	for range ticker.C {
-		cacheStats := d.cache.Stats()
-		rawStats := d.metrics.GetRawStats()
-		rlStats := d.rateLimiter.GetStats()
-		valStats := d.validator.GetStats()
-		perfStats := d.perfMon.GetStats()
-		healthStats := d.healthMon.GetStats()
+// probeLogs checks the log directory every logProbeInterval until ctx is done
+func (d *DNSListener) probeLogs(ctx context.Context) {
+	ticker := time.NewTicker(logProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.checkLogs()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkLogs probes the log directory and records the result
+func (d *DNSListener) checkLogs() error {
+	err := probeLogDir(filepath.Dir(d.config.LogPath))
+	d.logErr.Store(&err)
+	return err
+}
+
+// logWritable is a health check reporting the last log directory probe
+func (d *DNSListener) logWritable() error {
+	if err := d.logErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// overloaded reports whether the request channel utilization crossed the
+// configured shedding threshold
+func (d *DNSListener) overloaded() bool {
+	if d.config.ShedThreshold <= 0 {
+		return false
+	}
+	return d.getChannelStats().utilization >= d.config.ShedThreshold
+}
+
+func (d *DNSListener) monitorStats(ctx context.Context) {
+	interval, output := d.config.StatsInterval, d.config.StatsOutput
+	if interval <= 0 || output == config.StatsOutputNone {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stats := d.formatRuntimeStats()
+			if output == config.StatsOutputLog {
+				d.logger.Write(stripColors(stats))
+				continue
+			}
+			fmt.Print(stats)
+			os.Stdout.Sync()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-		// Convert RateBurst to int32 for calculation
-		rateBurst := int32(d.config.RateBurst)
-		activeClientsPercent := float64(rlStats.ActiveKeys) / float64(rateBurst) * 100
+// formatRuntimeStats returns the runtime statistics block, colored for the
+// console when useColor allows
+func (d *DNSListener) formatRuntimeStats() string {
+	cacheStats := d.cache.Stats()
+	rawStats := d.metrics.GetRawStats()
+	rlStats := d.rateLimiter.GetStats()
+	valStats := d.validator.GetStats()
+	perfStats := d.perfMon.GetStats()
+	healthStats := d.healthMon.GetStats()
 
-		// Replace the Channel Load stats calculation with:
-		channelStats := d.getChannelStats()
+	activeClientsPercent := ratio(float64(rlStats.ActiveKeys), float64(d.config.RateBurst)) * 100
+	validQueries := valStats.TotalValidated - valStats.InvalidQueries - valStats.InvalidResponses
 
-		stats := fmt.Sprintf(`
-%s=== Runtime Statistics ===%s
+	// Replace the Channel Load stats calculation with:
+	channelStats := d.getChannelStats()
+
+	return fmt.Sprintf(`
+%s
 ► System Health:
   • CPU Usage: %.1f%%
   • Memory Usage: %.1f%%
@@ -354,9 +757,12 @@ func (d *DNSListener) monitorStats() {
   • Size: %d entries (%s)
   • Hit Ratio: %.1f%% (%d/%d)
   • Evictions: %d
+  • Revalidations: %d
 ► Processing:
   • Channel Load: %d/%d (%d%% utilized)
   • Total Requests: %d (%.1f/sec avg)
+  • Shed Requests: %d
+  • Coalesced Requests: %d
   • Goroutines: %d
   • Heap Usage: %s
 ► Performance:
@@ -368,51 +774,74 @@ func (d *DNSListener) monitorStats() {
 ► Rate Limiting:
   • Limited Requests: %d
   • Active Clients: %d (%d%% of limit)
+  • Bucket Evictions: %d
   • Burst Usage: %.1f%%
 ► Validation:
   • Success Rate: %.1f%% (%d/%d total)
   • Invalid Queries: %d
   • Invalid Responses: %d
-%s=========================%s
+  • Oversized Queries: %d
+  • Excess Questions: %d
+%s%s
 `,
-			colorYellow,
-			colorReset,
-			healthStats.CPUUsage*100,
-			healthStats.MemoryUsage*100,
-			formatDuration(time.Since(startTime)),
-			formatGCTime(healthStats.LastGC),
-			formatResponseTime(healthStats.GCPause),
-			cacheStats.Size,
-			humanizeBytes(cacheStats.BytesInMemory),
-			float64(cacheStats.Hits)/(float64(cacheStats.Hits+cacheStats.Misses))*100,
-			cacheStats.Hits,
-			cacheStats.Hits+cacheStats.Misses,
-			cacheStats.Evictions,
-			channelStats.current, channelStats.capacity, channelStats.utilization,
-			rawStats["total_requests"],
-			float64(rawStats["total_requests"])/time.Since(startTime).Seconds(),
-			perfStats.Goroutines,
-			humanizeBytes(perfStats.HeapAlloc),
-			perfStats.RequestRate,
-			formatResponseTime(perfStats.AvgResponseTime),
-			formatResponseTime(perfStats.P95),
-			formatResponseTime(perfStats.P99),
-			rlStats.Limited,
-			rlStats.ActiveKeys,
-			int(activeClientsPercent), // Convert to int for display
-			rlStats.BurstUsage*100,
-			float64(valStats.TotalValidated-valStats.InvalidQueries-valStats.InvalidResponses)/float64(valStats.TotalValidated)*100,
-			valStats.TotalValidated-valStats.InvalidQueries-valStats.InvalidResponses,
-			valStats.TotalValidated,
-			valStats.InvalidQueries,
-			valStats.InvalidResponses,
-			colorYellow,
-			colorReset,
-		)
-
-		fmt.Print(stats)
-		os.Stdout.Sync()
+		colorize("=== Runtime Statistics ===", colorYellow),
+		healthStats.CPUUsage*100,
+		healthStats.MemoryUsage*100,
+		formatDuration(time.Since(d.startTime)),
+		formatGCTime(healthStats.LastGC),
+		formatResponseTime(healthStats.GCPause),
+		cacheStats.Size,
+		humanizeBytes(cacheStats.BytesInMemory),
+		ratio(float64(cacheStats.Hits), float64(cacheStats.Hits+cacheStats.Misses))*100,
+		cacheStats.Hits,
+		cacheStats.Hits+cacheStats.Misses,
+		cacheStats.Evictions,
+		rawStats["revalidations"],
+		channelStats.current, channelStats.capacity, channelStats.utilization,
+		rawStats["total_requests"],
+		ratio(float64(rawStats["total_requests"]), time.Since(d.startTime).Seconds()),
+		rawStats["shed_requests"],
+		rawStats["coalesced_requests"],
+		perfStats.Goroutines,
+		humanizeBytes(perfStats.HeapAlloc),
+		perfStats.RequestRate,
+		formatResponseTime(perfStats.AvgResponseTime),
+		formatResponseTime(perfStats.P95),
+		formatResponseTime(perfStats.P99),
+		rlStats.Limited,
+		rlStats.ActiveKeys,
+		int(activeClientsPercent), // Convert to int for display
+		rlStats.Evictions,
+		rlStats.BurstUsage*100,
+		ratio(float64(validQueries), float64(valStats.TotalValidated))*100,
+		validQueries,
+		valStats.TotalValidated,
+		valStats.InvalidQueries,
+		valStats.InvalidResponses,
+		valStats.OversizedQueries,
+		valStats.ExcessQuestions,
+		d.upstreamStats(),
+		colorize("=========================", colorYellow),
+	)
+}
+
+// upstreamStats formats the health of each upstream resolver for the
+// runtime statistics block, or returns "" when not forwarding
+func (d *DNSListener) upstreamStats() string {
+	pool, ok := d.resolver.(*protocol.UpstreamPool)
+	if !ok {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("► Upstreams:\n")
+	for _, s := range pool.Stats() {
+		health := "healthy"
+		if !s.Healthy {
+			health = "backing off"
+		}
+		fmt.Fprintf(&sb, "  • %s: %s (%d ok, %d failed)\n", s.Addr, health, s.Successes, s.Failures)
 	}
+	return sb.String()
 }
 
 // Cache returns the cache instance for testing
@@ -0,0 +1,860 @@
+package dns_listener
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/cache"
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/health"
+	"github.com/exiguus/ns-checker/dns_listener/metrics"
+	"github.com/exiguus/ns-checker/dns_listener/network"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+	"github.com/exiguus/ns-checker/dns_listener/ratelimit"
+	"github.com/exiguus/ns-checker/dns_listener/types"
+)
+
+func newTestListener(t *testing.T, cfg *config.Config) *DNSListener {
+	t.Helper()
+	cfg.Port = "45356"
+	if cfg.LogPath == "" {
+		cfg.LogPath = filepath.Join(t.TempDir(), "test.log")
+	}
+	cfg.WorkerCount = 4
+	cfg.CacheTTL = time.Minute
+	cfg.CacheCleanupInterval = time.Minute
+	cfg.RateLimit = 1000
+	cfg.RateBurst = 100
+
+	listener, err := NewDNSListener(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	t.Cleanup(listener.Close)
+	return listener
+}
+
+func buildTestQuery(name string, qtype protocol.DNSType) []byte {
+	query := []byte{0xab, 0xcd, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	query = protocol.AppendName(query, name)
+	return append(query, byte(qtype>>8), byte(qtype), 0, 1)
+}
+
+func queryRCode(t *testing.T, d *DNSListener, name string) protocol.RCode {
+	t.Helper()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	response, err := d.HandleRequest(buildTestQuery(name, protocol.TypeA), addr, "udp")
+	if err != nil {
+		t.Fatalf("HandleRequest(%s) error = %v", name, err)
+	}
+	return protocol.RCode(response[3] & 0x0F)
+}
+
+func TestOverloadSheddingServesCacheHits(t *testing.T) {
+	d := newTestListener(t, &config.Config{ShedThreshold: 50})
+
+	// Warm the cache while the listener is idle
+	if rcode := queryRCode(t, d, "cached.example"); rcode != protocol.RCodeNoError {
+		t.Fatalf("cached.example rcode = %v, want NOERROR", rcode)
+	}
+
+	// Simulate a backlog filling the request channel past the threshold
+	for len(d.requestCh) < cap(d.requestCh)*3/4 {
+		d.requestCh <- types.Request{}
+	}
+	if !d.overloaded() {
+		t.Fatalf("overloaded() = false at %d%% utilization", d.getChannelStats().utilization)
+	}
+
+	if rcode := queryRCode(t, d, "cached.example"); rcode != protocol.RCodeNoError {
+		t.Errorf("cache hit rcode = %v under overload, want NOERROR", rcode)
+	}
+	if rcode := queryRCode(t, d, "uncached.example"); rcode != protocol.RCodeRefused {
+		t.Errorf("cache miss rcode = %v under overload, want REFUSED", rcode)
+	}
+	if shed := d.metrics.GetShedRequests(); shed != 1 {
+		t.Errorf("shed requests = %d, want 1", shed)
+	}
+
+	// Misses are served again once the backlog drains
+	for len(d.requestCh) > 0 {
+		<-d.requestCh
+	}
+	if rcode := queryRCode(t, d, "uncached.example"); rcode != protocol.RCodeNoError {
+		t.Errorf("cache miss rcode = %v after recovery, want NOERROR", rcode)
+	}
+}
+
+func TestMaxAnswerTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	if err := os.WriteFile(path, []byte("www.example.com. 31536000 IN A 192.0.2.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestListener(t, &config.Config{ZoneFile: path, MaxAnswerTTL: time.Hour})
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	response, err := d.HandleRequest(buildTestQuery("www.example.com", protocol.TypeA), addr, "udp")
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	// The answer is the last record: TTL sits 10 bytes before the end
+	ttl := binary.BigEndian.Uint32(response[len(response)-10 : len(response)-6])
+	if ttl != 3600 {
+		t.Errorf("answer TTL = %d, want 3600", ttl)
+	}
+}
+
+func TestCacheTTLFromAnswers(t *testing.T) {
+	query := buildTestQuery("www.example.com", protocol.TypeA)
+	answers := func(ttls ...uint32) []byte {
+		b := protocol.NewResponseBuilder(query, protocol.ResponseOptions{})
+		for i, ttl := range ttls {
+			b.AddAnswer("www.example.com", protocol.TypeA, protocol.ClassIN, ttl, []byte{192, 0, 2, byte(i)})
+		}
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		response []byte
+		want     time.Duration
+	}{
+		{"smallest answer ttl", config.Config{}, answers(600, 45, 300), 45 * time.Second},
+		{"raised to min", config.Config{CacheMinTTL: time.Minute}, answers(600, 45), time.Minute},
+		{"lowered to max", config.Config{CacheMaxTTL: 5 * time.Minute}, answers(3600, 7200), 5 * time.Minute},
+		{"max defaults to cache ttl", config.Config{}, answers(7200), time.Minute},
+		{"no answers", config.Config{}, protocol.CreateErrorResponse(query, protocol.RCodeNXDomain), time.Minute},
+		{"zero ttl", config.Config{}, answers(0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			d := newTestListener(t, &cfg)
+			d.updateCache(query, tt.response)
+
+			entry, ok := d.cache.Entry(cacheKeyFromQuery(query))
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("entry cached for %v, want none", entry.TTL)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("response not cached")
+			}
+			if entry.TTL > tt.want || entry.TTL < tt.want-time.Second {
+				t.Errorf("cache TTL = %v, want %v", entry.TTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveFailureServFail(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+	}{
+		{"no response", nil},
+		{"invalid response", []byte{0xab, 0xcd, 0x81}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestListener(t, &config.Config{})
+			d.resolve = func([]byte) []byte { return tt.response }
+
+			addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+			response, err := d.HandleRequest(buildTestQuery("broken.example", protocol.TypeA), addr, "udp")
+			if err != nil {
+				t.Fatalf("HandleRequest() error = %v, want a SERVFAIL response", err)
+			}
+			if response[2]&0x80 == 0 {
+				t.Errorf("flags = %08b, want QR set", response[2])
+			}
+			if rcode := protocol.RCode(response[3] & 0x0F); rcode != protocol.RCodeServFail {
+				t.Errorf("rcode = %v, want SERVFAIL", rcode)
+			}
+			if ancount := binary.BigEndian.Uint16(response[6:8]); ancount != 0 {
+				t.Errorf("ANCOUNT = %d, want 0", ancount)
+			}
+		})
+	}
+}
+
+func TestMultipleQuestionsFormErr(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	resolved := false
+	d.resolve = func(query []byte) []byte {
+		resolved = true
+		return nil
+	}
+
+	query := buildTestQuery("one.example", protocol.TypeA)
+	query = append(protocol.AppendName(query, "two.example"), 0, byte(protocol.TypeA), 0, 1)
+	query[5] = 2
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	response, err := d.HandleRequest(query, addr, "udp")
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v, want a FORMERR response", err)
+	}
+	if response[0] != 0xab || response[1] != 0xcd {
+		t.Errorf("response ID = %x, want abcd", response[:2])
+	}
+	if rcode := protocol.RCode(response[3] & 0x0F); rcode != protocol.RCodeFormErr {
+		t.Errorf("rcode = %v, want FORMERR", rcode)
+	}
+	if resolved {
+		t.Error("a multi-question query reached the resolver")
+	}
+}
+
+func TestAuthoritativeFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	if err := os.WriteFile(path, []byte("www.example.com. 300 IN A 192.0.2.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestListener(t, &config.Config{ZoneFile: path})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	flags := func(name string) protocol.DNSFlags {
+		t.Helper()
+		response, err := d.HandleRequest(buildTestQuery(name, protocol.TypeA), addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest(%s) error = %v", name, err)
+		}
+		return protocol.DNSFlags(binary.BigEndian.Uint16(response[2:4]))
+	}
+
+	if f := flags("www.example.com"); f&protocol.FlagAA == 0 {
+		t.Errorf("zone answer flags = %v, want AA set", f)
+	}
+
+	flags("cached.example")
+	hits := d.metrics.GetCacheHits()
+	if f := flags("cached.example"); f&protocol.FlagAA != 0 {
+		t.Errorf("cache hit flags = %v, want AA clear", f)
+	}
+	if d.metrics.GetCacheHits() != hits+1 {
+		t.Error("second query was not served from the cache")
+	}
+}
+
+func TestRecursionAvailableClearInLocalModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	if err := os.WriteFile(path, []byte("www.example.com. 300 IN A 192.0.2.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	for _, cfg := range []*config.Config{{}, {ZoneFile: path}} {
+		d := newTestListener(t, cfg)
+		for _, name := range []string{"www.example.com", "other.example"} {
+			response, err := d.HandleRequest(buildTestQuery(name, protocol.TypeA), addr, "udp")
+			if err != nil {
+				t.Fatalf("HandleRequest(%s) error = %v", name, err)
+			}
+			flags := protocol.DNSFlags(binary.BigEndian.Uint16(response[2:4]))
+			if flags&protocol.FlagRA != 0 {
+				t.Errorf("%s mode: %s flags = %v, want RA clear", d.mode(), name, flags)
+			}
+			if flags&protocol.FlagRD == 0 {
+				t.Errorf("%s mode: %s flags = %v, want RD copied from query", d.mode(), name, flags)
+			}
+		}
+	}
+}
+
+func TestLogWritabilityDegradesHealth(t *testing.T) {
+	logDir := filepath.Join(t.TempDir(), "logs")
+	d := newTestListener(t, &config.Config{LogPath: filepath.Join(logDir, "test.log")})
+
+	srv := health.NewServer("0", d.GetMetrics())
+	srv.RegisterCheck("log_writable", d.logWritable)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	get := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body := make(map[string]interface{})
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("GET %s: decode: %v", path, err)
+		}
+		return resp.StatusCode, body
+	}
+
+	if err := d.checkLogs(); err != nil {
+		t.Fatalf("checkLogs() error = %v", err)
+	}
+	if code, body := get("/healthz"); code != http.StatusOK || body["status"] != "healthy" {
+		t.Errorf("/healthz = %d %v, want 200 healthy", code, body["status"])
+	}
+	if _, stats := get("/stats"); stats["log_writable"] != true {
+		t.Errorf("/stats log_writable = %v, want true", stats["log_writable"])
+	}
+
+	// Replace the directory with a file: unwritable even when running as root
+	if err := os.RemoveAll(logDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.checkLogs(); err == nil {
+		t.Fatal("checkLogs() error = nil for unwritable log directory")
+	}
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || body["status"] != "degraded" {
+		t.Errorf("/healthz = %d %v, want 503 degraded", code, body["status"])
+	}
+	if _, stats := get("/stats"); stats["log_writable"] != false {
+		t.Errorf("/stats log_writable = %v, want false", stats["log_writable"])
+	}
+}
+
+func TestCacheDisabledResolvesEveryQuery(t *testing.T) {
+	d := newTestListener(t, &config.Config{CacheDisabled: true})
+
+	if got := cacheType(d.cache); got != "none" {
+		t.Errorf("cacheType() = %q, want none", got)
+	}
+
+	const queries = 3
+	for i := 0; i < queries; i++ {
+		if rcode := queryRCode(t, d, "repeat.example"); rcode != protocol.RCodeNoError {
+			t.Fatalf("query %d rcode = %v, want NOERROR", i, rcode)
+		}
+	}
+
+	if hits := d.metrics.GetCacheHits(); hits != 0 {
+		t.Errorf("cache hits = %d, want 0", hits)
+	}
+	if misses := d.metrics.GetCacheMisses(); misses != queries {
+		t.Errorf("cache misses = %d, want %d", misses, queries)
+	}
+	if stats := d.cache.Stats(); stats != (cache.Stats{}) {
+		t.Errorf("cache stats = %+v, want zero", stats)
+	}
+}
+
+func TestCacheFileSurvivesRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.gob")
+	d := newTestListener(t, &config.Config{CacheFile: file})
+	if rcode := queryRCode(t, d, "persist.example"); rcode != protocol.RCodeNoError {
+		t.Fatalf("rcode = %v, want NOERROR", rcode)
+	}
+	d.Close()
+	d.Close()
+
+	restarted := newTestListener(t, &config.Config{CacheFile: file})
+	if rcode := queryRCode(t, restarted, "persist.example"); rcode != protocol.RCodeNoError {
+		t.Fatalf("rcode = %v, want NOERROR", rcode)
+	}
+	if hits := restarted.metrics.GetCacheHits(); hits != 1 {
+		t.Errorf("cache hits after restart = %d, want 1", hits)
+	}
+	if _, err := os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary dump left behind: %v", err)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	d := newTestListener(t, &config.Config{StaleWhileRevalidate: time.Minute})
+	query := buildTestQuery("stale.example", protocol.TypeA)
+	key := cacheKeyFromQuery(query)
+
+	// Seed an entry that has just expired
+	d.cache.Set(key, d.createResponse(query), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		if rcode := queryRCode(t, d, "stale.example"); rcode != protocol.RCodeNoError {
+			t.Fatalf("query %d rcode = %v, want NOERROR", i, rcode)
+		}
+	}
+	if hits := d.metrics.GetCacheHits(); hits != 5 {
+		t.Errorf("cache hits = %d, want 5 served from the stale entry", hits)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for d.metrics.GetRevalidations() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, stale, ok := d.cache.(cache.StaleCache).GetStale(key); !ok || stale {
+		t.Errorf("entry stale = %v, ok = %v after revalidation, want fresh", stale, ok)
+	}
+
+	// Fresh again, so further hits must not trigger another refresh
+	queryRCode(t, d, "stale.example")
+	if n := d.metrics.GetRevalidations(); n != 1 {
+		t.Errorf("revalidations = %d, want 1", n)
+	}
+}
+
+func TestUDPResponseSize(t *testing.T) {
+	withOPT := func(query []byte, size uint16) []byte {
+		query[11]++
+		query = append(query, 0, 0, byte(protocol.TypeOPT), byte(size>>8), byte(size), 0, 0, 0, 0, 0, 0)
+		return query
+	}
+	tests := []struct {
+		name          string
+		maxUDP        int
+		protocol      string
+		edns          uint16
+		wantTruncated bool
+	}{
+		{"edns 4096 within limit", 4096, "UDP", 4096, false},
+		{"edns 4096 above default limit", 0, "UDP", 4096, true},
+		{"no edns", 4096, "UDP", 0, true},
+		{"tcp is never truncated", 0, "TCP", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestListener(t, &config.Config{EDNSMaxUDP: tt.maxUDP})
+			d.resolve = func(query []byte) []byte {
+				b := protocol.NewResponseBuilder(query, protocol.ResponseOptions{})
+				for i := 0; i < 100; i++ {
+					b.AddAnswer(b.Question(), protocol.TypeA, protocol.ClassIN, 60, []byte{192, 0, 2, byte(i)})
+				}
+				return b.Bytes()
+			}
+
+			query := buildTestQuery("big.example", protocol.TypeA)
+			if tt.edns != 0 {
+				query = withOPT(query, tt.edns)
+			}
+			addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+			response, err := d.HandleRequest(query, addr, tt.protocol)
+			if err != nil {
+				t.Fatalf("HandleRequest() error = %v", err)
+			}
+
+			truncated := response[2]&byte(protocol.FlagTC>>8) != 0
+			if truncated != tt.wantTruncated {
+				t.Errorf("TC = %v for %d bytes, want %v", truncated, len(response), tt.wantTruncated)
+			}
+			ancount := binary.BigEndian.Uint16(response[6:8])
+			if truncated && ancount != 0 || !truncated && ancount != 100 {
+				t.Errorf("ANCOUNT = %d with TC %v", ancount, truncated)
+			}
+		})
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	ts := httptest.NewServer(d.newHealthServer().Handler())
+	defer ts.Close()
+
+	get := func(path string) (int, health.HealthStatus) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var status health.HealthStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("GET %s: decode: %v", path, err)
+		}
+		return resp.StatusCode, status
+	}
+
+	if code, status := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz before start = %d %s, want 503", code, status.Status)
+	}
+	if code, status := get("/readyz"); code != http.StatusServiceUnavailable || status.Status != "not_ready" {
+		t.Errorf("/readyz before start = %d %s, want 503 not_ready", code, status.Status)
+	}
+
+	server := network.NewServer("0", d)
+	go server.Start(context.Background())
+	d.server.Store(server)
+	d.started.Store(true)
+	for deadline := time.Now().Add(time.Second); !server.Listening(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("DNS listeners did not come up")
+		}
+	}
+
+	code, status := get("/healthz")
+	if code != http.StatusOK || status.Status != "healthy" {
+		t.Errorf("/healthz = %d %s, want 200 healthy", code, status.Status)
+	}
+	if status.System == nil || status.System.Goroutines == 0 || status.System.Uptime == "" || status.System.HeapInUse == 0 {
+		t.Errorf("/healthz system = %+v, want uptime, goroutines and memory", status.System)
+	}
+	if code, status := get("/readyz"); code != http.StatusOK || status.Status != "ready" {
+		t.Errorf("/readyz = %d %s, want 200 ready", code, status.Status)
+	}
+
+	server.Stop()
+	if code, _ := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz after stop = %d, want 503", code)
+	}
+}
+
+func TestHealthServerShutdown(t *testing.T) {
+	srv := health.NewServer("0", metrics.NewCollector())
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Start() }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Start() error = %v after Shutdown", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Start() did not return after Shutdown")
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	d.rateLimiter = ratelimit.New(0.001, 2)
+
+	// The third query is over the burst and refused
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	for i := 0; i < 3; i++ {
+		_, err := d.HandleRequest(buildTestQuery("metrics.example", protocol.TypeA), addr, "udp")
+		if limited := err != nil; limited != (i == 2) {
+			t.Fatalf("query %d error = %v", i, err)
+		}
+	}
+
+	ts := httptest.NewServer(d.newHealthServer().Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"dns_requests_total 2",
+		"dns_cache_hits_total 1",
+		"dns_cache_misses_total 1",
+		"dns_errors_total 1",
+		"dns_rate_limited_total 1",
+		"dns_response_time_seconds_count 3",
+		"dns_cache_entries 1",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("/metrics lacks %q:\n%s", line, body)
+		}
+	}
+	for _, q := range responseQuantiles {
+		name := fmt.Sprintf(`dns_response_time_seconds{quantile="%v"} `, q)
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics lacks %s", name)
+		}
+	}
+}
+
+func TestQueryCaps(t *testing.T) {
+	d := newTestListener(t, &config.Config{MaxQuestions: 1, MaxQuerySize: 64})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	// Within the caps the query is answered
+	if _, err := d.HandleRequest(buildTestQuery("example.com", protocol.TypeA), addr, "udp"); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	overSize := buildTestQuery(strings.Repeat("a", 60)+".example.com", protocol.TypeA)
+	if response, err := d.HandleRequest(overSize, addr, "udp"); err == nil || response != nil {
+		t.Errorf("HandleRequest(%d bytes) = %v, %v, want it dropped", len(overSize), response, err)
+	}
+	// Cache hits are answered before validation, so use another name
+	overCount := buildTestQuery("uncached.example.com", protocol.TypeA)
+	overCount[5] = 2
+	if response, err := d.HandleRequest(overCount, addr, "udp"); err == nil || response != nil {
+		t.Errorf("HandleRequest(2 questions) = %v, %v, want it dropped", response, err)
+	}
+
+	stats := d.validator.GetStats()
+	if stats.OversizedQueries != 1 || stats.ExcessQuestions != 1 {
+		t.Errorf("stats = %+v, want one oversized query and one with excess questions", stats)
+	}
+}
+
+func TestStubResponse(t *testing.T) {
+	d := newTestListener(t, &config.Config{StubResponseIP: "192.0.2.53", StubResponseTTL: 30 * time.Second})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	response, err := d.HandleRequest(buildTestQuery("stub.example.com", protocol.TypeA), addr, "udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := net.IP(response[len(response)-4:]); !got.Equal(net.ParseIP("192.0.2.53")) {
+		t.Errorf("answer RDATA = %v, want 192.0.2.53", got)
+	}
+	// The TTL precedes RDLENGTH and the 4 bytes of RDATA
+	if ttl := binary.BigEndian.Uint32(response[len(response)-10:]); ttl != 30 {
+		t.Errorf("answer TTL = %d, want 30", ttl)
+	}
+}
+
+func TestStubResponseAAAA(t *testing.T) {
+	d := newTestListener(t, &config.Config{StubResponseIPv6: "2001:db8::53"})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	response, err := d.HandleRequest(buildTestQuery("stub.example.com", protocol.TypeAAAA), addr, "udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := protocol.CountAnswers(response, protocol.TypeAAAA); n != 1 {
+		t.Fatalf("AAAA answers = %d, want 1", n)
+	}
+	// TYPE, CLASS, TTL and RDLENGTH precede the 16 bytes of RDATA
+	rr := response[len(response)-26:]
+	if rrType := protocol.DNSType(binary.BigEndian.Uint16(rr[0:2])); rrType != protocol.TypeAAAA {
+		t.Errorf("answer type = %v, want AAAA", rrType)
+	}
+	if rdLen := binary.BigEndian.Uint16(rr[8:10]); rdLen != 16 {
+		t.Errorf("RDLENGTH = %d, want 16", rdLen)
+	}
+	if got := net.IP(rr[10:]); !got.Equal(net.ParseIP("2001:db8::53")) {
+		t.Errorf("answer RDATA = %v, want 2001:db8::53", got)
+	}
+}
+
+func TestCacheKeyFromQuery(t *testing.T) {
+	key := cacheKeyFromQuery(buildTestQuery("example.com", protocol.TypeA))
+
+	chaos := buildTestQuery("example.com", protocol.TypeA)
+	chaos[len(chaos)-1] = byte(protocol.ClassCH)
+	twoQuestions := buildTestQuery("example.com", protocol.TypeA)
+	twoQuestions[5] = 2
+	pointer := append(buildTestQuery("", protocol.TypeA)[:12], 0xc0, 0x0c, 0, 1, 0, 1)
+
+	tests := []struct {
+		name  string
+		query []byte
+		same  bool
+	}{
+		{"upper case name", buildTestQuery("EXAMPLE.COM", protocol.TypeA), true},
+		{"mixed case name", buildTestQuery("eXample.Com", protocol.TypeA), true},
+		{"other type", buildTestQuery("example.com", protocol.TypeAAAA), false},
+		{"other class", chaos, false},
+		{"other name", buildTestQuery("example.org", protocol.TypeA), false},
+		{"two questions", twoQuestions, false},
+		{"truncated", buildTestQuery("example.com", protocol.TypeA)[:20], false},
+		{"compressed name", pointer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheKeyFromQuery(tt.query); (got == key) != tt.same {
+				t.Errorf("key = %q, want same as %q: %v", got, key, tt.same)
+			}
+		})
+	}
+
+	// The previous key format is kept for lower case names, so saved
+	// caches stay valid
+	if want := "076578616d706c6503636f6d0000010001"; key != want {
+		t.Errorf("key = %q, want %q", key, want)
+	}
+	if got := cacheKeyFromQuery([]byte{1, 2}); !strings.HasPrefix(got, "malformed:") {
+		t.Errorf("key of a short query = %q, want the malformed prefix", got)
+	}
+}
+
+func TestSlidingRateLimitAlgorithm(t *testing.T) {
+	d := newTestListener(t, &config.Config{RateLimitAlgorithm: config.RateLimitSliding})
+	if _, ok := d.rateLimiter.(*ratelimit.SlidingWindow); !ok {
+		t.Fatalf("rateLimiter = %T, want *ratelimit.SlidingWindow", d.rateLimiter)
+	}
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	if _, err := d.HandleRequest(buildTestQuery("sliding.example", protocol.TypeA), addr, "udp"); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if stats := d.formatRuntimeStats(); !strings.Contains(stats, "Rate Limiting") {
+		t.Errorf("runtime stats without the rate limiter section:\n%s", stats)
+	}
+}
+
+func TestRateLimitEndpoint(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	d.rateLimiter = ratelimit.New(0.001, 2)
+	ts := httptest.NewServer(d.newHealthServer().Handler())
+	defer ts.Close()
+
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 12345}
+	for i := 0; i < 5; i++ {
+		d.HandleRequest(buildTestQuery("limited.example", protocol.TypeA), addr, "udp")
+	}
+
+	get := func(query string, v interface{}) int {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/ratelimit" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode
+	}
+
+	var top struct {
+		TopLimited []ratelimit.ClientStat `json:"top_limited"`
+	}
+	if status := get("", &top); status != http.StatusOK {
+		t.Fatalf("GET /ratelimit status = %d", status)
+	}
+	want := ratelimit.ClientStat{Key: "192.0.2.1", Allowed: 2, Limited: 3}
+	if len(top.TopLimited) != 1 || top.TopLimited[0] != want {
+		t.Errorf("top_limited = %+v, want [%+v]", top.TopLimited, want)
+	}
+
+	var stat ratelimit.ClientStat
+	if status := get("?client=192.0.2.1", &stat); status != http.StatusOK || stat != want {
+		t.Errorf("GET ?client = %d %+v, want 200 %+v", status, stat, want)
+	}
+	if status := get("?client=198.51.100.1", &stat); status != http.StatusNotFound {
+		t.Errorf("GET ?client of an unseen client status = %d, want 404", status)
+	}
+	if status := get("?n=0", &top); status != http.StatusBadRequest {
+		t.Errorf("GET ?n=0 status = %d, want 400", status)
+	}
+}
+
+func TestFormatRuntimeStats(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	stats := d.formatRuntimeStats()
+	for _, header := range []string{
+		"=== Runtime Statistics ===",
+		"► System Health:",
+		"► Cache:",
+		"► Processing:",
+		"► Performance:",
+		"► Rate Limiting:",
+		"► Validation:",
+	} {
+		if !strings.Contains(stats, header) {
+			t.Errorf("runtime stats without %q:\n%s", header, stats)
+		}
+	}
+}
+
+func TestFormatRuntimeStatsIdle(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	// No queries, lookups or validations yet, and no burst to relate
+	// clients to
+	d.config.RateBurst = 0
+
+	stats := d.formatRuntimeStats()
+	for _, bad := range []string{"NaN", "Inf"} {
+		if strings.Contains(stats, bad) {
+			t.Errorf("idle runtime stats contain %s:\n%s", bad, stats)
+		}
+	}
+	for _, want := range []string{"Hit Ratio: 0.0% (0/0)", "Success Rate: 0.0% (0/0 total)", "Active Clients: 0 (0% of limit)"} {
+		if !strings.Contains(stats, want) {
+			t.Errorf("idle runtime stats without %q:\n%s", want, stats)
+		}
+	}
+}
+
+func TestRatio(t *testing.T) {
+	if got := ratio(1, 0); got != 0 {
+		t.Errorf("ratio(1, 0) = %v, want 0", got)
+	}
+	if got := ratio(1, 4); got != 0.25 {
+		t.Errorf("ratio(1, 4) = %v, want 0.25", got)
+	}
+}
+
+func TestMonitorStatsToLog(t *testing.T) {
+	t.Setenv("FORCE_COLOR", "1")
+	dir := t.TempDir()
+	d := newTestListener(t, &config.Config{
+		LogPath:       filepath.Join(dir, "stats.log"),
+		StatsInterval: 10 * time.Millisecond,
+		StatsOutput:   config.StatsOutputLog,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	d.monitorStats(ctx)
+
+	// The file sink prefixes the log name with the date
+	files, _ := filepath.Glob(filepath.Join(dir, "*stats.log"))
+	if len(files) != 1 {
+		t.Fatalf("log files = %v, want one", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "=== Runtime Statistics ===") {
+		t.Fatalf("log = %q, want the statistics block", data)
+	}
+	if strings.Contains(string(data), "\033[") {
+		t.Errorf("statistics in the log contain escape codes:\n%q", data)
+	}
+}
+
+func TestDispatchDroppedGetsServFail(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	// The processor is not started, so its queue only fills up
+	for d.processor.Process(types.Request{}) == nil {
+	}
+
+	query := buildTestQuery("dropped.example", protocol.TypeA)
+	response, err := d.dispatch(query, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}, "udp")
+	if err != nil {
+		t.Fatalf("dispatch() error = %v, want a SERVFAIL answer", err)
+	}
+	if len(response) < 12 || response[0] != query[0] || response[1] != query[1] || protocol.RCode(response[3]&0x0F) != protocol.RCodeServFail {
+		t.Errorf("answer = %x, want SERVFAIL with the query ID", response)
+	}
+	if got := d.metrics.GetQueueDropped(); got == 0 {
+		t.Error("GetQueueDropped() = 0 after dropping")
+	}
+}
+
+func TestDispatchWaitsForQueueRoom(t *testing.T) {
+	const wait = 100 * time.Millisecond
+	d := newTestListener(t, &config.Config{QueueWait: wait})
+	for d.processor.Process(types.Request{}) == nil {
+	}
+
+	// A full queue holds the query for QueueWait before dropping it
+	start := time.Now()
+	response, err := d.dispatch(buildTestQuery("waited.example", protocol.TypeA), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}, "udp")
+	if elapsed := time.Since(start); elapsed < wait {
+		t.Errorf("dispatch() returned after %v, want it to wait %v", elapsed, wait)
+	}
+	if err != nil || len(response) < 12 || protocol.RCode(response[3]&0x0F) != protocol.RCodeServFail {
+		t.Errorf("dispatch() = %x, %v, want SERVFAIL after waiting", response, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/exiguus/ns-checker/dns_listener"
 	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
 	"github.com/exiguus/ns-checker/internal/testflags"
 )
 
@@ -132,6 +133,103 @@ func TestRateLimiting(t *testing.T) {
 	}
 }
 
+func TestRateLimitRefused(t *testing.T) {
+	tc, cleanup := setupTest(t)
+	defer cleanup()
+
+	cfg := createTestConfig(tc)
+	cfg.RateLimit = 1
+	cfg.RateBurst = 1
+	cfg.RateLimitResponse = config.RateLimitRefused
+
+	listener, cancel := setupTestListener(t, cfg)
+	defer cancel()
+	defer listener.Close()
+
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
+	query := []byte{
+		0x12, 0x34, // ID
+		0x01, 0x00, // Standard query
+		0x00, 0x01, // One question
+		0x00, 0x00, // No answers
+		0x00, 0x00, // No authority
+		0x00, 0x00, // No additional
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+		0x03, 'c', 'o', 'm',
+		0x00,       // Root label
+		0x00, 0x01, // Type A
+		0x00, 0x01, // Class IN
+	}
+
+	if _, err := listener.HandleRequest(query, addr, "UDP"); err != nil {
+		t.Fatalf("First request should succeed, got error: %v", err)
+	}
+
+	resp, err := listener.HandleRequest(query, addr, "UDP")
+	if err != nil {
+		t.Fatalf("Rate limited request should be refused, got error: %v", err)
+	}
+	if len(resp) < 12 {
+		t.Fatalf("Rate limited response too short: %x", resp)
+	}
+	if resp[0] != 0x12 || resp[1] != 0x34 {
+		t.Errorf("ID = %#x%02x, want 0x1234", resp[0], resp[1])
+	}
+	if resp[2]&0x80 == 0 {
+		t.Errorf("flags = %08b, want QR set", resp[2])
+	}
+	if rcode := protocol.RCode(resp[3] & 0x0F); rcode != protocol.RCodeRefused {
+		t.Errorf("rcode = %v, want REFUSED", rcode)
+	}
+}
+
+func TestRateLimitAllowlist(t *testing.T) {
+	tc, cleanup := setupTest(t)
+	defer cleanup()
+
+	cfg := createTestConfig(tc)
+	cfg.RateLimit = 1
+	cfg.RateBurst = 1
+	cfg.RateLimitAllowlist = "127.0.0.0/8,::1/128"
+
+	listener, cancel := setupTestListener(t, cfg)
+	defer cancel()
+	defer listener.Close()
+
+	query := []byte{
+		0x00, 0x01, // ID
+		0x01, 0x00, // Standard query
+		0x00, 0x01, // One question
+		0x00, 0x00, // No answers
+		0x00, 0x00, // No authority
+		0x00, 0x00, // No additional
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+		0x03, 'c', 'o', 'm',
+		0x00,       // Root label
+		0x00, 0x01, // Type A
+		0x00, 0x01, // Class IN
+	}
+
+	// Allowlisted sources are never limited
+	for _, addr := range []net.Addr{
+		&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345},
+		&net.TCPAddr{IP: net.ParseIP("::1"), Port: 12345},
+	} {
+		for i := 0; i < 3; i++ {
+			if _, err := listener.HandleRequest(query, addr, "UDP"); err != nil {
+				t.Errorf("Request %d from %v should not be limited, got error: %v", i+1, addr, err)
+			}
+		}
+	}
+
+	// Others still are
+	addr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}
+	listener.HandleRequest(query, addr, "UDP")
+	if _, err := listener.HandleRequest(query, addr, "UDP"); err == nil {
+		t.Error("Second request from outside the allowlist should be rate limited")
+	}
+}
+
 func setupTestListener(t *testing.T, cfg *config.Config) (*dns_listener.DNSListener, context.CancelFunc) {
 	t.Helper()
 	_, cancel := context.WithCancel(context.Background())
@@ -276,3 +374,52 @@ func TestCacheExpiration(t *testing.T) {
 		t.Errorf("Expected 2 cache misses, got %d", stats.Misses)
 	}
 }
+
+func TestResponseHooks(t *testing.T) {
+	cfg := &config.Config{
+		Port:                 "25353",
+		LogPath:              filepath.Join(t.TempDir(), "dns.log"),
+		CacheTTL:             time.Minute,
+		CacheCleanupInterval: time.Minute,
+		RateLimit:            100,
+		RateBurst:            10,
+		WorkerCount:          4,
+	}
+
+	var seen string
+	rewrite := func(q *protocol.ParsedMessage, resp []byte) []byte {
+		seen = q.Question.Name
+		out := append([]byte(nil), resp...)
+		copy(out[len(out)-4:], net.ParseIP("192.0.2.55").To4())
+		return out
+	}
+
+	listener, err := dns_listener.NewDNSListener(cfg, dns_listener.WithResponseHooks(rewrite))
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	query := []byte{
+		0x00, 0x02, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x04, 'h', 'o', 'o', 'k',
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+		0x00,
+		0x00, 0x01, 0x00, 0x01,
+	}
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
+
+	// Both the miss and the cache hit pass through the hook
+	for i := 0; i < 2; i++ {
+		resp, err := listener.HandleRequest(query, addr, "UDP")
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		if got := net.IP(resp[len(resp)-4:]); !got.Equal(net.ParseIP("192.0.2.55")) {
+			t.Errorf("request %d answer = %s, want rewritten 192.0.2.55", i, got)
+		}
+	}
+	if seen != "hook.example" {
+		t.Errorf("hook saw question %q, want hook.example", seen)
+	}
+}
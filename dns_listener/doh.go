@@ -0,0 +1,130 @@
+package dns_listener
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	dnserr "github.com/exiguus/ns-checker/dns_listener/errors"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// dohPath is the endpoint DNS over HTTPS clients query (RFC 8484)
+const dohPath = "/dns-query"
+
+// maxDoHMessage bounds the size of a DNS message in a DoH request
+const maxDoHMessage = 65535
+
+// dohHandler answers DNS over HTTPS queries sent as POST with a
+// application/dns-message body or as GET with a base64url dns parameter.
+// Queries take the same path as UDP and TCP ones, so rate limiting,
+// validation and the cache apply.
+func (d *DNSListener) dohHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query []byte
+		switch r.Method {
+		case http.MethodGet:
+			param := r.URL.Query().Get("dns")
+			if param == "" {
+				http.Error(w, "missing dns parameter", http.StatusBadRequest)
+				return
+			}
+			// Clients must omit the padding, but tolerate it
+			var err error
+			if query, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "=")); err != nil {
+				http.Error(w, "dns parameter is not base64url", http.StatusBadRequest)
+				return
+			}
+		case http.MethodPost:
+			if ct := r.Header.Get("Content-Type"); ct != protocol.DoHMediaType {
+				http.Error(w, "unsupported content type "+ct, http.StatusUnsupportedMediaType)
+				return
+			}
+			var err error
+			if query, err = io.ReadAll(io.LimitReader(r.Body, maxDoHMessage+1)); err != nil {
+				http.Error(w, "reading body failed", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(query) > maxDoHMessage {
+			http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		response, err := d.HandleRequest(query, httpClientAddr(r), "DoH")
+		if err != nil {
+			status := http.StatusInternalServerError
+			if dnserr.Is(err, dnserr.ValidationError) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if response == nil {
+			http.Error(w, "no response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", protocol.DoHMediaType)
+		// The answer stays fresh no longer than its shortest TTL
+		if ttl, ok := protocol.MinAnswerTTL(response); ok {
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(ttl.Seconds())))
+		}
+		w.Write(response)
+	})
+}
+
+// httpClientAddr returns the client of r as a net.Addr for rate limiting
+// and the access log, falling back to localhost when RemoteAddr is unset
+func httpClientAddr(r *http.Request) net.Addr {
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return net.TCPAddrFromAddrPort(ap)
+	}
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+// newDoHServer builds the HTTP server for DOH_PORT
+func (d *DNSListener) newDoHServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(dohPath, d.dohHandler())
+	return &http.Server{
+		Addr:              net.JoinHostPort(d.config.BindAddress, d.config.DoHPort),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serveDoH serves srv over HTTPS with the DNS over TLS certificate when one
+// is configured, else over plain HTTP for a TLS terminating proxy
+func (d *DNSListener) serveDoH(srv *http.Server) {
+	var err error
+	if d.config.TLSCertFile != "" {
+		fmt.Printf("DoH server listening on https://%s%s\n", srv.Addr, dohPath)
+		err = srv.ListenAndServeTLS(d.config.TLSCertFile, d.config.TLSKeyFile)
+	} else {
+		fmt.Printf("DoH server listening on http://%s%s\n", srv.Addr, dohPath)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Printf("DoH server failed: %v\n", err)
+	}
+}
+
+// stopDoH waits for the DoH requests in flight until ctx is done
+func (d *DNSListener) stopDoH(ctx context.Context) error {
+	if d.doh == nil {
+		return nil
+	}
+	return d.doh.Shutdown(ctx)
+}
@@ -0,0 +1,83 @@
+package dns_listener
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestDoHHandler(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	handler := d.dohHandler()
+	query := buildTestQuery("doh.example.com", protocol.TypeA)
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+	}{
+		{"get", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, dohPath+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+		}},
+		{"post", func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader(query))
+			r.Header.Set("Content-Type", protocol.DoHMediaType)
+			return r
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request())
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != protocol.DoHMediaType {
+				t.Errorf("Content-Type = %q, want %q", ct, protocol.DoHMediaType)
+			}
+			response := rec.Body.Bytes()
+			if len(response) < 12 || response[0] != query[0] || response[1] != query[1] {
+				t.Fatalf("response does not answer the query: % x", response)
+			}
+			ttl, ok := protocol.MinAnswerTTL(response)
+			if !ok {
+				t.Fatal("response has no answer")
+			}
+			if want := fmt.Sprintf("max-age=%d", int(ttl.Seconds())); rec.Header().Get("Cache-Control") != want {
+				t.Errorf("Cache-Control = %q, want %q", rec.Header().Get("Cache-Control"), want)
+			}
+		})
+	}
+}
+
+func TestDoHHandlerRejects(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	handler := d.dohHandler()
+	query := buildTestQuery("doh.example.com", protocol.TypeA)
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		want    int
+	}{
+		{"get without dns", httptest.NewRequest(http.MethodGet, dohPath, nil), http.StatusBadRequest},
+		{"get with bad base64", httptest.NewRequest(http.MethodGet, dohPath+"?dns=!!", nil), http.StatusBadRequest},
+		{"post without content type", httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader(query)), http.StatusUnsupportedMediaType},
+		{"put", httptest.NewRequest(http.MethodPut, dohPath, nil), http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package dns_listener
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// upstreamQuery prepares query for forwarding. With ECS enabled it carries
+// the client's subnet: an option sent by the client is kept, narrowed to
+// the configured prefix, otherwise one is derived from addr.
+func (d *DNSListener) upstreamQuery(query []byte, addr net.Addr) []byte {
+	if !d.config.ECSEnabled {
+		return query
+	}
+
+	ecs, found, err := protocol.ClientSubnetOf(query)
+	if err != nil {
+		return query
+	}
+	switch {
+	case found && ecs.SourcePrefix == 0:
+		// The client opted out of revealing its subnet
+		return query
+	case found:
+		ecs = ecs.Truncate(d.config.ECSPrefixV4, d.config.ECSPrefixV6)
+	default:
+		ip := clientIP(addr)
+		if ip == nil {
+			return query
+		}
+		ecs = protocol.NewClientSubnet(ip, d.config.ECSPrefixV4, d.config.ECSPrefixV6)
+	}
+
+	out, err := protocol.SetClientSubnet(query, ecs)
+	if err != nil {
+		return query
+	}
+	return out
+}
+
+// subnetKey returns the client subnet carried by an upstream query as a
+// suffix for the coalescing key, so that only queries sent with the same
+// subnet share an answer, or "" when it carries none
+func subnetKey(query []byte) string {
+	ecs, found, err := protocol.ClientSubnetOf(query)
+	if err != nil || !found {
+		return ""
+	}
+	return fmt.Sprintf("/ecs:%s/%d", ecs.Address, ecs.SourcePrefix)
+}
+
+// scopedAnswer reports whether response was tailored to the client subnet
+// of its query, that is its ECS scope is non-zero. Such answers must not be
+// cached for other clients.
+func scopedAnswer(response []byte) bool {
+	ecs, found, err := protocol.ClientSubnetOf(response)
+	return err == nil && found && ecs.ScopePrefix > 0
+}
+
+// matchEDNS removes the OPT record from response when query carried none,
+// such as the one added to send the client subnet upstream
+func matchEDNS(query, response []byte) []byte {
+	if opt, err := protocol.ParseOPT(query); err != nil || opt != nil || response == nil {
+		return response
+	}
+	if out, err := protocol.RemoveOPT(response); err == nil {
+		return out
+	}
+	return response
+}
+
+func clientIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package dns_listener
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestUpstreamQueryClientSubnet(t *testing.T) {
+	d := newTestListener(t, &config.Config{ECSEnabled: true, ECSPrefixV4: 24, ECSPrefixV6: 56})
+	query := buildTestQuery("cdn.example", protocol.TypeA)
+
+	tests := []struct {
+		name       string
+		query      []byte
+		addr       net.Addr
+		wantAddr   string
+		wantPrefix uint8
+	}{
+		{
+			name:       "derived from IPv4 source",
+			query:      query,
+			addr:       &net.UDPAddr{IP: net.ParseIP("198.51.100.77"), Port: 5353},
+			wantAddr:   "198.51.100.0",
+			wantPrefix: 24,
+		},
+		{
+			name:       "derived from IPv6 source",
+			query:      query,
+			addr:       &net.TCPAddr{IP: net.ParseIP("2001:db8:1:2ff::1"), Port: 5353},
+			wantAddr:   "2001:db8:1:200::",
+			wantPrefix: 56,
+		},
+		{
+			name:       "client option narrowed",
+			query:      withClientSubnet(t, query, "203.0.113.9", 32),
+			addr:       &net.UDPAddr{IP: net.ParseIP("198.51.100.77"), Port: 5353},
+			wantAddr:   "203.0.113.0",
+			wantPrefix: 24,
+		},
+		{
+			name:       "client opt-out kept",
+			query:      withClientSubnet(t, query, "0.0.0.0", 0),
+			addr:       &net.UDPAddr{IP: net.ParseIP("198.51.100.77"), Port: 5353},
+			wantAddr:   "0.0.0.0",
+			wantPrefix: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecs, found, err := protocol.ClientSubnetOf(d.upstreamQuery(tt.query, tt.addr))
+			if err != nil || !found {
+				t.Fatalf("outgoing query ECS = %v, %v, want option", found, err)
+			}
+			if ecs.SourcePrefix != tt.wantPrefix || !ecs.Address.Equal(net.ParseIP(tt.wantAddr)) {
+				t.Errorf("outgoing ECS = %s/%d, want %s/%d", ecs.Address, ecs.SourcePrefix, tt.wantAddr, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestUpstreamQueryWithoutECS(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	query := buildTestQuery("cdn.example", protocol.TypeA)
+
+	out := d.upstreamQuery(query, &net.UDPAddr{IP: net.ParseIP("198.51.100.77"), Port: 5353})
+	if string(out) != string(query) {
+		t.Errorf("upstreamQuery() modified the query with ECS disabled")
+	}
+}
+
+func withClientSubnet(t *testing.T, query []byte, ip string, prefix int) []byte {
+	t.Helper()
+	msg, err := protocol.SetClientSubnet(query, protocol.NewClientSubnet(net.ParseIP(ip), prefix, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// startECSUpstream runs a UDP resolver answering A queries with the first
+// address of the client subnet they carry, echoing the option with scope
+// as its scope prefix. It counts the queries seen.
+func startECSUpstream(t *testing.T, scope uint8) (string, *int32) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var queries int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&queries, 1)
+			ecs, found, err := protocol.ClientSubnetOf(buf[:n])
+			if err != nil || !found {
+				continue
+			}
+			ip := ecs.Address.To4()
+			b := protocol.NewResponseBuilder(buf[:n], protocol.ResponseOptions{RecursionAvailable: true})
+			b.AddAnswer(b.Question(), protocol.TypeA, protocol.ClassIN, 300, []byte{ip[0], ip[1], ip[2], 1})
+			ecs.ScopePrefix = scope
+			response, err := protocol.SetClientSubnet(b.Bytes(), ecs)
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestScopedAnswersNotShared(t *testing.T) {
+	upstream, queries := startECSUpstream(t, 24)
+	d := newTestListener(t, &config.Config{
+		UpstreamDNS: upstream, UpstreamTimeout: time.Second,
+		ECSEnabled: true, ECSPrefixV4: 24, ECSPrefixV6: 56,
+	})
+
+	clients := []struct {
+		addr string
+		want string
+	}{
+		{"198.51.100.7", "\xc6\x33\x64\x01"}, // 198.51.100.1
+		{"203.0.113.9", "\xcb\x00\x71\x01"},  // 203.0.113.1
+		{"198.51.100.8", "\xc6\x33\x64\x01"},
+	}
+	for _, c := range clients {
+		query := buildTestQuery("cdn.example", protocol.TypeA)
+		response, err := d.HandleRequest(query, &net.UDPAddr{IP: net.ParseIP(c.addr), Port: 5353}, "udp")
+		if err != nil {
+			t.Fatalf("%s: HandleRequest() error = %v", c.addr, err)
+		}
+		if !strings.Contains(string(response), c.want) {
+			t.Errorf("%s: response %x lacks the answer for its subnet", c.addr, response)
+		}
+		// The client sent no OPT record, so it gets none back
+		if opt, err := protocol.ParseOPT(response); err != nil || opt != nil {
+			t.Errorf("%s: response carries an OPT record the client did not send", c.addr)
+		}
+	}
+	if got := atomic.LoadInt32(queries); got != 3 {
+		t.Errorf("upstream saw %d queries, want 3 with scoped answers never cached", got)
+	}
+}
+
+func TestUnscopedAnswerCached(t *testing.T) {
+	upstream, queries := startECSUpstream(t, 0)
+	d := newTestListener(t, &config.Config{
+		UpstreamDNS: upstream, UpstreamTimeout: time.Second,
+		ECSEnabled: true, ECSPrefixV4: 24, ECSPrefixV6: 56,
+	})
+
+	for _, ip := range []string{"198.51.100.7", "203.0.113.9"} {
+		query := buildTestQuery("global.example", protocol.TypeA)
+		response, err := d.HandleRequest(query, &net.UDPAddr{IP: net.ParseIP(ip), Port: 5353}, "udp")
+		if err != nil {
+			t.Fatalf("%s: HandleRequest() error = %v", ip, err)
+		}
+		if opt, _ := protocol.ParseOPT(response); opt != nil {
+			t.Errorf("%s: cached response carries an OPT record the client did not send", ip)
+		}
+	}
+	if got := atomic.LoadInt32(queries); got != 1 {
+		t.Errorf("upstream saw %d queries, want 1 with the scope 0 answer cached", got)
+	}
+}
+
+func TestSubnetKey(t *testing.T) {
+	query := buildTestQuery("cdn.example", protocol.TypeA)
+	a := subnetKey(withClientSubnet(t, query, "198.51.100.7", 24))
+	b := subnetKey(withClientSubnet(t, query, "203.0.113.9", 24))
+	if a == "" || a == b {
+		t.Errorf("subnetKey() = %q, %q, want distinct keys per subnet", a, b)
+	}
+	if got := subnetKey(query); got != "" {
+		t.Errorf("subnetKey() without ECS = %q, want empty", got)
+	}
+}
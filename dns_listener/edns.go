@@ -0,0 +1,29 @@
+package dns_listener
+
+import (
+	"strings"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// fitUDP truncates response to the payload size the query advertises in
+// its OPT record, capped at EDNS_MAX_UDP. Queries without EDNS get 512
+// bytes.
+func (d *DNSListener) fitUDP(query, response []byte) []byte {
+	limit := protocol.MinUDPSize
+	if msg, err := protocol.ParseMessage(query); err == nil {
+		limit = msg.EDNS.PayloadSize()
+	}
+	max := d.config.EDNSMaxUDP
+	if max == 0 {
+		max = protocol.DefaultUDPSize
+	}
+	if limit > max {
+		limit = max
+	}
+	return protocol.Truncate(response, limit)
+}
+
+func isUDP(protocolType string) bool {
+	return strings.EqualFold(protocolType, "udp")
+}
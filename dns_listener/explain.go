@@ -0,0 +1,116 @@
+package dns_listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// ErrExplainDisabled is returned by Explain unless debug mode is on
+var ErrExplainDisabled = errors.New("explain is only available in debug mode")
+
+// explainLayers maps the trace event that settles a query to the layer
+// reported by Explain
+var explainLayers = map[string]string{
+	"rate_limited":              "rate_limit",
+	"any_answer":                "any",
+	"blocklist_answer":          "blocklist",
+	"rules_answer":              "rules",
+	"hosts_answer":              "hosts",
+	"zone_answer":               "zone",
+	"cache_hit":                 "cache",
+	"validation_error":          "validator",
+	"shed":                      "shed",
+	"upstream_saturated":        "upstream_limit",
+	"resolver_answer":           "resolver",
+	"response_creation_error":   "resolver",
+	"response_validation_error": "resolver",
+}
+
+// Explanation describes the path a query took through the listener
+type Explanation struct {
+	Layer       string         `json:"layer"`
+	CacheHit    bool           `json:"cache_hit"`
+	RateLimited bool           `json:"rate_limited"`
+	RCode       string         `json:"rcode,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Duration    time.Duration  `json:"duration"`
+	Events      []ExplainEvent `json:"events"`
+}
+
+// ExplainEvent is one step of an Explanation. Offset is measured from the
+// start of the query.
+type ExplainEvent struct {
+	Name   string        `json:"name"`
+	Offset time.Duration `json:"offset"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Explain resolves query like HandleRequest and reports which layer
+// produced the answer, built from the query's trace events. The query
+// counts against the rate limit and may fill the cache like any other.
+func (d *DNSListener) Explain(query []byte, addr net.Addr) (*Explanation, error) {
+	if !d.config.Debug {
+		return nil, ErrExplainDisabled
+	}
+
+	ctx := d.tracer.StartTrace(context.Background())
+	response, err := d.handleTraced(ctx, query, addr, "explain")
+	trace := d.tracer.Finish(ctx)
+
+	e := &Explanation{Duration: time.Since(trace.StartTime)}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if len(response) >= 4 {
+		e.RCode = protocol.RCode(response[3] & 0x0F).String()
+	}
+	for _, ev := range trace.Events {
+		event := ExplainEvent{Name: ev.Name, Offset: ev.Timestamp.Sub(trace.StartTime)}
+		if ev.Error != nil {
+			event.Error = ev.Error.Error()
+		}
+		e.Events = append(e.Events, event)
+	}
+	e.Layer = traceLayer(trace.Events)
+	e.CacheHit = e.Layer == "cache"
+	e.RateLimited = e.Layer == "rate_limit"
+	return e, nil
+}
+
+// explainHandler serves Explain over HTTP for GET ?name=example.com&type=A
+func (d *DNSListener) explainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing name", http.StatusBadRequest)
+			return
+		}
+		qtype := protocol.TypeA
+		if t := r.URL.Query().Get("type"); t != "" {
+			var ok bool
+			if qtype, ok = protocol.ParseDNSType(t); !ok {
+				http.Error(w, "unknown type "+t, http.StatusBadRequest)
+				return
+			}
+		}
+
+		query := []byte{0, 0, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+		query = protocol.AppendName(query, name)
+		query = append(query, byte(qtype>>8), byte(qtype), 0, 1)
+
+		// Rate limiting applies to the HTTP client as it would to a DNS one
+		e, err := d.Explain(query, httpClientAddr(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+}
@@ -0,0 +1,64 @@
+package dns_listener
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestExplainBlocklist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ads.example\n"))
+	}))
+	defer srv.Close()
+
+	d := newTestListener(t, &config.Config{BlocklistURL: srv.URL, Debug: true})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	e, err := d.Explain(buildTestQuery("ads.example", protocol.TypeA), addr)
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if e.Layer != "blocklist" {
+		t.Errorf("Layer = %q, want blocklist", e.Layer)
+	}
+	if e.RCode != protocol.RCodeNXDomain.String() {
+		t.Errorf("RCode = %q, want %s", e.RCode, protocol.RCodeNXDomain)
+	}
+	if e.CacheHit || e.RateLimited {
+		t.Errorf("CacheHit = %v, RateLimited = %v, want false", e.CacheHit, e.RateLimited)
+	}
+	if len(e.Events) == 0 || e.Events[len(e.Events)-1].Name != "request_complete" {
+		t.Errorf("Events = %v, want trace ending in request_complete", e.Events)
+	}
+
+	// The same answer over HTTP
+	ts := httptest.NewServer(d.explainHandler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "?name=ads.example&type=aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got Explanation
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Layer != "blocklist" {
+		t.Errorf("GET explain layer = %q, want blocklist", got.Layer)
+	}
+}
+
+func TestExplainRequiresDebug(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	if _, err := d.Explain(buildTestQuery("example.com", protocol.TypeA), addr); !errors.Is(err, ErrExplainDisabled) {
+		t.Errorf("Explain() error = %v, want ErrExplainDisabled", err)
+	}
+}
@@ -0,0 +1,62 @@
+package dns_listener
+
+import (
+	"net"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// forwarding reports whether cache misses go to an upstream resolver
+func (d *DNSListener) forwarding() bool {
+	return d.resolver != nil
+}
+
+// forward resolves query through the upstream resolver. Failures and
+// timeouts are answered with SERVFAIL.
+func (d *DNSListener) forward(query []byte) []byte {
+	response, err := d.resolver.Resolve(query)
+	if err != nil {
+		d.logger.Error("Upstream query failed", err)
+		return d.errorResponse(query, protocol.RCodeServFail)
+	}
+	return d.capTTLs(response)
+}
+
+// forwardQuery prepares query for the resolve step; only forwarded queries
+// carry the client subnet
+func (d *DNSListener) forwardQuery(query []byte, addr net.Addr) []byte {
+	if !d.forwarding() {
+		return query
+	}
+	return d.upstreamQuery(query, addr)
+}
+
+// fromCache answers query with a cached response stored age ago. Forwarded
+// answers are replayed under the query's ID with their TTLs lowered by the
+// age; stub answers are built afresh.
+func (d *DNSListener) fromCache(query, cached []byte, age time.Duration) []byte {
+	if !d.forwarding() {
+		return d.createResponse(query)
+	}
+	response := make([]byte, len(cached))
+	copy(response, cached)
+	response[0], response[1] = query[0], query[1]
+	// The entry may have been stored for the name in another case; echo
+	// the question as asked, which is the same length
+	if key, ok := questionKey(query); ok && len(response) >= 12+len(key) {
+		copy(response[12:], query[12:12+len(key)])
+	}
+	if age >= time.Second {
+		protocol.AgeTTLs(response, uint32(age/time.Second))
+	}
+	return response
+}
+
+// cacheable reports whether response may be stored. SERVFAIL marks a
+// transient upstream failure and is retried on the next query, and a
+// truncated answer would keep TCP clients from ever getting the full one.
+func cacheable(response []byte) bool {
+	return len(response) >= 12 && protocol.RCode(response[3]&0x0F) != protocol.RCodeServFail &&
+		response[2]&byte(protocol.FlagTC>>8) == 0
+}
@@ -0,0 +1,206 @@
+package dns_listener
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// startUpstream runs a UDP resolver answering every query with an A record
+// for 192.0.2.53, or dropping it when silent. It counts the queries seen.
+func startUpstream(t *testing.T, silent bool) (string, *int32) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var queries int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&queries, 1)
+			if silent {
+				continue
+			}
+			b := protocol.NewResponseBuilder(buf[:n], protocol.ResponseOptions{RecursionAvailable: true})
+			b.AddAnswer(b.Question(), protocol.TypeA, protocol.ClassIN, 120, []byte{192, 0, 2, 53})
+			conn.WriteTo(b.Bytes(), addr)
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestForwardToUpstream(t *testing.T) {
+	upstream, queries := startUpstream(t, false)
+	d := newTestListener(t, &config.Config{UpstreamDNS: upstream, UpstreamTimeout: time.Second})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	for i, id := range []byte{0x01, 0x02} {
+		query := buildTestQuery("forward.example", protocol.TypeA)
+		query[1] = id
+		response, err := d.HandleRequest(query, addr, "udp")
+		if err != nil {
+			t.Fatalf("query %d: HandleRequest() error = %v", i, err)
+		}
+		if response[0] != query[0] || response[1] != query[1] {
+			t.Errorf("query %d: response ID %x, want %x", i, response[:2], query[:2])
+		}
+		if !strings.Contains(string(response), "\xc0\x00\x02\x35") {
+			t.Errorf("query %d: response %x lacks the upstream's answer", i, response)
+		}
+	}
+
+	// The second query is a cache hit
+	if got := atomic.LoadInt32(queries); got != 1 {
+		t.Errorf("upstream saw %d queries, want 1", got)
+	}
+	if mode := d.mode(); mode != "forward" {
+		t.Errorf("mode() = %q, want forward", mode)
+	}
+}
+
+func TestTruncatedAnswerNotCached(t *testing.T) {
+	// The upstream truncates every answer and has no TCP listener to retry
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var queries int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&queries, 1)
+			b := protocol.NewResponseBuilder(buf[:n], protocol.ResponseOptions{RecursionAvailable: true})
+			b.SetFlags(protocol.FlagTC)
+			conn.WriteTo(b.Bytes(), addr)
+		}
+	}()
+
+	d := newTestListener(t, &config.Config{UpstreamDNS: conn.LocalAddr().String(), UpstreamTimeout: time.Second})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	for i := 0; i < 2; i++ {
+		response, err := d.HandleRequest(buildTestQuery("truncated.example", protocol.TypeA), addr, "udp")
+		if err != nil {
+			t.Fatalf("query %d: HandleRequest() error = %v", i, err)
+		}
+		if response[2]&byte(protocol.FlagTC>>8) == 0 {
+			t.Errorf("query %d: TC not set on the truncated answer", i)
+		}
+	}
+	if got := atomic.LoadInt32(&queries); got != 2 {
+		t.Errorf("upstream saw %d queries, want 2 as truncated answers are not cached", got)
+	}
+}
+
+func TestForwardCacheIgnoresCase(t *testing.T) {
+	upstream, queries := startUpstream(t, false)
+	d := newTestListener(t, &config.Config{UpstreamDNS: upstream, UpstreamTimeout: time.Second})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	for i, name := range []string{"case.example", "CaSe.EXAMPLE"} {
+		query := buildTestQuery(name, protocol.TypeA)
+		response, err := d.HandleRequest(query, addr, "udp")
+		if err != nil {
+			t.Fatalf("query %d: HandleRequest() error = %v", i, err)
+		}
+		q, err := protocol.ReadQuestion(response)
+		if err != nil || q.Name != name {
+			t.Errorf("query %d: response question = %q, %v, want %q as asked", i, q.Name, err, name)
+		}
+	}
+	if got := atomic.LoadInt32(queries); got != 1 {
+		t.Errorf("upstream saw %d queries, want 1 with the second a cache hit", got)
+	}
+}
+
+func TestCacheHitAgesTTLs(t *testing.T) {
+	upstream, _ := startUpstream(t, false)
+	d := newTestListener(t, &config.Config{UpstreamDNS: upstream, UpstreamTimeout: time.Second})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	query := buildTestQuery("aging.example", protocol.TypeA)
+	if _, err := d.HandleRequest(query, addr, "udp"); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	cached, _ := d.checkCache(query)
+	if cached == nil {
+		t.Fatal("answer was not cached")
+	}
+
+	// A replay 90s after storing the 120s answer has 30s left
+	response := d.fromCache(query, cached, 90*time.Second)
+	if ttl, ok := protocol.MinAnswerTTL(response); !ok || ttl != 30*time.Second {
+		t.Errorf("replayed TTL = %v, want 30s", ttl)
+	}
+	if ttl, _ := protocol.MinAnswerTTL(cached); ttl != 120*time.Second {
+		t.Errorf("cached entry TTL = %v after a replay, want it untouched at 120s", ttl)
+	}
+}
+
+func TestForwardTimeoutServFail(t *testing.T) {
+	upstream, queries := startUpstream(t, true)
+	d := newTestListener(t, &config.Config{UpstreamDNS: upstream, UpstreamTimeout: 50 * time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		if rcode := queryRCode(t, d, "timeout.example"); rcode != protocol.RCodeServFail {
+			t.Errorf("query %d: rcode = %v, want SERVFAIL", i, rcode)
+		}
+	}
+
+	// SERVFAIL is not cached, so the retry went upstream again
+	if got := atomic.LoadInt32(queries); got != 2 {
+		t.Errorf("upstream saw %d queries, want 2", got)
+	}
+}
+
+func TestForwardFailover(t *testing.T) {
+	down, downQueries := startUpstream(t, true)
+	up, upQueries := startUpstream(t, false)
+	d := newTestListener(t, &config.Config{
+		UpstreamDNS:     down + "," + up,
+		UpstreamTimeout: 50 * time.Millisecond,
+	})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	for _, name := range []string{"first.example", "second.example"} {
+		response, err := d.HandleRequest(buildTestQuery(name, protocol.TypeA), addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest(%s) error = %v", name, err)
+		}
+		if !strings.Contains(string(response), "\xc0\x00\x02\x35") {
+			t.Errorf("%s: response %x lacks the healthy upstream's answer", name, response)
+		}
+	}
+
+	// The timed out upstream is skipped for the second query
+	if got := atomic.LoadInt32(downQueries); got != 1 {
+		t.Errorf("failing upstream saw %d queries, want 1", got)
+	}
+	if got := atomic.LoadInt32(upQueries); got != 2 {
+		t.Errorf("healthy upstream saw %d queries, want 2", got)
+	}
+
+	stats := d.upstreamStats()
+	for _, want := range []string{down + ": backing off (0 ok, 1 failed)", up + ": healthy (2 ok, 0 failed)"} {
+		if !strings.Contains(stats, want) {
+			t.Errorf("upstreamStats() = %q, want it to contain %q", stats, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package dns_listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/health"
+	"github.com/exiguus/ns-checker/dns_listener/ratelimit"
+)
+
+// healthShutdownTimeout bounds how long Close waits for health requests in
+// flight
+const healthShutdownTimeout = 5 * time.Second
+
+// defaultTopLimited and maxTopLimited bound the clients /ratelimit lists
+const (
+	defaultTopLimited = 10
+	maxTopLimited     = 1000
+)
+
+// newHealthServer builds the health endpoints for cfg.HealthPort. /healthz
+// fails while the DNS listeners are down or the logs are unwritable, and
+// /readyz until Start has the workers running.
+func (d *DNSListener) newHealthServer() *health.Server {
+	srv := health.NewServer(d.config.HealthPort, d.GetMetrics())
+	srv.SetMonitor(d.healthMon)
+	srv.SetMetricsHandler(d.prometheusHandler())
+	srv.RegisterCheck("dns_listening", d.listening)
+	srv.RegisterCheck("log_writable", d.logWritable)
+	srv.RegisterReadiness("workers_running", d.ready)
+	srv.Handle("/ratelimit", d.rateLimitHandler())
+	if d.config.Debug {
+		srv.Handle("/debug/explain", d.explainHandler())
+	}
+	if d.config.AdminToken != "" {
+		srv.Handle("/cache/flush", d.requireAdmin(d.cacheFlushHandler()))
+	}
+	return srv
+}
+
+// rateLimitHandler serves GET /ratelimit, listing the clients limited most
+// often (?n=10 by default), or the counts of one client with ?client=addr
+func (d *DNSListener) rateLimitHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body interface{}
+		if client := r.URL.Query().Get("client"); client != "" {
+			stat, ok := d.rateLimiter.ClientStats(client)
+			if !ok {
+				http.Error(w, "client not tracked", http.StatusNotFound)
+				return
+			}
+			body = stat
+		} else {
+			n := defaultTopLimited
+			if v := r.URL.Query().Get("n"); v != "" {
+				var err error
+				if n, err = strconv.Atoi(v); err != nil || n < 1 || n > maxTopLimited {
+					http.Error(w, "n must be between 1 and "+strconv.Itoa(maxTopLimited), http.StatusBadRequest)
+					return
+				}
+			}
+			top := d.rateLimiter.TopLimited(n)
+			if top == nil {
+				top = []ratelimit.ClientStat{}
+			}
+			body = map[string]interface{}{"top_limited": top}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// listening fails unless both the UDP and the TCP listener are up
+func (d *DNSListener) listening() error {
+	if s := d.server.Load(); s == nil || !s.Listening() {
+		return errors.New("DNS listeners are not up")
+	}
+	return nil
+}
+
+// ready fails until Start has launched the background workers
+func (d *DNSListener) ready() error {
+	if !d.started.Load() {
+		return errors.New("workers are not running")
+	}
+	return nil
+}
+
+// stopHealth shuts down the health server and the runtime monitor
+func (d *DNSListener) stopHealth() {
+	if d.health != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+		defer cancel()
+		d.health.Shutdown(ctx)
+	}
+	d.healthMon.Stop()
+}
@@ -1,40 +1,191 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Server struct {
 	port    string
 	metrics MetricsProvider
+	mux     *http.ServeMux
+
+	mu        sync.RWMutex
+	checks    []namedCheck
+	readiness []namedCheck
+	monitor   *HealthMonitor
+	exporter  http.Handler // serves /metrics in place of the JSON metrics
+	srv       *http.Server
+	closed    bool
 }
 
 type MetricsProvider interface {
 	GetStats() map[string]interface{}
 }
 
+// Check reports a problem with a component by returning an error
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
 type HealthStatus struct {
 	Status    string                 `json:"status"`
 	Timestamp string                 `json:"timestamp"`
+	System    *SystemInfo            `json:"system,omitempty"`
 	Metrics   map[string]interface{} `json:"metrics,omitempty"`
+	Checks    []HealthCheck          `json:"checks,omitempty"`
+}
+
+// SystemInfo is the runtime state reported by /healthz and /readyz
+type SystemInfo struct {
+	Uptime      string  `json:"uptime"`
+	Goroutines  int     `json:"goroutines"`
+	HeapInUse   uint64  `json:"heap_in_use"`
+	MemoryUsage float64 `json:"memory_usage"`
 }
 
 func NewServer(port string, metrics MetricsProvider) *Server {
-	return &Server{
+	s := &Server{
 		port:    port,
 		metrics: metrics,
+		mux:     http.NewServeMux(),
 	}
+	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/stats", s.handleStats)
+	return s
+}
+
+// RegisterCheck adds a check that degrades /healthz while it fails. Its
+// state is reported in /stats as a boolean under name.
+func (s *Server) RegisterCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, namedCheck{name: name, check: check})
+}
+
+// RegisterReadiness adds a check that holds /readyz at 503 while it fails.
+// /readyz also runs the checks added with RegisterCheck.
+func (s *Server) RegisterReadiness(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readiness = append(s.readiness, namedCheck{name: name, check: check})
+}
+
+// SetMonitor adds the runtime state collected by m to /healthz and /readyz
+func (s *Server) SetMonitor(m *HealthMonitor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.monitor = m
+}
+
+// SetMetricsHandler serves /metrics with h instead of the JSON metrics,
+// which remain available under /stats
+func (s *Server) SetMetricsHandler(h http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exporter = h
+}
+
+// Handle serves an additional endpoint next to the health endpoints
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
 }
 
+// Handler returns the HTTP handler serving the health endpoints
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves the health endpoints until Shutdown is called
 func (s *Server) Start() error {
-	http.HandleFunc("/health", s.handleHealth)
-	http.HandleFunc("/metrics", s.handleMetrics)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.srv = &http.Server{Addr: fmt.Sprintf(":%s", s.port), Handler: s.mux}
+	srv := s.srv
+	s.mu.Unlock()
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
 
-	addr := fmt.Sprintf(":%s", s.port)
-	return http.ListenAndServe(addr, nil)
+// Shutdown stops the server, letting requests in flight finish until ctx
+// is done. A server shut down before Start never serves.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	srv := s.srv
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// systemInfo returns the monitor's runtime state, or nil without a monitor
+func (s *Server) systemInfo() *SystemInfo {
+	s.mu.RLock()
+	m := s.monitor
+	s.mu.RUnlock()
+	if m == nil {
+		return nil
+	}
+
+	stats := m.GetStats()
+	return &SystemInfo{
+		Uptime:      stats.Uptime.Round(time.Second).String(),
+		Goroutines:  stats.GoroutineCount,
+		HeapInUse:   stats.HeapInUse,
+		MemoryUsage: stats.MemoryUsage,
+	}
+}
+
+// runChecks runs all registered checks, and with readiness also the
+// readiness checks, and reports whether all passed
+func (s *Server) runChecks(readiness bool) ([]HealthCheck, bool) {
+	s.mu.RLock()
+	checks := make([]namedCheck, len(s.checks))
+	copy(checks, s.checks)
+	if readiness {
+		checks = append(checks, s.readiness...)
+	}
+	s.mu.RUnlock()
+
+	results := make([]HealthCheck, 0, len(checks))
+	healthy := true
+	for _, c := range checks {
+		start := time.Now()
+		err := c.check()
+		result := HealthCheck{
+			Name:     c.name,
+			Status:   err == nil,
+			Message:  "ok",
+			LastRun:  start,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			result.Message = err.Error()
+			healthy = false
+		}
+		results = append(results, result)
+	}
+	return results, healthy
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -47,7 +198,53 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+// handleHealthz answers 503 while any registered check fails so that
+// orchestrators can recycle a degraded instance
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := s.runChecks(false)
+	status := HealthStatus{
+		Status:    "healthy",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		System:    s.systemInfo(),
+		Checks:    checks,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		status.Status = "degraded"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleReadyz answers 503 until the readiness checks pass, so that no
+// traffic is sent to an instance that is still starting
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks, ready := s.runChecks(true)
+	status := HealthStatus{
+		Status:    "ready",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		System:    s.systemInfo(),
+		Checks:    checks,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		status.Status = "not_ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	exporter := s.exporter
+	s.mu.RUnlock()
+	if exporter != nil {
+		exporter.ServeHTTP(w, r)
+		return
+	}
+
 	status := HealthStatus{
 		Status:    "healthy",
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -57,3 +254,19 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
+
+// handleStats returns the collected metrics together with one boolean per
+// registered check
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := make(map[string]interface{})
+	for k, v := range s.metrics.GetStats() {
+		stats[k] = v
+	}
+	checks, _ := s.runChecks(false)
+	for _, c := range checks {
+		stats[c.Name] = c.Status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -37,7 +37,7 @@ func NewMonitor(interval time.Duration) *HealthMonitor {
 		stopCh:      make(chan struct{}),
 		lastCPUTime: time.Now(),
 	}
-	m.stats.Store(&SystemStats{})
+	m.sample()
 	go m.collect()
 	return m
 }
@@ -51,52 +51,57 @@ func (m *HealthMonitor) collect() {
 		case <-m.stopCh:
 			return
 		case <-ticker.C:
-			var stats runtime.MemStats
-			runtime.ReadMemStats(&stats)
-
-			// Track GC stats
-			if stats.NumGC > m.lastPause {
-				m.gcPause = time.Duration(stats.PauseNs[(stats.NumGC+255)%256])
-				m.lastGC = time.Now().Add(-time.Duration(stats.LastGC))
-				m.lastPause = stats.NumGC
-			}
-
-			// Calculate CPU usage
-			now := time.Now()
-			duration := now.Sub(m.lastCPUTime).Seconds()
-
-			if duration > 0 {
-				// Get number of CPU cores
-				numCPU := float64(runtime.NumCPU())
-
-				// Get the number of goroutines as a rough approximation of CPU load
-				numGoroutines := float64(runtime.NumGoroutine())
-
-				// Calculate CPU usage as a percentage of available CPU capacity
-				cpuUsage := (numGoroutines / numCPU) * float64(runtime.GOMAXPROCS(0))
-
-				// Normalize to a value between 0 and 1
-				m.lastCPUStat = cpuUsage / (numCPU * 100)
-			}
-
-			m.lastCPUTime = now
-
-			systemStats := &SystemStats{
-				CPUUsage:       m.lastCPUStat,
-				MemoryUsage:    float64(stats.Alloc) / float64(stats.Sys),
-				GCPause:        m.gcPause,
-				GoroutineCount: runtime.NumGoroutine(),
-				ThreadCount:    runtime.NumCPU(),
-				HeapInUse:      stats.HeapInuse,
-				StackInUse:     stats.StackInuse,
-				LastGC:         m.lastGC,
-				Uptime:         time.Since(m.startTime),
-			}
-			m.stats.Store(systemStats)
+			m.sample()
 		}
 	}
 }
 
+// sample stores a fresh snapshot of the runtime statistics
+func (m *HealthMonitor) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	// Track GC stats
+	if stats.NumGC > m.lastPause {
+		m.gcPause = time.Duration(stats.PauseNs[(stats.NumGC+255)%256])
+		m.lastGC = time.Now().Add(-time.Duration(stats.LastGC))
+		m.lastPause = stats.NumGC
+	}
+
+	// Calculate CPU usage
+	now := time.Now()
+	duration := now.Sub(m.lastCPUTime).Seconds()
+
+	if duration > 0 {
+		// Get number of CPU cores
+		numCPU := float64(runtime.NumCPU())
+
+		// Get the number of goroutines as a rough approximation of CPU load
+		numGoroutines := float64(runtime.NumGoroutine())
+
+		// Calculate CPU usage as a percentage of available CPU capacity
+		cpuUsage := (numGoroutines / numCPU) * float64(runtime.GOMAXPROCS(0))
+
+		// Normalize to a value between 0 and 1
+		m.lastCPUStat = cpuUsage / (numCPU * 100)
+	}
+
+	m.lastCPUTime = now
+
+	systemStats := &SystemStats{
+		CPUUsage:       m.lastCPUStat,
+		MemoryUsage:    float64(stats.Alloc) / float64(stats.Sys),
+		GCPause:        m.gcPause,
+		GoroutineCount: runtime.NumGoroutine(),
+		ThreadCount:    runtime.NumCPU(),
+		HeapInUse:      stats.HeapInuse,
+		StackInUse:     stats.StackInuse,
+		LastGC:         m.lastGC,
+		Uptime:         time.Since(m.startTime),
+	}
+	m.stats.Store(systemStats)
+}
+
 func (m *HealthMonitor) GetStats() SystemStats {
 	return *m.stats.Load().(*SystemStats)
 }
@@ -0,0 +1,34 @@
+package dns_listener
+
+import "github.com/exiguus/ns-checker/dns_listener/protocol"
+
+// ResponseHook inspects or rewrites a response before it is sent. It
+// returns the response to send, which may be resp itself.
+type ResponseHook func(q *protocol.ParsedMessage, resp []byte) []byte
+
+// Option configures a DNSListener at construction
+type Option func(*DNSListener)
+
+// WithResponseHooks appends hooks run in order on every response
+func WithResponseHooks(hooks ...ResponseHook) Option {
+	return func(d *DNSListener) {
+		d.hooks = append(d.hooks, hooks...)
+	}
+}
+
+// applyHooks passes response through the configured hooks. The query is
+// only parsed when hooks are present.
+func (d *DNSListener) applyHooks(query, response []byte) []byte {
+	if len(d.hooks) == 0 || response == nil {
+		return response
+	}
+
+	q, err := protocol.ParseMessage(query)
+	if err != nil {
+		return response
+	}
+	for _, hook := range d.hooks {
+		response = hook(q, response)
+	}
+	return response
+}
@@ -0,0 +1,91 @@
+// Package hosts answers names from a static hosts file, like /etc/hosts.
+package hosts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// HostMap maps names to the addresses listed for them. Lookups are case
+// insensitive and ignore a trailing dot.
+type HostMap struct {
+	addrs map[string][]net.IP
+}
+
+// LoadHosts reads the hosts file at path
+func LoadHosts(path string) (HostMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return HostMap{}, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads "IP name [name...]" lines. Blank lines and everything after
+// a # are ignored. A name listed on several lines gets all their
+// addresses, in file order.
+func Parse(r io.Reader) (HostMap, error) {
+	h := HostMap{addrs: make(map[string][]net.IP)}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return HostMap{}, fmt.Errorf("line %d: expected an address and at least one name, got %q", lineNum, line)
+		}
+
+		// Link-local addresses may carry a zone, which DNS cannot express
+		address, _, _ := strings.Cut(fields[0], "%")
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return HostMap{}, fmt.Errorf("line %d: invalid address %q", lineNum, fields[0])
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		for _, name := range fields[1:] {
+			name = normalize(name)
+			h.addrs[name] = append(h.addrs[name], ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return HostMap{}, err
+	}
+
+	return h, nil
+}
+
+// Lookup returns the addresses of name, IPv4 ones as 4 byte slices, or nil
+// when the file does not list it
+func (h *HostMap) Lookup(name string) []net.IP {
+	if h == nil {
+		return nil
+	}
+	return h.addrs[normalize(name)]
+}
+
+// Len returns the number of names
+func (h *HostMap) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.addrs)
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
@@ -0,0 +1,96 @@
+package hosts
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHosts = `
+# static hosts
+127.0.0.1   localhost
+::1         localhost ip6-localhost   # loopback
+192.0.2.10  NAS.lan. nas
+2001:db8::10 nas.lan
+fe80::1%lo0 router.lan
+`
+
+func TestParseAndLookup(t *testing.T) {
+	h, err := Parse(strings.NewReader(testHosts))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if h.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", h.Len())
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"localhost", []string{"127.0.0.1", "::1"}},
+		{"ip6-localhost", []string{"::1"}},
+		{"nas.lan", []string{"192.0.2.10", "2001:db8::10"}},
+		{"NAS.LAN.", []string{"192.0.2.10", "2001:db8::10"}},
+		{"nas", []string{"192.0.2.10"}},
+		{"router.lan", []string{"fe80::1"}},
+		{"sub.nas.lan", nil},
+		{"example.org", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.Lookup(tt.name)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Lookup(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(net.ParseIP(tt.want[i])) {
+					t.Errorf("Lookup(%q)[%d] = %v, want %s", tt.name, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	// IPv4 addresses are stored in their 4 byte form
+	if addr := h.Lookup("nas")[0]; len(addr) != net.IPv4len {
+		t.Errorf("Lookup(nas) address has %d bytes, want %d", len(addr), net.IPv4len)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"192.0.2.1",
+		"nas.lan 192.0.2.1",
+		"192.0.2.300 nas.lan",
+	} {
+		if _, err := Parse(strings.NewReader(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", data)
+		}
+	}
+}
+
+func TestLoadHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(testHosts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := LoadHosts(path)
+	if err != nil {
+		t.Fatalf("LoadHosts() error = %v", err)
+	}
+	if got := h.Lookup("nas.lan"); len(got) != 2 {
+		t.Errorf("Lookup(nas.lan) = %v, want 2 addresses", got)
+	}
+
+	if _, err := LoadHosts(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadHosts() of a missing file succeeded")
+	}
+
+	// A nil map answers nothing
+	var none *HostMap
+	if none.Lookup("nas.lan") != nil || none.Len() != 0 {
+		t.Error("nil HostMap is not empty")
+	}
+}
@@ -0,0 +1,131 @@
+package dns_listener
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// requestEntry is a request as handed to a logFormatter. The client address
+// and question are parsed once, whichever format renders them.
+type requestEntry struct {
+	time          time.Time
+	protocol      string
+	remoteAddr    string
+	clientIP      string
+	data          []byte
+	question      protocol.Question
+	questionErr   error // set when data holds no readable question
+	response      []byte
+	responseBytes int
+	err           error
+}
+
+func newRequestEntry(protocolType, remoteAddr string, data, response []byte, err error) requestEntry {
+	// Extract IP address without port
+	clientIP := remoteAddr
+	if idx := strings.LastIndex(remoteAddr, ":"); idx != -1 {
+		clientIP = remoteAddr[:idx]
+	}
+	q, qerr := protocol.ReadQuestion(data)
+	return requestEntry{
+		time:          time.Now(),
+		protocol:      protocolType,
+		remoteAddr:    remoteAddr,
+		clientIP:      clientIP,
+		data:          data,
+		question:      q,
+		questionErr:   qerr,
+		response:      response,
+		responseBytes: len(response),
+		err:           err,
+	}
+}
+
+// logFormatter renders a request for the access log
+type logFormatter interface {
+	formatRequest(e requestEntry) string
+}
+
+// textFormatter writes a multi-line block with the decoded query, a hex
+// dump and the decoded response, for reading the log directly. With
+// redacted set the response is left out, as its records name the query.
+type textFormatter struct {
+	redacted bool
+}
+
+func (f textFormatter) formatRequest(e requestEntry) string {
+	var sb strings.Builder
+	// Basic info with all fields
+	sb.WriteString(fmt.Sprintf("[%s] [%s] Client: %s\n", e.time.Format("2006-01-02 15:04:05.000"), e.protocol, e.remoteAddr))
+	sb.WriteString(fmt.Sprintf("Protocol: %s\n", e.protocol))
+	sb.WriteString(fmt.Sprintf("Client IP: %s\n", e.clientIP))
+
+	// DNS query details
+	sb.WriteString(parseDNSQuery(e.data))
+
+	// Raw hex dump in canonical format
+	sb.WriteString("Raw Query (Hex):\n")
+	sb.WriteString(hex.Dump(e.data))
+	sb.WriteString(fmt.Sprintf("Response: %d bytes\n", e.responseBytes))
+	if len(e.response) > 0 && !f.redacted {
+		sb.WriteString(parseDNSResponse(e.response))
+	}
+	sb.WriteString("\n")
+
+	if e.err != nil {
+		sb.WriteString(fmt.Sprintf("Error: %v\n", e.err))
+	}
+	return sb.String()
+}
+
+// jsonFormatter writes one JSON object per line for log aggregation. The
+// query bytes are only included, hex encoded, when raw is set.
+type jsonFormatter struct {
+	raw bool
+}
+
+type jsonRequest struct {
+	Timestamp     string `json:"timestamp"`
+	Protocol      string `json:"protocol"`
+	ClientIP      string `json:"client_ip"`
+	QName         string `json:"qname,omitempty"`
+	QType         string `json:"qtype,omitempty"`
+	QClass        string `json:"qclass,omitempty"`
+	ResponseBytes int    `json:"response_bytes"`
+	Error         string `json:"error,omitempty"`
+	Raw           string `json:"raw,omitempty"`
+}
+
+func (f jsonFormatter) formatRequest(e requestEntry) string {
+	r := jsonRequest{
+		Timestamp:     e.time.Format(time.RFC3339Nano),
+		Protocol:      e.protocol,
+		ClientIP:      e.clientIP,
+		ResponseBytes: e.responseBytes,
+	}
+	if e.questionErr == nil {
+		r.QName = e.question.Name
+		r.QType = e.question.Type.String()
+		r.QClass = e.question.Class.String()
+	}
+	switch {
+	case e.err != nil:
+		r.Error = e.err.Error()
+	case e.questionErr != nil:
+		r.Error = e.questionErr.Error()
+	}
+	if f.raw {
+		r.Raw = hex.EncodeToString(e.data)
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`+"\n", err.Error())
+	}
+	return string(line) + "\n"
+}
@@ -0,0 +1,124 @@
+package dns_listener
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestJSONAccessLog(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestListener(t, &config.Config{
+		LogPath:   filepath.Join(dir, "access.log"),
+		LogFormat: config.LogFormatJSON,
+	})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	response, err := d.HandleRequest(buildTestQuery("json.example.com", protocol.TypeAAAA), addr, "udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs, _ := filepath.Glob(filepath.Join(dir, "*access.log"))
+	if len(logs) != 1 {
+		t.Fatalf("log files = %v, want one", logs)
+	}
+	data, err := os.ReadFile(logs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "{") {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("access log line is not JSON: %v\n%s", err, line)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) != 1 {
+		t.Fatalf("JSON entries = %d, want one:\n%s", len(entries), data)
+	}
+	entry := entries[0]
+	want := map[string]interface{}{
+		"protocol":       "udp",
+		"client_ip":      "127.0.0.1",
+		"qname":          "json.example.com",
+		"qtype":          "AAAA",
+		"qclass":         "IN",
+		"response_bytes": float64(len(response)),
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["timestamp"]; !ok {
+		t.Error("entry has no timestamp")
+	}
+	if _, ok := entry["raw"]; ok {
+		t.Error("entry has the raw query outside debug mode")
+	}
+	if strings.Contains(string(data), "Raw Query (Hex)") {
+		t.Errorf("JSON log contains the text block:\n%s", data)
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	query := buildTestQuery("example.com", protocol.TypeA)
+	entry := newRequestEntry("tcp", "[::1]:5353", query, nil, errors.New("upstream timeout"))
+
+	var got jsonRequest
+	line := jsonFormatter{raw: true}.formatRequest(entry)
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Errorf("entry = %q, want a single line", line)
+	}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ClientIP != "[::1]" || got.QName != "example.com" || got.QType != "A" || got.Error != "upstream timeout" {
+		t.Errorf("entry = %+v", got)
+	}
+	if got.Raw != "abcd01000001000000000000076578616d706c6503636f6d0000010001" {
+		t.Errorf("raw = %q, want the query in hex", got.Raw)
+	}
+
+	// A header without a question is logged with the parse error
+	got = jsonRequest{}
+	json.Unmarshal([]byte(jsonFormatter{}.formatRequest(newRequestEntry("udp", "127.0.0.1:53", query[:12], nil, nil))), &got)
+	if got.QName != "" || got.Error == "" {
+		t.Errorf("entry for a header only = %+v, want an error and no qname", got)
+	}
+}
+
+func TestTextFormatterResponse(t *testing.T) {
+	query := buildTestQuery("example.com", protocol.TypeA)
+	m := &protocol.Message{
+		Header:    protocol.Header{ID: 0xabcd, Flags: protocol.FlagQR},
+		Questions: []protocol.Question{{Name: "example.com", Type: protocol.TypeA, Class: protocol.ClassIN}},
+		Answers: []protocol.Record{
+			{Name: "example.com", Type: protocol.TypeA, Class: protocol.ClassIN, TTL: 60, Data: []byte{192, 0, 2, 1}},
+		},
+	}
+	response, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := newRequestEntry("udp", "127.0.0.1:5353", query, response, nil)
+
+	const answer = "Answer: example.com 60 IN A 192.0.2.1\n"
+	if got := (textFormatter{}).formatRequest(entry); !strings.Contains(got, answer) {
+		t.Errorf("entry = %q, want it to contain %q", got, answer)
+	}
+	if got := (textFormatter{redacted: true}).formatRequest(entry); strings.Contains(got, "Answer:") {
+		t.Errorf("redacted entry = %q, want no answers", got)
+	}
+}
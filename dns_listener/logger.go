@@ -1,26 +1,172 @@
 package dns_listener
 
 import (
-	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/cache"
+	"github.com/exiguus/ns-checker/dns_listener/config"
 )
 
-type FileLogger struct {
+// logProbeInterval is how often the log directory is checked for writability
+const logProbeInterval = 10 * time.Second
+
+// probeLogDir verifies that dir still accepts new files
+func probeLogDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("log directory not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// MultiLogger formats log entries and hands each one to every configured
+// sink
+type MultiLogger struct {
+	sinks      []LogSink
+	formatter  logFormatter
+	debugMode  atomic.Bool // changed by SetDebug on a configuration reload
+	debugLevel string
+	// echo prints entries to the console in debug mode; it is off when a
+	// stdout sink already does so
+	echo bool
+}
+
+// NewMultiLogger creates a logger writing to sinks
+func NewMultiLogger(sinks ...LogSink) *MultiLogger {
+	l := &MultiLogger{
+		sinks:      sinks,
+		formatter:  textFormatter{},
+		debugLevel: config.Getenv("DNS_LISTENER_DEBUG_LEVEL"),
+		echo:       true,
+	}
+	l.debugMode.Store(config.Getenv("DEBUG") == "true")
+	for _, sink := range sinks {
+		if _, ok := sink.(*StdoutSink); ok {
+			l.echo = false
+		}
+	}
+	return l
+}
+
+// newLogger builds the logger for the sinks named in cfg.LogOutputs,
+// defaulting to the log file alone
+func newLogger(cfg *config.Config) (*MultiLogger, error) {
+	outputs := cfg.LogOutputs
+	if len(outputs) == 0 {
+		outputs = []string{config.LogOutputFile}
+	}
+
+	var sinks []LogSink
+	for _, output := range outputs {
+		var sink LogSink
+		switch output {
+		case config.LogOutputFile:
+			fs, err := NewFileSink(cfg.LogPath)
+			if err != nil {
+				return nil, err
+			}
+			fs.SetRotation(cfg.LogMaxSize, cfg.LogMaxBackups, cfg.LogMaxAge)
+			sink = fs
+		case config.LogOutputStdout:
+			sink = NewStdoutSink(os.Stdout)
+		case config.LogOutputSyslog:
+			ss, err := NewSyslogSink("ns-checker")
+			if err != nil {
+				return nil, err
+			}
+			sink = ss
+		default:
+			return nil, fmt.Errorf("unknown log output %q", output)
+		}
+		sinks = append(sinks, sink)
+	}
+	l := NewMultiLogger(sinks...)
+	switch {
+	case cfg.LogFormat == config.LogFormatJSON:
+		l.formatter = jsonFormatter{raw: l.debugMode.Load()}
+	case cfg.QnameRedaction != config.RedactNone:
+		l.formatter = textFormatter{redacted: true}
+	}
+	return l, nil
+}
+
+// LogRequest writes an access log entry for a query that was answered
+// with response, or failed with err
+func (l *MultiLogger) LogRequest(protocol, remoteAddr string, data, response []byte, err error) {
+	l.Write(l.formatter.formatRequest(newRequestEntry(protocol, remoteAddr, data, response, err)))
+}
+
+func (l *MultiLogger) Write(entry string) {
+	// Ensure entry ends with newline
+	if !strings.HasSuffix(entry, "\n") {
+		entry += "\n"
+	}
+
+	for _, sink := range l.sinks {
+		if err := sink.WriteEntry(entry); err != nil {
+			fmt.Printf("Error writing to log sink: %v\n", err)
+		}
+	}
+
+	// Only print to console if it's not an INFO log in non-debug mode
+	if l.echo && (l.debugMode.Load() || l.debugLevel == "info" || l.debugLevel == "debug") {
+		fmt.Print(colorize(entry, colorCyan))
+		os.Stdout.Sync()
+	}
+}
+
+// SetDebug turns debug mode, which echoes every entry to the console, on
+// or off
+func (l *MultiLogger) SetDebug(on bool) {
+	l.debugMode.Store(on)
+}
+
+// CacheEvicted logs an entry dropped by the cache. Expirations are routine
+// and only logged in debug mode, evictions under MaxSize pressure always.
+func (l *MultiLogger) CacheEvicted(key string, size int64, reason cache.EvictReason) {
+	if reason == cache.EvictExpired && !l.debugMode.Load() {
+		return
+	}
+	timestamp := time.Now().Format("[2006-01-02 15:04:05.000]")
+	l.Write(fmt.Sprintf("%s CACHE EVICT: reason=%s size=%d key=%s\n", timestamp, reason, size, key))
+}
+
+func (l *MultiLogger) Error(msg string, err error) {
+	timestamp := time.Now().Format("[2006-01-02 15:04:05.000]")
+	l.Write(fmt.Sprintf("%s ERROR: %s: %v\n", timestamp, msg, err))
+}
+
+func (l *MultiLogger) Close() {
+	for _, sink := range l.sinks {
+		sink.Close()
+	}
+}
+
+// FileSink writes entries to a dated log file, rotating it by size
+type FileSink struct {
 	file       *os.File
 	mu         sync.Mutex
-	debugMode  bool
-	debugLevel string
 	logPath    string
 	flushRate  time.Duration
 	lastFlush  time.Time
+	size       int64 // bytes written to the current file
+	maxSize    int64 // rotate once size exceeds this; 0 disables rotation
+	maxBackups int
+	maxAge     time.Duration // remove older log files; 0 keeps them
 }
 
-func NewFileLogger(logPath string) (Logger, error) {
+// NewFileSink opens the dated log file for logPath, creating its directory
+// when needed
+func NewFileSink(logPath string) (*FileSink, error) {
 	logsDir := filepath.Dir(logPath)
 	absLogsDir, err := filepath.Abs(logsDir)
 	if err != nil {
@@ -51,21 +197,25 @@ func NewFileLogger(logPath string) (Logger, error) {
 	}
 	file.Sync()
 
-	logger := &FileLogger{
-		file:       file,
-		debugMode:  os.Getenv("DEBUG") == "true",
-		debugLevel: os.Getenv("DNS_LISTENER_DEBUG_LEVEL"),
-		logPath:    fullPath,
-		flushRate:  time.Second * 1, // Flush every second
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	sink := &FileSink{
+		file:      file,
+		logPath:   fullPath,
+		flushRate: time.Second * 1, // Flush every second
+		size:      size,
 	}
 
 	// Start background flush routine
-	go logger.periodicFlush()
+	go sink.periodicFlush()
 
-	return logger, nil
+	return sink, nil
 }
 
-func (l *FileLogger) periodicFlush() {
+func (l *FileSink) periodicFlush() {
 	ticker := time.NewTicker(l.flushRate)
 	for range ticker.C {
 		l.mu.Lock()
@@ -76,74 +226,153 @@ func (l *FileLogger) periodicFlush() {
 	}
 }
 
-func (l *FileLogger) LogRequest(protocol, remoteAddr string, data []byte, err error) {
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	humanReadable := parseDNSQuery(data)
+func (l *FileSink) WriteEntry(entry string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	// Extract IP address without port
-	clientIP := remoteAddr
-	if idx := strings.LastIndex(remoteAddr, ":"); idx != -1 {
-		clientIP = remoteAddr[:idx]
+	n, err := l.file.WriteString(entry)
+	l.written(n)
+	if err != nil {
+		// Try to reopen the file
+		if rerr := l.reopenLogFile(); rerr != nil {
+			return fmt.Errorf("%w (reopen: %v)", err, rerr)
+		}
+		return err
 	}
+	return nil
+}
 
-	var sb strings.Builder
-	// Basic info with all fields
-	sb.WriteString(fmt.Sprintf("[%s] [%s] Client: %s\n", timestamp, protocol, remoteAddr))
-	sb.WriteString(fmt.Sprintf("Protocol: %s\n", protocol))
-	sb.WriteString(fmt.Sprintf("Client IP: %s\n", clientIP))
+// SetRotation makes the logger roll the file over once it grows past
+// maxSizeMB megabytes, keeping up to maxBackups numbered backups. Backups
+// and the log files of earlier days older than maxAgeDays are removed now
+// and after every rotation.
+func (l *FileSink) SetRotation(maxSizeMB, maxBackups, maxAgeDays int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxSize = int64(maxSizeMB) << 20
+	l.maxBackups = maxBackups
+	l.maxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+	l.prune()
+}
+
+// written accounts n bytes against the current file and rotates it when it
+// has grown too large. Callers hold l.mu.
+func (l *FileSink) written(n int) {
+	l.size += int64(n)
+	if l.maxSize > 0 && l.size > l.maxSize {
+		l.rotate()
+	}
+}
 
-	// DNS query details
-	sb.WriteString(humanReadable)
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
 
-	// Raw hex dump in canonical format
-	sb.WriteString("Raw Query (Hex):\n")
-	sb.WriteString(hex.Dump(data))
-	sb.WriteString("\n")
+// rotate moves the current file to the first backup slot and continues on a
+// fresh file. If the backup cannot be created, or the new file fails a
+// read-back check, logging carries on in the current file with a warning.
+// Callers hold l.mu.
+func (l *FileSink) rotate() {
+	// Reset first so a failing rotation is retried after another maxSize
+	// bytes rather than on every write
+	l.size = 0
 
-	if err != nil {
-		sb.WriteString(fmt.Sprintf("Error: %v\n", err))
+	backups := l.maxBackups
+	if backups < 1 {
+		backups = 1
+	}
+	for i := backups - 1; i >= 1; i-- {
+		os.Rename(backupName(l.logPath, i), backupName(l.logPath, i+1))
 	}
 
-	// Write directly to file and console
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	backup := backupName(l.logPath, 1)
+	if err := os.Rename(l.logPath, backup); err != nil {
+		l.rotationFailed(err)
+		return
+	}
 
-	l.file.WriteString(sb.String())
-	l.file.Sync()
+	file, err := openVerified(l.logPath)
+	if err != nil {
+		// The old descriptor still points at the renamed file; move it back
+		// so the configured path keeps receiving entries
+		if rerr := os.Rename(backup, l.logPath); rerr != nil {
+			err = fmt.Errorf("%w (restore: %v)", err, rerr)
+		}
+		l.rotationFailed(err)
+		return
+	}
 
-	// Print to console only if in debug mode or debug level is info/debug
-	if l.debugMode || l.debugLevel == "info" || l.debugLevel == "debug" {
-		fmt.Printf("%s%s%s", colorCyan, sb.String(), colorReset)
+	l.file.Close()
+	l.file = file
+	if info, err := file.Stat(); err == nil {
+		l.size = info.Size()
 	}
-	os.Stdout.Sync()
+	l.prune()
 }
 
-func (l *FileLogger) Write(entry string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	// Ensure entry ends with newline
-	if !strings.HasSuffix(entry, "\n") {
-		entry += "\n"
+// prune removes backups numbered beyond maxBackups, left over from a
+// larger setting, and log files and backups older than maxAge. The dated
+// files of earlier days count as old log files. Callers hold l.mu.
+func (l *FileSink) prune() {
+	backups := l.maxBackups
+	if backups < 1 {
+		backups = 1
 	}
-
-	// Write to file
-	if _, err := l.file.WriteString(entry); err != nil {
-		fmt.Printf("Error writing to log file: %v\n", err)
-		// Try to reopen the file
-		if err := l.reopenLogFile(); err != nil {
-			fmt.Printf("Failed to reopen log file: %v\n", err)
+	dir, name := filepath.Split(l.logPath)
+	// Dated files are named 2006-01-02_<name>
+	pattern := filepath.Join(dir, "[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]_"+name[min(len(name), 11):]+"*")
+	matches, _ := filepath.Glob(pattern)
+	for _, path := range matches {
+		if path == l.logPath {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(path, l.logPath+"."); ok {
+			if n, err := strconv.Atoi(suffix); err == nil && n > backups {
+				os.Remove(path)
+				continue
+			}
+		}
+		if l.maxAge <= 0 {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && time.Since(info.ModTime()) > l.maxAge {
+			os.Remove(path)
 		}
 	}
+}
 
-	// Only print to console if it's not an INFO log in non-debug mode
-	if l.debugMode || l.debugLevel == "info" || l.debugLevel == "debug" {
-		fmt.Printf("%s%s%s", colorCyan, entry, colorReset)
+// openVerified creates a new log file and checks that a header written to
+// it can be read back
+func openVerified(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("[%s] Log rotated\n", time.Now().Format("2006-01-02 15:04:05"))
+	if _, err := file.WriteString(header); err != nil {
+		file.Close()
+		return nil, err
 	}
-	os.Stdout.Sync()
+	buf := make([]byte, len(header))
+	if _, err := file.ReadAt(buf, 0); err != nil || string(buf) != header {
+		file.Close()
+		if err == nil {
+			err = fmt.Errorf("read back %q", buf)
+		}
+		return nil, fmt.Errorf("verify rotated log file: %w", err)
+	}
+	return file, nil
+}
+
+func (l *FileSink) rotationFailed(err error) {
+	timestamp := time.Now().Format("[2006-01-02 15:04:05.000]")
+	entry := fmt.Sprintf("%s WARNING: log rotation failed, continuing on current file: %v\n", timestamp, err)
+	n, _ := l.file.WriteString(entry)
+	l.size += int64(n)
+	fmt.Print(colorize(entry, colorYellow))
 }
 
-func (l *FileLogger) reopenLogFile() error {
+func (l *FileSink) reopenLogFile() error {
 	if l.file != nil {
 		l.file.Close()
 	}
@@ -156,15 +385,11 @@ func (l *FileLogger) reopenLogFile() error {
 	return nil
 }
 
-func (l *FileLogger) Close() {
+func (l *FileSink) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if l.file != nil {
-		l.file.Close()
+		return l.file.Close()
 	}
-}
-
-func (l *FileLogger) Error(msg string, err error) {
-	timestamp := time.Now().Format("[2006-01-02 15:04:05.000]")
-	l.Write(fmt.Sprintf("%s ERROR: %s: %v\n", timestamp, msg, err))
+	return nil
 }
@@ -0,0 +1,195 @@
+package dns_listener
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+)
+
+func newRotatingSink(t *testing.T, maxBackups int) *FileSink {
+	t.Helper()
+	l, err := NewFileSink(filepath.Join(t.TempDir(), "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	l.SetRotation(1, maxBackups, 0)
+	l.maxSize = 64 // rotate after a couple of entries
+	return l
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLogRotation(t *testing.T) {
+	l := newRotatingSink(t, 2)
+
+	l.WriteEntry(strings.Repeat("a", 80) + "\n")
+	l.WriteEntry("after rotation\n")
+
+	if backup := readLog(t, l.logPath+".1"); !strings.Contains(backup, strings.Repeat("a", 80)) {
+		t.Errorf("backup = %q, want the entry written before rotation", backup)
+	}
+	current := readLog(t, l.logPath)
+	if !strings.Contains(current, "Log rotated") || !strings.Contains(current, "after rotation") {
+		t.Errorf("current log = %q, want rotation header and new entry", current)
+	}
+}
+
+func TestLogRotationUnwritableBackup(t *testing.T) {
+	l := newRotatingSink(t, 1)
+
+	// A non-empty directory in the backup slot cannot be replaced by a
+	// rename, even when running as root
+	backup := l.logPath + ".1"
+	if err := os.MkdirAll(filepath.Join(backup, "occupied"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	original := l.file
+
+	l.WriteEntry(strings.Repeat("a", 80) + "\n")
+	l.WriteEntry("still logging\n")
+
+	if l.file != original {
+		t.Error("logger switched files after a failed rotation")
+	}
+	current := readLog(t, l.logPath)
+	if !strings.Contains(current, "WARNING: log rotation failed") {
+		t.Errorf("current log = %q, want a rotation warning", current)
+	}
+	if !strings.Contains(current, "still logging") {
+		t.Errorf("current log = %q, want entries written after the failure", current)
+	}
+	if info, err := os.Stat(backup); err != nil || !info.IsDir() {
+		t.Errorf("backup slot changed: %v", err)
+	}
+}
+
+func TestLogRotationPrunes(t *testing.T) {
+	l := newRotatingSink(t, 2)
+	dir := filepath.Dir(l.logPath)
+	name := filepath.Base(l.logPath)[len("2006-01-02_"):]
+
+	// A backup beyond the limit from an earlier setting, and the logs of
+	// two earlier days, one of them past the maximum age
+	stale := l.logPath + ".5"
+	oldDay := filepath.Join(dir, "2020-01-01_"+name)
+	recentDay := filepath.Join(dir, "2020-01-02_"+name)
+	for _, path := range []string{stale, oldDay, recentDay} {
+		if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	if err := os.Chtimes(oldDay, old, old); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	l.maxAge = 7 * 24 * time.Hour
+	l.mu.Unlock()
+
+	for i := 0; i < 5; i++ {
+		l.WriteEntry(strings.Repeat("a", 80) + "\n")
+	}
+
+	backups, _ := filepath.Glob(l.logPath + ".*")
+	if want := []string{l.logPath + ".1", l.logPath + ".2"}; !slices.Equal(backups, want) {
+		t.Errorf("backups = %v, want %v", backups, want)
+	}
+	if _, err := os.Stat(oldDay); !os.IsNotExist(err) {
+		t.Errorf("log older than the maximum age kept: %v", err)
+	}
+	if _, err := os.Stat(recentDay); err != nil {
+		t.Errorf("recent log of an earlier day removed: %v", err)
+	}
+}
+
+// memorySink records entries for assertions
+type memorySink struct {
+	entries []string
+	closed  bool
+}
+
+func (m *memorySink) WriteEntry(entry string) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *memorySink) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestMultiLoggerFansOut(t *testing.T) {
+	a, b := &memorySink{}, &memorySink{}
+	l := NewMultiLogger(a, b)
+
+	l.Write("plain entry")
+	l.Error("lookup failed", os.ErrNotExist)
+	l.LogRequest("udp", "127.0.0.1:5353", buildTestQuery("example.com", 1), nil, nil)
+	l.Close()
+
+	for name, sink := range map[string]*memorySink{"a": a, "b": b} {
+		if len(sink.entries) != 3 {
+			t.Fatalf("sink %s got %d entries, want 3", name, len(sink.entries))
+		}
+		if sink.entries[0] != "plain entry\n" {
+			t.Errorf("sink %s entry = %q, want newline-terminated entry", name, sink.entries[0])
+		}
+		if !strings.Contains(sink.entries[1], "ERROR: lookup failed") {
+			t.Errorf("sink %s entry = %q, want error entry", name, sink.entries[1])
+		}
+		if !strings.Contains(sink.entries[2], "Question: example.com") {
+			t.Errorf("sink %s entry = %q, want request entry", name, sink.entries[2])
+		}
+		if !sink.closed {
+			t.Errorf("sink %s not closed", name)
+		}
+	}
+}
+
+func TestNewLoggerOutputs(t *testing.T) {
+	cfg := &config.Config{
+		LogPath:    filepath.Join(t.TempDir(), "test.log"),
+		LogOutputs: []string{config.LogOutputFile, config.LogOutputStdout},
+	}
+	l, err := newLogger(cfg)
+	if err != nil {
+		t.Fatalf("newLogger() error = %v", err)
+	}
+	defer l.Close()
+
+	if len(l.sinks) != 2 {
+		t.Fatalf("sinks = %d, want 2", len(l.sinks))
+	}
+	if _, ok := l.sinks[0].(*FileSink); !ok {
+		t.Errorf("sinks[0] = %T, want *FileSink", l.sinks[0])
+	}
+	if _, ok := l.sinks[1].(*StdoutSink); !ok {
+		t.Errorf("sinks[1] = %T, want *StdoutSink", l.sinks[1])
+	}
+	if l.echo {
+		t.Error("echo = true with a stdout sink, entries would print twice")
+	}
+
+	cfg.LogOutputs = nil
+	def, err := newLogger(cfg)
+	if err != nil {
+		t.Fatalf("newLogger() error = %v", err)
+	}
+	defer def.Close()
+	if len(def.sinks) != 1 {
+		t.Errorf("default sinks = %d, want the file sink alone", len(def.sinks))
+	}
+}
@@ -0,0 +1,30 @@
+package dns_listener
+
+import (
+	"io"
+	"sync"
+)
+
+// StdoutSink writes entries unchanged to a writer, normally os.Stdout, for
+// container log collectors
+type StdoutSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutSink creates a sink writing to w
+func NewStdoutSink(w io.Writer) *StdoutSink {
+	return &StdoutSink{w: w}
+}
+
+func (s *StdoutSink) WriteEntry(entry string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.w, entry)
+	return err
+}
+
+// Close is a no-op; the writer is owned by the caller
+func (s *StdoutSink) Close() error {
+	return nil
+}
@@ -0,0 +1,35 @@
+package dns_listener
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// SyslogSink sends entries to the local syslog daemon
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connects to the local syslog daemon, tagging messages with
+// tag
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// WriteEntry sends entry as one message, logging entries that carry an
+// ERROR marker at error severity
+func (s *SyslogSink) WriteEntry(entry string) error {
+	entry = strings.TrimSuffix(entry, "\n")
+	if strings.Contains(entry, " ERROR: ") {
+		return s.w.Err(entry)
+	}
+	return s.w.Info(entry)
+}
+
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
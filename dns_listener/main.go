@@ -2,31 +2,28 @@ package dns_listener
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/exiguus/ns-checker/dns_listener/cache"
 	"github.com/exiguus/ns-checker/dns_listener/config"
-	"github.com/exiguus/ns-checker/dns_listener/health"
 	"github.com/exiguus/ns-checker/dns_listener/network"
 	"github.com/exiguus/ns-checker/dns_listener/protocol/parser"
 	"github.com/exiguus/ns-checker/dns_listener/types"
 )
 
-const (
-	colorReset  = "\033[0m"
-	colorGreen  = "\033[32m"
-	colorYellow = "\033[33m"
-	colorCyan   = "\033[36m"
-)
-
 // Ensure test mode is disabled by default
 var isTestMode = false
 
@@ -35,7 +32,7 @@ func init() {
 }
 
 func calculateOptimalWorkers() int {
-	cpuCount := runtime.NumCPU()
+	cpuCount := availableCPUs()
 
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
@@ -43,24 +40,30 @@ func calculateOptimalWorkers() int {
 	// Convert memory to GB
 	totalMemoryGB := float64(m.Sys) / (1024 * 1024 * 1024)
 
+	workers := optimalWorkers(cpuCount, totalMemoryGB)
+
+	fmt.Printf("System resources: CPU cores: %d, Memory: %.2f GB\n", cpuCount, totalMemoryGB)
+	fmt.Printf("Calculated workers: %d (memory workers: %d, CPU workers: %d)\n",
+		workers, int(totalMemoryGB*4), cpuCount*3)
+
+	return workers
+}
+
+// optimalWorkers sizes the worker pool for cpuCount usable CPUs and
+// memoryGB of memory
+func optimalWorkers(cpuCount int, memoryGB float64) int {
 	// Base calculation:
 	// - Minimum 4 workers
 	// - Maximum of (CPU count * 4)
 	// - 1 worker per 256MB of system memory
-	memoryWorkers := int(totalMemoryGB * 4) // 4 workers per GB of RAM
-	cpuWorkers := cpuCount * 3              // CPU count * I/O waiting factor
+	memoryWorkers := int(memoryGB * 4) // 4 workers per GB of RAM
+	cpuWorkers := cpuCount * 3         // CPU count * I/O waiting factor
 
 	// Choose the smaller of the two to avoid overloading
 	workers := min(memoryWorkers, cpuWorkers)
 
 	// Ensure minimum and maximum bounds
-	workers = max(4, min(workers, cpuCount*4))
-
-	fmt.Printf("System resources: CPU cores: %d, Memory: %.2f GB\n", cpuCount, totalMemoryGB)
-	fmt.Printf("Calculated workers: %d (memory workers: %d, CPU workers: %d)\n",
-		workers, memoryWorkers, cpuWorkers)
-
-	return workers
+	return max(4, min(workers, cpuCount*4))
 }
 
 func min(a, b int) int {
@@ -84,14 +87,14 @@ func printBanner() {
 ║         DNS Listener Active       ║
 ╚═══════════════════════════════════╝
 `
-	fmt.Print(colorGreen, banner, colorReset)
+	fmt.Print(colorize(banner, colorGreen))
 	os.Stdout.Sync()
 }
 
 // printStats prints the DNS listener configuration and stats
 func (d *DNSListener) printStats() {
 	stats := fmt.Sprintf(`
-%s=== DNS Listener Configuration ===%s
+%s
 ► Port: %s
 ► Worker Pool Size: %d workers
 ► Request Channel Buffer: %d requests
@@ -99,10 +102,9 @@ func (d *DNSListener) printStats() {
 ► DNS Message Buffer Size: %d bytes
 ► Cache TTL: %v
 ► Cache Cleanup Interval: %v
-%s===================================%s
+%s
 `,
-		colorCyan,
-		colorReset,
+		colorize("=== DNS Listener Configuration ===", colorCyan),
 		d.config.Port,
 		d.config.WorkerCount,
 		cap(d.requestCh),
@@ -111,48 +113,166 @@ func (d *DNSListener) printStats() {
 		types.DefaultBufferSize,
 		d.config.CacheTTL,
 		d.config.CacheCleanupInterval,
-		colorCyan,
-		colorReset,
+		colorize("===================================", colorCyan),
 	)
 	fmt.Print(stats)
 	os.Stdout.Sync()
 	os.Stderr.Sync() // Add stderr flush
 }
 
+// startupSummary returns a single logfmt line with the effective settings
+func (d *DNSListener) startupSummary() string {
+	fields := []struct {
+		key   string
+		value interface{}
+	}{
+		{"time", time.Now().Format(time.RFC3339)},
+		{"level", "info"},
+		{"msg", "startup summary"},
+		{"bind", d.config.BindAddress},
+		{"port", d.config.Port},
+		{"mode", d.mode()},
+		{"upstream", d.config.UpstreamDNS},
+		{"workers", d.config.WorkerCount},
+		{"cache", cacheType(d.cache)},
+		{"cache_ttl", d.config.CacheTTL},
+		{"rate_limit", d.config.RateLimit},
+		{"rate_burst", d.config.RateBurst},
+		{"health_port", d.config.HealthPort},
+		{"blocklist", d.blocklistLocation() != ""},
+		{"dot", d.config.TLSCertFile != ""},
+		{"compression", !d.config.DisableCompression},
+	}
+
+	var sb strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		value := fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		sb.WriteString(f.key + "=" + value)
+	}
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// mode names how queries without a local answer are resolved
+func (d *DNSListener) mode() string {
+	if d.forwarding() {
+		return "forward"
+	}
+	if d.zoneLocation() != "" {
+		return "zone"
+	}
+	return "sink"
+}
+
+func cacheType(c cache.Cache) string {
+	switch c.(type) {
+	case *cache.BasicCache:
+		return "basic"
+	case *cache.LRUCache:
+		return "lru"
+	case *cache.ShardedCache:
+		return "sharded"
+	case cache.NoopCache:
+		return "none"
+	default:
+		return fmt.Sprintf("%T", c)
+	}
+}
+
 func (d *DNSListener) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Start server without printing message
-	server := network.NewServer(d.config.Port, d)
+	server := network.NewServer(d.config.Port, network.HandlerFunc(d.dispatch))
+	server.TCPIdleTimeout = d.config.TCPIdleTimeout
+	server.BindAddress = d.config.BindAddress
+	if d.config.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(d.config.TLSCertFile, d.config.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		server.TLSPort = d.config.DoTPort
+	}
+	d.server.Store(server)
+
+	if d.config.DoHPort != "" {
+		d.doh = d.newDoHServer()
+		go d.serveDoH(d.doh)
+	}
+
+	// Shutdown stops the background goroutines below
+	go func() {
+		select {
+		case <-d.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	// Only start cache cleanup if interval is positive
-	if d.config.CacheCleanupInterval > 0 {
+	// Only start cache cleanup if the cache is enabled and interval is positive
+	if !d.config.CacheDisabled && d.config.CacheCleanupInterval > 0 {
 		go func() {
 			ticker := time.NewTicker(d.config.CacheCleanupInterval)
 			defer ticker.Stop()
-			for range ticker.C {
-				d.cache.Cleanup()
+			for {
+				select {
+				case <-ticker.C:
+					d.cache.Cleanup()
+				case <-ctx.Done():
+					return
+				}
 			}
 		}()
 	}
-	go d.monitorStats()
+	go d.monitorStats(ctx)
+	go d.probeLogs(ctx)
+
+	if d.hasSources && d.config.SourceRefresh > 0 {
+		go d.refreshSources(ctx)
+	}
+
+	// Dump runtime stats on demand
+	stopStatsSignal := d.handleStatsSignal(os.Stdout)
+	defer stopStatsSignal()
+
+	// Reload zones and blocklists on SIGHUP
+	stopReloadSignal := d.handleReloadSignal()
+	defer stopReloadSignal()
 
 	// Handle shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		<-sigChan
+		select {
+		case <-sigChan:
+		case <-ctx.Done():
+			return
+		}
 		fmt.Println("\nShutting down gracefully...")
-		d.logger.Write("DNS Listener stopped")
-		cancel()
-		server.Stop()
-		d.Close()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := d.Shutdown(shutdownCtx); err != nil {
+			fmt.Printf("Shutdown incomplete: %v\n", err)
+		}
 	}()
 
-	printBanner()
-	d.printStats()
+	d.logger.Write(d.startupSummary())
+	if !d.config.Quiet {
+		printBanner()
+		d.printStats()
+	}
+
+	d.processor.Start()
+	d.started.Store(true)
 
 	// Block on server start
 	if err := server.Start(ctx); err != nil {
@@ -162,6 +282,60 @@ func (d *DNSListener) Start() error {
 	return nil
 }
 
+// handleStatsSignal writes the runtime statistics block to w whenever the
+// process receives SIGUSR1. The returned func stops the handler.
+func (d *DNSListener) handleStatsSignal(w io.Writer) func() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				fmt.Fprint(w, d.formatRuntimeStats())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
+
+// handleReloadSignal reloads the configuration and triggers a reload of
+// the sources whenever the process receives SIGHUP. Signals arriving
+// during a reload are coalesced into one more pass. The returned func
+// stops the handler.
+func (d *DNSListener) handleReloadSignal() func() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				d.logger.Write("Received SIGHUP, reloading\n")
+				if err := d.reloadConfig(); err != nil {
+					d.logger.Write(fmt.Sprintf("Config reload failed, keeping current settings: %v\n", err))
+				}
+				d.reloader.Trigger()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
+
 func parsePort(port string) int {
 	p, err := net.LookupPort("udp", port)
 	if err != nil || p < 1 || p > 65535 {
@@ -199,9 +373,62 @@ func parseDNSQuery(data []byte) string {
 	return result
 }
 
-// Close closes the log file
+// parseDNSResponse converts raw DNS response bytes into a human-readable
+// format, including the records of every section
+func parseDNSResponse(data []byte) string {
+	p := parser.New(data)
+	result, err := p.ParseResponse()
+	if err != nil {
+		return fmt.Sprintf("Error parsing DNS response: %v\n", err)
+	}
+	return result
+}
+
+// shutdownTimeout bounds how long a signalled shutdown waits for the
+// queries being answered
+const shutdownTimeout = 10 * time.Second
+
+// Shutdown stops accepting queries, waits until the queries being answered
+// have been sent or ctx is done, stops the background goroutines of Start
+// and closes the listener like Close. It returns ctx's error when queries
+// were still in flight. Later calls wait for the first one and return its
+// result.
+func (d *DNSListener) Shutdown(ctx context.Context) error {
+	d.shutdownOnce.Do(func() {
+		if server := d.server.Load(); server != nil {
+			d.shutdownErr = server.Shutdown(ctx)
+		}
+		// Queries still waiting for a worker are released once the
+		// server no longer waits for them
+		d.processor.Stop()
+		if err := d.stopDoH(ctx); err != nil && d.shutdownErr == nil {
+			d.shutdownErr = err
+		}
+		close(d.stopChan)
+		d.logger.Write("DNS Listener stopped")
+		d.Close()
+	})
+	return d.shutdownErr
+}
+
+// Close stops the health and DoH servers, saves the cache to CACHE_FILE,
+// if set, stops its cleanup and closes the logger. Only the first call has
+// an effect.
 func (d *DNSListener) Close() {
-	d.logger.Close()
+	d.closeOnce.Do(func() {
+		d.stopHealth()
+		if d.doh != nil {
+			d.doh.Close()
+		}
+		if err := d.saveCache(); err != nil {
+			d.logger.Write(fmt.Sprintf("Saving cache to %s failed: %v\n", d.config.CacheFile, err))
+		}
+		d.cache.Close()
+		if d.otlp != nil {
+			d.otlp.Close()
+		}
+		d.logger.Close()
+	})
 }
 
 // initializeListener creates and initializes a new DNS listener with validation
@@ -223,7 +450,8 @@ func initializeListener(cfg *config.Config) (*DNSListener, error) {
 
 	// Initialize health check server if enabled
 	if cfg.HealthPort != "" {
-		healthServer := health.NewServer(cfg.HealthPort, listener.GetMetrics())
+		healthServer := listener.newHealthServer()
+		listener.health = healthServer
 		go func() {
 			if err := healthServer.Start(); err != nil {
 				fmt.Printf("Health check server failed: %v\n", err)
@@ -255,8 +483,14 @@ func main() {
 }
 
 func run() error {
-	// Load configuration from environment
-	cfg := config.LoadFromEnv()
+	// Match the scheduler to a container CPU quota before sizing workers
+	applyCPUQuota()
+
+	// Load configuration from CONFIG_FILE or the environment
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
 
 	// Validate configuration
 	if err := config.ValidateConfig(cfg); err != nil {
@@ -270,32 +504,10 @@ func run() error {
 	}
 	defer listener.Close()
 
-	// Setup signal handling for graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start listener in a goroutine
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- listener.Start()
-	}()
-
-	// Wait for either error or shutdown signal
-	select {
-	case err := <-errChan:
-		if err != nil {
-			return fmt.Errorf("listener error: %w", err)
-		}
-	case <-stop:
-		fmt.Println("\nReceived shutdown signal")
-		cleanup(listener)
+	// Start shuts the listener down on SIGINT and SIGTERM, letting the
+	// queries in flight finish, and returns once it has
+	if err := listener.Start(); err != nil {
+		return fmt.Errorf("listener error: %w", err)
 	}
-
 	return nil
 }
-
-func cleanup(d *DNSListener) {
-	if d.cache != nil {
-		d.cache.Cleanup()
-	}
-}
@@ -1,11 +1,21 @@
 package dns_listener
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
 	"github.com/exiguus/ns-checker/dns_listener/types"
 )
 
@@ -20,6 +30,65 @@ func TestCalculateOptimalWorkers(t *testing.T) {
 	}
 }
 
+func TestWorkersRespectCPUQuota(t *testing.T) {
+	defer func(n func() int, q func() (float64, bool)) { numCPU, cpuQuota = n, q }(numCPU, cpuQuota)
+
+	// A 64 core host running a container limited to 1.5 CPUs
+	numCPU = func() int { return 64 }
+	cpuQuota = func() (float64, bool) { return 1.5, true }
+
+	if cpus := availableCPUs(); cpus != 2 {
+		t.Fatalf("availableCPUs() = %d, want quota rounded up to 2", cpus)
+	}
+	if workers := optimalWorkers(availableCPUs(), 64); workers != 6 {
+		t.Errorf("optimalWorkers() = %d, want 6 for 2 CPUs", workers)
+	}
+
+	// Without a quota the host cores count
+	cpuQuota = func() (float64, bool) { return 0, false }
+	if cpus := availableCPUs(); cpus != 64 {
+		t.Errorf("availableCPUs() = %d, want 64 without quota", cpus)
+	}
+}
+
+func TestReadCgroupQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  float64
+		ok    bool
+	}{
+		{"cgroup v2 limit", map[string]string{"cpu.max": "250000 100000\n"}, 2.5, true},
+		{"cgroup v2 unlimited", map[string]string{"cpu.max": "max 100000\n"}, 0, false},
+		{"cgroup v1 limit", map[string]string{
+			"cpu/cpu.cfs_quota_us":  "50000\n",
+			"cpu/cpu.cfs_period_us": "100000\n",
+		}, 0.5, true},
+		{"cgroup v1 unlimited", map[string]string{
+			"cpu/cpu.cfs_quota_us":  "-1\n",
+			"cpu/cpu.cfs_period_us": "100000\n",
+		}, 0, false},
+		{"no cgroup files", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, ok := readCgroupQuota(root)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("readCgroupQuota() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
 func TestParsePort(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -146,3 +215,282 @@ func TestDNSListenerIntegration(t *testing.T) {
 		t.Fatalf("Failed to read response: %v", err)
 	}
 }
+
+func TestStatsSignalDump(t *testing.T) {
+	cfg := &config.Config{
+		Port:                 "45354",
+		LogPath:              t.TempDir() + "/test.log",
+		WorkerCount:          4,
+		CacheTTL:             time.Minute,
+		CacheCleanupInterval: time.Minute,
+		RateLimit:            1000,
+		RateBurst:            100,
+	}
+
+	listener, err := NewDNSListener(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	r, w := io.Pipe()
+	defer r.Close()
+
+	stop := listener.handleStatsSignal(w)
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("Failed to send SIGUSR1: %v", err)
+	}
+
+	found := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if strings.Contains(scanner.Text(), "=== Runtime Statistics ===") {
+				found <- true
+				return
+			}
+		}
+		found <- false
+	}()
+
+	select {
+	case ok := <-found:
+		if !ok {
+			t.Error("Expected runtime statistics block after SIGUSR1")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("No stats dump received after SIGUSR1")
+	}
+	w.Close()
+}
+
+func TestReloadSignal(t *testing.T) {
+	cfg := &config.Config{
+		Port:                 "45355",
+		LogPath:              t.TempDir() + "/test.log",
+		WorkerCount:          4,
+		CacheTTL:             time.Minute,
+		CacheCleanupInterval: time.Minute,
+		RateLimit:            1000,
+		RateBurst:            100,
+	}
+
+	listener, err := NewDNSListener(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	reloaded := make(chan struct{}, 1)
+	listener.reloader.Register("test", func() error {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	stop := listener.handleReloadSignal()
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("Failed to send SIGHUP: %v", err)
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Error("No reload after SIGHUP")
+	}
+	listener.reloader.Wait()
+}
+
+func TestStartupSummary(t *testing.T) {
+	cfg := &config.Config{
+		Port:                 "45357",
+		HealthPort:           "45358",
+		LogPath:              t.TempDir() + "/test.log",
+		WorkerCount:          6,
+		CacheTTL:             time.Minute,
+		CacheCleanupInterval: time.Minute,
+		RateLimit:            1000,
+		RateBurst:            100,
+	}
+
+	listener, err := NewDNSListener(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	summary := listener.startupSummary()
+	if strings.Count(summary, "\n") != 1 || !strings.HasSuffix(summary, "\n") {
+		t.Errorf("summary should be a single line, got %q", summary)
+	}
+	for _, want := range []string{`msg="startup summary"`, "port=45357", "mode=sink", "workers=6", "cache=basic"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary %q does not contain %q", summary, want)
+		}
+	}
+
+	cfg.ZoneFile = "example.zone"
+	if summary := listener.startupSummary(); !strings.Contains(summary, "mode=zone") {
+		t.Errorf("summary %q does not contain mode=zone", summary)
+	}
+}
+
+func TestShutdownDrainsInflight(t *testing.T) {
+	d := newTestListener(t, &config.Config{Quiet: true})
+
+	// Hold the query in the resolver until Shutdown has begun
+	started := make(chan struct{})
+	var once sync.Once
+	d.resolve = func(query []byte) []byte {
+		once.Do(func() { close(started) })
+		time.Sleep(200 * time.Millisecond)
+		return d.createResponse(query)
+	}
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- d.Start() }()
+	deadline := time.Now().Add(2 * time.Second)
+	for server := d.server.Load(); server == nil || !server.Listening(); server = d.server.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+d.config.Port)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(buildTestQuery("drain.example.com", protocol.TypeA)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("query was not resolved")
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		shutdownErr <- d.Shutdown(ctx)
+	}()
+
+	// The query in flight is still answered
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response := make([]byte, 512)
+	n, err := conn.Read(response)
+	if err != nil {
+		t.Fatalf("in-flight query got no response: %v", err)
+	}
+	if n < 2 || response[0] != 0xab || response[1] != 0xcd {
+		t.Errorf("response does not match the query: % x", response[:n])
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown() = %v, want nil", err)
+	}
+	select {
+	case err := <-startErr:
+		if err != nil {
+			t.Errorf("Start() = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start did not return after Shutdown")
+	}
+	if d.server.Load().Listening() {
+		t.Error("server still listening after Shutdown")
+	}
+}
+
+func TestStartServesThroughWorkers(t *testing.T) {
+	d := newTestListener(t, &config.Config{Quiet: true})
+
+	// Hold every resolution so the workers stay busy
+	release := make(chan struct{})
+	resolving := make(chan struct{}, 16)
+	d.resolve = func(query []byte) []byte {
+		resolving <- struct{}{}
+		<-release
+		return d.createResponse(query)
+	}
+
+	go d.Start()
+	t.Cleanup(func() { d.Shutdown(context.Background()) })
+	deadline := time.Now().Add(2 * time.Second)
+	for server := d.server.Load(); server == nil || !server.Listening(); server = d.server.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// One query more than there are workers, each on its own socket
+	n := d.config.WorkerCount + 1
+	conns := make([]net.Conn, n)
+	for i := range conns {
+		conn, err := net.Dial("udp", "127.0.0.1:"+d.config.Port)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write(buildTestQuery(fmt.Sprintf("worker%d.example", i), protocol.TypeA)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		conns[i] = conn
+	}
+
+	// The workers each hold a query and the last one waits in the queue
+	for i := 0; i < d.config.WorkerCount; i++ {
+		<-resolving
+	}
+	for deadline := time.Now().Add(time.Second); len(d.requestCh) != 1; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued requests = %d with all workers busy, want 1", len(d.requestCh))
+		}
+	}
+
+	// Once released every query is answered, the queued one included
+	go func() {
+		for {
+			select {
+			case release <- struct{}{}:
+			case <-time.After(2 * time.Second):
+				return
+			}
+		}
+	}()
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response := make([]byte, 512)
+		n, err := conn.Read(response)
+		if err != nil {
+			t.Fatalf("query %d got no response: %v", i, err)
+		}
+		if n < 12 || response[0] != 0xab || response[1] != 0xcd {
+			t.Errorf("query %d response does not match: % x", i, response[:n])
+		}
+	}
+
+	// TCP queries take the same path
+	conn, err := net.Dial("tcp", "127.0.0.1:"+d.config.Port)
+	if err != nil {
+		t.Fatalf("dial tcp: %v", err)
+	}
+	defer conn.Close()
+	query := buildTestQuery("tcp.example", protocol.TypeA)
+	conn.Write(append([]byte{byte(len(query) >> 8), byte(len(query))}, query...))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var prefix [2]byte
+	if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+		t.Fatalf("TCP query got no response: %v", err)
+	}
+}
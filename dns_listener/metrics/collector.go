@@ -11,6 +11,12 @@ type Collector struct {
 	cacheHits        uint64
 	cacheMisses      uint64
 	errors           uint64
+	shedRequests     uint64
+	blockedRequests  uint64
+	revalidations    uint64
+	coalesced        uint64
+	queueDropped     uint64
+	upstreamInFlight int64
 	responseTimes    []time.Duration
 	responseTimeLock sync.RWMutex
 }
@@ -21,14 +27,34 @@ func NewCollector() *Collector {
 	}
 }
 
-func (c *Collector) RecordRequest()           { atomic.AddUint64(&c.totalRequests, 1) }
-func (c *Collector) RecordCacheHit()          { atomic.AddUint64(&c.cacheHits, 1) }
-func (c *Collector) RecordCacheMiss()         { atomic.AddUint64(&c.cacheMisses, 1) }
-func (c *Collector) RecordError()             { atomic.AddUint64(&c.errors, 1) }
-func (c *Collector) GetTotalRequests() uint64 { return atomic.LoadUint64(&c.totalRequests) }
-func (c *Collector) GetCacheHits() uint64     { return atomic.LoadUint64(&c.cacheHits) }
-func (c *Collector) GetCacheMisses() uint64   { return atomic.LoadUint64(&c.cacheMisses) }
-func (c *Collector) GetErrors() uint64        { return atomic.LoadUint64(&c.errors) }
+func (c *Collector) RecordRequest()             { atomic.AddUint64(&c.totalRequests, 1) }
+func (c *Collector) RecordCacheHit()            { atomic.AddUint64(&c.cacheHits, 1) }
+func (c *Collector) RecordCacheMiss()           { atomic.AddUint64(&c.cacheMisses, 1) }
+func (c *Collector) RecordError()               { atomic.AddUint64(&c.errors, 1) }
+func (c *Collector) RecordShed()                { atomic.AddUint64(&c.shedRequests, 1) }
+func (c *Collector) RecordBlocked()             { atomic.AddUint64(&c.blockedRequests, 1) }
+func (c *Collector) RecordRevalidation()        { atomic.AddUint64(&c.revalidations, 1) }
+func (c *Collector) RecordCoalesced()           { atomic.AddUint64(&c.coalesced, 1) }
+func (c *Collector) RecordQueueDropped()        { atomic.AddUint64(&c.queueDropped, 1) }
+func (c *Collector) GetTotalRequests() uint64   { return atomic.LoadUint64(&c.totalRequests) }
+func (c *Collector) GetCacheHits() uint64       { return atomic.LoadUint64(&c.cacheHits) }
+func (c *Collector) GetCacheMisses() uint64     { return atomic.LoadUint64(&c.cacheMisses) }
+func (c *Collector) GetErrors() uint64          { return atomic.LoadUint64(&c.errors) }
+func (c *Collector) GetShedRequests() uint64    { return atomic.LoadUint64(&c.shedRequests) }
+func (c *Collector) GetBlockedRequests() uint64 { return atomic.LoadUint64(&c.blockedRequests) }
+func (c *Collector) GetRevalidations() uint64   { return atomic.LoadUint64(&c.revalidations) }
+
+// GetCoalescedRequests counts cache misses that shared the upstream
+// resolution of an identical query in flight
+func (c *Collector) GetCoalescedRequests() uint64 { return atomic.LoadUint64(&c.coalesced) }
+
+// GetQueueDropped counts requests the processor dropped because its queue
+// was full
+func (c *Collector) GetQueueDropped() uint64 { return atomic.LoadUint64(&c.queueDropped) }
+
+// AddUpstreamInFlight adjusts the gauge of running upstream queries
+func (c *Collector) AddUpstreamInFlight(delta int64) { atomic.AddInt64(&c.upstreamInFlight, delta) }
+func (c *Collector) GetUpstreamInFlight() int64      { return atomic.LoadInt64(&c.upstreamInFlight) }
 
 func (c *Collector) RecordResponseTime(d time.Duration) {
 	c.responseTimeLock.Lock()
@@ -42,19 +68,30 @@ func (c *Collector) RecordResponseTime(d time.Duration) {
 
 func (c *Collector) GetStats() map[string]interface{} {
 	return map[string]interface{}{
-		"total_requests": c.GetTotalRequests(),
-		"cache_hits":     c.GetCacheHits(),
-		"cache_misses":   c.GetCacheMisses(),
-		"errors":         c.GetErrors(),
+		"total_requests":     c.GetTotalRequests(),
+		"cache_hits":         c.GetCacheHits(),
+		"cache_misses":       c.GetCacheMisses(),
+		"errors":             c.GetErrors(),
+		"shed_requests":      c.GetShedRequests(),
+		"blocked_requests":   c.GetBlockedRequests(),
+		"revalidations":      c.GetRevalidations(),
+		"coalesced_requests": c.GetCoalescedRequests(),
+		"queue_dropped":      c.GetQueueDropped(),
+		"upstream_inflight":  c.GetUpstreamInFlight(),
 	}
 }
 
 // Add GetRawStats method to Collector
 func (c *Collector) GetRawStats() map[string]uint64 {
 	return map[string]uint64{
-		"total_requests": c.GetTotalRequests(),
-		"cache_hits":     c.GetCacheHits(),
-		"cache_misses":   c.GetCacheMisses(),
-		"errors":         c.GetErrors(),
+		"total_requests":     c.GetTotalRequests(),
+		"cache_hits":         c.GetCacheHits(),
+		"cache_misses":       c.GetCacheMisses(),
+		"errors":             c.GetErrors(),
+		"shed_requests":      c.GetShedRequests(),
+		"blocked_requests":   c.GetBlockedRequests(),
+		"revalidations":      c.GetRevalidations(),
+		"coalesced_requests": c.GetCoalescedRequests(),
+		"queue_dropped":      c.GetQueueDropped(),
 	}
 }
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -37,3 +39,44 @@ func TestMetrics(t *testing.T) {
 		t.Error("Last request time should be a time.Time value")
 	}
 }
+
+func TestPrometheusHandler(t *testing.T) {
+	c := NewCollector()
+	c.RecordRequest()
+	c.RecordRequest()
+	c.RecordCacheHit()
+
+	summary := func() []Family {
+		return []Family{{
+			MetricDefinition: MetricDefinition{Name: "latency_seconds", Type: SummaryMetric, Description: "Latency."},
+			Values: []MetricValue{
+				{Value: 0.25, Labels: map[string]string{"quantile": "0.5", "proto": "udp"}},
+			},
+			Sum:   1.5,
+			Count: 4,
+		}}
+	}
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler(c.Families, summary).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE dns_requests_total counter",
+		"dns_requests_total 2",
+		"dns_cache_hits_total 1",
+		"dns_cache_misses_total 0",
+		"# TYPE dns_upstream_inflight gauge",
+		"# TYPE latency_seconds summary",
+		`latency_seconds{proto="udp",quantile="0.5"} 0.25`,
+		"latency_seconds_sum 1.5",
+		"latency_seconds_count 4",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("exposition lacks %q:\n%s", line, body)
+		}
+	}
+}
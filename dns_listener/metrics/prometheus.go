@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Family is a metric with its current values, as rendered by
+// PrometheusHandler. Sum and Count are only written for a SummaryMetric,
+// whose values carry a "quantile" label.
+type Family struct {
+	MetricDefinition
+	Values []MetricValue
+	Sum    float64
+	Count  uint64
+}
+
+// Gatherer returns the metric families of one source
+type Gatherer func() []Family
+
+// PrometheusHandler serves the families of all gatherers in the Prometheus
+// text exposition format
+func PrometheusHandler(gatherers ...Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, gather := range gatherers {
+			for _, f := range gather() {
+				writeFamily(w, f)
+			}
+		}
+	})
+}
+
+// Families returns the request counters of c
+func (c *Collector) Families() []Family {
+	return []Family{
+		NewCounter("dns_requests_total", "DNS queries accepted for resolution.", c.GetTotalRequests()),
+		NewCounter("dns_cache_hits_total", "Queries answered from the cache.", c.GetCacheHits()),
+		NewCounter("dns_cache_misses_total", "Queries not found in the cache.", c.GetCacheMisses()),
+		NewCounter("dns_errors_total", "Queries that failed, including rate limited ones.", c.GetErrors()),
+		NewCounter("dns_shed_requests_total", "Queries shed under overload.", c.GetShedRequests()),
+		NewCounter("dns_blocked_total", "Queries for names on the blocklist.", c.GetBlockedRequests()),
+		NewCounter("dns_coalesced_requests_total", "Cache misses that shared an identical upstream query in flight.", c.GetCoalescedRequests()),
+		NewCounter("dns_queue_dropped_total", "Requests dropped because the processor queue was full.", c.GetQueueDropped()),
+		NewGauge("dns_upstream_inflight", "Upstream queries currently running.", float64(c.GetUpstreamInFlight())),
+	}
+}
+
+// NewCounter returns a family holding the single counter value v
+func NewCounter(name, help string, v uint64) Family {
+	return Family{
+		MetricDefinition: MetricDefinition{Name: name, Type: CounterMetric, Description: help},
+		Values:           []MetricValue{{Value: float64(v)}},
+	}
+}
+
+// NewGauge returns a family holding the single gauge value v
+func NewGauge(name, help string, v float64) Family {
+	return Family{
+		MetricDefinition: MetricDefinition{Name: name, Type: GaugeMetric, Description: help},
+		Values:           []MetricValue{{Value: v}},
+	}
+}
+
+func (t MetricType) String() string {
+	switch t {
+	case CounterMetric:
+		return "counter"
+	case GaugeMetric:
+		return "gauge"
+	case HistogramMetric:
+		return "histogram"
+	case SummaryMetric:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
+func writeFamily(w io.Writer, f Family) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.Name, f.Description)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+	for _, v := range f.Values {
+		fmt.Fprintf(w, "%s%s %s\n", f.Name, formatLabels(v.Labels), formatValue(v.Value))
+	}
+	if f.Type == SummaryMetric {
+		fmt.Fprintf(w, "%s_sum %s\n", f.Name, formatValue(f.Sum))
+		fmt.Fprintf(w, "%s_count %d\n", f.Name, f.Count)
+	}
+}
+
+// formatLabels renders labels sorted by name, or nothing without labels
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
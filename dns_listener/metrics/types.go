@@ -9,6 +9,7 @@ const (
 	CounterMetric MetricType = iota
 	GaugeMetric
 	HistogramMetric
+	SummaryMetric
 )
 
 // MetricValue represents a metric value with timestamp
@@ -8,3 +8,11 @@ import (
 type RequestHandler interface {
 	HandleRequest(data []byte, addr net.Addr, protocol string) ([]byte, error)
 }
+
+// HandlerFunc adapts a function to a RequestHandler
+type HandlerFunc func(data []byte, addr net.Addr, protocol string) ([]byte, error)
+
+// HandleRequest calls f
+func (f HandlerFunc) HandleRequest(data []byte, addr net.Addr, protocol string) ([]byte, error) {
+	return f(data, addr, protocol)
+}
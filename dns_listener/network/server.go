@@ -2,37 +2,64 @@ package network
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
 	udpConn     *net.UDPConn
 	tcpListener net.Listener
+	tlsListener net.Listener
 	handler     RequestHandler
 	wg          sync.WaitGroup
 	stopChan    chan struct{}
 	port        string
 	ctx         context.Context
 	cancel      context.CancelFunc
+	udpUp       atomic.Bool
+	tcpUp       atomic.Bool
+	tlsUp       atomic.Bool
+	inflight    sync.WaitGroup // queries being answered and open TCP connections
+	connsMu     sync.Mutex
+	conns       map[net.Conn]struct{}
+
+	// TCPIdleTimeout bounds how long a TCP client may take to send each
+	// query; zero waits indefinitely. Set it before Start.
+	TCPIdleTimeout time.Duration
+
+	// TLSConfig enables DNS over TLS (RFC 7858) on TLSPort, with the same
+	// framing as TCP. Nil leaves it off. Set both before Start.
+	TLSConfig *tls.Config
+	TLSPort   string
+
+	// BindAddress is the IP the listeners accept queries on. An IPv4 or
+	// IPv6 address listens on that address family only; empty or "::"
+	// listens on all IPv4 and IPv6 addresses. Set it before Start.
+	BindAddress string
 }
 
 func NewServer(port string, handler RequestHandler) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
-		handler:  handler,
-		stopChan: make(chan struct{}),
-		port:     port,
-		ctx:      ctx,
-		cancel:   cancel,
+		handler:     handler,
+		stopChan:    make(chan struct{}),
+		conns:       make(map[net.Conn]struct{}),
+		port:        port,
+		ctx:         ctx,
+		cancel:      cancel,
+		BindAddress: "0.0.0.0",
 	}
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 3)
 
 	s.wg.Add(2) // Add for UDP and TCP servers
 
@@ -52,6 +79,17 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}()
 
+	// Start DNS over TLS listener
+	if s.TLSConfig != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.startTLS(); err != nil {
+				errChan <- fmt.Errorf("TLS listener failed: %w", err)
+			}
+		}()
+	}
+
 	// Wait for context cancellation or error
 	select {
 	case err := <-errChan:
@@ -61,6 +99,15 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// Listening reports whether the UDP, the TCP and, if configured, the TLS
+// listener are accepting queries
+func (s *Server) Listening() bool {
+	if s.TLSConfig != nil && !s.tlsUp.Load() {
+		return false
+	}
+	return s.udpUp.Load() && s.tcpUp.Load()
+}
+
 func (s *Server) Stop() {
 	s.cancel() // Signal all goroutines to stop
 
@@ -70,22 +117,81 @@ func (s *Server) Stop() {
 	if s.tcpListener != nil {
 		s.tcpListener.Close()
 	}
+	if s.tlsListener != nil {
+		s.tlsListener.Close()
+	}
 
 	s.wg.Wait() // Wait for main server goroutines to finish
 }
 
+// Shutdown stops accepting queries and waits until the queries being
+// answered have been sent or ctx is done. TCP connections are closed once
+// their current query is answered. The UDP socket stays open for the
+// replies until then, so its answers are not lost.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancel()
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+	if s.tlsListener != nil {
+		s.tlsListener.Close()
+	}
+	if s.udpConn != nil {
+		// Unblock the read loop without closing the socket
+		s.udpConn.SetReadDeadline(time.Now())
+	}
+	// Once the accept and read loops are gone no new queries are started
+	s.wg.Wait()
+
+	// Idle connections stop waiting for their next query
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.connsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	return err
+}
+
 func (s *Server) startUDP() error {
+	network, ip, err := s.bindIP("udp")
+	if err != nil {
+		return err
+	}
 	addr := &net.UDPAddr{
 		Port: s.getPort(),
-		IP:   net.ParseIP("0.0.0.0"),
+		IP:   ip,
 	}
 
-	conn, err := net.ListenUDP("udp", addr)
+	conn, err := net.ListenUDP(network, addr)
 	if err != nil {
 		return fmt.Errorf("failed to start UDP listener: %w", err)
 	}
 	s.udpConn = conn
-	fmt.Printf("UDP server listening on %s:%d\n", addr.IP, addr.Port)
+	s.udpUp.Store(true)
+	defer s.udpUp.Store(false)
+	fmt.Printf("UDP server listening on %s\n", conn.LocalAddr())
 
 	buffer := make([]byte, 4096)
 	for {
@@ -95,50 +201,107 @@ func (s *Server) startUDP() error {
 		default:
 			n, remoteAddr, err := conn.ReadFromUDP(buffer)
 			if err != nil {
-				if !strings.Contains(err.Error(), "use of closed network connection") {
+				if s.ctx.Err() == nil && !strings.Contains(err.Error(), "use of closed network connection") {
 					fmt.Printf("UDP read error: %v\n", err)
 				}
 				return nil
 			}
 
-			go s.handleUDPRequest(buffer[:n], remoteAddr)
+			// The buffer is reused by the next read
+			data := append([]byte(nil), buffer[:n]...)
+			s.inflight.Add(1)
+			go func() {
+				defer s.inflight.Done()
+				s.handleUDPRequest(data, remoteAddr)
+			}()
 		}
 	}
 }
 
 func (s *Server) startTCP() error {
+	network, ip, err := s.bindIP("tcp")
+	if err != nil {
+		return err
+	}
 	addr := &net.TCPAddr{
 		Port: s.getPort(),
-		IP:   net.ParseIP("0.0.0.0"),
+		IP:   ip,
 	}
-	conn, err := net.Listen("tcp", addr.String())
+	conn, err := net.Listen(network, addr.String())
 	if err != nil {
 		return fmt.Errorf("failed to start TCP listener: %w", err)
 	}
 	s.tcpListener = conn
-	fmt.Printf("TCP server listening on %s:%d\n", addr.IP, addr.Port)
+	s.tcpUp.Store(true)
+	defer s.tcpUp.Store(false)
+	fmt.Printf("TCP server listening on %s\n", conn.Addr())
+
+	s.serveStream(conn, "TCP")
+	return nil
+}
 
+// startTLS serves DNS over TLS on TLSPort
+func (s *Server) startTLS() error {
+	network, ip, err := s.bindIP("tcp")
+	if err != nil {
+		return err
+	}
+	addr := &net.TCPAddr{
+		Port: portNumber(s.TLSPort, 853),
+		IP:   ip,
+	}
+	listener, err := tls.Listen(network, addr.String(), s.TLSConfig)
+	if err != nil {
+		return fmt.Errorf("failed to start TLS listener: %w", err)
+	}
+	s.tlsListener = listener
+	s.tlsUp.Store(true)
+	defer s.tlsUp.Store(false)
+	fmt.Printf("TLS server listening on %s\n", listener.Addr())
+
+	s.serveStream(listener, "TLS")
+	return nil
+}
+
+// serveStream accepts connections on listener until it is closed and
+// answers their length prefixed queries as protocol
+func (s *Server) serveStream(listener net.Listener, protocol string) {
 	for {
 		select {
 		case <-s.ctx.Done():
-			return nil
+			return
 		default:
-			conn, err := s.tcpListener.Accept()
+			conn, err := listener.Accept()
 			if err != nil {
 				if !strings.Contains(err.Error(), "use of closed network connection") {
-					fmt.Printf("TCP accept error: %v\n", err)
+					fmt.Printf("%s accept error: %v\n", protocol, err)
 				}
-				return nil
+				return
 			}
 
+			s.inflight.Add(1)
+			s.track(conn, true)
 			go func() {
+				defer s.inflight.Done()
+				defer s.track(conn, false)
 				defer conn.Close()
-				s.handleTCPConnection(conn)
+				s.handleTCPConnection(conn, protocol)
 			}()
 		}
 	}
 }
 
+// track adds conn to or removes it from the open TCP connections
+func (s *Server) track(conn net.Conn, open bool) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if open {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
 func (s *Server) handleUDPRequest(data []byte, addr *net.UDPAddr) {
 	// Handle request
 	response, err := s.handler.HandleRequest(data, addr, "UDP")
@@ -158,44 +321,82 @@ func (s *Server) handleUDPRequest(data []byte, addr *net.UDPAddr) {
 	}
 }
 
-func (s *Server) handleTCPConnection(conn net.Conn) {
-	buffer := make([]byte, 512)
+// maxTCPMessage is the largest message a 2 byte length prefix can frame
+const maxTCPMessage = 65535
+
+// handleTCPConnection answers the queries a client sends over conn, one
+// after another, until the client closes it, sends a malformed frame or
+// stays idle past TCPIdleTimeout. Clients may pipeline queries (RFC 7766).
+// protocol names the transport to the handler.
+func (s *Server) handleTCPConnection(conn net.Conn, protocol string) {
+	var prefix [2]byte
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
 		default:
+			// The deadline covers the whole message so a slow client gets the
+			// same allowance whether it sends in one segment or several
+			if s.TCPIdleTimeout > 0 {
+				conn.SetReadDeadline(time.Now().Add(s.TCPIdleTimeout))
+			}
+
 			// Read message length
-			if _, err := conn.Read(buffer[:2]); err != nil {
+			if _, err := io.ReadFull(conn, prefix[:]); err != nil {
 				return
 			}
-			length := int(buffer[0])<<8 | int(buffer[1])
-
-			// Read message
-			if length > len(buffer)-2 {
+			length := int(prefix[0])<<8 | int(prefix[1])
+			if length == 0 {
 				return
 			}
-			if _, err := conn.Read(buffer[2 : length+2]); err != nil {
+
+			// Read message; each query gets its own buffer since handlers
+			// may still use it after answering
+			message := make([]byte, length)
+			if _, err := io.ReadFull(conn, message); err != nil {
 				return
 			}
 
-			response, err := s.handler.HandleRequest(buffer[2:length+2], conn.RemoteAddr(), "TCP")
-			if err != nil {
+			response, err := s.handler.HandleRequest(message, conn.RemoteAddr(), protocol)
+			if err != nil || response == nil || len(response) > maxTCPMessage {
 				continue
 			}
 
-			// Write response length
-			respLen := len(response)
-			conn.Write([]byte{byte(respLen >> 8), byte(respLen)})
-			conn.Write(response)
+			// Write length and response in one frame
+			frame := make([]byte, 2, 2+len(response))
+			frame[0], frame[1] = byte(len(response)>>8), byte(len(response))
+			if _, err := conn.Write(append(frame, response...)); err != nil {
+				return
+			}
 		}
 	}
 }
 
+// bindIP returns the network, base or its IPv4 or IPv6 only variant, and
+// the IP to listen on for BindAddress. A nil IP listens on every address.
+func (s *Server) bindIP(base string) (string, net.IP, error) {
+	if s.BindAddress == "" || s.BindAddress == "::" {
+		return base, nil, nil
+	}
+	ip := net.ParseIP(s.BindAddress)
+	if ip == nil {
+		return "", nil, fmt.Errorf("invalid bind address %q", s.BindAddress)
+	}
+	if ip.To4() != nil {
+		return base + "4", ip, nil
+	}
+	return base + "6", ip, nil
+}
+
 func (s *Server) getPort() int {
-	port, err := strconv.Atoi(s.port)
-	if err != nil || port < 1 || port > 65535 {
-		return 25353 // Default port
+	return portNumber(s.port, 25353)
+}
+
+// portNumber parses port, falling back to def when it is not a valid port
+func portNumber(port string, def int) int {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return def
 	}
-	return port
+	return n
 }
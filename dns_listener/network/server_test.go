@@ -2,6 +2,14 @@ package network
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
 	"net"
 	"testing"
 	"time"
@@ -27,8 +35,14 @@ func TestServer(t *testing.T) {
 
 	// Wait for server to start
 	time.Sleep(100 * time.Millisecond)
+	if !server.Listening() {
+		t.Error("Listening() = false after start")
+	}
 
 	server.Stop()
+	if server.Listening() {
+		t.Error("Listening() = true after Stop")
+	}
 
 	select {
 	case err := <-errCh:
@@ -39,3 +53,219 @@ func TestServer(t *testing.T) {
 		t.Error("server didn't stop in time")
 	}
 }
+
+func TestTCPIdleTimeout(t *testing.T) {
+	server := NewServer("0", &mockHandler{})
+	server.TCPIdleTimeout = 500 * time.Millisecond
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go func() {
+		server.handleTCPConnection(conn, "TCP")
+		conn.Close()
+	}()
+
+	// A query arriving within the timeout, split across two writes, is
+	// still answered
+	query := []byte{0x12, 0x34, 0x01, 0x00}
+	time.Sleep(200 * time.Millisecond)
+	client.Write([]byte{0, byte(len(query))})
+	time.Sleep(200 * time.Millisecond)
+	client.Write(query)
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, 2+len(query))
+	if _, err := io.ReadFull(client, response); err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if string(response[2:]) != string(query) {
+		t.Errorf("response = %x, want echo of %x", response[2:], query)
+	}
+
+	// An idle connection is closed once the timeout passes
+	if _, err := client.Read(response); err != io.EOF {
+		t.Errorf("read on idle connection = %v, want EOF", err)
+	}
+}
+
+func TestTCPPipelinedQueries(t *testing.T) {
+	server := NewServer("0", &mockHandler{})
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	go func() {
+		server.handleTCPConnection(conn, "TCP")
+		conn.Close()
+	}()
+
+	// Two queries sent back to back, the second larger than the old 512
+	// byte buffer
+	first := []byte{0x00, 0x01, 0x01, 0x00}
+	second := make([]byte, 1024)
+	second[0], second[1] = 0x00, 0x02
+	var frames []byte
+	for _, query := range [][]byte{first, second} {
+		frames = append(frames, byte(len(query)>>8), byte(len(query)))
+		frames = append(frames, query...)
+	}
+	go client.Write(frames)
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for _, query := range [][]byte{first, second} {
+		prefix := make([]byte, 2)
+		if _, err := io.ReadFull(client, prefix); err != nil {
+			t.Fatalf("reading response length: %v", err)
+		}
+		if length := int(prefix[0])<<8 | int(prefix[1]); length != len(query) {
+			t.Fatalf("response length = %d, want %d", length, len(query))
+		}
+		response := make([]byte, len(query))
+		if _, err := io.ReadFull(client, response); err != nil {
+			t.Fatalf("reading response: %v", err)
+		}
+		if string(response) != string(query) {
+			t.Errorf("response = %x, want echo of %x", response[:4], query[:4])
+		}
+	}
+}
+
+// selfSignedCert returns a certificate for localhost valid for an hour
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDNSOverTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	server := NewServer("45357", &mockHandler{})
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.TLSPort = "45858"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+	defer server.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !server.Listening() {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	client, err := tls.Dial("tcp", "127.0.0.1:45858", &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("TLS dial: %v", err)
+	}
+	defer client.Close()
+
+	query := []byte{0x12, 0x34, 0x01, 0x00}
+	if _, err := client.Write(append([]byte{0, byte(len(query))}, query...)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, 2+len(query))
+	if _, err := io.ReadFull(client, response); err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if string(response[2:]) != string(query) {
+		t.Errorf("response = %x, want echo of %x", response[2:], query)
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	server := NewServer("45359", &mockHandler{})
+	server.BindAddress = "127.0.0.1"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+	defer server.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !server.Listening() {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only the loopback address is bound
+	if addr := server.udpConn.LocalAddr().(*net.UDPAddr); !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("UDP bound to %v, want 127.0.0.1", addr)
+	}
+	if addr := server.tcpListener.Addr().(*net.TCPAddr); !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("TCP bound to %v, want 127.0.0.1", addr)
+	}
+
+	// A query from loopback is answered
+	client, err := net.Dial("udp", "127.0.0.1:45359")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	query := []byte{0x12, 0x34, 0x01, 0x00}
+	if _, err := client.Write(query); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	response := make([]byte, 512)
+	n, err := client.Read(response)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if string(response[:n]) != string(query) {
+		t.Errorf("response = %x, want echo of %x", response[:n], query)
+	}
+}
+
+func TestBindIP(t *testing.T) {
+	tests := []struct {
+		bind    string
+		network string
+		ip      net.IP
+		wantErr bool
+	}{
+		{bind: "0.0.0.0", network: "udp4", ip: net.IPv4zero},
+		{bind: "127.0.0.1", network: "udp4", ip: net.IPv4(127, 0, 0, 1)},
+		{bind: "::1", network: "udp6", ip: net.IPv6loopback},
+		{bind: "::", network: "udp"},
+		{bind: "", network: "udp"},
+		{bind: "localhost", wantErr: true},
+	}
+	for _, tt := range tests {
+		server := &Server{BindAddress: tt.bind}
+		network, ip, err := server.bindIP("udp")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("bindIP() with %q error = %v, wantErr %v", tt.bind, err, tt.wantErr)
+			continue
+		}
+		if network != tt.network || !ip.Equal(tt.ip) {
+			t.Errorf("bindIP() with %q = %s %v, want %s %v", tt.bind, network, ip, tt.network, tt.ip)
+		}
+	}
+}
@@ -39,6 +39,8 @@ type Monitor struct {
 	lastUpdate     time.Time
 	goroutines     uint64
 	heapAlloc      uint64
+	count          uint64 // responses recorded since start
+	sumNanos       uint64 // their total time
 }
 
 func New(sampleInterval time.Duration) *Monitor {
@@ -91,6 +93,9 @@ func (m *Monitor) collect() {
 }
 
 func (m *Monitor) RecordResponseTime(d time.Duration) {
+	atomic.AddUint64(&m.count, 1)
+	atomic.AddUint64(&m.sumNanos, uint64(d))
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -121,8 +126,8 @@ func (m *Monitor) updatePercentiles() {
 
 	stats := m.stats.Load().(*Stats)
 	stats.ResponseTimes = sorted
-	stats.P95 = sorted[len(sorted)*95/100]
-	stats.P99 = sorted[len(sorted)*99/100]
+	stats.P95 = percentile(sorted, 0.95)
+	stats.P99 = percentile(sorted, 0.99)
 	stats.AvgResponseTime = total / time.Duration(len(sorted))
 	stats.MinResponseTime = sorted[0]
 	stats.MaxResponseTime = sorted[len(sorted)-1]
@@ -172,15 +177,8 @@ func (m *Monitor) GetStats() Stats {
 		return times[i] < times[j]
 	})
 
-	p95Index := int(float64(count) * 0.95)
-	p99Index := int(float64(count) * 0.99)
-
-	if p95Index < count {
-		stats.P95 = times[p95Index]
-	}
-	if p99Index < count {
-		stats.P99 = times[p99Index]
-	}
+	stats.P95 = percentile(times, 0.95)
+	stats.P99 = percentile(times, 0.99)
 
 	// Calculate request rate
 	now := time.Now()
@@ -196,6 +194,45 @@ func (m *Monitor) GetStats() Stats {
 	return stats
 }
 
+// Totals returns the number of responses recorded since start and their
+// total time
+func (m *Monitor) Totals() (count uint64, sum time.Duration) {
+	return atomic.LoadUint64(&m.count), time.Duration(atomic.LoadUint64(&m.sumNanos))
+}
+
+// Quantiles returns the response time at each quantile q, between 0 and 1,
+// of the recent samples. Without samples all are zero.
+func (m *Monitor) Quantiles(qs ...float64) []time.Duration {
+	m.mu.RLock()
+	times := make([]time.Duration, len(m.samples))
+	copy(times, m.samples)
+	m.mu.RUnlock()
+
+	result := make([]time.Duration, len(qs))
+	if len(times) == 0 {
+		return result
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	for i, q := range qs {
+		result[i] = percentile(times, q)
+	}
+	return result
+}
+
+// percentile returns the sample at quantile q, between 0 and 1, of sorted,
+// which must not be empty. The index is clamped to the samples, so q = 1
+// or rounding never reads past the last one.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	idx := int(q * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
 // FormatStats returns a formatted string of performance statistics
 func (m *Monitor) FormatStats() string {
 	stats := m.GetStats()
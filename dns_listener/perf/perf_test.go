@@ -26,3 +26,31 @@ func TestPerformanceMonitor(t *testing.T) {
 		t.Errorf("average response time = %v, want %v", stats.AvgResponseTime, 100*time.Millisecond)
 	}
 }
+
+func TestPercentilesOfFewSamples(t *testing.T) {
+	tests := []struct {
+		samples  int
+		p95, p99 time.Duration
+	}{
+		{1, time.Millisecond, time.Millisecond},
+		{2, 2 * time.Millisecond, 2 * time.Millisecond},
+		{101, 96 * time.Millisecond, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		mon := New(time.Hour)
+		// Record the samples 1ms to n ms in descending order so that
+		// sorting matters
+		for i := tt.samples; i > 0; i-- {
+			mon.RecordResponseTime(time.Duration(i) * time.Millisecond)
+		}
+
+		stats := mon.GetStats()
+		if stats.P95 != tt.p95 || stats.P99 != tt.p99 {
+			t.Errorf("%d samples: P95, P99 = %v, %v, want %v, %v", tt.samples, stats.P95, stats.P99, tt.p95, tt.p99)
+		}
+		q := mon.Quantiles(0, 0.95, 0.99, 1)
+		if q[0] != time.Millisecond || q[1] != tt.p95 || q[2] != tt.p99 || q[3] != time.Duration(tt.samples)*time.Millisecond {
+			t.Errorf("%d samples: Quantiles(0, 0.95, 0.99, 1) = %v", tt.samples, q)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package dns_listener
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/exiguus/ns-checker/dns_listener/cache"
+)
+
+// loadCache fills the cache from CACHE_FILE when that file exists
+func (d *DNSListener) loadCache() {
+	p, ok := d.cache.(cache.Persistable)
+	if d.config.CacheFile == "" || !ok {
+		return
+	}
+
+	f, err := os.Open(d.config.CacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		d.logger.Write(fmt.Sprintf("Loading cache from %s failed: %v\n", d.config.CacheFile, err))
+		return
+	}
+	defer f.Close()
+
+	if err := p.Load(f); err != nil {
+		d.logger.Write(fmt.Sprintf("Loading cache from %s failed: %v\n", d.config.CacheFile, err))
+		return
+	}
+	d.logger.Write(fmt.Sprintf("Loaded %d cache entries from %s\n", d.cache.Stats().Size, d.config.CacheFile))
+}
+
+// saveCache writes the cache to CACHE_FILE. The dump goes to a temporary
+// file first so an interrupted write leaves the previous one intact.
+func (d *DNSListener) saveCache() error {
+	p, ok := d.cache.(cache.Persistable)
+	if d.config.CacheFile == "" || !ok {
+		return nil
+	}
+
+	tmp := d.config.CacheFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := p.Dump(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, d.config.CacheFile)
+}
@@ -0,0 +1,55 @@
+package dns_listener
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// redactName hides name according to mode. Hashing keeps names
+// correlatable without revealing them; truncating keeps the last two
+// labels.
+func redactName(name, mode string) string {
+	switch mode {
+	case config.RedactHash:
+		sum := sha256.Sum256([]byte(strings.ToLower(name)))
+		return "h-" + hex.EncodeToString(sum[:8])
+	case config.RedactTruncate:
+		labels := strings.Split(name, ".")
+		if len(labels) <= 2 {
+			return name
+		}
+		return "*." + strings.Join(labels[len(labels)-2:], ".")
+	}
+	return name
+}
+
+// redactQuery returns query with its question name redacted, so neither the
+// decoded nor the hex dump in the access log carries the full qname. Queries
+// that cannot be parsed are reduced to their header.
+func (d *DNSListener) redactQuery(query []byte) []byte {
+	mode := d.config.QnameRedaction
+	if mode == config.RedactNone {
+		return query
+	}
+
+	q, err := protocol.ReadQuestion(query)
+	if err != nil {
+		if len(query) > 12 {
+			return query[:12]
+		}
+		return query
+	}
+
+	out := make([]byte, 12, len(query))
+	copy(out, query[:12])
+	out[4], out[5] = 0, 1
+	for i := 6; i < 12; i++ {
+		out[i] = 0
+	}
+	out = protocol.AppendName(out, redactName(q.Name, mode))
+	return append(out, byte(q.Type>>8), byte(q.Type), byte(q.Class>>8), byte(q.Class))
+}
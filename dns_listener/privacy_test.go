@@ -0,0 +1,57 @@
+package dns_listener
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+)
+
+func TestQnameRedaction(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{config.RedactNone, "Question: payroll.corp.example.com"},
+		{config.RedactHash, "Question: " + redactName("payroll.corp.example.com", config.RedactHash)},
+		{config.RedactTruncate, "Question: *.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode="+tt.mode, func(t *testing.T) {
+			dir := t.TempDir()
+			d := newTestListener(t, &config.Config{
+				LogPath:        filepath.Join(dir, "access.log"),
+				QnameRedaction: tt.mode,
+			})
+			queryRCode(t, d, "payroll.corp.example.com")
+
+			logs, _ := filepath.Glob(filepath.Join(dir, "*access.log"))
+			if len(logs) != 1 {
+				t.Fatalf("log files = %v, want one", logs)
+			}
+			data, err := os.ReadFile(logs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			log := string(data)
+
+			if !strings.Contains(log, tt.want) {
+				t.Errorf("log does not contain %q:\n%s", tt.want, log)
+			}
+			if tt.mode != config.RedactNone && strings.Contains(log, "payroll") {
+				t.Errorf("log leaks the full qname:\n%s", log)
+			}
+		})
+	}
+}
+
+func TestRedactNameHashIsStable(t *testing.T) {
+	a := redactName("WWW.Example.com", config.RedactHash)
+	b := redactName("www.example.com", config.RedactHash)
+	if a != b || !strings.HasPrefix(a, "h-") || len(a) != 18 {
+		t.Errorf("redactName() = %q, %q, want equal 16-digit hashes", a, b)
+	}
+}
@@ -2,33 +2,39 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
-	"sync"
 	"time"
 
 	dnserr "github.com/exiguus/ns-checker/dns_listener/errors"
 	"github.com/exiguus/ns-checker/dns_listener/metrics"
-	"github.com/exiguus/ns-checker/dns_listener/tracing"
 	"github.com/exiguus/ns-checker/dns_listener/types"
 )
 
 const (
 	DefaultTimeout = 5 * time.Second
-	maxRetries     = 3
 )
 
+var (
+	// ErrQueueFull is returned by Process when the request was dropped
+	// because the queue stayed full
+	ErrQueueFull = errors.New("request queue full")
+	// ErrStopped is returned by Process after Stop
+	ErrStopped = errors.New("processor stopped")
+)
+
+// Processor answers requests with a fixed number of workers taking them
+// from a bounded queue
 type Processor struct {
 	workers    int
 	timeout    time.Duration
 	handler    RequestHandler
 	metrics    *metrics.Collector
 	requestCh  chan types.Request
-	pool       *sync.Pool
 	ctx        context.Context
 	cancelFunc context.CancelFunc
-	reqPool    *requestPool
-	tracer     *tracing.Tracer
+	queueWait  time.Duration
 }
 
 type RequestHandler interface {
@@ -39,22 +45,26 @@ type ProcessorConfig struct {
 	Workers    int
 	Timeout    time.Duration
 	BufferSize int
+	QueueWait  time.Duration      // How long Process waits for room in a full queue, 0 drops at once
+	Queue      chan types.Request // Queue to take requests from, nil creates one of BufferSize
 }
 
 func New(cfg ProcessorConfig, handler RequestHandler, metrics *metrics.Collector) *Processor {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	queue := cfg.Queue
+	if queue == nil {
+		queue = make(chan types.Request, cfg.BufferSize)
+	}
 	return &Processor{
 		workers:    cfg.Workers,
 		timeout:    cfg.Timeout,
 		handler:    handler,
 		metrics:    metrics,
-		requestCh:  make(chan types.Request, cfg.BufferSize),
-		pool:       &sync.Pool{New: func() interface{} { return make([]byte, 512) }},
+		requestCh:  queue,
 		ctx:        ctx,
 		cancelFunc: cancel,
-		reqPool:    newRequestPool(),
-		tracer:     tracing.New(),
+		queueWait:  cfg.QueueWait,
 	}
 }
 
@@ -64,20 +74,59 @@ func (p *Processor) Start() {
 	}
 }
 
+// Stop ends the workers. Requests still queued are not answered.
 func (p *Processor) Stop() {
 	p.cancelFunc()
 }
 
-func (p *Processor) Process(req types.Request) {
+// Process queues req for the workers. When the queue is full it waits up
+// to QueueWait for room and then drops req, returning ErrQueueFull so the
+// caller can answer the client at once instead of letting it time out.
+func (p *Processor) Process(req types.Request) error {
+	if p.ctx.Err() != nil {
+		p.metrics.RecordError()
+		return ErrStopped
+	}
+
 	select {
 	case p.requestCh <- req:
-		// Request accepted
-	case <-p.ctx.Done():
-		// Processor is shutting down
-		p.metrics.RecordError()
+		return nil
 	default:
-		// Channel full, handle overflow
-		p.metrics.RecordError()
+	}
+
+	if p.queueWait > 0 {
+		timer := time.NewTimer(p.queueWait)
+		defer timer.Stop()
+		select {
+		case p.requestCh <- req:
+			return nil
+		case <-p.ctx.Done():
+			p.metrics.RecordError()
+			return ErrStopped
+		case <-timer.C:
+		}
+	}
+
+	p.metrics.RecordError()
+	p.metrics.RecordQueueDropped()
+	return ErrQueueFull
+}
+
+// HandleRequest queues a query and waits for a worker to answer it, which
+// makes the processor a handler for network.Server. A query that cannot be
+// queued fails with the error of Process.
+func (p *Processor) HandleRequest(data []byte, addr net.Addr, protocol string) ([]byte, error) {
+	reply := make(chan types.Response, 1)
+	req := types.Request{Data: data, ClientAddr: addr, Protocol: protocol, Reply: reply}
+	if err := p.Process(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-reply:
+		return resp.Data, resp.Err
+	case <-p.ctx.Done():
+		return nil, ErrStopped
 	}
 }
 
@@ -92,68 +141,28 @@ func (p *Processor) worker() {
 	}
 }
 
+// handleRequest answers req through its Reply channel or, without one, by
+// writing to its Conn. Answers that took longer than the timeout are
+// dropped.
 func (p *Processor) handleRequest(req types.Request) {
-	// Create timeout context for request
 	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
 	defer cancel()
 
-	// Start trace
-	ctx = p.tracer.StartTrace(ctx)
-	p.tracer.AddEvent(ctx, "request_received", nil)
-
-	// Get request from pool
-	pooledReq := p.reqPool.get()
-	defer p.reqPool.put(pooledReq)
-
-	// Copy request data
-	pooledReq.Conn = req.Conn
-	pooledReq.ClientAddr = req.ClientAddr
-	pooledReq.Protocol = req.Protocol
-	copy(pooledReq.Data, req.Data)
-
-	var response []byte
-	var err error
-
-	// Handle request with retries
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		select {
-		case <-ctx.Done():
-			p.tracer.AddEvent(ctx, "request_timeout", ctx.Err())
-			p.metrics.RecordError()
-			return
-		default:
-			p.tracer.AddEvent(ctx, fmt.Sprintf("attempt_%d_start", attempt), nil)
-			response, err = p.handler.HandleRequest(pooledReq.Data, pooledReq.ClientAddr, pooledReq.Protocol)
-			if err == nil {
-				p.tracer.AddEvent(ctx, fmt.Sprintf("attempt_%d_success", attempt), nil)
-				break
-			}
-			p.tracer.AddEvent(ctx, fmt.Sprintf("attempt_%d_failed", attempt), err)
-
-			if attempt == maxRetries {
-				p.metrics.RecordError()
-				return
-			}
-
-			// Simple exponential backoff
-			time.Sleep(time.Duration(attempt*100) * time.Millisecond)
-		}
+	response, err := p.handler.HandleRequest(req.Data, req.ClientAddr, req.Protocol)
+	if err == nil && ctx.Err() != nil {
+		p.metrics.RecordError()
+		response, err = nil, fmt.Errorf("answering %s: %w", req.ClientAddr, ctx.Err())
 	}
 
-	if err != nil {
-		p.metrics.RecordError()
+	if req.Reply != nil {
+		req.Reply <- types.Response{Data: response, Err: err}
 		return
 	}
-
-	// Send response with context
-	select {
-	case <-ctx.Done():
-		p.metrics.RecordError()
+	if err != nil || req.Conn == nil {
 		return
-	default:
-		if err := p.sendResponse(req.Conn, response); err != nil {
-			p.metrics.RecordError()
-		}
+	}
+	if err := p.sendResponse(req.Conn, response); err != nil {
+		p.metrics.RecordError()
 	}
 }
 
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/metrics"
+	"github.com/exiguus/ns-checker/dns_listener/types"
+)
+
+type nopHandler struct{}
+
+func (nopHandler) HandleRequest(data []byte, addr net.Addr, protocol string) ([]byte, error) {
+	return data, nil
+}
+
+func TestProcessSignalsQueueFull(t *testing.T) {
+	m := metrics.NewCollector()
+	// Not started, so nothing drains the queue
+	p := New(ProcessorConfig{Workers: 1, Timeout: time.Second, BufferSize: 2}, nopHandler{}, m)
+
+	for i := 0; i < 2; i++ {
+		if err := p.Process(types.Request{}); err != nil {
+			t.Fatalf("Process() #%d error = %v, want nil", i, err)
+		}
+	}
+	if err := p.Process(types.Request{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Process() on a full queue error = %v, want ErrQueueFull", err)
+	}
+	if got := m.GetQueueDropped(); got != 1 {
+		t.Errorf("GetQueueDropped() = %d, want 1", got)
+	}
+
+	p.Stop()
+	if err := p.Process(types.Request{}); !errors.Is(err, ErrStopped) {
+		t.Errorf("Process() after Stop error = %v, want ErrStopped", err)
+	}
+}
+
+func TestProcessQueueWait(t *testing.T) {
+	m := metrics.NewCollector()
+	p := New(ProcessorConfig{Workers: 1, Timeout: time.Second, BufferSize: 1, QueueWait: 50 * time.Millisecond}, nopHandler{}, m)
+	defer p.Stop()
+	p.Process(types.Request{})
+
+	// Nothing makes room: dropped once the wait is over
+	start := time.Now()
+	if err := p.Process(types.Request{}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Process() error = %v, want ErrQueueFull", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Process() gave up after %v, want at least the 50ms wait", waited)
+	}
+
+	// A worker taking a request within the wait lets it through
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-p.requestCh
+	}()
+	if err := p.Process(types.Request{}); err != nil {
+		t.Errorf("Process() with room made during the wait error = %v, want nil", err)
+	}
+	if got := m.GetQueueDropped(); got != 1 {
+		t.Errorf("GetQueueDropped() = %d, want 1", got)
+	}
+}
+
+func TestHandleRequestWaitsForWorker(t *testing.T) {
+	p := New(ProcessorConfig{Workers: 2, Timeout: time.Second, BufferSize: 4}, nopHandler{}, metrics.NewCollector())
+	p.Start()
+	defer p.Stop()
+
+	got, err := p.HandleRequest([]byte("query"), &net.UDPAddr{}, "udp")
+	if err != nil || string(got) != "query" {
+		t.Errorf("HandleRequest() = %q, %v, want the handler's answer", got, err)
+	}
+}
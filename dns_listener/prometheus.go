@@ -0,0 +1,48 @@
+package dns_listener
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/exiguus/ns-checker/dns_listener/metrics"
+)
+
+// responseQuantiles are the response time quantiles exported to Prometheus
+var responseQuantiles = []float64{0.5, 0.95, 0.99}
+
+// prometheusHandler serves the request counters together with the rate
+// limiter, response time and cache metrics in the Prometheus text format
+func (d *DNSListener) prometheusHandler() http.Handler {
+	return metrics.PrometheusHandler(d.metrics.Families, d.families)
+}
+
+// families returns the metrics tracked outside the collector
+func (d *DNSListener) families() []metrics.Family {
+	_, limited := d.rateLimiter.Counts()
+
+	count, sum := d.perfMon.Totals()
+	responseTime := metrics.Family{
+		MetricDefinition: metrics.MetricDefinition{
+			Name:        "dns_response_time_seconds",
+			Type:        metrics.SummaryMetric,
+			Description: "Time to answer a query, over the most recent queries.",
+		},
+		Sum:   sum.Seconds(),
+		Count: count,
+	}
+	for i, q := range d.perfMon.Quantiles(responseQuantiles...) {
+		responseTime.Values = append(responseTime.Values, metrics.MetricValue{
+			Value:  q.Seconds(),
+			Labels: map[string]string{"quantile": strconv.FormatFloat(responseQuantiles[i], 'g', -1, 64)},
+		})
+	}
+
+	cacheStats := d.cache.Stats()
+	return []metrics.Family{
+		metrics.NewCounter("dns_rate_limited_total", "Queries refused by the rate limiter.", limited),
+		responseTime,
+		metrics.NewGauge("dns_cache_entries", "Entries held in the cache.", float64(cacheStats.Size)),
+		metrics.NewGauge("dns_cache_bytes", "Bytes held in the cache.", float64(cacheStats.BytesInMemory)),
+		metrics.NewCounter("dns_cache_evictions_total", "Entries evicted from the cache.", uint64(cacheStats.Evictions)),
+	}
+}
@@ -0,0 +1,231 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// DefaultStubTTL is the TTL of the stub answer when ResponseOptions leave
+// StubTTL unset
+const DefaultStubTTL = 300
+
+// DefaultStubIP and DefaultStubIPv6 are the addresses of the stub answers
+// when ResponseOptions leave StubIP and StubIPv6 unset
+var (
+	DefaultStubIP   = net.IPv4(127, 0, 0, 1)
+	DefaultStubIPv6 = net.IPv6loopback
+)
+
+// ResponseOptions controls how responses are encoded
+type ResponseOptions struct {
+	// DisableCompression writes fully expanded owner names instead of
+	// compression pointers, for clients that mishandle RFC 1035 4.1.4
+	DisableCompression bool
+	// RecursionAvailable advertises RA; only set it when queries are
+	// actually resolved recursively or forwarded
+	RecursionAvailable bool
+	// StubIP, StubIPv6 and StubTTL are the A and AAAA addresses and the
+	// TTL of the answers built by CreateResponse; nil and 0 use
+	// DefaultStubIP, DefaultStubIPv6 and DefaultStubTTL
+	StubIP   net.IP
+	StubIPv6 net.IP
+	StubTTL  uint32
+}
+
+// ResponseBuilder assembles a response to a query by echoing its header and
+// question section and appending answer records
+type ResponseBuilder struct {
+	buf      []byte
+	opts     ResponseOptions
+	question string
+	answers  uint16
+	auth     uint16
+	names    compressor
+}
+
+// NewResponseBuilder starts a response to query with the QR bit set. The
+// answer, authority and additional sections of the query are dropped. It
+// returns nil unless the query has exactly one parsable question.
+func NewResponseBuilder(query []byte, opts ResponseOptions) *ResponseBuilder {
+	if len(query) < 12 {
+		return nil
+	}
+
+	// Multiple questions have no defined semantics (RFC 9619)
+	if binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return nil
+	}
+
+	b := &ResponseBuilder{
+		opts:  opts,
+		names: compressor{},
+	}
+
+	name, next, err := ReadName(query, 12)
+	if err != nil || next+4 > len(query) {
+		return nil
+	}
+	b.question = name
+	b.rememberName(name, 12, query)
+	offset := next + 4
+
+	b.buf = make([]byte, offset, offset+64)
+	copy(b.buf, query[:offset])
+	b.buf[2] |= 0x80
+	// AA is only set by authoritative sources; RD is echoed from the query
+	// as required by RFC 1035 while RA reflects this server's capability
+	b.buf[2] &^= byte(FlagAA >> 8)
+	b.buf[3] &^= byte(FlagRA)
+	if opts.RecursionAvailable {
+		b.buf[3] |= byte(FlagRA)
+	}
+	// Only the question section is echoed
+	binary.BigEndian.PutUint16(b.buf[6:8], 0)
+	binary.BigEndian.PutUint16(b.buf[8:10], 0)
+	binary.BigEndian.PutUint16(b.buf[10:12], 0)
+
+	return b
+}
+
+// Question returns the name of the first question
+func (b *ResponseBuilder) Question() string {
+	return b.question
+}
+
+// AddAnswer appends a resource record to the answer section
+func (b *ResponseBuilder) AddAnswer(name string, rrType DNSType, class DNSClass, ttl uint32, rdata []byte) {
+	b.appendRecord(name, rrType, class, ttl, rdata)
+	b.answers++
+	binary.BigEndian.PutUint16(b.buf[6:8], b.answers)
+}
+
+// AddAuthority appends a resource record to the authority section. All
+// answers must be added before the first authority record.
+func (b *ResponseBuilder) AddAuthority(name string, rrType DNSType, class DNSClass, ttl uint32, rdata []byte) {
+	b.appendRecord(name, rrType, class, ttl, rdata)
+	b.auth++
+	binary.BigEndian.PutUint16(b.buf[8:10], b.auth)
+}
+
+func (b *ResponseBuilder) appendRecord(name string, rrType DNSType, class DNSClass, ttl uint32, rdata []byte) {
+	b.buf = b.appendOwner(b.buf, name)
+	b.buf = binary.BigEndian.AppendUint16(b.buf, uint16(rrType))
+	b.buf = binary.BigEndian.AppendUint16(b.buf, uint16(class))
+	b.buf = binary.BigEndian.AppendUint32(b.buf, ttl)
+	b.buf = binary.BigEndian.AppendUint16(b.buf, uint16(len(rdata)))
+	b.buf = append(b.buf, rdata...)
+}
+
+// SetFlags sets the given header flags in addition to the current ones
+func (b *ResponseBuilder) SetFlags(flags DNSFlags) {
+	b.buf[2] |= byte(flags >> 8)
+	b.buf[3] |= byte(flags)
+}
+
+// SetRCode sets the response code in the low nibble of the flags
+func (b *ResponseBuilder) SetRCode(rcode RCode) {
+	b.buf[3] = b.buf[3]&0xF0 | byte(rcode)&0x0F
+}
+
+// Bytes returns the encoded response
+func (b *ResponseBuilder) Bytes() []byte {
+	return b.buf
+}
+
+// appendOwner writes name, pointing at the longest suffix already written
+// unless compression is disabled
+func (b *ResponseBuilder) appendOwner(buf []byte, name string) []byte {
+	if b.opts.DisableCompression {
+		return AppendName(buf, name)
+	}
+	return b.names.appendName(buf, name)
+}
+
+// rememberName records the suffix offsets of an uncompressed name in msg
+func (b *ResponseBuilder) rememberName(name string, offset int, msg []byte) {
+	labels := splitName(name)
+	for i := range labels {
+		if offset > maxPointerOffset || msg[offset]&pointerMask != 0 {
+			return
+		}
+		b.names[strings.ToLower(strings.Join(labels[i:], "."))] = offset
+		offset += int(msg[offset]) + 1
+	}
+}
+
+// CreateResponse builds the stub answer for query: an A record pointing at
+// opts.StubIP for A questions, an AAAA record pointing at opts.StubIPv6 for
+// AAAA questions and an empty NOERROR (NODATA) answer for any other type.
+// Queries without a parsable question are echoed back with only the QR bit
+// set.
+func CreateResponse(query []byte, opts ResponseOptions) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	b := NewResponseBuilder(query, opts)
+	if b == nil {
+		response := make([]byte, len(query))
+		copy(response, query)
+		response[2] |= 0x80
+		return response
+	}
+
+	ttl := opts.StubTTL
+	if ttl == 0 {
+		ttl = DefaultStubTTL
+	}
+	// The builder only accepts queries with a readable question
+	q, _ := ReadQuestion(query)
+	switch q.Type {
+	case TypeA:
+		ip := opts.StubIP.To4()
+		if ip == nil {
+			ip = DefaultStubIP.To4()
+		}
+		b.AddAnswer(b.Question(), TypeA, q.Class, ttl, ip)
+	case TypeAAAA:
+		ip := opts.StubIPv6.To16()
+		if ip == nil {
+			ip = DefaultStubIPv6
+		}
+		b.AddAnswer(b.Question(), TypeAAAA, q.Class, ttl, ip)
+	}
+	return b.Bytes()
+}
+
+// CreateErrorResponse builds an answerless response to query carrying
+// rcode, e.g. NXDOMAIN for blocked names or SERVFAIL on resolution errors
+func CreateErrorResponse(query []byte, rcode RCode) []byte {
+	return CreateErrorResponseWithOptions(query, rcode, ResponseOptions{})
+}
+
+// CreateRefusedResponse builds a REFUSED response to query that echoes its
+// ID and question, telling a rate limited client to give up at once
+func CreateRefusedResponse(query []byte) []byte {
+	return CreateErrorResponse(query, RCodeRefused)
+}
+
+// CreateErrorResponseWithOptions is CreateErrorResponse with explicit
+// response options
+func CreateErrorResponseWithOptions(query []byte, rcode RCode, opts ResponseOptions) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	b := NewResponseBuilder(query, opts)
+	if b == nil {
+		response := make([]byte, 12)
+		copy(response, query[:12])
+		response[2] |= 0x80
+		response[3] = response[3]&0xF0 | byte(rcode)&0x0F
+		for i := 4; i < 12; i++ {
+			response[i] = 0
+		}
+		return response
+	}
+
+	b.SetRCode(rcode)
+	return b.Bytes()
+}
@@ -0,0 +1,342 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testRecord struct {
+	Name  string
+	Type  DNSType
+	Class DNSClass
+	TTL   uint32
+	Data  string
+}
+
+// buildQuery creates a single question query for name
+func buildQuery(name string, qtype DNSType) []byte {
+	query := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	query = AppendName(query, name)
+	query = binary.BigEndian.AppendUint16(query, uint16(qtype))
+	return binary.BigEndian.AppendUint16(query, uint16(ClassIN))
+}
+
+// parseAnswers decodes the answer section of msg
+func parseAnswers(t *testing.T, msg []byte) []testRecord {
+	t.Helper()
+
+	offset := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		_, next, err := ReadName(msg, offset)
+		if err != nil {
+			t.Fatalf("question %d: %v", i, err)
+		}
+		offset = next + 4
+	}
+
+	var records []testRecord
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[6:8])); i++ {
+		name, next, err := ReadName(msg, offset)
+		if err != nil {
+			t.Fatalf("answer %d: %v", i, err)
+		}
+		if next+10 > len(msg) {
+			t.Fatalf("answer %d: truncated header", i)
+		}
+		rdLen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		if next+10+rdLen > len(msg) {
+			t.Fatalf("answer %d: truncated data", i)
+		}
+		records = append(records, testRecord{
+			Name:  name,
+			Type:  DNSType(binary.BigEndian.Uint16(msg[next : next+2])),
+			Class: DNSClass(binary.BigEndian.Uint16(msg[next+2 : next+4])),
+			TTL:   binary.BigEndian.Uint32(msg[next+4 : next+8]),
+			Data:  string(msg[next+10 : next+10+rdLen]),
+		})
+		offset = next + 10 + rdLen
+	}
+	if offset != len(msg) {
+		t.Fatalf("trailing bytes after answers: %d", len(msg)-offset)
+	}
+	return records
+}
+
+func TestResponseBuilderCompression(t *testing.T) {
+	query := buildQuery("www.example.com", TypeA)
+
+	build := func(opts ResponseOptions) []byte {
+		b := NewResponseBuilder(query, opts)
+		if b == nil {
+			t.Fatal("NewResponseBuilder() = nil")
+		}
+		b.AddAnswer("www.example.com", TypeA, ClassIN, 300, []byte{127, 0, 0, 1})
+		b.AddAnswer("www.example.com", TypeA, ClassIN, 300, []byte{127, 0, 0, 2})
+		b.AddAnswer("mail.example.com", TypeA, ClassIN, 60, []byte{127, 0, 0, 3})
+		return b.Bytes()
+	}
+
+	compressed := build(ResponseOptions{})
+	expanded := build(ResponseOptions{DisableCompression: true})
+
+	if !reflect.DeepEqual(parseAnswers(t, compressed), parseAnswers(t, expanded)) {
+		t.Errorf("answers differ:\ncompressed: %+v\nexpanded:   %+v",
+			parseAnswers(t, compressed), parseAnswers(t, expanded))
+	}
+	if len(expanded) <= len(compressed) {
+		t.Errorf("expanded size = %d, want more than compressed size %d", len(expanded), len(compressed))
+	}
+	if bytes.IndexByte(expanded, pointerMask) != -1 {
+		t.Errorf("expanded response contains a compression pointer: %x", expanded)
+	}
+	if bytes.IndexByte(compressed, pointerMask) == -1 {
+		t.Errorf("compressed response contains no compression pointer: %x", compressed)
+	}
+}
+
+func TestCreateResponse(t *testing.T) {
+	query := buildQuery("example.org", TypeA)
+	// EDNS OPT record in the additional section must not be echoed
+	query[11] = 1
+	query = append(query, 0, 0, 41, 0x10, 0, 0, 0, 0, 0, 0, 0)
+
+	for _, opts := range []ResponseOptions{{}, {DisableCompression: true}} {
+		response := CreateResponse(query, opts)
+		if response[2]&0x80 == 0 {
+			t.Errorf("QR bit not set")
+		}
+		if ar := binary.BigEndian.Uint16(response[10:12]); ar != 0 {
+			t.Errorf("additional count = %d, want 0", ar)
+		}
+
+		want := []testRecord{{
+			Name:  "example.org",
+			Type:  TypeA,
+			Class: ClassIN,
+			TTL:   300,
+			Data:  string([]byte{127, 0, 0, 1}),
+		}}
+		if got := parseAnswers(t, response); !reflect.DeepEqual(got, want) {
+			t.Errorf("CreateResponse(%+v) answers = %+v, want %+v", opts, got, want)
+		}
+	}
+}
+
+func TestReadName(t *testing.T) {
+	msg := AppendName(make([]byte, 12), "example.com")
+	// www -> pointer to example.com at offset 12
+	msg = append(msg, 3, 'w', 'w', 'w', 0xC0, 12)
+
+	name, next, err := ReadName(msg, 25)
+	if err != nil || name != "www.example.com" || next != len(msg) {
+		t.Errorf("ReadName() = %q, %d, %v", name, next, err)
+	}
+
+	loop := []byte{0xC0, 0}
+	if _, _, err := ReadName(loop, 0); err != ErrPointerLoop {
+		t.Errorf("ReadName(loop) error = %v, want %v", err, ErrPointerLoop)
+	}
+	if _, _, err := ReadName([]byte{5, 'a'}, 0); err != ErrNameTruncated {
+		t.Errorf("ReadName(truncated) error = %v, want %v", err, ErrNameTruncated)
+	}
+}
+
+func TestCreateErrorResponse(t *testing.T) {
+	query := buildQuery("blocked.example", TypeA)
+
+	response := CreateErrorResponse(query, RCodeNXDomain)
+	if response[2] != 0x81 {
+		t.Errorf("flags byte 2 = %#x, want 0x81 (QR|RD)", response[2])
+	}
+	if rcode := RCode(response[3] & 0x0F); rcode != RCodeNXDomain {
+		t.Errorf("rcode = %v, want %v", rcode, RCodeNXDomain)
+	}
+	if an := binary.BigEndian.Uint16(response[6:8]); an != 0 {
+		t.Errorf("answer count = %d, want 0", an)
+	}
+
+	q, err := ReadQuestion(response)
+	if err != nil {
+		t.Fatalf("ReadQuestion() error = %v", err)
+	}
+	if q.Name != "blocked.example" || q.Type != TypeA || q.Class != ClassIN {
+		t.Errorf("ReadQuestion() = %+v", q)
+	}
+}
+
+func TestCreateRefusedResponse(t *testing.T) {
+	query := buildQuery("limited.example", TypeA)
+	query[0], query[1] = 0xbe, 0xef
+
+	response := CreateRefusedResponse(query)
+	if response[0] != 0xbe || response[1] != 0xef {
+		t.Errorf("ID = %#x%02x, want the query's 0xbeef", response[0], response[1])
+	}
+	if response[2]&0x80 == 0 {
+		t.Errorf("flags = %08b, want QR set", response[2])
+	}
+	if rcode := RCode(response[3] & 0x0F); rcode != RCodeRefused {
+		t.Errorf("rcode = %v, want REFUSED", rcode)
+	}
+	if q, err := ReadQuestion(response); err != nil || q.Name != "limited.example" {
+		t.Errorf("ReadQuestion() = %+v, %v, want the query's question", q, err)
+	}
+}
+
+func TestMultipleQuestionsRejected(t *testing.T) {
+	query := buildQuery("one.example", TypeA)
+	query = append(AppendName(query, "two.example"), 0, byte(TypeA), 0, 1)
+	query[5] = 2
+
+	if err := ValidateDNSMessage(query); err == nil {
+		t.Error("ValidateDNSMessage() error = nil for two questions")
+	}
+	if _, err := ReadQuestion(query); err == nil {
+		t.Error("ReadQuestion() error = nil for two questions")
+	}
+	if b := NewResponseBuilder(query, ResponseOptions{}); b != nil {
+		t.Error("NewResponseBuilder() accepted two questions")
+	}
+
+	response := CreateErrorResponse(query, RCodeFormErr)
+	if len(response) != 12 {
+		t.Fatalf("response length = %d, want a bare header", len(response))
+	}
+	if response[2]&0x80 == 0 {
+		t.Errorf("flags = %08b, want QR set", response[2])
+	}
+	if rcode := RCode(response[3] & 0x0F); rcode != RCodeFormErr {
+		t.Errorf("rcode = %v, want FORMERR", rcode)
+	}
+	if qd := binary.BigEndian.Uint16(response[4:6]); qd != 0 {
+		t.Errorf("question count = %d, want 0", qd)
+	}
+}
+
+func TestClampTTLs(t *testing.T) {
+	b := NewResponseBuilder(buildQuery("www.example.com", TypeA), ResponseOptions{})
+	b.AddAnswer("www.example.com", TypeA, ClassIN, 365*24*3600, []byte{192, 0, 2, 1})
+	b.AddAnswer("mail.example.com", TypeA, ClassIN, 60, []byte{192, 0, 2, 2})
+	response := b.Bytes()
+
+	clamped, err := ClampTTLs(response, 3600)
+	if err != nil {
+		t.Fatalf("ClampTTLs() error = %v", err)
+	}
+	if clamped != 1 {
+		t.Errorf("ClampTTLs() clamped %d records, want 1", clamped)
+	}
+
+	answers := parseAnswers(t, response)
+	if answers[0].TTL != 3600 || answers[1].TTL != 60 {
+		t.Errorf("TTLs = %d, %d, want 3600, 60", answers[0].TTL, answers[1].TTL)
+	}
+}
+
+func TestAgeTTLs(t *testing.T) {
+	b := NewResponseBuilder(buildQuery("www.example.com", TypeA), ResponseOptions{})
+	b.AddAnswer("www.example.com", TypeA, ClassIN, 300, []byte{192, 0, 2, 1})
+	b.AddAnswer("www.example.com", TypeA, ClassIN, 30, []byte{192, 0, 2, 2})
+	response := b.Bytes()
+
+	if err := AgeTTLs(response, 60); err != nil {
+		t.Fatalf("AgeTTLs() error = %v", err)
+	}
+	answers := parseAnswers(t, response)
+	if answers[0].TTL != 240 || answers[1].TTL != 0 {
+		t.Errorf("TTLs = %d, %d, want 240, 0", answers[0].TTL, answers[1].TTL)
+	}
+}
+
+func TestMinAnswerTTL(t *testing.T) {
+	query := buildQuery("www.example.com", TypeA)
+
+	// Compressed owner names; authority records do not count
+	b := NewResponseBuilder(query, ResponseOptions{})
+	b.AddAnswer("www.example.com", TypeCNAME, ClassIN, 3600, AppendName(nil, "web.example.com"))
+	b.AddAnswer("web.example.com", TypeA, ClassIN, 120, []byte{192, 0, 2, 1})
+	b.AddAnswer("web.example.com", TypeA, ClassIN, 300, []byte{192, 0, 2, 2})
+	b.AddAuthority("example.com", TypeNS, ClassIN, 5, AppendName(nil, "ns.example.com"))
+	multi := b.Bytes()
+
+	empty := NewResponseBuilder(query, ResponseOptions{})
+	empty.AddAuthority("example.com", TypeSOA, ClassIN, 60, []byte{0, 0})
+
+	tests := []struct {
+		name   string
+		msg    []byte
+		want   time.Duration
+		wantOK bool
+	}{
+		{"multiple answers", multi, 120 * time.Second, true},
+		{"stub answer", CreateResponse(query, ResponseOptions{}), 300 * time.Second, true},
+		{"no answers", empty.Bytes(), 0, false},
+		{"truncated", multi[:len(multi)-20], 0, false},
+		{"short", []byte{1, 2, 3}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := MinAnswerTTL(tt.msg)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("MinAnswerTTL() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestResponseBuilderFlags(t *testing.T) {
+	query := buildQuery("example.com", TypeA)
+	query[2] |= byte(FlagAA >> 8)
+
+	b := NewResponseBuilder(query, ResponseOptions{})
+	if flags := DNSFlags(binary.BigEndian.Uint16(b.Bytes()[2:4])); flags&FlagAA != 0 {
+		t.Errorf("flags = %v, AA must not be echoed from the query", flags)
+	}
+
+	b.SetFlags(FlagAA)
+	flags := DNSFlags(binary.BigEndian.Uint16(b.Bytes()[2:4]))
+	if flags&(FlagQR|FlagAA|FlagRD) != FlagQR|FlagAA|FlagRD {
+		t.Errorf("flags = %v, want QR|AA|RD", flags)
+	}
+}
+
+func TestRecursionFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		rd     bool
+		opts   ResponseOptions
+		wantRD bool
+		wantRA bool
+	}{
+		{"forward mode", true, ResponseOptions{RecursionAvailable: true}, true, true},
+		{"sink mode", true, ResponseOptions{}, true, false},
+		{"no recursion desired", false, ResponseOptions{RecursionAvailable: true}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := buildQuery("example.com", TypeA)
+			if !tt.rd {
+				query[2] &^= byte(FlagRD >> 8)
+			}
+			// A query never legitimately carries RA; it must not leak through
+			query[3] |= byte(FlagRA)
+
+			for _, response := range [][]byte{
+				CreateResponse(query, tt.opts),
+				CreateErrorResponseWithOptions(query, RCodeServFail, tt.opts),
+			} {
+				flags := DNSFlags(binary.BigEndian.Uint16(response[2:4]))
+				if got := flags&FlagRD != 0; got != tt.wantRD {
+					t.Errorf("RD = %v, want %v (flags %v)", got, tt.wantRD, flags)
+				}
+				if got := flags&FlagRA != 0; got != tt.wantRA {
+					t.Errorf("RA = %v, want %v (flags %v)", got, tt.wantRA, flags)
+				}
+			}
+		})
+	}
+}
@@ -25,22 +25,79 @@ func ValidateDNSMessage(data []byte) error {
 	if questionCount == 0 {
 		return &ValidationError{Field: "questions", Reason: "no questions in query"}
 	}
+	if questionCount > 1 {
+		return &ValidationError{Field: "questions", Reason: "multiple questions not supported"}
+	}
 	return nil
 }
 
-// CreateDNSResponse creates a DNS response from a query
-func CreateDNSResponse(query []byte, clientAddr string) []byte {
-	if len(query) < 12 {
-		return nil
+// Question is the first entry of a message's question section
+type Question struct {
+	Name  string
+	Type  DNSType
+	Class DNSClass
+}
+
+// ReadQuestion returns the first question of msg
+func ReadQuestion(msg []byte) (Question, error) {
+	if len(msg) < 12 {
+		return Question{}, &ValidationError{Field: "length", Reason: "message too short"}
+	}
+	if msg[4] == 0 && msg[5] == 0 {
+		return Question{}, &ValidationError{Field: "questions", Reason: "no questions in query"}
+	}
+	if msg[4] != 0 || msg[5] > 1 {
+		return Question{}, &ValidationError{Field: "questions", Reason: "multiple questions not supported"}
+	}
+
+	name, offset, err := ReadName(msg, 12)
+	if err != nil {
+		return Question{}, &ValidationError{Field: "question", Reason: err.Error()}
 	}
+	if offset+4 > len(msg) {
+		return Question{}, &ValidationError{Field: "question", Reason: "truncated question"}
+	}
+
+	return Question{
+		Name:  name,
+		Type:  DNSType(uint16(msg[offset])<<8 | uint16(msg[offset+1])),
+		Class: DNSClass(uint16(msg[offset+2])<<8 | uint16(msg[offset+3])),
+	}, nil
+}
 
-	response := make([]byte, len(query))
-	copy(response, query)
+// ParsedMessage is the decoded header, first question and EDNS record of
+// a message together with its wire form
+type ParsedMessage struct {
+	ID       uint16
+	Flags    DNSFlags
+	Question Question
+	EDNS     *EDNS // nil without an OPT record
+	Raw      []byte
+}
 
-	// Set QR bit to indicate response
-	response[2] |= 0x80
+// ParseMessage decodes the header, first question and OPT record of msg
+func ParseMessage(msg []byte) (*ParsedMessage, error) {
+	q, err := ReadQuestion(msg)
+	if err != nil {
+		return nil, err
+	}
+	edns, err := ParseOPT(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &ParsedMessage{
+		ID:       uint16(msg[0])<<8 | uint16(msg[1]),
+		Flags:    DNSFlags(uint16(msg[2])<<8 | uint16(msg[3])),
+		Question: q,
+		EDNS:     edns,
+		Raw:      msg,
+	}, nil
+}
 
-	return response
+// CreateDNSResponse creates a DNS response from a query using the default
+// response options
+func CreateDNSResponse(query []byte, clientAddr string) []byte {
+	return CreateResponse(query, ResponseOptions{})
 }
 
 // ParseDNSName parses a DNS name from the query bytes starting at the given offset
@@ -105,3 +105,23 @@ func TestParseDNSName(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMessage(t *testing.T) {
+	query := buildQuery("www.example.com", TypeAAAA)
+
+	msg, err := ParseMessage(query)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	if msg.ID != 0x1234 || msg.Flags&FlagRD == 0 {
+		t.Errorf("header = %#04x/%#04x, want ID 0x1234 with RD", msg.ID, uint16(msg.Flags))
+	}
+	want := Question{Name: "www.example.com", Type: TypeAAAA, Class: ClassIN}
+	if msg.Question != want {
+		t.Errorf("Question = %+v, want %+v", msg.Question, want)
+	}
+
+	if _, err := ParseMessage(query[:10]); err == nil {
+		t.Error("ParseMessage() on a truncated header error = nil")
+	}
+}
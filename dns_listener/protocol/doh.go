@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DoHMediaType is the content type of DNS messages over HTTPS
+const DoHMediaType = "application/dns-message"
+
+// DoHResolver sends queries to a DNS over HTTPS endpoint (RFC 8484)
+type DoHResolver struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewDoHResolver creates a resolver posting to url, allowing timeout for
+// each exchange
+func NewDoHResolver(url string, timeout time.Duration) *DoHResolver {
+	return &DoHResolver{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+// Resolve posts query to the endpoint and returns its answer
+func (r *DoHResolver) Resolve(query []byte) ([]byte, error) {
+	return r.ResolveContext(context.Background(), query)
+}
+
+// ResolveContext is like Resolve but gives up once ctx is done
+func (r *DoHResolver) ResolveContext(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, &ValidationError{Field: "length", Reason: "message too short"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", DoHMediaType)
+	req.Header.Set("Accept", DoHMediaType)
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("query DoH endpoint %s: %w", r.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH endpoint %s answered %s", r.URL, resp.Status)
+	}
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, maxUDPResponse))
+	if err != nil {
+		return nil, fmt.Errorf("read from DoH endpoint %s: %w", r.URL, err)
+	}
+	if len(response) < 12 {
+		return nil, ErrShortResponse
+	}
+	return response, nil
+}
@@ -0,0 +1,286 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+const (
+	// optionClientSubnet is the EDNS Client Subnet option code (RFC 7871)
+	optionClientSubnet = 8
+	// DefaultUDPSize is the payload size advertised in an added OPT record
+	DefaultUDPSize = 1232
+	// MinUDPSize is the payload size every client accepts, with or without
+	// EDNS (RFC 6891 section 6.2.5)
+	MinUDPSize = 512
+
+	familyIPv4 = 1
+	familyIPv6 = 2
+)
+
+var (
+	ErrBadOption       = errors.New("malformed EDNS option")
+	ErrBadClientSubnet = errors.New("malformed EDNS client subnet option")
+)
+
+// ClientSubnet is an EDNS Client Subnet option. Address holds only the
+// first SourcePrefix bits; ScopePrefix is set by upstreams in responses.
+type ClientSubnet struct {
+	Address      net.IP
+	SourcePrefix uint8
+	ScopePrefix  uint8
+}
+
+// NewClientSubnet truncates ip to prefix4 or prefix6 bits depending on its
+// address family
+func NewClientSubnet(ip net.IP, prefix4, prefix6 int) ClientSubnet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ClientSubnet{Address: ip4.Mask(net.CIDRMask(prefix4, 32)), SourcePrefix: uint8(prefix4)}
+	}
+	return ClientSubnet{Address: ip.To16().Mask(net.CIDRMask(prefix6, 128)), SourcePrefix: uint8(prefix6)}
+}
+
+// Truncate narrows the subnet to at most prefix4 or prefix6 bits
+func (c ClientSubnet) Truncate(prefix4, prefix6 int) ClientSubnet {
+	limit := prefix6
+	if c.Address.To4() != nil {
+		limit = prefix4
+	}
+	if int(c.SourcePrefix) <= limit {
+		return c
+	}
+	return NewClientSubnet(c.Address, prefix4, prefix6)
+}
+
+func (c ClientSubnet) pack() []byte {
+	family, addr := uint16(familyIPv6), c.Address.To16()
+	if ip4 := c.Address.To4(); ip4 != nil {
+		family, addr = familyIPv4, ip4
+	}
+	// Only the bytes covering the source prefix are sent
+	addr = addr[:(int(c.SourcePrefix)+7)/8]
+
+	data := make([]byte, 4, 4+len(addr))
+	binary.BigEndian.PutUint16(data[0:2], family)
+	data[2], data[3] = c.SourcePrefix, c.ScopePrefix
+	return append(data, addr...)
+}
+
+func parseClientSubnet(data []byte) (ClientSubnet, error) {
+	if len(data) < 4 {
+		return ClientSubnet{}, ErrBadClientSubnet
+	}
+	size := net.IPv6len
+	switch binary.BigEndian.Uint16(data[0:2]) {
+	case familyIPv4:
+		size = net.IPv4len
+	case familyIPv6:
+	default:
+		return ClientSubnet{}, ErrBadClientSubnet
+	}
+
+	c := ClientSubnet{SourcePrefix: data[2], ScopePrefix: data[3]}
+	addr := data[4:]
+	if int(c.SourcePrefix) > size*8 || len(addr) != (int(c.SourcePrefix)+7)/8 {
+		return ClientSubnet{}, ErrBadClientSubnet
+	}
+	c.Address = make(net.IP, size)
+	copy(c.Address, addr)
+	return c, nil
+}
+
+// EDNS holds the fixed fields of an OPT record
+type EDNS struct {
+	UDPSize  uint16 // Largest UDP payload the sender can reassemble
+	Version  uint8
+	DNSSECOK bool
+}
+
+// PayloadSize returns the largest UDP response the sender accepts. Without
+// EDNS, or below the minimum, that is 512 bytes.
+func (e *EDNS) PayloadSize() int {
+	if e == nil || e.UDPSize < MinUDPSize {
+		return MinUDPSize
+	}
+	return int(e.UDPSize)
+}
+
+// ParseOPT returns the OPT record carried by msg, or nil when there is none
+func ParseOPT(msg []byte) (*EDNS, error) {
+	fixed, err := findOPT(msg)
+	if err != nil || fixed < 0 {
+		return nil, err
+	}
+	return &EDNS{
+		UDPSize:  binary.BigEndian.Uint16(msg[fixed+2 : fixed+4]),
+		Version:  msg[fixed+5],
+		DNSSECOK: msg[fixed+6]&0x80 != 0,
+	}, nil
+}
+
+// Truncate returns msg when it fits in limit bytes. Otherwise it returns
+// the header and question with the TC bit set, keeping any OPT record, so
+// the client retries over TCP.
+func Truncate(msg []byte, limit int) []byte {
+	if len(msg) <= limit || len(msg) < 12 {
+		return msg
+	}
+
+	end := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		_, next, err := ReadName(msg, end)
+		if err != nil || next+4 > len(msg) {
+			end = 12
+			break
+		}
+		end = next + 4
+	}
+
+	out := make([]byte, end, end+11)
+	copy(out, msg[:end])
+	out[2] |= byte(FlagTC >> 8)
+	if end == 12 {
+		binary.BigEndian.PutUint16(out[4:6], 0)
+	}
+	binary.BigEndian.PutUint32(out[6:10], 0)
+	binary.BigEndian.PutUint16(out[10:12], 0)
+
+	// The OPT owner name is the root, a single zero byte
+	if fixed, err := findOPT(msg); err == nil && fixed > 0 {
+		record := msg[fixed-1 : fixed+10+int(binary.BigEndian.Uint16(msg[fixed+8:fixed+10]))]
+		if len(out)+len(record) <= limit {
+			out = append(out, record...)
+			binary.BigEndian.PutUint16(out[10:12], 1)
+		}
+	}
+	return out
+}
+
+// RemoveOPT returns msg without its OPT record, for answering a client
+// that sent none (RFC 6891 section 7). msg is returned as is when it has
+// no OPT record.
+func RemoveOPT(msg []byte) ([]byte, error) {
+	fixed, err := findOPT(msg)
+	if err != nil || fixed < 0 {
+		return msg, err
+	}
+	// The OPT owner name is the root, a single zero byte
+	if fixed < 1 || msg[fixed-1] != 0 {
+		return nil, ErrBadOption
+	}
+	start := fixed - 1
+	end := fixed + 10 + int(binary.BigEndian.Uint16(msg[fixed+8:fixed+10]))
+
+	out := make([]byte, 0, len(msg)-(end-start))
+	out = append(out, msg[:start]...)
+	out = append(out, msg[end:]...)
+	binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(msg[10:12])-1)
+	return out, nil
+}
+
+// findOPT returns the offset of the OPT record's fixed fields, or -1 when
+// msg carries none
+func findOPT(msg []byte) (int, error) {
+	opt := -1
+	err := walkRecords(msg, func(rrType DNSType, fixed int) {
+		if rrType == TypeOPT && opt < 0 {
+			opt = fixed
+		}
+	})
+	return opt, err
+}
+
+// optOptions calls fn with the code and data of every option in the OPT
+// record whose fixed fields start at fixed
+func optOptions(msg []byte, fixed int, fn func(code uint16, data []byte)) error {
+	rdata := msg[fixed+10 : fixed+10+int(binary.BigEndian.Uint16(msg[fixed+8:fixed+10]))]
+	for len(rdata) > 0 {
+		if len(rdata) < 4 {
+			return ErrBadOption
+		}
+		length := int(binary.BigEndian.Uint16(rdata[2:4]))
+		if 4+length > len(rdata) {
+			return ErrBadOption
+		}
+		fn(binary.BigEndian.Uint16(rdata[0:2]), rdata[4:4+length])
+		rdata = rdata[4+length:]
+	}
+	return nil
+}
+
+// ClientSubnetOf returns the client subnet option carried by msg and
+// whether there is one
+func ClientSubnetOf(msg []byte) (ClientSubnet, bool, error) {
+	fixed, err := findOPT(msg)
+	if err != nil || fixed < 0 {
+		return ClientSubnet{}, false, err
+	}
+
+	var ecs ClientSubnet
+	var parseErr error
+	found := false
+	err = optOptions(msg, fixed, func(code uint16, data []byte) {
+		if code != optionClientSubnet || found || parseErr != nil {
+			return
+		}
+		ecs, parseErr = parseClientSubnet(data)
+		found = parseErr == nil
+	})
+	if err == nil {
+		err = parseErr
+	}
+	if err != nil {
+		return ClientSubnet{}, false, err
+	}
+	return ecs, found, nil
+}
+
+// SetClientSubnet returns a copy of msg carrying ecs as its only client
+// subnet option. An OPT record is added when msg has none.
+func SetClientSubnet(msg []byte, ecs ClientSubnet) ([]byte, error) {
+	fixed, err := findOPT(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	data := ecs.pack()
+	option := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(option[0:2], optionClientSubnet)
+	binary.BigEndian.PutUint16(option[2:4], uint16(len(data)))
+	option = append(option, data...)
+
+	if fixed < 0 {
+		out := make([]byte, len(msg), len(msg)+11+len(option))
+		copy(out, msg)
+		binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(msg[10:12])+1)
+		out = append(out, 0) // root owner name
+		out = binary.BigEndian.AppendUint16(out, uint16(TypeOPT))
+		out = binary.BigEndian.AppendUint16(out, DefaultUDPSize)
+		out = binary.BigEndian.AppendUint32(out, 0)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(option)))
+		return append(out, option...), nil
+	}
+
+	// Rebuild the OPT data without any previous client subnet option
+	var rdata []byte
+	err = optOptions(msg, fixed, func(code uint16, data []byte) {
+		if code == optionClientSubnet {
+			return
+		}
+		rdata = binary.BigEndian.AppendUint16(rdata, code)
+		rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(data)))
+		rdata = append(rdata, data...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rdata = append(rdata, option...)
+
+	end := fixed + 10 + int(binary.BigEndian.Uint16(msg[fixed+8:fixed+10]))
+	out := make([]byte, 0, len(msg)-(end-fixed-10)+len(rdata))
+	out = append(out, msg[:fixed+8]...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+	out = append(out, rdata...)
+	return append(out, msg[end:]...), nil
+}
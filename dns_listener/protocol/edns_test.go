@@ -0,0 +1,171 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestSetClientSubnet(t *testing.T) {
+	query := buildQuery("example.com", TypeA)
+
+	ecs := NewClientSubnet(net.ParseIP("198.51.100.77"), 24, 56)
+	msg, err := SetClientSubnet(query, ecs)
+	if err != nil {
+		t.Fatalf("SetClientSubnet() error = %v", err)
+	}
+	if arcount := binary.BigEndian.Uint16(msg[10:12]); arcount != 1 {
+		t.Errorf("ARCOUNT = %d, want 1", arcount)
+	}
+
+	got, found, err := ClientSubnetOf(msg)
+	if err != nil || !found {
+		t.Fatalf("ClientSubnetOf() = %v, %v, want option", found, err)
+	}
+	if got.SourcePrefix != 24 || !got.Address.Equal(net.ParseIP("198.51.100.0")) {
+		t.Errorf("ClientSubnetOf() = %s/%d, want 198.51.100.0/24", got.Address, got.SourcePrefix)
+	}
+
+	// Replacing keeps a single option and other EDNS data intact
+	v6 := NewClientSubnet(net.ParseIP("2001:db8:aaaa:bbbb::1"), 24, 48)
+	msg, err = SetClientSubnet(msg, v6)
+	if err != nil {
+		t.Fatalf("SetClientSubnet() error = %v", err)
+	}
+	if arcount := binary.BigEndian.Uint16(msg[10:12]); arcount != 1 {
+		t.Errorf("ARCOUNT = %d after replace, want 1", arcount)
+	}
+	got, _, _ = ClientSubnetOf(msg)
+	if got.SourcePrefix != 48 || !got.Address.Equal(net.ParseIP("2001:db8:aaaa::")) {
+		t.Errorf("ClientSubnetOf() = %s/%d, want 2001:db8:aaaa::/48", got.Address, got.SourcePrefix)
+	}
+	options := 0
+	fixed, _ := findOPT(msg)
+	optOptions(msg, fixed, func(uint16, []byte) { options++ })
+	if options != 1 {
+		t.Errorf("OPT carries %d options, want 1", options)
+	}
+}
+
+func TestClientSubnetTruncate(t *testing.T) {
+	wide := ClientSubnet{Address: net.ParseIP("203.0.113.129").To4(), SourcePrefix: 32}
+	if got := wide.Truncate(24, 56); got.SourcePrefix != 24 || !got.Address.Equal(net.ParseIP("203.0.113.0")) {
+		t.Errorf("Truncate() = %s/%d, want 203.0.113.0/24", got.Address, got.SourcePrefix)
+	}
+
+	narrow := NewClientSubnet(net.ParseIP("203.0.113.129"), 16, 56)
+	if got := narrow.Truncate(24, 56); got.SourcePrefix != 16 {
+		t.Errorf("Truncate() prefix = %d, want narrower 16 kept", got.SourcePrefix)
+	}
+}
+
+func TestClientSubnetOfMalformed(t *testing.T) {
+	query := buildQuery("example.com", TypeA)
+	msg, err := SetClientSubnet(query, NewClientSubnet(net.ParseIP("192.0.2.1"), 24, 56))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Claim a longer prefix than the address bytes carried
+	msg[len(msg)-5] = 32
+	if _, _, err := ClientSubnetOf(msg); err != ErrBadClientSubnet {
+		t.Errorf("ClientSubnetOf() error = %v, want %v", err, ErrBadClientSubnet)
+	}
+}
+
+// withOPT appends an OPT record advertising size to query
+func withOPT(query []byte, size uint16, dnssecOK bool) []byte {
+	out := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(out[10:12])+1)
+	out = append(out, 0)
+	out = binary.BigEndian.AppendUint16(out, uint16(TypeOPT))
+	out = binary.BigEndian.AppendUint16(out, size)
+	flags := uint32(0)
+	if dnssecOK {
+		flags = 1 << 15
+	}
+	out = binary.BigEndian.AppendUint32(out, flags)
+	return binary.BigEndian.AppendUint16(out, 0)
+}
+
+func TestParseOPT(t *testing.T) {
+	msg, err := ParseMessage(withOPT(buildQuery("example.com", TypeA), 4096, true))
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	want := EDNS{UDPSize: 4096, DNSSECOK: true}
+	if msg.EDNS == nil || *msg.EDNS != want {
+		t.Fatalf("EDNS = %+v, want %+v", msg.EDNS, want)
+	}
+	if size := msg.EDNS.PayloadSize(); size != 4096 {
+		t.Errorf("PayloadSize() = %d, want 4096", size)
+	}
+
+	plain, err := ParseMessage(buildQuery("example.com", TypeA))
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	if plain.EDNS != nil {
+		t.Errorf("EDNS = %+v for a query without OPT", plain.EDNS)
+	}
+	if size := plain.EDNS.PayloadSize(); size != MinUDPSize {
+		t.Errorf("PayloadSize() without EDNS = %d, want %d", size, MinUDPSize)
+	}
+
+	small, _ := ParseOPT(withOPT(buildQuery("example.com", TypeA), 256, false))
+	if size := small.PayloadSize(); size != MinUDPSize {
+		t.Errorf("PayloadSize() for 256 = %d, want %d", size, MinUDPSize)
+	}
+}
+
+func TestRemoveOPT(t *testing.T) {
+	query := buildQuery("opt.example", TypeA)
+	b := NewResponseBuilder(query, ResponseOptions{})
+	b.AddAnswer(b.Question(), TypeA, ClassIN, 60, []byte{192, 0, 2, 1})
+	plain := b.Bytes()
+
+	withOPT, err := SetClientSubnet(plain, NewClientSubnet(net.ParseIP("192.0.2.1"), 24, 56))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RemoveOPT(withOPT)
+	if err != nil {
+		t.Fatalf("RemoveOPT() error = %v", err)
+	}
+	if string(got) != string(plain) {
+		t.Errorf("RemoveOPT() = %x, want %x", got, plain)
+	}
+	if got, err := RemoveOPT(plain); err != nil || string(got) != string(plain) {
+		t.Errorf("RemoveOPT() without OPT = %x, %v, want the message unchanged", got, err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	query := withOPT(buildQuery("big.example", TypeA), 4096, false)
+	b := NewResponseBuilder(query, ResponseOptions{})
+	for i := 0; i < 100; i++ {
+		b.AddAnswer(b.Question(), TypeA, ClassIN, 60, []byte{192, 0, 2, byte(i)})
+	}
+	response := withOPT(b.Bytes(), 4096, false)
+	if len(response) <= 1232 {
+		t.Fatalf("response is only %d bytes", len(response))
+	}
+
+	if got := Truncate(response, 4096); len(got) != len(response) {
+		t.Errorf("Truncate() to 4096 shortened a %d byte response to %d", len(response), len(got))
+	}
+
+	got := Truncate(response, 1232)
+	if got[2]&byte(FlagTC>>8) == 0 {
+		t.Errorf("flags = %08b, want TC set", got[2])
+	}
+	if an := binary.BigEndian.Uint16(got[6:8]); an != 0 {
+		t.Errorf("answer count = %d, want 0", an)
+	}
+	q, err := ReadQuestion(got)
+	if err != nil || q.Name != "big.example" {
+		t.Errorf("ReadQuestion() = %+v, %v, want the original question", q, err)
+	}
+	if edns, err := ParseOPT(got); err != nil || edns == nil || edns.UDPSize != 4096 {
+		t.Errorf("ParseOPT() = %+v, %v, want the OPT record kept", edns, err)
+	}
+}
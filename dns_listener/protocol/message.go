@@ -0,0 +1,251 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxLabelLength and maxNameLength are the RFC 1035 limits on a label
+	// and on a whole name in wire format
+	maxLabelLength = 63
+	maxNameLength  = 255
+	// maxSectionLength is the largest count a header section field holds
+	maxSectionLength = 0xFFFF
+)
+
+var ErrTrailingData = errors.New("trailing data after DNS message")
+
+// Header is the message header apart from the section counts, which
+// Marshal derives from the sections
+type Header struct {
+	ID    uint16
+	Flags DNSFlags // QR, opcode, AA, TC, RD, RA and the Z bits
+	RCode RCode
+}
+
+// Record is a resource record. Data holds the RDATA in wire format with
+// any names in it written out in full.
+type Record struct {
+	Name  string
+	Type  DNSType
+	Class DNSClass
+	TTL   uint32
+	Data  []byte
+}
+
+// Message is a complete DNS message
+type Message struct {
+	Header     Header
+	Questions  []Question
+	Answers    []Record
+	Authority  []Record
+	Additional []Record
+
+	// DisableCompression makes Marshal write owner names in full instead
+	// of pointing at earlier occurrences
+	DisableCompression bool
+}
+
+// Marshal encodes m in wire format. Owner and question names are
+// compressed unless DisableCompression is set; names in record data are
+// written as they are.
+func (m *Message) Marshal() ([]byte, error) {
+	sections := [][]Record{m.Answers, m.Authority, m.Additional}
+	if len(m.Questions) > maxSectionLength {
+		return nil, fmt.Errorf("%d questions exceed the section limit", len(m.Questions))
+	}
+	for _, records := range sections {
+		if len(records) > maxSectionLength {
+			return nil, fmt.Errorf("%d records exceed the section limit", len(records))
+		}
+	}
+
+	buf := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(buf[0:2], m.Header.ID)
+	binary.BigEndian.PutUint16(buf[2:4], uint16(m.Header.Flags)&^0x000F|uint16(m.Header.RCode)&0x000F)
+	binary.BigEndian.PutUint16(buf[4:6], uint16(len(m.Questions)))
+	for i, records := range sections {
+		binary.BigEndian.PutUint16(buf[6+2*i:8+2*i], uint16(len(records)))
+	}
+
+	names := compressor{}
+	appendName := func(buf []byte, name string) ([]byte, error) {
+		if err := checkName(name); err != nil {
+			return nil, err
+		}
+		if m.DisableCompression {
+			return AppendName(buf, name), nil
+		}
+		return names.appendName(buf, name), nil
+	}
+
+	var err error
+	for _, q := range m.Questions {
+		if buf, err = appendName(buf, q.Name); err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(q.Type))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(q.Class))
+	}
+	for _, records := range sections {
+		for _, rr := range records {
+			if len(rr.Data) > 0xFFFF {
+				return nil, fmt.Errorf("record %s: %d bytes of data exceed the limit", rr.Name, len(rr.Data))
+			}
+			if buf, err = appendName(buf, rr.Name); err != nil {
+				return nil, err
+			}
+			buf = binary.BigEndian.AppendUint16(buf, uint16(rr.Type))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(rr.Class))
+			buf = binary.BigEndian.AppendUint32(buf, rr.TTL)
+			buf = binary.BigEndian.AppendUint16(buf, uint16(len(rr.Data)))
+			buf = append(buf, rr.Data...)
+		}
+	}
+	return buf, nil
+}
+
+// Unmarshal decodes a message in wire format. Compressed names in the
+// data of NS, CNAME, PTR, MX and SOA records are expanded so that records
+// can be copied into other messages.
+func Unmarshal(msg []byte) (*Message, error) {
+	if len(msg) < 12 {
+		return nil, &ValidationError{Field: "length", Reason: "message too short"}
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:4])
+	m := &Message{
+		Header: Header{
+			ID:    binary.BigEndian.Uint16(msg[0:2]),
+			Flags: DNSFlags(flags &^ 0x000F),
+			RCode: RCode(flags & 0x000F),
+		},
+	}
+
+	offset := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		name, next, err := ReadName(msg, offset)
+		if err != nil {
+			return nil, fmt.Errorf("question %d: %w", i, err)
+		}
+		if next+4 > len(msg) {
+			return nil, &ValidationError{Field: "question", Reason: "truncated question"}
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  DNSType(binary.BigEndian.Uint16(msg[next : next+2])),
+			Class: DNSClass(binary.BigEndian.Uint16(msg[next+2 : next+4])),
+		})
+		offset = next + 4
+	}
+
+	sections := []*[]Record{&m.Answers, &m.Authority, &m.Additional}
+	for i, section := range sections {
+		for j := 0; j < int(binary.BigEndian.Uint16(msg[6+2*i:8+2*i])); j++ {
+			name, next, err := ReadName(msg, offset)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", j, err)
+			}
+			if next+10 > len(msg) {
+				return nil, ErrNameTruncated
+			}
+			rdLen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+			if next+10+rdLen > len(msg) {
+				return nil, &ValidationError{Field: "rdata", Reason: "record data truncated"}
+			}
+			rr := Record{
+				Name:  name,
+				Type:  DNSType(binary.BigEndian.Uint16(msg[next : next+2])),
+				Class: DNSClass(binary.BigEndian.Uint16(msg[next+2 : next+4])),
+				TTL:   binary.BigEndian.Uint32(msg[next+4 : next+8]),
+			}
+			if rr.Data, err = expandData(msg, rr.Type, next+10, rdLen); err != nil {
+				return nil, fmt.Errorf("record %s: %w", name, err)
+			}
+			*section = append(*section, rr)
+			offset = next + 10 + rdLen
+		}
+	}
+
+	if offset != len(msg) {
+		return nil, ErrTrailingData
+	}
+	return m, nil
+}
+
+// expandData copies the length bytes of record data at offset, writing
+// the names of the types that carry them uncompressed
+func expandData(msg []byte, rrType DNSType, offset, length int) ([]byte, error) {
+	end := offset + length
+	rdata := msg[offset:end:end]
+
+	// prefix is the number of fixed bytes before the names, names their
+	// count and suffix the number of fixed bytes after them
+	var prefix, names, suffix int
+	switch rrType {
+	case TypeNS, TypeCNAME, TypePTR:
+		names = 1
+	case TypeMX:
+		prefix, names = 2, 1
+	case TypeSOA:
+		names, suffix = 2, 20
+	default:
+		return append([]byte(nil), rdata...), nil
+	}
+
+	if prefix > length {
+		return nil, &ValidationError{Field: "rdata", Reason: "record data truncated"}
+	}
+	data := append([]byte(nil), rdata[:prefix]...)
+	pos := offset + prefix
+	for i := 0; i < names; i++ {
+		name, next, err := ReadName(msg, pos)
+		if err != nil || next > end {
+			return nil, &ValidationError{Field: "rdata", Reason: "invalid name in record data"}
+		}
+		data = AppendName(data, name)
+		pos = next
+	}
+	if end-pos != suffix {
+		return nil, &ValidationError{Field: "rdata", Reason: "record data length mismatch"}
+	}
+	return append(data, msg[pos:end]...), nil
+}
+
+// checkName reports names that cannot be written in wire format
+func checkName(name string) error {
+	length := 1
+	for _, label := range splitName(name) {
+		if label == "" || len(label) > maxLabelLength {
+			return fmt.Errorf("name %q: label length must be 1 to %d", name, maxLabelLength)
+		}
+		length += len(label) + 1
+	}
+	if length > maxNameLength {
+		return fmt.Errorf("name %q: longer than %d bytes", name, maxNameLength)
+	}
+	return nil
+}
+
+// compressor maps lowercased name suffixes to their offset in a message
+type compressor map[string]int
+
+// appendName writes name, pointing at the longest suffix already written
+func (c compressor) appendName(buf []byte, name string) []byte {
+	labels := splitName(name)
+	for i := range labels {
+		suffix := strings.ToLower(strings.Join(labels[i:], "."))
+		if ptr, ok := c[suffix]; ok {
+			return append(buf, byte(pointerMask|ptr>>8), byte(ptr))
+		}
+		if pos := len(buf); pos <= maxPointerOffset {
+			c[suffix] = pos
+		}
+		buf = append(buf, byte(len(labels[i])))
+		buf = append(buf, labels[i]...)
+	}
+	return append(buf, 0)
+}
@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// soaData builds SOA record data with uncompressed names
+func soaData(mname, rname string) []byte {
+	data := AppendName(nil, mname)
+	data = AppendName(data, rname)
+	return append(data, 0, 0, 0, 1, 0, 0, 0x0E, 0x10, 0, 0, 0x02, 0x58, 0, 1, 0x51, 0x80, 0, 0, 0x01, 0x2C)
+}
+
+func testMessage() *Message {
+	return &Message{
+		Header: Header{ID: 0xBEEF, Flags: FlagQR | FlagRD | FlagRA, RCode: RCodeNoError},
+		Questions: []Question{
+			{Name: "www.example.com", Type: TypeA, Class: ClassIN},
+		},
+		Answers: []Record{
+			{Name: "www.example.com", Type: TypeCNAME, Class: ClassIN, TTL: 300, Data: AppendName(nil, "web.example.com")},
+			{Name: "web.example.com", Type: TypeA, Class: ClassIN, TTL: 60, Data: []byte{192, 0, 2, 1}},
+			{Name: "web.example.com", Type: TypeAAAA, Class: ClassIN, TTL: 60,
+				Data: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		},
+		Authority: []Record{
+			{Name: "example.com", Type: TypeSOA, Class: ClassIN, TTL: 3600, Data: soaData("ns1.example.com", "hostmaster.example.com")},
+		},
+		Additional: []Record{
+			{Name: "example.com", Type: TypeMX, Class: ClassIN, TTL: 300, Data: append([]byte{0, 10}, AppendName(nil, "mail.example.com")...)},
+			{Name: "", Type: TypeOPT, Class: 1232, TTL: 0, Data: []byte{0, 8, 0, 4, 0, 1, 24, 0}},
+		},
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		m := testMessage()
+		m.DisableCompression = disable
+
+		wire, err := m.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		got, err := Unmarshal(wire)
+		if err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		got.DisableCompression = disable
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("round trip with DisableCompression=%v = %+v, want %+v", disable, got, m)
+		}
+
+		// The existing decoders read the encoded message too
+		q, err := ReadQuestion(wire)
+		if err != nil || q != m.Questions[0] {
+			t.Errorf("ReadQuestion() = %+v, %v, want %+v", q, err, m.Questions[0])
+		}
+		if n, err := CountAnswers(wire, TypeA); err != nil || n != 1 {
+			t.Errorf("CountAnswers(A) = %d, %v, want 1", n, err)
+		}
+	}
+}
+
+func TestMarshalCompression(t *testing.T) {
+	m := testMessage()
+	compressed, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	m.DisableCompression = true
+	expanded, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if len(compressed) >= len(expanded) {
+		t.Errorf("compressed message has %d bytes, uncompressed %d", len(compressed), len(expanded))
+	}
+
+	// The first answer's owner points at the question name
+	if owner := 12 + len(AppendName(nil, "www.example.com")) + 4; !bytes.Equal(compressed[owner:owner+2], []byte{0xC0, 12}) {
+		t.Errorf("first answer owner = %x, want a pointer to offset 12", compressed[owner:owner+2])
+	}
+}
+
+func TestMarshalMatchesBuilder(t *testing.T) {
+	query := buildQuery("stub.example", TypeA)
+	want := CreateResponse(query, ResponseOptions{})
+
+	m := &Message{
+		Header:    Header{ID: 0x1234, Flags: FlagQR | FlagRD},
+		Questions: []Question{{Name: "stub.example", Type: TypeA, Class: ClassIN}},
+		Answers:   []Record{{Name: "stub.example", Type: TypeA, Class: ClassIN, TTL: 300, Data: []byte{127, 0, 0, 1}}},
+	}
+	got, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Marshal() = %x, want the builder's %x", got, want)
+	}
+}
+
+func TestUnmarshalExpandsDataNames(t *testing.T) {
+	// A CNAME whose target is compressed against the question name
+	b := NewResponseBuilder(buildQuery("www.example.com", TypeA), ResponseOptions{})
+	b.AddAnswer(b.Question(), TypeCNAME, ClassIN, 300, []byte{3, 'c', 'd', 'n', 0xC0, 16})
+	m, err := Unmarshal(b.Bytes())
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if want := AppendName(nil, "cdn.example.com"); !bytes.Equal(m.Answers[0].Data, want) {
+		t.Errorf("CNAME data = %x, want the expanded name %x", m.Answers[0].Data, want)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for _, name := range []string{
+		strings.Repeat("a", 64) + ".example",
+		"empty..label",
+		strings.Repeat(strings.Repeat("a", 63)+".", 4) + "example",
+	} {
+		m := &Message{Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}}}
+		if _, err := m.Marshal(); err == nil {
+			t.Errorf("Marshal() with name %.20q... succeeded, want error", name)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	wire, err := testMessage().Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for name, msg := range map[string][]byte{
+		"short header":   wire[:11],
+		"truncated":      wire[:len(wire)-3],
+		"trailing bytes": append(append([]byte(nil), wire...), 0),
+	} {
+		if _, err := Unmarshal(msg); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// pointerMask marks a compression pointer in a label length byte
+	pointerMask = 0xC0
+	// maxPointerOffset is the largest offset a 14-bit pointer can address
+	maxPointerOffset = 0x3FFF
+	// maxPointerHops bounds pointer chains to defeat compression loops
+	maxPointerHops = 32
+)
+
+var (
+	ErrNameTruncated = errors.New("DNS name truncated")
+	ErrPointerLoop   = errors.New("DNS name compression loop")
+	ErrBadLabelType  = errors.New("unsupported DNS label type")
+)
+
+// ReadName reads a possibly compressed DNS name from msg starting at offset.
+// It returns the dotted name and the offset just past the name as it appears
+// at offset (a pointer counts as two bytes).
+func ReadName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	hops := 0
+
+	for {
+		if offset >= len(msg) {
+			return "", 0, ErrNameTruncated
+		}
+		length := int(msg[offset])
+
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&pointerMask == pointerMask:
+			if offset+1 >= len(msg) {
+				return "", 0, ErrNameTruncated
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			hops++
+			if hops > maxPointerHops {
+				return "", 0, ErrPointerLoop
+			}
+			offset = (length&^pointerMask)<<8 | int(msg[offset+1])
+		case length&pointerMask != 0:
+			return "", 0, ErrBadLabelType
+		default:
+			offset++
+			if offset+length > len(msg) {
+				return "", 0, ErrNameTruncated
+			}
+			labels = append(labels, string(msg[offset:offset+length]))
+			offset += length
+		}
+	}
+}
+
+// splitName splits a dotted name into its labels, ignoring a trailing dot
+func splitName(name string) []string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
+
+// AppendName appends name to buf in uncompressed wire format
+func AppendName(buf []byte, name string) []byte {
+	for _, label := range splitName(name) {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/exiguus/ns-checker/dns_listener/protocol"
@@ -42,6 +43,9 @@ func ParseDNSQuestion(query []byte) (string, error) {
 	if len(query) < 12 {
 		return "", errors.New("DNS message too short")
 	}
+	if query[4] != 0 || query[5] > 1 {
+		return "", errors.New("multiple questions not supported")
+	}
 
 	// Skip header
 	pos := 12
@@ -88,6 +92,9 @@ func (p *Parser) ParseQuery() (string, error) {
 
 	qCount := int(p.data[4])<<8 | int(p.data[5])
 	sb.WriteString(fmt.Sprintf("Questions: %d\n", qCount))
+	if qCount > 1 {
+		return "", fmt.Errorf("malformed DNS query: multiple questions not supported")
+	}
 
 	offset := 12
 	for i := 0; i < qCount; i++ {
@@ -138,3 +145,161 @@ func (p *Parser) parseName(offset int) (string, int) {
 	}
 	return strings.Join(labels, "."), offset
 }
+
+// ParseResponse parses a DNS response and returns a human-readable string:
+// the header and question as ParseQuery renders them, followed by one line
+// per record of the answer, authority and additional sections
+func (p *Parser) ParseResponse() (string, error) {
+	result, err := p.ParseQuery()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(result)
+	sb.WriteString(fmt.Sprintf("Response Code: %s\n", protocol.RCode(p.data[3]&0x0F)))
+
+	offset, err := p.skipQuestions()
+	if err != nil {
+		return "", err
+	}
+	sections := []string{"Answer", "Authority", "Additional"}
+	for i, section := range sections {
+		count := int(binary.BigEndian.Uint16(p.data[6+2*i : 8+2*i]))
+		for j := 0; j < count; j++ {
+			record, next, err := p.parseRecord(offset)
+			if err != nil {
+				return "", fmt.Errorf("malformed DNS response: %s record %d: %w", strings.ToLower(section), j, err)
+			}
+			sb.WriteString(fmt.Sprintf("%s: %s\n", section, record))
+			offset = next
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// skipQuestions returns the offset of the first record after the question
+// section
+func (p *Parser) skipQuestions() (int, error) {
+	offset := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(p.data[4:6])); i++ {
+		_, next, err := protocol.ReadName(p.data, offset)
+		if err != nil {
+			return 0, fmt.Errorf("malformed DNS response: question %d: %w", i, err)
+		}
+		offset = next + 4
+	}
+	return offset, nil
+}
+
+// parseRecord renders the resource record at offset in zone file order,
+// "name ttl class type data", and returns the offset of the next record
+func (p *Parser) parseRecord(offset int) (string, int, error) {
+	name, next, err := protocol.ReadName(p.data, offset)
+	if err != nil {
+		return "", 0, err
+	}
+	if next+10 > len(p.data) {
+		return "", 0, errors.New("incomplete record header")
+	}
+	rrType := protocol.DNSType(binary.BigEndian.Uint16(p.data[next : next+2]))
+	class := protocol.DNSClass(binary.BigEndian.Uint16(p.data[next+2 : next+4]))
+	ttl := binary.BigEndian.Uint32(p.data[next+4 : next+8])
+	rdLen := int(binary.BigEndian.Uint16(p.data[next+8 : next+10]))
+	start := next + 10
+	if start+rdLen > len(p.data) {
+		return "", 0, errors.New("record data truncated")
+	}
+
+	data, err := p.parseRData(rrType, start, rdLen)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s %s: %w", displayName(name), rrType, err)
+	}
+	return fmt.Sprintf("%s %d %s %s %s", displayName(name), ttl, class, rrType, data), start + rdLen, nil
+}
+
+// parseRData renders the length bytes of record data at offset. Names are
+// read from the whole message, so compression pointers into earlier
+// records resolve. Types without a text form are shown as in RFC 3597.
+func (p *Parser) parseRData(rrType protocol.DNSType, offset, length int) (string, error) {
+	rdata := p.data[offset : offset+length]
+	end := offset + length
+
+	// name reads a name that must lie within the record data
+	name := func(pos int) (string, int, error) {
+		n, next, err := protocol.ReadName(p.data, pos)
+		if err != nil {
+			return "", 0, err
+		}
+		if next > end {
+			return "", 0, errors.New("name runs past record data")
+		}
+		return displayName(n), next, nil
+	}
+
+	switch rrType {
+	case protocol.TypeA, protocol.TypeAAAA:
+		if (rrType == protocol.TypeA && length != net.IPv4len) || (rrType == protocol.TypeAAAA && length != net.IPv6len) {
+			return "", fmt.Errorf("invalid address length %d", length)
+		}
+		return net.IP(rdata).String(), nil
+
+	case protocol.TypeCNAME, protocol.TypeNS, protocol.TypePTR:
+		target, _, err := name(offset)
+		return target, err
+
+	case protocol.TypeMX:
+		if length < 3 {
+			return "", errors.New("record data truncated")
+		}
+		exchange, _, err := name(offset + 2)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(rdata[:2]), exchange), nil
+
+	case protocol.TypeTXT:
+		var parts []string
+		for pos := 0; pos < length; {
+			n := int(rdata[pos])
+			if pos+1+n > length {
+				return "", errors.New("character string truncated")
+			}
+			parts = append(parts, fmt.Sprintf("%q", rdata[pos+1:pos+1+n]))
+			pos += 1 + n
+		}
+		return strings.Join(parts, " "), nil
+
+	case protocol.TypeSOA:
+		mname, next, err := name(offset)
+		if err != nil {
+			return "", err
+		}
+		rname, next, err := name(next)
+		if err != nil {
+			return "", err
+		}
+		if end-next != 20 {
+			return "", errors.New("record data length mismatch")
+		}
+		f := p.data[next:end]
+		return fmt.Sprintf("%s %s %d %d %d %d %d", mname, rname,
+			binary.BigEndian.Uint32(f[0:4]), binary.BigEndian.Uint32(f[4:8]),
+			binary.BigEndian.Uint32(f[8:12]), binary.BigEndian.Uint32(f[12:16]),
+			binary.BigEndian.Uint32(f[16:20])), nil
+	}
+
+	if length == 0 {
+		return `\# 0`, nil
+	}
+	return fmt.Sprintf(`\# %d %x`, length, rdata), nil
+}
+
+// displayName shows the root name as "."
+func displayName(name string) string {
+	if name == "" {
+		return "."
+	}
+	return name
+}
@@ -1,7 +1,11 @@
 package parser
 
 import (
+	"net"
+	"strings"
 	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
 )
 
 func TestParseDNSHeader(t *testing.T) {
@@ -68,6 +72,17 @@ func TestParseDNSQuestion(t *testing.T) {
 			wantDomain: "example.com",
 			wantErr:    false,
 		},
+		{
+			name: "multiple questions",
+			query: []byte{
+				// Header with QDCOUNT 2
+				0x00, 0x01, 0x01, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x01, 'a', 0x00, 0x00, 0x01, 0x00, 0x01,
+				0x01, 'b', 0x00, 0x00, 0x01, 0x00, 0x01,
+			},
+			wantDomain: "",
+			wantErr:    true,
+		},
 		{
 			name:       "invalid query",
 			query:      []byte{0x00},
@@ -150,3 +165,75 @@ func headerEqual(a, b *DNSHeader) bool {
 		a.NSCount == b.NSCount &&
 		a.ARCount == b.ARCount
 }
+
+func TestParseResponse(t *testing.T) {
+	response := []byte{
+		// Header: response, RD RA, one question, two answers
+		0xab, 0xcd, 0x81, 0x80, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00,
+		// Question at offset 12, example.com starts at 16
+		0x03, 'w', 'w', 'w',
+		0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+		0x03, 'c', 'o', 'm',
+		0x00,
+		0x00, 0x01, 0x00, 0x01,
+		// www.example.com CNAME example.com, both names compressed
+		0xc0, 0x0c, 0x00, 0x05, 0x00, 0x01, 0x00, 0x00, 0x01, 0x2c, 0x00, 0x02,
+		0xc0, 0x10,
+		// example.com A 93.184.216.34
+		0xc0, 0x10, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x3c, 0x00, 0x04,
+		93, 184, 216, 34,
+	}
+
+	got, err := New(response).ParseResponse()
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	for _, want := range []string{
+		"Question: www.example.com\n",
+		"Response Code: NOERROR\n",
+		"Answer: www.example.com 300 IN CNAME example.com\n",
+		"Answer: example.com 60 IN A 93.184.216.34\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ParseResponse() = %q, want it to contain %q", got, want)
+		}
+	}
+
+	// A record cut short is reported rather than rendered
+	if _, err := New(response[:len(response)-2]).ParseResponse(); err == nil {
+		t.Error("ParseResponse() of a truncated response succeeded")
+	}
+}
+
+func TestParseRData(t *testing.T) {
+	tests := []struct {
+		name   string
+		rrType protocol.DNSType
+		rdata  []byte
+		want   string
+	}{
+		{"AAAA", protocol.TypeAAAA, net.ParseIP("2001:db8::1"), "2001:db8::1"},
+		{"MX", protocol.TypeMX, append([]byte{0x00, 0x0a}, protocol.AppendName(nil, "mail.example.com")...), "10 mail.example.com"},
+		{"TXT", protocol.TypeTXT, []byte{0x05, 'h', 'e', 'l', 'l', 'o', 0x03, 'a', ' ', 'b'}, `"hello" "a b"`},
+		{"NS", protocol.TypeNS, protocol.AppendName(nil, "ns1.example.com"), "ns1.example.com"},
+		{
+			"SOA", protocol.TypeSOA,
+			append(protocol.AppendName(protocol.AppendName(nil, "ns1.example.com"), "hostmaster.example.com"),
+				0, 0, 0, 1, 0, 0, 0x0e, 0x10, 0, 0, 0x07, 0x08, 0, 0x12, 0x75, 0, 0, 0, 0x01, 0x2c),
+			"ns1.example.com hostmaster.example.com 1 3600 1800 1209600 300",
+		},
+		{"unknown", protocol.DNSType(99), []byte{0xde, 0xad}, `\# 2 dead`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.rdata).parseRData(tt.rrType, 0, len(tt.rdata))
+			if err != nil {
+				t.Fatalf("parseRData() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseRData() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package protocol
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream selection strategies of an UpstreamPool
+const (
+	StrategyFailover   = "failover"   // always start with the first healthy upstream
+	StrategyRoundRobin = "roundrobin" // start with the next upstream on every query
+)
+
+// Backoff bounds of an UpstreamPool
+const (
+	DefaultPoolBackoff    = time.Second
+	DefaultPoolMaxBackoff = time.Minute
+)
+
+// UpstreamPool resolves through several upstreams, moving on to the next
+// one when an upstream fails or answers SERVFAIL. A failing upstream is
+// marked unhealthy for a backoff that doubles with every failure in a row
+// and is only asked again when it expires, or when every healthy upstream
+// failed too. Each attempt has its upstream's full timeout.
+type UpstreamPool struct {
+	members  []*poolMember
+	strategy string
+	next     atomic.Uint64
+
+	// Backoff is how long an upstream is skipped after its first failure;
+	// MaxBackoff caps the doubling. Set both before the first Resolve.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type poolMember struct {
+	name     string
+	resolver Resolver
+
+	mu        sync.Mutex
+	successes uint64
+	failures  uint64
+	streak    int // failures in a row
+	downUntil time.Time
+}
+
+// UpstreamStats reports the state of one upstream of a pool
+type UpstreamStats struct {
+	Addr      string
+	Successes uint64
+	Failures  uint64
+	Healthy   bool
+}
+
+// NewUpstreamPool creates a pool forwarding over UDP to addrs, tried in
+// the order given by strategy. An unknown strategy means failover.
+func NewUpstreamPool(addrs []string, timeout time.Duration, strategy string) *UpstreamPool {
+	resolvers := make([]Resolver, len(addrs))
+	for i, addr := range addrs {
+		resolvers[i] = NewUpstreamResolver(addr, timeout)
+	}
+	return newUpstreamPool(addrs, resolvers, strategy)
+}
+
+func newUpstreamPool(names []string, resolvers []Resolver, strategy string) *UpstreamPool {
+	p := &UpstreamPool{
+		strategy:   strategy,
+		Backoff:    DefaultPoolBackoff,
+		MaxBackoff: DefaultPoolMaxBackoff,
+	}
+	for i, r := range resolvers {
+		p.members = append(p.members, &poolMember{name: names[i], resolver: r})
+	}
+	return p
+}
+
+// Resolve implements Resolver. When every upstream fails it returns the
+// last SERVFAIL answer, if any upstream gave one, or else the last error.
+func (p *UpstreamPool) Resolve(query []byte) ([]byte, error) {
+	var servFail []byte
+	var errs []error
+	for _, m := range p.order(time.Now()) {
+		response, err := m.resolver.Resolve(query)
+		if err == nil && len(response) < 12 {
+			err = ErrShortResponse
+		}
+		if err == nil && RCode(response[3]&0x0F) != RCodeServFail {
+			p.succeeded(m)
+			return response, nil
+		}
+		p.failed(m, time.Now())
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			servFail = response
+		}
+	}
+	if servFail != nil {
+		return servFail, nil
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no upstreams configured")
+	}
+	return nil, errs[len(errs)-1]
+}
+
+// Stats returns the state of every upstream in configuration order
+func (p *UpstreamPool) Stats() []UpstreamStats {
+	now := time.Now()
+	stats := make([]UpstreamStats, len(p.members))
+	for i, m := range p.members {
+		m.mu.Lock()
+		stats[i] = UpstreamStats{
+			Addr:      m.name,
+			Successes: m.successes,
+			Failures:  m.failures,
+			Healthy:   !now.Before(m.downUntil),
+		}
+		m.mu.Unlock()
+	}
+	return stats
+}
+
+// order returns the upstreams to try for one query: the healthy ones in
+// strategy order, followed by the unhealthy ones as a last resort
+func (p *UpstreamPool) order(now time.Time) []*poolMember {
+	start := 0
+	if p.strategy == StrategyRoundRobin && len(p.members) > 0 {
+		start = int((p.next.Add(1) - 1) % uint64(len(p.members)))
+	}
+
+	healthy := make([]*poolMember, 0, len(p.members))
+	var down []*poolMember
+	for i := range p.members {
+		m := p.members[(start+i)%len(p.members)]
+		m.mu.Lock()
+		up := !now.Before(m.downUntil)
+		m.mu.Unlock()
+		if up {
+			healthy = append(healthy, m)
+		} else {
+			down = append(down, m)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (p *UpstreamPool) succeeded(m *poolMember) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.successes++
+	m.streak = 0
+	m.downUntil = time.Time{}
+}
+
+func (p *UpstreamPool) failed(m *poolMember, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+	m.streak++
+	backoff := p.Backoff
+	for i := 1; i < m.streak && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	m.downUntil = now.Add(backoff)
+}
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers with the stub response, or with SERVFAIL or an
+// error while failing is set. It counts the queries it sees.
+type fakeResolver struct {
+	failing  atomic.Bool
+	servFail bool
+	queries  atomic.Int32
+}
+
+func (r *fakeResolver) Resolve(query []byte) ([]byte, error) {
+	r.queries.Add(1)
+	if !r.failing.Load() {
+		return CreateResponse(query, ResponseOptions{}), nil
+	}
+	if r.servFail {
+		response := CreateResponse(query, ResponseOptions{})
+		response[3] = response[3]&0xF0 | byte(RCodeServFail)
+		return response, nil
+	}
+	return nil, errors.New("upstream down")
+}
+
+func TestUpstreamPoolFailover(t *testing.T) {
+	bad, good := &fakeResolver{servFail: true}, &fakeResolver{}
+	bad.failing.Store(true)
+	pool := newUpstreamPool([]string{"bad", "good"}, []Resolver{bad, good}, StrategyFailover)
+	pool.Backoff = 50 * time.Millisecond
+	query := buildQuery("pool.example", TypeA)
+
+	// The SERVFAIL of the first upstream moves on to the second
+	response, err := pool.Resolve(query)
+	if err != nil || RCode(response[3]&0x0F) != RCodeNoError {
+		t.Fatalf("Resolve() = rcode %d, %v, want NOERROR from the healthy upstream", response[3]&0x0F, err)
+	}
+
+	// While backing off, the failed upstream is skipped
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Resolve(query); err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+	}
+	if got := bad.queries.Load(); got != 1 {
+		t.Errorf("failing upstream saw %d queries during its backoff, want 1", got)
+	}
+	stats := pool.Stats()
+	if stats[0].Healthy || stats[0].Failures != 1 || !stats[1].Healthy || stats[1].Successes != 4 {
+		t.Errorf("Stats() = %+v, want bad unhealthy with 1 failure, good healthy with 4 successes", stats)
+	}
+
+	// Once the backoff expires the recovered upstream is preferred again
+	bad.failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := pool.Resolve(query); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := bad.queries.Load(); got != 2 {
+		t.Errorf("recovered upstream saw %d queries, want 2", got)
+	}
+	if stats := pool.Stats(); !stats[0].Healthy || stats[0].Successes != 1 {
+		t.Errorf("Stats()[0] = %+v, want healthy with 1 success", stats[0])
+	}
+}
+
+func TestUpstreamPoolBackoff(t *testing.T) {
+	bad := &fakeResolver{}
+	bad.failing.Store(true)
+	pool := newUpstreamPool([]string{"bad"}, []Resolver{bad}, StrategyFailover)
+	pool.Backoff, pool.MaxBackoff = time.Second, 3*time.Second
+
+	// A lone upstream is still asked while unhealthy, and its backoff
+	// doubles up to the cap
+	now := time.Now()
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if _, err := pool.Resolve(buildQuery("backoff.example", TypeA)); err == nil {
+			t.Fatalf("query %d: Resolve() succeeded with every upstream down", i)
+		}
+		m := pool.members[0]
+		m.mu.Lock()
+		backoff := m.downUntil.Sub(now)
+		m.mu.Unlock()
+		if backoff < want || backoff > want+time.Second/2 {
+			t.Errorf("query %d: backoff = %v, want %v", i, backoff, want)
+		}
+	}
+	if got := bad.queries.Load(); got != 4 {
+		t.Errorf("lone upstream saw %d queries, want 4", got)
+	}
+}
+
+func TestUpstreamPoolRoundRobin(t *testing.T) {
+	a, b := &fakeResolver{}, &fakeResolver{}
+	pool := newUpstreamPool([]string{"a", "b"}, []Resolver{a, b}, StrategyRoundRobin)
+
+	for i := 0; i < 4; i++ {
+		if _, err := pool.Resolve(buildQuery("rr.example", TypeA)); err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+	}
+	if a.queries.Load() != 2 || b.queries.Load() != 2 {
+		t.Errorf("queries = %d, %d, want 2 each", a.queries.Load(), b.queries.Load())
+	}
+
+	// A failing upstream's turn falls through to the other one
+	a.failing.Store(true)
+	if _, err := pool.Resolve(buildQuery("rr.example", TypeA)); err != nil {
+		t.Errorf("Resolve() error = %v, want the answer of b", err)
+	}
+}
+
+func TestNewUpstreamPool(t *testing.T) {
+	pool := NewUpstreamPool([]string{fakeUpstream(t, true), fakeUpstream(t, false)}, 50*time.Millisecond, StrategyFailover)
+	response, err := pool.Resolve(buildQuery("pool.example", TypeA))
+	if err != nil || len(response) < 12 {
+		t.Fatalf("Resolve() = %x, %v, want the second upstream's answer", response, err)
+	}
+	if stats := pool.Stats(); stats[0].Failures != 1 || stats[1].Successes != 1 {
+		t.Errorf("Stats() = %+v, want a timeout on the first and a success on the second", stats)
+	}
+}
@@ -16,6 +16,19 @@ func TestDNSType_String(t *testing.T) {
 		{"PTR Record", TypePTR, "PTR"},
 		{"SOA Record", TypeSOA, "SOA"},
 		{"TXT Record", TypeTXT, "TXT"},
+		{"OPT Record", TypeOPT, "OPT"},
+		{"SRV Record", TypeSRV, "SRV"},
+		{"CAA Record", TypeCAA, "CAA"},
+		{"DS Record", TypeDS, "DS"},
+		{"DNSKEY Record", TypeDNSKEY, "DNSKEY"},
+		{"RRSIG Record", TypeRRSIG, "RRSIG"},
+		{"NSEC Record", TypeNSEC, "NSEC"},
+		{"NSEC3 Record", TypeNSEC3, "NSEC3"},
+		{"TLSA Record", TypeTLSA, "TLSA"},
+		{"SVCB Record", TypeSVCB, "SVCB"},
+		{"HTTPS Record", TypeHTTPS, "HTTPS"},
+		{"NSAP-PTR Record", DNSType(23), "NSAP-PTR"},
+		{"DLV Record", DNSType(32769), "DLV"},
 		{"Unknown Type", DNSType(999), "TYPE-999"},
 	}
 
@@ -28,6 +41,43 @@ func TestDNSType_String(t *testing.T) {
 	}
 }
 
+func TestParseDNSType(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   DNSType
+		wantOK bool
+	}{
+		{"A", TypeA, true},
+		{"aaaa", TypeAAAA, true},
+		{"Https", TypeHTTPS, true},
+		{"caa", TypeCAA, true},
+		{"nsap-ptr", DNSType(23), true},
+		{"TYPE-999", DNSType(999), true},
+		{"type65", TypeHTTPS, true},
+		{"TYPE", 0, false},
+		{"TYPE-70000", 0, false},
+		{"TYPE+1", 0, false},
+		{"AAA", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseDNSType(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseDNSType(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// Every name String returns parses back to its type
+	for typ := range typeNames {
+		if got, ok := ParseDNSType(typ.String()); !ok || got != typ {
+			t.Errorf("ParseDNSType(%q) = %v, %v, want %v", typ.String(), got, ok, typ)
+		}
+	}
+}
+
 func TestDNSClass_String(t *testing.T) {
 	tests := []struct {
 		name string
@@ -73,3 +123,24 @@ func TestDNSFlags_String(t *testing.T) {
 		})
 	}
 }
+
+func TestRCode_String(t *testing.T) {
+	tests := []struct {
+		rcode RCode
+		want  string
+	}{
+		{RCodeNoError, "NOERROR"},
+		{RCodeServFail, "SERVFAIL"},
+		{RCodeNXDomain, "NXDOMAIN"},
+		{RCodeRefused, "REFUSED"},
+		{RCode(11), "RCODE-11"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.rcode.String(); got != tt.want {
+				t.Errorf("RCode.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
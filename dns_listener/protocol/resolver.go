@@ -0,0 +1,158 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxUDPResponse bounds the size of a response read from an upstream
+const maxUDPResponse = 65535
+
+var ErrShortResponse = errors.New("upstream response too short")
+
+// Resolver answers a DNS query in wire format with a response in wire
+// format
+type Resolver interface {
+	Resolve(query []byte) ([]byte, error)
+}
+
+// StubResolver answers every query with the stub A record built by
+// CreateResponse
+type StubResolver struct {
+	Options ResponseOptions
+}
+
+func (r StubResolver) Resolve(query []byte) ([]byte, error) {
+	response := CreateResponse(query, r.Options)
+	if response == nil {
+		return nil, &ValidationError{Field: "length", Reason: "message too short"}
+	}
+	return response, nil
+}
+
+// UpstreamResolver forwards queries over UDP to another resolver, retrying
+// over TCP when the UDP answer is truncated
+type UpstreamResolver struct {
+	Addr    string        // host:port of the upstream
+	Timeout time.Duration // time allowed for the whole exchange
+}
+
+// NewUpstreamResolver creates a resolver forwarding to addr
+func NewUpstreamResolver(addr string, timeout time.Duration) *UpstreamResolver {
+	return &UpstreamResolver{Addr: addr, Timeout: timeout}
+}
+
+// Resolve sends query to the upstream under a random ID and returns its
+// answer under the query's own ID. Datagrams that are not a response with
+// that ID to the same question are ignored until the timeout expires, so
+// a spoofer has to guess the ID as well as the source port. A truncated
+// answer is asked again over TCP (RFC 7766) and only returned as is when
+// that fails, so the client can retry on its own.
+func (r *UpstreamResolver) Resolve(query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, &ValidationError{Field: "length", Reason: "message too short"}
+	}
+	question, err := ReadQuestion(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	upstreamQuery := append([]byte(nil), query...)
+	copy(upstreamQuery, id[:])
+
+	deadline := time.Now().Add(r.Timeout)
+	response, err := r.exchangeUDP(upstreamQuery, id, question, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if response[2]&byte(FlagTC>>8) != 0 {
+		if full, err := r.exchangeTCP(upstreamQuery, id, question, deadline); err == nil {
+			response = full
+		}
+	}
+	response[0], response[1] = query[0], query[1]
+	return response, nil
+}
+
+// exchangeUDP sends query in one datagram and reads until the answer to it
+// arrives or deadline passes
+func (r *UpstreamResolver) exchangeUDP(query []byte, id [2]byte, question Question, deadline time.Time) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", r.Addr, time.Until(deadline))
+	if err != nil {
+		return nil, fmt.Errorf("dial upstream %s: %w", r.Addr, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf("send to upstream %s: %w", r.Addr, err)
+	}
+
+	buf := make([]byte, maxUDPResponse)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("read from upstream %s: %w", r.Addr, err)
+		}
+		if !answers(buf[:n], id, question) {
+			continue
+		}
+		response := make([]byte, n)
+		copy(response, buf[:n])
+		return response, nil
+	}
+}
+
+// exchangeTCP sends query with its two byte length prefix over a new TCP
+// connection and reads the answer the same way
+func (r *UpstreamResolver) exchangeTCP(query []byte, id [2]byte, question Question, deadline time.Time) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", r.Addr, time.Until(deadline))
+	if err != nil {
+		return nil, fmt.Errorf("dial upstream %s over TCP: %w", r.Addr, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	message := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(message, query...)); err != nil {
+		return nil, fmt.Errorf("send to upstream %s over TCP: %w", r.Addr, err)
+	}
+
+	var prefix [2]byte
+	if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+		return nil, fmt.Errorf("read from upstream %s over TCP: %w", r.Addr, err)
+	}
+	response := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, fmt.Errorf("read from upstream %s over TCP: %w", r.Addr, err)
+	}
+	if !answers(response, id, question) {
+		return nil, fmt.Errorf("upstream %s answered another query over TCP", r.Addr)
+	}
+	return response, nil
+}
+
+// answers reports whether msg is a response with id to question. Names
+// compare without regard to case, which upstreams may change (RFC 4343).
+func answers(msg []byte, id [2]byte, question Question) bool {
+	if len(msg) < 12 || msg[0] != id[0] || msg[1] != id[1] || msg[2]&0x80 == 0 {
+		return false
+	}
+	q, err := ReadQuestion(msg)
+	return err == nil && q.Type == question.Type && q.Class == question.Class &&
+		strings.EqualFold(q.Name, question.Name)
+}
@@ -0,0 +1,242 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeUpstream answers each datagram with a stray reply carrying a wrong
+// ID followed by the stub answer. A silent upstream reads and drops.
+func fakeUpstream(t *testing.T, silent bool) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if silent {
+				continue
+			}
+			response := CreateResponse(buf[:n], ResponseOptions{})
+			stray := append([]byte(nil), response...)
+			stray[0] ^= 0xFF
+			conn.WriteTo(stray, addr)
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestUpstreamResolver(t *testing.T) {
+	query := buildQuery("forward.example", TypeA)
+	r := NewUpstreamResolver(fakeUpstream(t, false), time.Second)
+
+	response, err := r.Resolve(query)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := CreateResponse(query, ResponseOptions{}); !bytes.Equal(response, want) {
+		t.Errorf("Resolve() = %x, want the upstream's answer %x", response, want)
+	}
+}
+
+func TestUpstreamResolverRejectsSpoofedReplies(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	query := buildQuery("victim.example", TypeA)
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		// A spoofer knowing the client's ID, unless the random upstream ID
+		// happens to be the same, then one answering another question
+		// under the upstream ID, before the real answer
+		if buf[0] != query[0] || buf[1] != query[1] {
+			withClientID := CreateResponse(buf[:n], ResponseOptions{StubIP: net.ParseIP("203.0.113.66")})
+			withClientID[0], withClientID[1] = query[0], query[1]
+			conn.WriteTo(withClientID, addr)
+		}
+		other := CreateResponse(buildQuery("attacker.example", TypeA), ResponseOptions{StubIP: net.ParseIP("203.0.113.66")})
+		other[0], other[1] = buf[0], buf[1]
+		conn.WriteTo(other, addr)
+		conn.WriteTo(CreateResponse(buf[:n], ResponseOptions{}), addr)
+	}()
+
+	response, err := NewUpstreamResolver(conn.LocalAddr().String(), time.Second).Resolve(query)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := CreateResponse(query, ResponseOptions{}); !bytes.Equal(response, want) {
+		t.Errorf("Resolve() = %x, want the real answer under the client's ID %x", response, want)
+	}
+}
+
+func TestUpstreamResolverRetriesTruncatedOverTCP(t *testing.T) {
+	// The upstream truncates every UDP answer and sends the full one over
+	// TCP on the same port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	conn, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		t.Skipf("UDP port of %s is taken: %v", ln.Addr(), err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			b := NewResponseBuilder(buf[:n], ResponseOptions{})
+			b.SetFlags(FlagTC)
+			conn.WriteTo(b.Bytes(), addr)
+		}
+	}()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var prefix [2]byte
+			if _, err := io.ReadFull(c, prefix[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+				if _, err := io.ReadFull(c, query); err == nil {
+					response := CreateResponse(query, ResponseOptions{})
+					c.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+				}
+			}
+			c.Close()
+		}
+	}()
+
+	query := buildQuery("truncated.example", TypeA)
+	response, err := NewUpstreamResolver(ln.Addr().String(), time.Second).Resolve(query)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if want := CreateResponse(query, ResponseOptions{}); !bytes.Equal(response, want) {
+		t.Errorf("Resolve() = %x, want the full answer over TCP %x", response, want)
+	}
+}
+
+func TestUpstreamResolverTimeout(t *testing.T) {
+	r := NewUpstreamResolver(fakeUpstream(t, true), 50*time.Millisecond)
+
+	start := time.Now()
+	_, err := r.Resolve(buildQuery("silent.example", TypeA))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Resolve() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Resolve() took %v with a 50ms timeout", elapsed)
+	}
+}
+
+func TestStubResolver(t *testing.T) {
+	query := buildQuery("stub.example", TypeA)
+	response, err := StubResolver{}.Resolve(query)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	records := parseAnswers(t, response)
+	if len(records) != 1 || records[0].Data != "\x7f\x00\x00\x01" {
+		t.Errorf("answers = %+v, want one A record for 127.0.0.1", records)
+	}
+	if _, err := (StubResolver{}).Resolve([]byte{1, 2}); err == nil {
+		t.Error("Resolve() of a short query succeeded")
+	}
+
+	r := StubResolver{Options: ResponseOptions{StubIP: net.ParseIP("192.0.2.53"), StubTTL: 30}}
+	if response, err = r.Resolve(query); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got := response[len(response)-4:]; string(got) != "\xc0\x00\x02\x35" {
+		t.Errorf("RDATA = %v, want 192.0.2.53", net.IP(got))
+	}
+	if records = parseAnswers(t, response); len(records) != 1 || records[0].TTL != 30 {
+		t.Errorf("answers = %+v, want one record with TTL 30", records)
+	}
+
+	// AAAA questions get the IPv6 address, other types no answer
+	r.Options.StubIPv6 = net.ParseIP("2001:db8::53")
+	if response, err = r.Resolve(buildQuery("stub.example", TypeAAAA)); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	records = parseAnswers(t, response)
+	if len(records) != 1 || records[0].Type != TypeAAAA || len(records[0].Data) != 16 || !net.IP(records[0].Data).Equal(r.Options.StubIPv6) {
+		t.Errorf("answers = %+v, want one AAAA record for 2001:db8::53", records)
+	}
+	if response, err = r.Resolve(buildQuery("stub.example", TypeMX)); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if records = parseAnswers(t, response); len(records) != 0 || RCode(response[3]&0x0F) != RCodeNoError {
+		t.Errorf("MX answers = %+v, rcode %d, want NODATA", records, response[3]&0x0F)
+	}
+}
+
+func TestDoHResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "want a POST of application/dns-message", http.StatusUnsupportedMediaType)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		b := NewResponseBuilder(query, ResponseOptions{})
+		b.AddAnswer(b.Question(), TypeNS, ClassIN, 300, AppendName(nil, "ns1.doh.example"))
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b.Bytes())
+	}))
+	defer server.Close()
+
+	r := NewDoHResolver(server.URL, time.Second)
+	response, err := r.Resolve(buildQuery("doh.example", TypeNS))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if n, err := CountAnswers(response, TypeNS); err != nil || n != 1 {
+		t.Errorf("CountAnswers(NS) = %d, %v, want 1", n, err)
+	}
+	if n, _ := CountAnswers(response, TypeA); n != 0 {
+		t.Errorf("CountAnswers(A) = %d, want 0", n)
+	}
+
+	if _, err := r.Resolve([]byte{1, 2}); err == nil {
+		t.Error("Resolve() of a short query succeeded")
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	if _, err := NewDoHResolver(missing.URL, time.Second).Resolve(buildQuery("doh.example", TypeNS)); err == nil {
+		t.Error("Resolve() succeeded on a 404 answer")
+	}
+}
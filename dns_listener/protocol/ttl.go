@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// walkRecords calls fn with the offset of the fixed fields (type, class,
+// TTL, RDLENGTH) of every resource record in msg
+func walkRecords(msg []byte, fn func(rrType DNSType, fixed int)) error {
+	if len(msg) < 12 {
+		return &ValidationError{Field: "length", Reason: "message too short"}
+	}
+
+	offset := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		_, next, err := ReadName(msg, offset)
+		if err != nil {
+			return err
+		}
+		offset = next + 4
+	}
+
+	records := int(binary.BigEndian.Uint16(msg[6:8])) +
+		int(binary.BigEndian.Uint16(msg[8:10])) +
+		int(binary.BigEndian.Uint16(msg[10:12]))
+	for i := 0; i < records; i++ {
+		_, next, err := ReadName(msg, offset)
+		if err != nil {
+			return err
+		}
+		if next+10 > len(msg) {
+			return ErrNameTruncated
+		}
+		rdLen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		if next+10+rdLen > len(msg) {
+			return &ValidationError{Field: "rdata", Reason: "record data truncated"}
+		}
+		fn(DNSType(binary.BigEndian.Uint16(msg[next:next+2])), next)
+		offset = next + 10 + rdLen
+	}
+	return nil
+}
+
+// ClampTTLs lowers every record TTL in msg above maxTTL to maxTTL, in
+// place. It returns the number of clamped records.
+func ClampTTLs(msg []byte, maxTTL uint32) (int, error) {
+	clamped := 0
+	err := walkRecords(msg, func(rrType DNSType, fixed int) {
+		if rrType == TypeOPT {
+			return
+		}
+		ttl := msg[fixed+4 : fixed+8]
+		if binary.BigEndian.Uint32(ttl) > maxTTL {
+			binary.BigEndian.PutUint32(ttl, maxTTL)
+			clamped++
+		}
+	})
+	return clamped, err
+}
+
+// AgeTTLs lowers every record TTL in msg by elapsed seconds, stopping at
+// zero, in place. It is applied to answers replayed from a cache.
+func AgeTTLs(msg []byte, elapsed uint32) error {
+	return walkRecords(msg, func(rrType DNSType, fixed int) {
+		if rrType == TypeOPT {
+			return
+		}
+		ttl := msg[fixed+4 : fixed+8]
+		if v := binary.BigEndian.Uint32(ttl); v > elapsed {
+			binary.BigEndian.PutUint32(ttl, v-elapsed)
+		} else {
+			binary.BigEndian.PutUint32(ttl, 0)
+		}
+	})
+}
+
+// MinAnswerTTL returns the smallest TTL in the answer section of msg. It
+// reports false when msg has no answers or cannot be parsed.
+func MinAnswerTTL(msg []byte) (time.Duration, bool) {
+	if len(msg) < 12 {
+		return 0, false
+	}
+	answers := int(binary.BigEndian.Uint16(msg[6:8]))
+
+	var min uint32
+	seen := 0
+	err := walkRecords(msg, func(rrType DNSType, fixed int) {
+		if seen >= answers {
+			return
+		}
+		ttl := binary.BigEndian.Uint32(msg[fixed+4 : fixed+8])
+		if seen == 0 || ttl < min {
+			min = ttl
+		}
+		seen++
+	})
+	if err != nil || seen == 0 {
+		return 0, false
+	}
+	return time.Duration(min) * time.Second, true
+}
+
+// CountAnswers returns the number of rrType records in the answer section
+// of msg
+func CountAnswers(msg []byte, rrType DNSType) (int, error) {
+	if len(msg) < 12 {
+		return 0, &ValidationError{Field: "length", Reason: "message too short"}
+	}
+	answers := int(binary.BigEndian.Uint16(msg[6:8]))
+
+	count, seen := 0, 0
+	err := walkRecords(msg, func(t DNSType, _ int) {
+		if seen < answers && t == rrType {
+			count++
+		}
+		seen++
+	})
+	return count, err
+}
@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -10,38 +11,88 @@ type DNSType uint16
 
 // DNS Record Types
 const (
-	TypeA     DNSType = 1
-	TypeNS    DNSType = 2
-	TypeCNAME DNSType = 5
-	TypeSOA   DNSType = 6
-	TypePTR   DNSType = 12
-	TypeMX    DNSType = 15
-	TypeTXT   DNSType = 16
-	TypeAAAA  DNSType = 28
+	TypeA          DNSType = 1
+	TypeNS         DNSType = 2
+	TypeCNAME      DNSType = 5
+	TypeSOA        DNSType = 6
+	TypePTR        DNSType = 12
+	TypeHINFO      DNSType = 13
+	TypeMX         DNSType = 15
+	TypeTXT        DNSType = 16
+	TypeAAAA       DNSType = 28
+	TypeSRV        DNSType = 33
+	TypeNAPTR      DNSType = 35
+	TypeDNAME      DNSType = 39
+	TypeOPT        DNSType = 41 // EDNS pseudo record, its TTL field carries flags
+	TypeDS         DNSType = 43
+	TypeSSHFP      DNSType = 44
+	TypeRRSIG      DNSType = 46
+	TypeNSEC       DNSType = 47
+	TypeDNSKEY     DNSType = 48
+	TypeNSEC3      DNSType = 50
+	TypeNSEC3PARAM DNSType = 51
+	TypeTLSA       DNSType = 52
+	TypeSVCB       DNSType = 64
+	TypeHTTPS      DNSType = 65
+	TypeIXFR       DNSType = 251
+	TypeAXFR       DNSType = 252
+	TypeANY        DNSType = 255
+	TypeCAA        DNSType = 257
 )
 
-// String returns the string representation of DNSType
+// typeNames holds the mnemonic of every type in the IANA registry
+var typeNames = map[DNSType]string{
+	1: "A", 2: "NS", 3: "MD", 4: "MF", 5: "CNAME", 6: "SOA", 7: "MB", 8: "MG",
+	9: "MR", 10: "NULL", 11: "WKS", 12: "PTR", 13: "HINFO", 14: "MINFO", 15: "MX",
+	16: "TXT", 17: "RP", 18: "AFSDB", 19: "X25", 20: "ISDN", 21: "RT", 22: "NSAP",
+	23: "NSAP-PTR", 24: "SIG", 25: "KEY", 26: "PX", 27: "GPOS", 28: "AAAA",
+	29: "LOC", 30: "NXT", 31: "EID", 32: "NIMLOC", 33: "SRV", 34: "ATMA",
+	35: "NAPTR", 36: "KX", 37: "CERT", 38: "A6", 39: "DNAME", 40: "SINK",
+	41: "OPT", 42: "APL", 43: "DS", 44: "SSHFP", 45: "IPSECKEY", 46: "RRSIG",
+	47: "NSEC", 48: "DNSKEY", 49: "DHCID", 50: "NSEC3", 51: "NSEC3PARAM",
+	52: "TLSA", 53: "SMIMEA", 55: "HIP", 56: "NINFO", 57: "RKEY", 58: "TALINK",
+	59: "CDS", 60: "CDNSKEY", 61: "OPENPGPKEY", 62: "CSYNC", 63: "ZONEMD",
+	64: "SVCB", 65: "HTTPS", 66: "DSYNC", 99: "SPF", 100: "UINFO", 101: "UID",
+	102: "GID", 103: "UNSPEC", 104: "NID", 105: "L32", 106: "L64", 107: "LP",
+	108: "EUI48", 109: "EUI64", 128: "NXNAME", 249: "TKEY", 250: "TSIG",
+	251: "IXFR", 252: "AXFR", 253: "MAILB", 254: "MAILA", 255: "ANY",
+	256: "URI", 257: "CAA", 258: "AVC", 259: "DOA", 260: "AMTRELAY",
+	261: "RESINFO", 262: "WALLET", 263: "CLA", 264: "IPN", 32768: "TA",
+	32769: "DLV",
+}
+
+// typeValues maps the upper case mnemonics back to their types
+var typeValues = func() map[string]DNSType {
+	values := make(map[string]DNSType, len(typeNames))
+	for t, name := range typeNames {
+		values[name] = t
+	}
+	return values
+}()
+
+// String returns the string representation of DNSType: its IANA mnemonic,
+// or TYPE-<n> for unassigned values
 func (t DNSType) String() string {
-	switch t {
-	case TypeA:
-		return "A"
-	case TypeNS:
-		return "NS"
-	case TypeCNAME:
-		return "CNAME"
-	case TypeSOA:
-		return "SOA"
-	case TypePTR:
-		return "PTR"
-	case TypeMX:
-		return "MX"
-	case TypeTXT:
-		return "TXT"
-	case TypeAAAA:
-		return "AAAA"
-	default:
-		return fmt.Sprintf("TYPE-%d", t)
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE-%d", t)
+}
+
+// ParseDNSType returns the record type named s, e.g. "AAAA", ignoring case.
+// Numeric types are accepted as TYPE<n> (RFC 3597) and as TYPE-<n>, the
+// form String falls back to.
+func ParseDNSType(s string) (DNSType, bool) {
+	s = strings.ToUpper(s)
+	if t, ok := typeValues[s]; ok {
+		return t, true
+	}
+	if n, ok := strings.CutPrefix(s, "TYPE"); ok {
+		if v, err := strconv.ParseUint(strings.TrimPrefix(n, "-"), 10, 16); err == nil {
+			return DNSType(v), true
+		}
 	}
+	return 0, false
 }
 
 // DNSClass represents the class of DNS record
@@ -106,3 +157,36 @@ func (f DNSFlags) String() string {
 	}
 	return strings.Join(flags, "|")
 }
+
+// RCode represents the DNS response code in the low nibble of the flags
+type RCode uint8
+
+// DNS Response Codes
+const (
+	RCodeNoError  RCode = 0
+	RCodeFormErr  RCode = 1
+	RCodeServFail RCode = 2
+	RCodeNXDomain RCode = 3
+	RCodeNotImp   RCode = 4
+	RCodeRefused  RCode = 5
+)
+
+// String returns the string representation of RCode
+func (r RCode) String() string {
+	switch r {
+	case RCodeNoError:
+		return "NOERROR"
+	case RCodeFormErr:
+		return "FORMERR"
+	case RCodeServFail:
+		return "SERVFAIL"
+	case RCodeNXDomain:
+		return "NXDOMAIN"
+	case RCodeNotImp:
+		return "NOTIMP"
+	case RCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("RCODE-%d", r)
+	}
+}
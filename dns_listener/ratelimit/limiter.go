@@ -1,28 +1,70 @@
 package ratelimit
 
 import (
+	"container/list"
+	"net"
+	"net/netip"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// RateLimiter implements a token bucket rate limiter
+// DefaultMaxKeys bounds the number of tracked keys when none is configured
+const DefaultMaxKeys = 65536
+
+// Limiter decides per client whether a request is allowed. RateLimiter
+// (token bucket) and SlidingWindow implement it.
+type Limiter interface {
+	Allow(key string) bool
+	GetStats() Stats
+	// Counts returns how many requests were allowed and limited without
+	// taking a lock
+	Counts() (allowed, limited uint64)
+	// SetRate replaces the rate and burst while keeping per-key state
+	SetRate(rate float64, burst int)
+	// SetAllowlist exempts sources in nets from limiting
+	SetAllowlist(nets []*net.IPNet)
+	// ClientStats returns the counts of the client key is limited as and
+	// TopLimited the n tracked clients limited most often
+	ClientStats(key string) (ClientStat, bool)
+	TopLimited(n int) []ClientStat
+}
+
+// ClientStat counts the requests of one tracked client, keyed by address
+// or network. The counts start over when the client is evicted.
+type ClientStat struct {
+	Key     string `json:"key"`
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+}
+
+// RateLimiter implements a token bucket rate limiter. Buckets are kept in a
+// bounded LRU so that spoofed sources cannot grow memory without limit; an
+// evicted key simply starts over with a full bucket.
 type RateLimiter struct {
-	mu           sync.RWMutex
-	limits       map[string]*bucket
-	rate         float64
-	burst        int
-	cleanupEvery time.Duration
-	stats        struct {
-		allowed    uint64
-		limited    uint64
-		activeKeys int32
+	clients
+	mu      sync.Mutex
+	limits  map[string]*list.Element
+	order   *list.List // front is most recently used
+	rate    float64
+	burst   int
+	maxKeys int
+	stats   struct {
+		allowed   uint64 // atomic, read by Counts without the lock
+		limited   uint64 // atomic, read by Counts without the lock
+		hits      uint64
+		misses    uint64
+		evictions uint64
 	}
 }
 
 type bucket struct {
+	key       string
 	tokens    float64
 	lastCheck time.Time
+	allowed   uint64
+	limited   uint64
 }
 
 // Stats represents rate limiter statistics
@@ -31,35 +73,57 @@ type Stats struct {
 	Limited    uint64
 	ActiveKeys int32
 	BurstUsage float64
+	// Hits and Misses count bucket lookups that found or created a bucket
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
 }
 
-// New creates a new rate limiter
+// New creates a new rate limiter tracking up to DefaultMaxKeys keys
 func New(rate float64, burst int) *RateLimiter {
-	rl := &RateLimiter{
-		limits:       make(map[string]*bucket),
-		rate:         rate,
-		burst:        burst,
-		cleanupEvery: 5 * time.Minute,
+	return NewWithMaxKeys(rate, burst, DefaultMaxKeys)
+}
+
+// NewWithMaxKeys creates a rate limiter that tracks at most maxKeys keys,
+// evicting the least recently used one when full. A non-positive maxKeys
+// uses DefaultMaxKeys.
+func NewWithMaxKeys(rate float64, burst int, maxKeys int) *RateLimiter {
+	return NewWithPrefix(rate, burst, maxKeys, 32, 128)
+}
+
+// NewWithPrefix creates a rate limiter like NewWithMaxKeys whose clients
+// share a bucket per network: IPv4 addresses by their first prefix4 bits
+// and IPv6 addresses by their first prefix6 bits. Prefixes out of range
+// key on the full address.
+func NewWithPrefix(rate float64, burst int, maxKeys int, prefix4, prefix6 int) *RateLimiter {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &RateLimiter{
+		clients: newClients(prefix4, prefix6),
+		limits:  make(map[string]*list.Element),
+		order:   list.New(),
+		rate:    rate,
+		burst:   burst,
+		maxKeys: maxKeys,
 	}
-	go rl.cleanup()
-	return rl
 }
 
-// Allow checks if a request should be allowed
+// Allow checks if a request from key should be allowed. A key holding an
+// address, with or without a port, is limited per client IP or network;
+// any other key is limited as is. Allowlisted addresses always pass.
 func (rl *RateLimiter) Allow(key string) bool {
+	key, exempt := rl.resolve(key)
+	if exempt {
+		atomic.AddUint64(&rl.stats.allowed, 1)
+		return true
+	}
+
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	now := time.Now()
-	b, exists := rl.limits[key]
-	if !exists {
-		b = &bucket{
-			tokens:    float64(rl.burst),
-			lastCheck: now,
-		}
-		rl.limits[key] = b
-		atomic.AddInt32(&rl.stats.activeKeys, 1)
-	}
+	b := rl.bucket(key, now)
 
 	elapsed := now.Sub(b.lastCheck).Seconds()
 	b.tokens += elapsed * rl.rate
@@ -70,44 +134,209 @@ func (rl *RateLimiter) Allow(key string) bool {
 
 	if b.tokens >= 1 {
 		b.tokens--
+		b.allowed++
 		atomic.AddUint64(&rl.stats.allowed, 1)
 		return true
 	}
 
+	b.limited++
 	atomic.AddUint64(&rl.stats.limited, 1)
 	return false
 }
 
-// cleanup removes inactive buckets periodically
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(rl.cleanupEvery)
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, bucket := range rl.limits {
-			if now.Sub(bucket.lastCheck) > rl.cleanupEvery {
-				delete(rl.limits, key)
-				atomic.AddInt32(&rl.stats.activeKeys, -1)
-			}
+// ClientStats returns the counts of the bucket key is limited by, without
+// counting as a use of it
+func (rl *RateLimiter) ClientStats(key string) (ClientStat, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	e, ok := rl.limits[rl.clientKey(key)]
+	if !ok {
+		return ClientStat{}, false
+	}
+	b := e.Value.(*bucket)
+	return ClientStat{Key: b.key, Allowed: b.allowed, Limited: b.limited}, true
+}
+
+// TopLimited returns up to n tracked clients that were limited, most
+// limited first
+func (rl *RateLimiter) TopLimited(n int) []ClientStat {
+	rl.mu.Lock()
+	var stats []ClientStat
+	for _, e := range rl.limits {
+		if b := e.Value.(*bucket); b.limited > 0 {
+			stats = append(stats, ClientStat{Key: b.key, Allowed: b.allowed, Limited: b.limited})
+		}
+	}
+	rl.mu.Unlock()
+	return topLimited(stats, n)
+}
+
+// topLimited sorts stats by limited count, then key, and keeps the first n
+func topLimited(stats []ClientStat, n int) []ClientStat {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Limited != stats[j].Limited {
+			return stats[i].Limited > stats[j].Limited
 		}
-		rl.mu.Unlock()
+		return stats[i].Key < stats[j].Key
+	})
+	if n >= 0 && len(stats) > n {
+		stats = stats[:n]
 	}
+	return stats
+}
+
+// Counts returns how many requests were allowed and limited. Unlike
+// GetStats it takes no lock.
+func (rl *RateLimiter) Counts() (allowed, limited uint64) {
+	return atomic.LoadUint64(&rl.stats.allowed), atomic.LoadUint64(&rl.stats.limited)
+}
+
+// SetRate replaces the rate and burst of a live limiter, keeping per-key
+// state. Buckets holding more tokens than the new burst are capped.
+func (rl *RateLimiter) SetRate(rate float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.rate = rate
+	rl.burst = burst
+	for _, e := range rl.limits {
+		if b := e.Value.(*bucket); b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+}
+
+// clients maps request keys to the client or network they are limited by
+// and exempts allowlisted sources. Both limiters embed it.
+type clients struct {
+	prefix4 int                          // IPv4 addresses sharing a limit, 32 keys on the full address
+	prefix6 int                          // IPv6 addresses sharing a limit, 128 keys on the full address
+	allow   atomic.Pointer[[]*net.IPNet] // sources that are never limited
+}
+
+// newClients keys IPv4 addresses by their first prefix4 bits and IPv6
+// addresses by their first prefix6 bits; prefixes out of range key on the
+// full address
+func newClients(prefix4, prefix6 int) clients {
+	if prefix4 < 0 || prefix4 > 32 {
+		prefix4 = 32
+	}
+	if prefix6 < 0 || prefix6 > 128 {
+		prefix6 = 128
+	}
+	return clients{prefix4: prefix4, prefix6: prefix6}
+}
+
+// SetAllowlist exempts sources in nets from limiting, replacing any
+// previous allowlist. It is safe to call while Allow is in use.
+func (c *clients) SetAllowlist(nets []*net.IPNet) {
+	c.allow.Store(&nets)
+}
+
+// resolve maps key to the key it is limited by, reporting whether it is an
+// allowlisted address that is not limited at all
+func (c *clients) resolve(key string) (string, bool) {
+	if addr, ok := clientAddr(key); ok {
+		if c.allowlisted(addr) {
+			return key, true
+		}
+		return c.networkKey(addr), false
+	}
+	return key, false
+}
+
+// allowlisted reports whether addr is in the allowlist
+func (c *clients) allowlisted(addr netip.Addr) bool {
+	nets := c.allow.Load()
+	if nets == nil {
+		return false
+	}
+	ip := net.IP(addr.AsSlice())
+	for _, n := range *nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr parses key as an address, with or without a port
+func clientAddr(key string) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(key); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if addr, err := netip.ParseAddr(key); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// clientKey maps key to the bucket it is limited by
+func (c *clients) clientKey(key string) string {
+	if addr, ok := clientAddr(key); ok {
+		return c.networkKey(addr)
+	}
+	return key
+}
+
+// networkKey maps an address to the network its bucket is kept for, so
+// that new source ports, and with a prefix neighbouring addresses, cannot
+// start over with a full bucket
+func (c *clients) networkKey(addr netip.Addr) string {
+	bits := c.prefix6
+	if addr.Is4() {
+		bits = c.prefix4
+	}
+	if bits == addr.BitLen() {
+		return addr.WithZone("").String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// bucket returns the bucket for key, creating it and evicting the least
+// recently used bucket when needed. Callers hold rl.mu.
+func (rl *RateLimiter) bucket(key string, now time.Time) *bucket {
+	if e, ok := rl.limits[key]; ok {
+		rl.stats.hits++
+		rl.order.MoveToFront(e)
+		return e.Value.(*bucket)
+	}
+
+	rl.stats.misses++
+	if rl.order.Len() >= rl.maxKeys {
+		oldest := rl.order.Back()
+		rl.order.Remove(oldest)
+		delete(rl.limits, oldest.Value.(*bucket).key)
+		rl.stats.evictions++
+	}
+
+	b := &bucket{key: key, tokens: float64(rl.burst), lastCheck: now}
+	rl.limits[key] = rl.order.PushFront(b)
+	return b
 }
 
 // GetStats returns current rate limiter statistics
 func (rl *RateLimiter) GetStats() Stats {
-	rl.mu.RLock()
-	defer rl.mu.RUnlock()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 
 	stats := Stats{
 		Allowed:    atomic.LoadUint64(&rl.stats.allowed),
 		Limited:    atomic.LoadUint64(&rl.stats.limited),
-		ActiveKeys: atomic.LoadInt32(&rl.stats.activeKeys),
+		ActiveKeys: int32(len(rl.limits)),
+		Hits:       rl.stats.hits,
+		Misses:     rl.stats.misses,
+		Evictions:  rl.stats.evictions,
 	}
 
 	var totalTokens float64
-	for _, b := range rl.limits {
-		totalTokens += b.tokens
+	for _, e := range rl.limits {
+		totalTokens += e.Value.(*bucket).tokens
 	}
 	if len(rl.limits) > 0 {
 		stats.BurstUsage = 1 - (totalTokens / (float64(len(rl.limits)) * float64(rl.burst)))
@@ -115,3 +344,8 @@ func (rl *RateLimiter) GetStats() Stats {
 
 	return stats
 }
+
+var (
+	_ Limiter = (*RateLimiter)(nil)
+	_ Limiter = (*SlidingWindow)(nil)
+)
@@ -0,0 +1,246 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	rl := NewWithMaxKeys(1, 2, 2)
+
+	// Drain a's bucket so a fresh bucket would be distinguishable
+	rl.Allow("a")
+	rl.Allow("a")
+	if rl.Allow("a") {
+		t.Fatal("Allow(a) = true after burst, want limited")
+	}
+
+	rl.Allow("b")
+	rl.Allow("a") // a becomes most recently used
+	rl.Allow("c") // evicts b, the least recently used
+
+	if _, ok := rl.limits["b"]; ok {
+		t.Error("b still tracked, want it evicted as least recently used")
+	}
+	if _, ok := rl.limits["a"]; !ok {
+		t.Error("a evicted, want it kept as recently used")
+	}
+	// a keeps its drained bucket
+	if rl.Allow("a") {
+		t.Error("Allow(a) = true, want limited bucket retained")
+	}
+}
+
+func TestStats(t *testing.T) {
+	rl := NewWithMaxKeys(1, 1, 3)
+
+	for i := 0; i < 5; i++ {
+		rl.Allow(fmt.Sprintf("client-%d", i))
+	}
+	rl.Allow("client-4")
+
+	stats := rl.GetStats()
+	if stats.ActiveKeys != 3 {
+		t.Errorf("ActiveKeys = %d, want 3", stats.ActiveKeys)
+	}
+	if stats.Evictions != 2 {
+		t.Errorf("Evictions = %d, want 2", stats.Evictions)
+	}
+	if stats.Hits != 1 || stats.Misses != 5 {
+		t.Errorf("Hits, Misses = %d, %d, want 1, 5", stats.Hits, stats.Misses)
+	}
+	if stats.Allowed != 5 || stats.Limited != 1 {
+		t.Errorf("Allowed, Limited = %d, %d, want 5, 1", stats.Allowed, stats.Limited)
+	}
+	if allowed, limited := rl.Counts(); allowed != 5 || limited != 1 {
+		t.Errorf("Counts() = %d, %d, want 5, 1", allowed, limited)
+	}
+}
+
+func TestDefaultMaxKeys(t *testing.T) {
+	if rl := NewWithMaxKeys(1, 1, 0); rl.maxKeys != DefaultMaxKeys {
+		t.Errorf("maxKeys = %d, want %d", rl.maxKeys, DefaultMaxKeys)
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	rl := NewWithMaxKeys(0, 10, 8)
+	rl.Allow("a")
+
+	rl.SetRate(0, 2)
+	if _, ok := rl.limits["a"]; !ok {
+		t.Fatal("SetRate() dropped per-key state")
+	}
+	if tokens := rl.limits["a"].Value.(*bucket).tokens; tokens != 2 {
+		t.Errorf("tokens = %v, want capped to new burst 2", tokens)
+	}
+	rl.Allow("a")
+	rl.Allow("a")
+	if rl.Allow("a") {
+		t.Error("Allow() = true beyond the new burst")
+	}
+}
+
+// Run with -race to verify SetRate and Allow synchronize
+func TestSetRateConcurrentAllow(t *testing.T) {
+	rl := New(1000, 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				rl.Allow(fmt.Sprintf("client-%d", j%16))
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			rl.SetRate(float64(100+j), 10+j%5)
+			rl.GetStats()
+		}
+	}()
+	wg.Wait()
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix4 int
+		prefix6 int
+		key     string
+		want    string
+	}{
+		{"ipv4 port dropped", 32, 128, "192.0.2.10:5353", "192.0.2.10"},
+		{"ipv6 port dropped", 32, 128, "[2001:db8::1]:5353", "2001:db8::1"},
+		{"bare address", 32, 128, "192.0.2.10", "192.0.2.10"},
+		{"mapped ipv4", 24, 64, "[::ffff:192.0.2.10]:53", "192.0.2.0/24"},
+		{"ipv4 network", 24, 64, "192.0.2.10:53", "192.0.2.0/24"},
+		{"ipv6 network", 24, 64, "[2001:db8:0:1:2::3]:53", "2001:db8:0:1::/64"},
+		{"not an address", 24, 64, "client-a", "client-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewWithPrefix(1, 1, 0, tt.prefix4, tt.prefix6)
+			if got := rl.clientKey(tt.key); got != tt.want {
+				t.Errorf("clientKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcePortsShareBucket(t *testing.T) {
+	rl := New(0, 1)
+	if !rl.Allow("192.0.2.10:1000") {
+		t.Fatal("first query limited")
+	}
+	if rl.Allow("192.0.2.10:1001") {
+		t.Error("Allow() from a new source port = true, want the client's drained bucket")
+	}
+}
+
+func TestPrefixSharesBucket(t *testing.T) {
+	rl := NewWithPrefix(0, 1, 0, 24, 64)
+	if !rl.Allow("192.0.2.10:53") {
+		t.Fatal("first query limited")
+	}
+	if rl.Allow("192.0.2.99:53") {
+		t.Error("Allow() from the same /24 = true, want the network's drained bucket")
+	}
+	if !rl.Allow("192.0.3.10:53") {
+		t.Error("Allow() from another /24 = false, want a bucket of its own")
+	}
+
+	// Without a prefix each address has its own bucket
+	rl = New(0, 1)
+	rl.Allow("192.0.2.10:53")
+	if !rl.Allow("192.0.2.99:53") {
+		t.Error("Allow() from a neighbouring address = false without a prefix")
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "2001:db8::/32"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nets = append(nets, n)
+	}
+
+	rl := New(0, 1)
+	rl.SetAllowlist(nets)
+
+	for _, key := range []string{"10.1.2.3:53", "[2001:db8::53]:53", "[::ffff:10.1.2.3]:53"} {
+		for i := 0; i < 3; i++ {
+			if !rl.Allow(key) {
+				t.Errorf("Allow(%q) #%d = false, want allowlisted", key, i+1)
+			}
+		}
+	}
+	if stats := rl.GetStats(); stats.ActiveKeys != 0 {
+		t.Errorf("ActiveKeys = %d, want no buckets for allowlisted sources", stats.ActiveKeys)
+	}
+
+	// Sources outside the allowlist are still limited
+	for _, key := range []string{"192.0.2.1:53", "[2001:db9::1]:53"} {
+		rl.Allow(key)
+		if rl.Allow(key) {
+			t.Errorf("Allow(%q) = true after burst, want limited", key)
+		}
+	}
+
+	rl.SetAllowlist(nil)
+	rl.Allow("10.1.2.3:53")
+	if rl.Allow("10.1.2.3:53") {
+		t.Error("Allow() = true after clearing the allowlist, want limited")
+	}
+}
+
+func TestTopLimited(t *testing.T) {
+	limiters := map[string]Limiter{
+		"token":   New(0, 5),
+		"sliding": NewSlidingWindow(5, time.Second, 0, 32, 128),
+	}
+	for name, l := range limiters {
+		t.Run(name, func(t *testing.T) {
+			// One client hammers the limiter, two others stay close to it
+			for i := 0; i < 100; i++ {
+				l.Allow(fmt.Sprintf("192.0.2.1:%d", 1000+i))
+			}
+			for i := 0; i < 7; i++ {
+				l.Allow("192.0.2.2:53")
+			}
+			for i := 0; i < 3; i++ {
+				l.Allow("192.0.2.3:53")
+			}
+
+			top := l.TopLimited(10)
+			want := []ClientStat{
+				{Key: "192.0.2.1", Allowed: 5, Limited: 95},
+				{Key: "192.0.2.2", Allowed: 5, Limited: 2},
+			}
+			if !reflect.DeepEqual(top, want) {
+				t.Errorf("TopLimited(10) = %+v, want %+v", top, want)
+			}
+			if top := l.TopLimited(1); len(top) != 1 || top[0].Key != "192.0.2.1" {
+				t.Errorf("TopLimited(1) = %+v, want only 192.0.2.1", top)
+			}
+
+			if stat, ok := l.ClientStats("192.0.2.3:4000"); !ok || stat.Allowed != 3 || stat.Limited != 0 {
+				t.Errorf("ClientStats(192.0.2.3) = %+v, %v, want 3 allowed", stat, ok)
+			}
+			if _, ok := l.ClientStats("198.51.100.1"); ok {
+				t.Error("ClientStats() of an unseen client ok = true")
+			}
+		})
+	}
+}
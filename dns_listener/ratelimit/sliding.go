@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWindow is the window of a SlidingWindow created without one
+const DefaultWindow = time.Second
+
+// SlidingWindow limits each client to rate requests per second counted
+// over the trailing window. Unlike the token bucket it has no burst: at no
+// point do more than rate*window requests of a client pass within one
+// window. The times of the allowed requests are kept per client, so memory
+// grows with the rate of the busiest clients; clients are kept in a
+// bounded LRU like the buckets of RateLimiter.
+type SlidingWindow struct {
+	clients
+	mu      sync.Mutex
+	windows map[string]*list.Element
+	order   *list.List // front is most recently used
+	window  time.Duration
+	limit   int // requests allowed per window
+	maxKeys int
+	stats   struct {
+		allowed   uint64 // atomic, read by Counts without the lock
+		limited   uint64 // atomic, read by Counts without the lock
+		hits      uint64
+		misses    uint64
+		evictions uint64
+	}
+}
+
+// requestLog holds the times of a client's allowed requests, in
+// nanoseconds. Once it holds limit entries it is a ring whose oldest entry
+// is at head.
+type requestLog struct {
+	key     string
+	times   []int64
+	head    int
+	allowed uint64
+	limited uint64
+}
+
+// NewSlidingWindow creates a sliding window limiter allowing rate requests
+// per second over window, tracking at most maxKeys clients keyed like
+// NewWithPrefix. A non-positive window uses DefaultWindow and a
+// non-positive maxKeys DefaultMaxKeys.
+func NewSlidingWindow(rate float64, window time.Duration, maxKeys int, prefix4, prefix6 int) *SlidingWindow {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &SlidingWindow{
+		clients: newClients(prefix4, prefix6),
+		windows: make(map[string]*list.Element),
+		order:   list.New(),
+		window:  window,
+		limit:   windowLimit(rate, window),
+		maxKeys: maxKeys,
+	}
+}
+
+// windowLimit is the number of requests rate allows within window, at
+// least one
+func windowLimit(rate float64, window time.Duration) int {
+	// The epsilon keeps e.g. 0.1/s over 10s from rounding down to zero
+	n := int(math.Floor(rate*window.Seconds() + 1e-9))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Allow checks if a request from key should be allowed, mapping and
+// exempting keys like RateLimiter.Allow
+func (sw *SlidingWindow) Allow(key string) bool {
+	key, exempt := sw.resolve(key)
+	if exempt {
+		atomic.AddUint64(&sw.stats.allowed, 1)
+		return true
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	l := sw.log(key)
+	switch {
+	case len(l.times) < sw.limit:
+		l.times = append(l.times, now)
+	case l.times[l.head] <= now-int64(sw.window):
+		// The oldest request left the window, its slot is reused
+		l.times[l.head] = now
+		l.head = (l.head + 1) % len(l.times)
+	default:
+		l.limited++
+		atomic.AddUint64(&sw.stats.limited, 1)
+		return false
+	}
+
+	l.allowed++
+	atomic.AddUint64(&sw.stats.allowed, 1)
+	return true
+}
+
+// ClientStats returns the counts of the client key is limited as, without
+// counting as a use of it
+func (sw *SlidingWindow) ClientStats(key string) (ClientStat, bool) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	e, ok := sw.windows[sw.clientKey(key)]
+	if !ok {
+		return ClientStat{}, false
+	}
+	l := e.Value.(*requestLog)
+	return ClientStat{Key: l.key, Allowed: l.allowed, Limited: l.limited}, true
+}
+
+// TopLimited returns up to n tracked clients that were limited, most
+// limited first
+func (sw *SlidingWindow) TopLimited(n int) []ClientStat {
+	sw.mu.Lock()
+	var stats []ClientStat
+	for _, e := range sw.windows {
+		if l := e.Value.(*requestLog); l.limited > 0 {
+			stats = append(stats, ClientStat{Key: l.key, Allowed: l.allowed, Limited: l.limited})
+		}
+	}
+	sw.mu.Unlock()
+	return topLimited(stats, n)
+}
+
+// Counts returns how many requests were allowed and limited. Unlike
+// GetStats it takes no lock.
+func (sw *SlidingWindow) Counts() (allowed, limited uint64) {
+	return atomic.LoadUint64(&sw.stats.allowed), atomic.LoadUint64(&sw.stats.limited)
+}
+
+// SetRate replaces the rate of a live limiter, keeping the request times
+// of each client. burst does not apply, the window itself bounds bursts.
+func (sw *SlidingWindow) SetRate(rate float64, burst int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.limit = windowLimit(rate, sw.window)
+	for _, e := range sw.windows {
+		e.Value.(*requestLog).resize(sw.limit)
+	}
+}
+
+// resize puts the times in order, oldest first, keeping the latest limit
+// of them so that appending continues the ring
+func (l *requestLog) resize(limit int) {
+	ordered := append(append([]int64(nil), l.times[l.head:]...), l.times[:l.head]...)
+	if len(ordered) > limit {
+		ordered = ordered[len(ordered)-limit:]
+	}
+	l.times, l.head = ordered, 0
+}
+
+// log returns the request log for key, creating it and evicting the least
+// recently used one when needed. Callers hold sw.mu.
+func (sw *SlidingWindow) log(key string) *requestLog {
+	if e, ok := sw.windows[key]; ok {
+		sw.stats.hits++
+		sw.order.MoveToFront(e)
+		return e.Value.(*requestLog)
+	}
+
+	sw.stats.misses++
+	if sw.order.Len() >= sw.maxKeys {
+		oldest := sw.order.Back()
+		sw.order.Remove(oldest)
+		delete(sw.windows, oldest.Value.(*requestLog).key)
+		sw.stats.evictions++
+	}
+
+	l := &requestLog{key: key}
+	sw.windows[key] = sw.order.PushFront(l)
+	return l
+}
+
+// GetStats returns current rate limiter statistics. BurstUsage is the
+// share of the window limit the tracked clients use on average.
+func (sw *SlidingWindow) GetStats() Stats {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	stats := Stats{
+		Allowed:    atomic.LoadUint64(&sw.stats.allowed),
+		Limited:    atomic.LoadUint64(&sw.stats.limited),
+		ActiveKeys: int32(len(sw.windows)),
+		Hits:       sw.stats.hits,
+		Misses:     sw.stats.misses,
+		Evictions:  sw.stats.evictions,
+	}
+
+	since := time.Now().UnixNano() - int64(sw.window)
+	var used int
+	for _, e := range sw.windows {
+		for _, t := range e.Value.(*requestLog).times {
+			if t > since {
+				used++
+			}
+		}
+	}
+	if len(sw.windows) > 0 {
+		stats.BurstUsage = float64(used) / (float64(len(sw.windows)) * float64(sw.limit))
+	}
+
+	return stats
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// allowN calls Allow n times and returns how many were allowed
+func allowN(l Limiter, key string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if l.Allow(key) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestSlidingWindowVersusTokenBucket(t *testing.T) {
+	// Both allow 10 requests per second. The token bucket refills while
+	// the client waits, so a drained client gets more requests through
+	// within the same second; the sliding window does not.
+	limiters := []struct {
+		name      string
+		limiter   Limiter
+		wantAfter func(int) bool
+	}{
+		{"token", New(10, 10), func(n int) bool { return n >= 1 }},
+		{"sliding", NewSlidingWindow(10, time.Second, 0, 32, 128), func(n int) bool { return n == 0 }},
+	}
+	for _, l := range limiters {
+		t.Run(l.name, func(t *testing.T) {
+			if got := allowN(l.limiter, "192.0.2.1:53", 20); got != 10 {
+				t.Fatalf("initial burst allowed %d of 20, want 10", got)
+			}
+			time.Sleep(200 * time.Millisecond)
+			if got := allowN(l.limiter, "192.0.2.1:53", 10); !l.wantAfter(got) {
+				t.Errorf("200ms after the burst allowed %d of 10", got)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowExpiry(t *testing.T) {
+	sw := NewSlidingWindow(100, 50*time.Millisecond, 0, 32, 128)
+	if got := allowN(sw, "a", 6); got != 5 {
+		t.Fatalf("allowed %d of 6, want 5", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := allowN(sw, "a", 6); got != 5 {
+		t.Errorf("after the window allowed %d of 6, want 5", got)
+	}
+
+	stats := sw.GetStats()
+	if stats.Allowed != 10 || stats.Limited != 2 || stats.ActiveKeys != 1 || stats.BurstUsage != 1 {
+		t.Errorf("GetStats() = %+v, want 10 allowed, 2 limited and a full window", stats)
+	}
+}
+
+func TestSlidingWindowSetRate(t *testing.T) {
+	sw := NewSlidingWindow(10, time.Second, 0, 32, 128)
+	allowN(sw, "a", 6)
+
+	// Lowering the limit keeps the requests already in the window
+	sw.SetRate(4, 0)
+	if sw.Allow("a") {
+		t.Error("Allow() = true with 4 requests already in the window")
+	}
+
+	sw.SetRate(8, 0)
+	if got := allowN(sw, "a", 8); got != 4 {
+		t.Errorf("after raising the limit allowed %d of 8, want 4", got)
+	}
+}
+
+func TestSlidingWindowKeys(t *testing.T) {
+	sw := NewSlidingWindow(1, time.Second, 2, 24, 64)
+	sw.Allow("192.0.2.10:53")
+	if sw.Allow("192.0.2.99:1000") {
+		t.Error("Allow() from the same /24 = true, want the network's full window")
+	}
+
+	sw.Allow("198.51.100.1:53")
+	sw.Allow("203.0.113.1:53") // evicts 192.0.2.0/24
+	if !sw.Allow("192.0.2.10:53") {
+		t.Error("Allow() after eviction = false, want a new window")
+	}
+	if stats := sw.GetStats(); stats.ActiveKeys != 2 || stats.Evictions != 2 {
+		t.Errorf("ActiveKeys, Evictions = %d, %d, want 2, 2", stats.ActiveKeys, stats.Evictions)
+	}
+}
+
+func TestWindowLimit(t *testing.T) {
+	tests := []struct {
+		rate   float64
+		window time.Duration
+		want   int
+	}{
+		{100, time.Second, 100},
+		{0.1, 10 * time.Second, 1},
+		{1.5, time.Second, 1},
+		{0, time.Second, 1},
+		{100, 50 * time.Millisecond, 5},
+	}
+	for _, tt := range tests {
+		if got := windowLimit(tt.rate, tt.window); got != tt.want {
+			t.Errorf("windowLimit(%v, %v) = %d, want %d", tt.rate, tt.window, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package dns_listener
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/cache"
+	"github.com/exiguus/ns-checker/dns_listener/config"
+)
+
+// liveSettings are the settings a configuration reload changes while the
+// listener runs
+type liveSettings struct {
+	cacheTTL    time.Duration
+	cacheMinTTL time.Duration
+	cacheMaxTTL time.Duration
+}
+
+// setLive publishes the reloadable settings of cfg
+func (d *DNSListener) setLive(cfg *config.Config) {
+	d.live.Store(&liveSettings{
+		cacheTTL:    cfg.CacheTTL,
+		cacheMinTTL: cfg.CacheMinTTL,
+		cacheMaxTTL: cfg.CacheMaxTTL,
+	})
+}
+
+// reloadConfig loads the configuration again through config.Load and
+// applies what can change while running: the rate limit and burst, the
+// cache TTLs and debug logging. Other changes are logged as needing a
+// restart. An invalid configuration is rejected as a whole.
+func (d *DNSListener) reloadConfig() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := config.ValidateReload(cfg); err != nil {
+		if ve, ok := err.(*config.ValidationError); ok {
+			msgs := make([]string, len(ve.Errors))
+			for i, e := range ve.Errors {
+				msgs[i] = e.Error()
+			}
+			return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
+		}
+		return err
+	}
+
+	for _, name := range restartRequired(d.config, cfg) {
+		d.logger.Write(fmt.Sprintf("Config reload: %s changed, restart to apply\n", name))
+	}
+
+	d.rateLimiter.SetRate(cfg.RateLimit, cfg.RateBurst)
+	d.setLive(cfg)
+	if setter, ok := d.cache.(cache.TTLSetter); ok {
+		setter.SetDefaultTTL(cfg.CacheTTL)
+	}
+	if logger, ok := d.logger.(*MultiLogger); ok {
+		logger.SetDebug(cfg.Debug)
+	}
+	d.logger.Write(fmt.Sprintf("Config reloaded: rate_limit=%.0f rate_burst=%d cache_ttl=%v debug=%v\n",
+		cfg.RateLimit, cfg.RateBurst, cfg.CacheTTL, cfg.Debug))
+	return nil
+}
+
+// restartRequired names the Config fields that differ between the running
+// configuration and next but only take effect on a restart, which are all
+// those reloadConfig does not apply
+func restartRequired(running, next *config.Config) []string {
+	applied := *running
+	applied.RateLimit, applied.RateBurst = next.RateLimit, next.RateBurst
+	applied.CacheTTL, applied.CacheMinTTL, applied.CacheMaxTTL = next.CacheTTL, next.CacheMinTTL, next.CacheMaxTTL
+	applied.Debug = next.Debug
+
+	old, updated := reflect.ValueOf(applied), reflect.ValueOf(*next)
+	var changed []string
+	for i := 0; i < old.NumField(); i++ {
+		if fmt.Sprint(old.Field(i).Interface()) != fmt.Sprint(updated.Field(i).Interface()) {
+			changed = append(changed, old.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
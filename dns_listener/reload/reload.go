@@ -0,0 +1,143 @@
+// Package reload serializes reloads of swappable data such as zones and
+// blocklists.
+package reload
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Func loads fresh data and publishes it, typically through Value.Store.
+// Reloader never runs two Funcs concurrently.
+type Func func() error
+
+// Value holds data that is replaced wholesale on reload. Readers always see
+// either the previous or the new version, never a partially loaded one.
+type Value[T any] struct {
+	ptr atomic.Pointer[T]
+}
+
+// Load returns the current version, or nil before the first Store
+func (v *Value[T]) Load() *T {
+	return v.ptr.Load()
+}
+
+// Store publishes a fully built version
+func (v *Value[T]) Store(data *T) {
+	v.ptr.Store(data)
+}
+
+type entry struct {
+	name string
+	fn   Func
+}
+
+// Reloader runs registered reload funcs one pass at a time. Triggers that
+// arrive while a pass is running are coalesced into a single follow-up pass.
+type Reloader struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	entries []entry
+	running bool
+	pending bool
+	passes  uint64
+	lastErr error
+	// OnError is called for every failed reload func; it may be nil
+	OnError func(name string, err error)
+}
+
+// New creates an idle Reloader
+func New() *Reloader {
+	r := &Reloader{}
+	r.idle = sync.NewCond(&r.mu)
+	return r
+}
+
+// Register adds a reload func. Funcs run in registration order.
+func (r *Reloader) Register(name string, fn Func) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry{name: name, fn: fn})
+}
+
+// Trigger requests a reload without waiting for it. If a pass is already
+// running, another pass is scheduled to start once it finishes.
+func (r *Reloader) Trigger() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		r.pending = true
+		return
+	}
+	r.running = true
+	go r.loop()
+}
+
+// Reload triggers a reload and waits until no pass is running. It returns
+// the error of the last pass.
+func (r *Reloader) Reload() error {
+	r.Trigger()
+	return r.Wait()
+}
+
+// Wait blocks until no pass is running or pending and returns the error
+// of the last pass
+func (r *Reloader) Wait() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.running {
+		r.idle.Wait()
+	}
+	return r.lastErr
+}
+
+// Passes returns the number of completed reload passes
+func (r *Reloader) Passes() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.passes
+}
+
+func (r *Reloader) loop() {
+	for {
+		err := r.runPass()
+
+		r.mu.Lock()
+		r.passes++
+		r.lastErr = err
+		if r.pending {
+			r.pending = false
+			r.mu.Unlock()
+			continue
+		}
+		r.running = false
+		r.idle.Broadcast()
+		r.mu.Unlock()
+		return
+	}
+}
+
+// runPass runs every registered func; a failing func keeps its previous
+// data and does not stop the others
+func (r *Reloader) runPass() error {
+	r.mu.Lock()
+	entries := make([]entry, len(r.entries))
+	copy(entries, r.entries)
+	onError := r.OnError
+	r.mu.Unlock()
+
+	var firstErr error
+	for _, e := range entries {
+		if err := e.fn(); err != nil {
+			if onError != nil {
+				onError(e.name, err)
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("reload %s: %w", e.name, err)
+			}
+		}
+	}
+	return firstErr
+}
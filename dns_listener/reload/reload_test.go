@@ -0,0 +1,129 @@
+package reload
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type table struct {
+	version int
+	entries map[string]int
+}
+
+func TestConcurrentReloads(t *testing.T) {
+	var (
+		data    Value[table]
+		active  int32
+		overlap int32
+		version int
+	)
+
+	r := New()
+	r.Register("table", func() error {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.StoreInt32(&overlap, 1)
+		}
+		defer atomic.AddInt32(&active, -1)
+
+		version++
+		next := &table{version: version, entries: make(map[string]int)}
+		for _, key := range []string{"a", "b", "c", "d"} {
+			next.entries[key] = version
+			time.Sleep(100 * time.Microsecond)
+		}
+		data.Store(next)
+		return nil
+	})
+
+	// Readers must only ever see complete tables
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if tbl := data.Load(); tbl != nil {
+					if len(tbl.entries) != 4 {
+						t.Errorf("partial table: %v", tbl.entries)
+						return
+					}
+					for key, v := range tbl.entries {
+						if v != tbl.version {
+							t.Errorf("entry %s = %d, want %d", key, v, tbl.version)
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	const triggers = 50
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < triggers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			r.Trigger()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	close(stop)
+	readers.Wait()
+
+	if atomic.LoadInt32(&overlap) != 0 {
+		t.Error("reload funcs ran concurrently")
+	}
+
+	passes := r.Passes()
+	if passes == 0 || passes >= triggers {
+		t.Errorf("Passes() = %d, want between 1 and %d", passes, triggers-1)
+	}
+	if got := data.Load().version; uint64(got) != passes {
+		t.Errorf("final version = %d, want %d", got, passes)
+	}
+
+	// A trigger after the reloader went idle starts a new pass
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := r.Passes(); got != passes+1 {
+		t.Errorf("Passes() = %d after Reload, want %d", got, passes+1)
+	}
+}
+
+func TestReloadErrorKeepsPreviousData(t *testing.T) {
+	var data Value[table]
+	data.Store(&table{version: 1})
+
+	var reported string
+	r := New()
+	r.OnError = func(name string, err error) { reported = name }
+	r.Register("broken", func() error { return errors.New("fetch failed") })
+
+	if err := r.Reload(); err == nil {
+		t.Error("Reload() error = nil, want error")
+	}
+	if reported != "broken" {
+		t.Errorf("OnError name = %q, want %q", reported, "broken")
+	}
+	if got := data.Load().version; got != 1 {
+		t.Errorf("version = %d, want previous version 1", got)
+	}
+}
@@ -0,0 +1,70 @@
+package dns_listener
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestReloadConfig(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	query := buildTestQuery("reload.example.com", protocol.TypeA)
+
+	allowed := func(n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if _, err := d.HandleRequest(query, addr, "udp"); err == nil {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Tighten the limit to a single query
+	t.Setenv("RATE_LIMIT", "1")
+	t.Setenv("RATE_BURST", "1")
+	t.Setenv("CACHE_TTL", "2m")
+	if err := d.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	if got := allowed(3); got != 1 {
+		t.Errorf("%d of 3 queries allowed after reload, want 1", got)
+	}
+	if ttl := d.cacheTTL(d.errorResponse(query, protocol.RCodeNXDomain)); ttl != 2*time.Minute {
+		t.Errorf("cacheTTL() = %v, want the reloaded 2m", ttl)
+	}
+
+	// An invalid configuration keeps the current settings
+	t.Setenv("RATE_BURST", "100")
+	if err := d.reloadConfig(); err == nil {
+		t.Error("reloadConfig() with burst above the rate succeeded")
+	}
+	if got := allowed(1); got != 0 {
+		t.Errorf("%d queries allowed after a rejected reload, want 0", got)
+	}
+
+	// Loosening it takes effect at once; the emptied bucket refills at the
+	// new rate
+	t.Setenv("RATE_LIMIT", "1000")
+	if err := d.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got := allowed(3); got != 3 {
+		t.Errorf("%d of 3 queries allowed after raising the limit, want 3", got)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	running := &config.Config{Port: "25353", WorkerCount: 4, RateLimit: 100, CacheTTL: time.Minute}
+	next := &config.Config{Port: "5353", WorkerCount: 4, RateLimit: 1000, CacheTTL: time.Hour, QnameRedaction: "hash"}
+	want := []string{"Port", "QnameRedaction"}
+	if got := restartRequired(running, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("restartRequired() = %v, want %v", got, want)
+	}
+}
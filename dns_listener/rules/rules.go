@@ -0,0 +1,104 @@
+// Package rules maps query names to fixed addresses for sinkholing and
+// split-horizon setups.
+package rules
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// Set is an immutable, ordered list of rewrite rules. A pattern containing
+// * is a glob matched against the whole name (* does not cross dots);
+// any other pattern matches that name and every name below it.
+type Set struct {
+	rules []rule
+}
+
+type rule struct {
+	pattern string
+	glob    bool
+	addr    net.IP
+}
+
+// Parse reads comma separated pattern=address rules, e.g.
+// "ads.example=0.0.0.0,host-*.lan=10.0.0.1". An empty spec yields an
+// empty set.
+func Parse(spec string) (*Set, error) {
+	s := &Set{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, address, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: expected pattern=address", entry)
+		}
+
+		r := rule{pattern: normalize(strings.TrimSpace(pattern))}
+		if r.pattern == "" {
+			return nil, fmt.Errorf("rule %q: empty pattern", entry)
+		}
+		if r.glob = strings.Contains(r.pattern, "*"); r.glob {
+			if _, err := path.Match(r.pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %q: %w", entry, err)
+			}
+		}
+		if r.addr = net.ParseIP(strings.TrimSpace(address)); r.addr == nil {
+			return nil, fmt.Errorf("rule %q: invalid address %q", entry, address)
+		}
+		if ip4 := r.addr.To4(); ip4 != nil {
+			r.addr = ip4
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// Lookup returns the addresses of the first pattern matching name. Rules
+// sharing that pattern all contribute, so a name can map to both an IPv4
+// and an IPv6 address.
+func (s *Set) Lookup(name string) []net.IP {
+	if s == nil {
+		return nil
+	}
+
+	name = normalize(name)
+	var matched string
+	var addrs []net.IP
+	for _, r := range s.rules {
+		if addrs != nil {
+			if r.pattern == matched {
+				addrs = append(addrs, r.addr)
+			}
+			continue
+		}
+		if r.match(name) {
+			matched = r.pattern
+			addrs = append(addrs, r.addr)
+		}
+	}
+	return addrs
+}
+
+// Len returns the number of rules
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
+
+func (r rule) match(name string) bool {
+	if r.glob {
+		ok, _ := path.Match(r.pattern, name)
+		return ok
+	}
+	return name == r.pattern || strings.HasSuffix(name, "."+r.pattern)
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
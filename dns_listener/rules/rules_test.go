@@ -0,0 +1,58 @@
+package rules
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseAndLookup(t *testing.T) {
+	set, err := Parse("sink.example=0.0.0.0, sink.example=::, host-*.lan=10.0.0.1,Corp.Example.=192.0.2.10")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if set.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", set.Len())
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"sink.example", []string{"0.0.0.0", "::"}},
+		{"ads.sink.example", []string{"0.0.0.0", "::"}},
+		{"notsink.example", nil},
+		{"host-1.lan", []string{"10.0.0.1"}},
+		{"a.host-1.lan", nil},
+		{"WWW.corp.example.", []string{"192.0.2.10"}},
+		{"example.org", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := set.Lookup(tt.name)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Lookup(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(net.ParseIP(tt.want[i])) {
+					t.Errorf("Lookup(%q)[%d] = %v, want %s", tt.name, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"sink.example",
+		"=10.0.0.1",
+		"sink.example=not-an-ip",
+		"*[.lan=10.0.0.1",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", spec)
+		}
+	}
+	if set, err := Parse(""); err != nil || set.Len() != 0 {
+		t.Errorf("Parse(\"\") = %v, %v, want empty set", set, err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package source loads documents such as zones and blocklists from local
+// files or HTTP(S) URLs, skipping unchanged content.
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a single remote fetch
+const DefaultTimeout = 30 * time.Second
+
+// maxDocumentSize caps the size of a fetched document
+const maxDocumentSize = 64 << 20
+
+// Source yields a document for parsing
+type Source interface {
+	// Refresh loads the document and passes it to apply when it changed since
+	// the last successful apply. When loading or apply fails, the previously
+	// applied document stays in effect and the change is retried next time.
+	Refresh(ctx context.Context, apply func([]byte) error) error
+	// String describes the location for logs
+	String() string
+}
+
+// New returns a Remote for http and https URLs and a File otherwise
+func New(location string) Source {
+	if u, err := url.Parse(location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return NewRemote(location, nil)
+	}
+	return NewFile(location)
+}
+
+// File reads a document from disk, skipping unchanged files by size and
+// modification time
+type File struct {
+	path    string
+	mu      sync.Mutex
+	size    int64
+	modTime time.Time
+}
+
+// NewFile creates a File source for path
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Refresh implements Source
+func (f *File) Refresh(ctx context.Context, apply func([]byte) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == f.size && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	if err := apply(data); err != nil {
+		return err
+	}
+
+	f.size, f.modTime = info.Size(), info.ModTime()
+	return nil
+}
+
+func (f *File) String() string {
+	return f.path
+}
+
+// Remote fetches a document over HTTP(S) using ETag and Last-Modified
+// validators to avoid downloading unchanged content
+type Remote struct {
+	url          string
+	client       *http.Client
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+}
+
+// NewRemote creates a Remote source for url. A nil client uses a client
+// with DefaultTimeout.
+func NewRemote(url string, client *http.Client) *Remote {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Remote{url: url, client: client}
+}
+
+// Refresh implements Source
+func (r *Remote) Refresh(ctx context.Context, apply func([]byte) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	if r.lastModified != "" {
+		req.Header.Set("If-Modified-Since", r.lastModified)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("fetch %s: unexpected status %s", r.url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", r.url, err)
+	}
+	if len(data) > maxDocumentSize {
+		return fmt.Errorf("fetch %s: document exceeds %d bytes", r.url, maxDocumentSize)
+	}
+	if err := apply(data); err != nil {
+		return err
+	}
+
+	r.etag = resp.Header.Get("ETag")
+	r.lastModified = resp.Header.Get("Last-Modified")
+	return nil
+}
+
+func (r *Remote) String() string {
+	return r.url
+}
@@ -0,0 +1,140 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoteConditionalFetch(t *testing.T) {
+	var downloads, requests int32
+	body := "v1"
+	etag := `"v1"`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	src := New(srv.URL)
+	if _, ok := src.(*Remote); !ok {
+		t.Fatalf("New(%q) = %T, want *Remote", srv.URL, src)
+	}
+
+	var applied []string
+	apply := func(data []byte) error {
+		applied = append(applied, string(data))
+		return nil
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := src.Refresh(ctx, apply); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+	}
+	if downloads != 1 || len(applied) != 1 {
+		t.Errorf("downloads = %d, applied = %v, want one download of v1", downloads, applied)
+	}
+
+	body, etag = "v2", `"v2"`
+	if err := src.Refresh(ctx, apply); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(applied) != 2 || applied[1] != "v2" {
+		t.Errorf("applied = %v, want v2 after change", applied)
+	}
+	if requests != 3 {
+		t.Errorf("requests = %d, want 3", requests)
+	}
+}
+
+func TestRemoteRetriesRejectedDocument(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("v1"))
+	}))
+	defer srv.Close()
+
+	src := NewRemote(srv.URL, nil)
+	ctx := context.Background()
+
+	reject := errors.New("parse error")
+	if err := src.Refresh(ctx, func([]byte) error { return reject }); !errors.Is(err, reject) {
+		t.Fatalf("Refresh() error = %v, want %v", err, reject)
+	}
+
+	// The rejected version must be downloaded again rather than skipped
+	var got string
+	if err := src.Refresh(ctx, func(data []byte) error { got = string(data); return nil }); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got != "v1" {
+		t.Errorf("applied %q, want v1", got)
+	}
+}
+
+func TestRemoteServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	called := false
+	err := NewRemote(srv.URL, nil).Refresh(context.Background(), func([]byte) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf("Refresh() error = %v, apply called = %v, want error without apply", err, called)
+	}
+}
+
+func TestFileRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := New(path)
+	count := 0
+	apply := func([]byte) error { count++; return nil }
+
+	for i := 0; i < 2; i++ {
+		if err := src.Refresh(context.Background(), apply); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+	}
+	if count != 1 {
+		t.Errorf("applied %d times, want 1 for an unchanged file", count)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(path, []byte("v2!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, later, later)
+	if err := src.Refresh(context.Background(), apply); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("applied %d times, want 2 after change", count)
+	}
+}
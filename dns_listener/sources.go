@@ -0,0 +1,203 @@
+package dns_listener
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/blocklist"
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/hosts"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+	"github.com/exiguus/ns-checker/dns_listener/source"
+	"github.com/exiguus/ns-checker/dns_listener/zone"
+)
+
+// registerSources wires the configured blocklist, zone and hosts file
+// sources into the reloader. It reports whether any source is configured.
+func (d *DNSListener) registerSources() bool {
+	registered := false
+
+	if location := d.blocklistLocation(); location != "" {
+		src := source.New(location)
+		d.reloader.Register("blocklist", func() error {
+			return src.Refresh(context.Background(), func(data []byte) error {
+				list, err := blocklist.Parse(bytes.NewReader(data))
+				if err != nil {
+					return fmt.Errorf("parse %s: %w", src, err)
+				}
+				d.blocklist.Store(list)
+				d.logger.Write(fmt.Sprintf("Loaded blocklist from %s: %d entries\n", src, list.Len()))
+				return nil
+			})
+		})
+		registered = true
+	}
+
+	if location := d.zoneLocation(); location != "" {
+		src := source.New(location)
+		d.reloader.Register("zone", func() error {
+			return src.Refresh(context.Background(), func(data []byte) error {
+				z, err := zone.Parse(bytes.NewReader(data))
+				if err != nil {
+					return fmt.Errorf("parse %s: %w", src, err)
+				}
+				d.zone.Store(z)
+				d.logger.Write(fmt.Sprintf("Loaded zone from %s: %d records\n", src, z.Len()))
+				return nil
+			})
+		})
+		registered = true
+	}
+
+	if d.config.HostsFile != "" {
+		src := source.New(d.config.HostsFile)
+		d.reloader.Register("hosts", func() error {
+			return src.Refresh(context.Background(), func(data []byte) error {
+				h, err := hosts.Parse(bytes.NewReader(data))
+				if err != nil {
+					return fmt.Errorf("parse %s: %w", src, err)
+				}
+				d.hosts.Store(&h)
+				d.logger.Write(fmt.Sprintf("Loaded hosts from %s: %d names\n", src, h.Len()))
+				return nil
+			})
+		})
+		registered = true
+	}
+
+	return registered
+}
+
+func (d *DNSListener) blocklistLocation() string {
+	if d.config.BlocklistURL != "" {
+		return d.config.BlocklistURL
+	}
+	return d.config.BlocklistFile
+}
+
+func (d *DNSListener) zoneLocation() string {
+	if d.config.ZoneURL != "" {
+		return d.config.ZoneURL
+	}
+	return d.config.ZoneFile
+}
+
+// refreshSources triggers a reload every SourceRefresh until ctx is done
+func (d *DNSListener) refreshSources(ctx context.Context) {
+	ticker := time.NewTicker(d.config.SourceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.reloader.Trigger()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resolveLocal answers query from the hosts file, the blocklist, the
+// rewrite rules or the zone, in that order. It reports false when none
+// applies and resolution should continue.
+func (d *DNSListener) resolveLocal(query []byte) ([]byte, string, bool) {
+	list, z, h := d.blocklist.Load(), d.zone.Load(), d.hosts.Load()
+	if list == nil && z == nil && h == nil && d.rules.Len() == 0 {
+		return nil, "", false
+	}
+
+	q, err := protocol.ReadQuestion(query)
+	if err != nil {
+		return nil, "", false
+	}
+
+	// Hosts entries answer A and AAAA only; other types of listed names
+	// resolve as usual
+	if q.Type == protocol.TypeA || q.Type == protocol.TypeAAAA {
+		if addrs := h.Lookup(q.Name); addrs != nil {
+			if response := d.addressResponse(query, q, addrs, d.hostsTTL()); response != nil {
+				return response, "hosts", true
+			}
+		}
+	}
+
+	if list.Match(q.Name) {
+		d.metrics.RecordBlocked()
+		if sinkhole := net.ParseIP(d.config.BlocklistSinkhole); sinkhole != nil {
+			if response := d.addressResponse(query, q, []net.IP{sinkhole}, ruleTTL); response != nil {
+				return response, "blocklist", true
+			}
+		}
+		return d.errorResponse(query, protocol.RCodeNXDomain), "blocklist", true
+	}
+
+	if addrs := d.rules.Lookup(q.Name); addrs != nil {
+		if response := d.addressResponse(query, q, addrs, ruleTTL); response != nil {
+			return response, "rules", true
+		}
+	}
+
+	records := z.Lookup(q.Name, q.Type)
+	soa, inZone := z.SOA(q.Name)
+	exists := len(records) > 0 || z.Exists(q.Name)
+	// Outside any SOA only owners are ours; their ancestors up to the TLD
+	// merely exist in the zone and must not get an authoritative NODATA
+	if !inZone && !z.Owns(q.Name) {
+		return nil, "", false
+	}
+	b := protocol.NewResponseBuilder(query, d.responseOptions())
+	if b == nil {
+		return nil, "", false
+	}
+	// Zone data is authoritative, unlike cached or stub answers
+	b.SetFlags(protocol.FlagAA)
+	for _, rec := range records {
+		b.AddAnswer(q.Name, rec.Type, protocol.ClassIN, rec.TTL, rec.Data)
+	}
+
+	// A missing name is NXDOMAIN; an existing name without the type is
+	// NODATA (NOERROR, no answers). Both carry the SOA when there is one so
+	// resolvers can cache them.
+	if !exists {
+		b.SetRCode(protocol.RCodeNXDomain)
+	}
+	if len(records) == 0 && inZone {
+		b.AddAuthority(soa.Name, protocol.TypeSOA, protocol.ClassIN, zone.NegativeTTL(soa), soa.Data)
+	}
+	return d.capTTLs(b.Bytes()), "zone", true
+}
+
+// ruleTTL is the TTL of answers synthesized from rewrite rules and for
+// sinkholed names
+const ruleTTL = 60
+
+// hostsTTL returns the TTL of answers from the hosts file in seconds
+func (d *DNSListener) hostsTTL() uint32 {
+	if d.config.HostsTTL <= 0 {
+		return uint32(config.DefaultHostsTTL.Seconds())
+	}
+	return uint32(d.config.HostsTTL.Seconds())
+}
+
+// addressResponse answers q with the addresses of the queried family,
+// each with the given TTL. Names that have no address of that family get
+// an empty NOERROR answer.
+func (d *DNSListener) addressResponse(query []byte, q protocol.Question, addrs []net.IP, ttl uint32) []byte {
+	b := protocol.NewResponseBuilder(query, d.responseOptions())
+	if b == nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ip4 := addr.To4()
+		switch {
+		case q.Type == protocol.TypeA && ip4 != nil:
+			b.AddAnswer(q.Name, protocol.TypeA, protocol.ClassIN, ttl, ip4)
+		case q.Type == protocol.TypeAAAA && ip4 == nil:
+			b.AddAnswer(q.Name, protocol.TypeAAAA, protocol.ClassIN, ttl, addr.To16())
+		}
+	}
+	return d.capTTLs(b.Bytes())
+}
@@ -0,0 +1,357 @@
+package dns_listener
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestBlocklistFromURL(t *testing.T) {
+	var mu sync.Mutex
+	body, etag, fail := "ads.example\n", `"1"`, false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	d := newTestListener(t, &config.Config{BlocklistURL: srv.URL})
+
+	// Loaded on startup
+	if rcode := queryRCode(t, d, "ads.example"); rcode != protocol.RCodeNXDomain {
+		t.Errorf("ads.example rcode = %v, want NXDOMAIN", rcode)
+	}
+	if rcode := queryRCode(t, d, "tracker.example"); rcode != protocol.RCodeNoError {
+		t.Errorf("tracker.example rcode = %v, want NOERROR", rcode)
+	}
+
+	// Refreshed when the content changes
+	mu.Lock()
+	body, etag = "tracker.example\n", `"2"`
+	mu.Unlock()
+	if err := d.reloader.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if rcode := queryRCode(t, d, "tracker.example"); rcode != protocol.RCodeNXDomain {
+		t.Errorf("tracker.example rcode = %v after refresh, want NXDOMAIN", rcode)
+	}
+	if rcode := queryRCode(t, d, "ads.example"); rcode != protocol.RCodeNoError {
+		t.Errorf("ads.example rcode = %v after refresh, want NOERROR", rcode)
+	}
+
+	// The last good version survives a failing server
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	if err := d.reloader.Reload(); err == nil {
+		t.Error("Reload() error = nil with failing server")
+	}
+	if rcode := queryRCode(t, d, "tracker.example"); rcode != protocol.RCodeNXDomain {
+		t.Errorf("tracker.example rcode = %v after failed fetch, want NXDOMAIN", rcode)
+	}
+}
+
+func TestZoneFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	zoneData := "www.example.com. 120 IN A 192.0.2.10\n"
+	if err := os.WriteFile(path, []byte(zoneData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestListener(t, &config.Config{ZoneFile: path})
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	response, err := d.HandleRequest(buildTestQuery("www.example.com", protocol.TypeA), addr, "udp")
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+
+	// Header, question (17+4 bytes), then a compressed A record
+	want := []byte{0xC0, 0x0C, 0, 1, 0, 1, 0, 0, 0, 120, 0, 4, 192, 0, 2, 10}
+	if len(response) < len(want) || string(response[len(response)-len(want):]) != string(want) {
+		t.Errorf("response = %x, want answer %x", response, want)
+	}
+}
+
+func TestZoneSOA(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	zoneData := "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 300\n" +
+		"www.example.com. 120 IN A 192.0.2.10\n"
+	if err := os.WriteFile(path, []byte(zoneData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestListener(t, &config.Config{ZoneFile: path})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     protocol.DNSType
+		rcode     protocol.RCode
+		answers   uint16
+		authority uint16
+		ttl       uint32 // of the first record
+	}{
+		{"direct SOA query", "example.com", protocol.TypeSOA, protocol.RCodeNoError, 1, 0, 3600},
+		{"NXDOMAIN carries SOA", "missing.example.com", protocol.TypeA, protocol.RCodeNXDomain, 0, 1, 300},
+		{"NODATA carries SOA", "www.example.com", protocol.TypeAAAA, protocol.RCodeNoError, 0, 1, 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := d.HandleRequest(buildTestQuery(tt.qname, tt.qtype), addr, "udp")
+			if err != nil {
+				t.Fatalf("HandleRequest() error = %v", err)
+			}
+			if rcode := protocol.RCode(resp[3] & 0x0F); rcode != tt.rcode {
+				t.Errorf("rcode = %v, want %v", rcode, tt.rcode)
+			}
+			if resp[2]&byte(protocol.FlagAA>>8) == 0 {
+				t.Error("AA not set")
+			}
+			an, ns := binary.BigEndian.Uint16(resp[6:8]), binary.BigEndian.Uint16(resp[8:10])
+			if an != tt.answers || ns != tt.authority {
+				t.Fatalf("ANCOUNT, NSCOUNT = %d, %d, want %d, %d", an, ns, tt.answers, tt.authority)
+			}
+
+			_, offset, _ := protocol.ReadName(resp, 12)
+			_, offset, err = protocol.ReadName(resp, offset+4)
+			if err != nil {
+				t.Fatalf("reading record owner: %v", err)
+			}
+			if rrType := protocol.DNSType(binary.BigEndian.Uint16(resp[offset:])); rrType != protocol.TypeSOA {
+				t.Errorf("record type = %v, want SOA", rrType)
+			}
+			if ttl := binary.BigEndian.Uint32(resp[offset+4:]); ttl != tt.ttl {
+				t.Errorf("record TTL = %d, want %d", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestZoneNoData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	if err := os.WriteFile(path, []byte("www.example.com. 120 IN A 192.0.2.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestListener(t, &config.Config{ZoneFile: path})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	resp, err := d.HandleRequest(buildTestQuery("www.example.com", protocol.TypeAAAA), addr, "udp")
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if rcode := protocol.RCode(resp[3] & 0x0F); rcode != protocol.RCodeNoError {
+		t.Errorf("rcode = %v, want NOERROR (NODATA), not NXDOMAIN", rcode)
+	}
+	if an := binary.BigEndian.Uint16(resp[6:8]); an != 0 {
+		t.Errorf("ANCOUNT = %d, want 0", an)
+	}
+	if resp[2]&byte(protocol.FlagAA>>8) == 0 {
+		t.Error("AA not set on NODATA from the zone")
+	}
+}
+
+func TestZoneAncestorsFallThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	if err := os.WriteFile(path, []byte("www.example.com. 120 IN A 192.0.2.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestListener(t, &config.Config{ZoneFile: path})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	// Parents of an owner outside any SOA are not the zone's to answer
+	for _, name := range []string{"example.com", "com"} {
+		resp, err := d.HandleRequest(buildTestQuery(name, protocol.TypeA), addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest(%s) error = %v", name, err)
+		}
+		if resp[2]&byte(protocol.FlagAA>>8) != 0 {
+			t.Errorf("%s: AA set, want the stub answer", name)
+		}
+		if got := resp[len(resp)-4:]; !net.IP(got).Equal(net.IPv4(127, 0, 0, 1)) {
+			t.Errorf("%s = %v, want the stub answer", name, net.IP(got))
+		}
+	}
+}
+
+func TestRewriteRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.zone")
+	if err := os.WriteFile(path, []byte("www.example.com. 120 IN A 192.0.2.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestListener(t, &config.Config{
+		ZoneFile:     path,
+		RewriteRules: "sink.example=10.0.0.1",
+	})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	answer := func(name string) []byte {
+		t.Helper()
+		resp, err := d.HandleRequest(buildTestQuery(name, protocol.TypeA), addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest(%s) error = %v", name, err)
+		}
+		if an := binary.BigEndian.Uint16(resp[6:8]); an != 1 {
+			t.Fatalf("%s ANCOUNT = %d, want 1", name, an)
+		}
+		return resp[len(resp)-4:]
+	}
+
+	// Subdomains match a plain pattern
+	if got := answer("ads.sink.example"); !net.IP(got).Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("ads.sink.example = %v, want 10.0.0.1 from the rule", net.IP(got))
+	}
+	// Non-matching names fall through to the zone and then the stub answer
+	if got := answer("www.example.com"); !net.IP(got).Equal(net.IPv4(192, 0, 2, 10)) {
+		t.Errorf("www.example.com = %v, want 192.0.2.10 from the zone", net.IP(got))
+	}
+	if got := answer("other.test"); !net.IP(got).Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("other.test = %v, want the stub answer", net.IP(got))
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	hostsData := "# static hosts\n" +
+		"192.0.2.10   nas.lan nas\n" +
+		"2001:db8::10 nas.lan\n" +
+		"192.0.2.20   printer.lan\n"
+	if err := os.WriteFile(path, []byte(hostsData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestListener(t, &config.Config{HostsFile: path, HostsTTL: 90 * time.Second, Debug: true})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	query := func(name string, qtype protocol.DNSType) []byte {
+		t.Helper()
+		resp, err := d.HandleRequest(buildTestQuery(name, qtype), addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest(%s) error = %v", name, err)
+		}
+		return resp
+	}
+
+	// A compressed record of the given type, TTL 90 and address
+	record := func(qtype protocol.DNSType, ip net.IP) []byte {
+		rr := []byte{0xC0, 0x0C, 0, byte(qtype), 0, 1, 0, 0, 0, 90, 0, byte(len(ip))}
+		return append(rr, ip...)
+	}
+
+	tests := []struct {
+		name  string
+		qtype protocol.DNSType
+		want  []byte
+	}{
+		{"nas.lan", protocol.TypeA, record(protocol.TypeA, net.IPv4(192, 0, 2, 10).To4())},
+		{"NAS", protocol.TypeA, record(protocol.TypeA, net.IPv4(192, 0, 2, 10).To4())},
+		{"nas.lan", protocol.TypeAAAA, record(protocol.TypeAAAA, net.ParseIP("2001:db8::10"))},
+		{"printer.lan", protocol.TypeA, record(protocol.TypeA, net.IPv4(192, 0, 2, 20).To4())},
+	}
+	for _, tt := range tests {
+		resp := query(tt.name, tt.qtype)
+		if an := binary.BigEndian.Uint16(resp[6:8]); an != 1 {
+			t.Errorf("%s type %d ANCOUNT = %d, want 1", tt.name, tt.qtype, an)
+			continue
+		}
+		if got := resp[len(resp)-len(tt.want):]; string(got) != string(tt.want) {
+			t.Errorf("%s type %d answer = %x, want %x", tt.name, tt.qtype, got, tt.want)
+		}
+	}
+
+	// A listed name without an address of the queried family has no answers
+	resp := query("printer.lan", protocol.TypeAAAA)
+	if an := binary.BigEndian.Uint16(resp[6:8]); an != 0 || resp[3]&0x0F != 0 {
+		t.Errorf("printer.lan AAAA ANCOUNT = %d, rcode = %d, want an empty NOERROR answer", an, resp[3]&0x0F)
+	}
+
+	// Names not in the file fall through to the stub answer
+	resp = query("other.test", protocol.TypeA)
+	if got := resp[len(resp)-4:]; !net.IP(got).Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("other.test = %v, want the stub answer", net.IP(got))
+	}
+
+	e, err := d.Explain(buildTestQuery("nas.lan", protocol.TypeA), addr)
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if e.Layer != "hosts" {
+		t.Errorf("Explain() layer = %q, want hosts", e.Layer)
+	}
+}
+
+func TestBlocklistFileSinkhole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("ads.example\n*.tracker.example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestListener(t, &config.Config{BlocklistFile: path, BlocklistSinkhole: "0.0.0.0"})
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+	answer := func(name string, qtype protocol.DNSType) []byte {
+		t.Helper()
+		resp, err := d.HandleRequest(buildTestQuery(name, qtype), addr, "udp")
+		if err != nil {
+			t.Fatalf("HandleRequest(%s) error = %v", name, err)
+		}
+		if rcode := resp[3] & 0x0F; rcode != 0 {
+			t.Fatalf("%s rcode = %d, want NOERROR", name, rcode)
+		}
+		if binary.BigEndian.Uint16(resp[6:8]) == 0 {
+			return nil
+		}
+		return resp[len(resp)-4:]
+	}
+
+	// Exact and subdomain matches resolve to the sinkhole
+	for _, name := range []string{"ads.example", "a.tracker.example"} {
+		if got := answer(name, protocol.TypeA); !net.IP(got).Equal(net.IPv4zero) {
+			t.Errorf("%s = %v, want the sinkhole 0.0.0.0", name, net.IP(got))
+		}
+	}
+	// An IPv4 sinkhole leaves AAAA queries without answers
+	if got := answer("ads.example", protocol.TypeAAAA); got != nil {
+		t.Errorf("ads.example AAAA = %x, want no answer", got)
+	}
+	// Other names pass through to the stub answer
+	if got := answer("example.org", protocol.TypeA); !net.IP(got).Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("example.org = %v, want the stub answer", net.IP(got))
+	}
+	if blocked := d.metrics.GetBlockedRequests(); blocked != 3 {
+		t.Errorf("GetBlockedRequests() = %d, want 3", blocked)
+	}
+
+	// The file is read again on reload
+	if err := os.WriteFile(path, []byte("ads.example\nexample.org\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.reloader.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := answer("example.org", protocol.TypeA); !net.IP(got).Equal(net.IPv4zero) {
+		t.Errorf("example.org = %v after reload, want the sinkhole", net.IP(got))
+	}
+	if got := answer("a.tracker.example", protocol.TypeA); !net.IP(got).Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("a.tracker.example = %v after reload, want the stub answer", net.IP(got))
+	}
+}
@@ -0,0 +1,58 @@
+package dns_listener
+
+import (
+	"context"
+	"net"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+	"github.com/exiguus/ns-checker/dns_listener/tracing"
+)
+
+// spanService is the service.name of exported spans
+const spanService = "ns-checker"
+
+// WithSpanExporter exports a span for every request to e, replacing the
+// OTLP exporter set up from OTEL_EXPORTER_OTLP_ENDPOINT
+func WithSpanExporter(e tracing.Exporter) Option {
+	return func(d *DNSListener) {
+		d.tracer.SetExporter(e)
+	}
+}
+
+// finishTrace ends the trace of a request and, when spans are exported,
+// exports it tagged with the protocol, client address, question name and
+// the layer that settled the query. The name is redacted like in the
+// access log.
+func (d *DNSListener) finishTrace(ctx context.Context, query []byte, addr net.Addr, protocolType string) {
+	trace := d.tracer.Finish(ctx)
+	if trace == nil || !d.tracer.Exporting() {
+		return
+	}
+
+	client := addr.String()
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	attrs := []tracing.Attribute{
+		{Key: "dns.protocol", Value: protocolType},
+		{Key: "client.address", Value: client},
+	}
+	if q, err := protocol.ReadQuestion(query); err == nil {
+		attrs = append(attrs, tracing.Attribute{Key: "dns.qname", Value: redactName(q.Name, d.config.QnameRedaction)})
+	}
+	attrs = append(attrs, tracing.Attribute{Key: "dns.outcome", Value: traceLayer(trace.Events)})
+
+	d.tracer.Export(trace, "dns.query", attrs...)
+}
+
+// traceLayer returns the layer that settled a query, from the last event
+// of events found in explainLayers, or "" when none is
+func traceLayer(events []tracing.Event) string {
+	var layer string
+	for _, ev := range events {
+		if l, ok := explainLayers[ev.Name]; ok {
+			layer = l
+		}
+	}
+	return layer
+}
@@ -0,0 +1,92 @@
+package dns_listener
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+	"github.com/exiguus/ns-checker/dns_listener/tracing"
+)
+
+// spanAttrs returns the attributes of s by key
+func spanAttrs(s tracing.Span) map[string]string {
+	attrs := make(map[string]string)
+	for _, a := range s.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	return attrs
+}
+
+func TestSpanPerRequest(t *testing.T) {
+	d := newTestListener(t, &config.Config{})
+	exp := &tracing.MemoryExporter{}
+	WithSpanExporter(exp)(d)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 5353}
+
+	query := buildTestQuery("span.example", protocol.TypeA)
+	for i := 0; i < 2; i++ {
+		if _, err := d.HandleRequest(query, addr, "udp"); err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want one per request", len(spans))
+	}
+	tests := []struct {
+		outcome string
+		events  []string
+	}{
+		{"resolver", []string{"request_start", "cache_miss", "resolver_answer", "request_complete"}},
+		{"cache", []string{"request_start", "cache_hit", "request_complete"}},
+	}
+	for i, tt := range tests {
+		s := spans[i]
+		var events []string
+		for _, ev := range s.Events {
+			events = append(events, ev.Name)
+		}
+		if strings.Join(events, ",") != strings.Join(tt.events, ",") {
+			t.Errorf("span %d events = %v, want %v", i, events, tt.events)
+		}
+
+		want := map[string]string{
+			"dns.protocol":   "udp",
+			"client.address": "192.0.2.7",
+			"dns.qname":      "span.example",
+			"dns.outcome":    tt.outcome,
+		}
+		attrs := spanAttrs(s)
+		for k, v := range want {
+			if attrs[k] != v {
+				t.Errorf("span %d %s = %q, want %q", i, k, attrs[k], v)
+			}
+		}
+		if len(s.TraceID) != 32 || len(s.SpanID) != 16 || s.End.Before(s.Start) {
+			t.Errorf("span %d = %+v, want hex IDs and End after Start", i, s)
+		}
+	}
+	if spans[0].TraceID == spans[1].TraceID {
+		t.Error("both requests share a trace ID")
+	}
+}
+
+func TestSpanRedactsQname(t *testing.T) {
+	d := newTestListener(t, &config.Config{QnameRedaction: config.RedactHash})
+	exp := &tracing.MemoryExporter{}
+	WithSpanExporter(exp)(d)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 7), Port: 5353}
+
+	d.HandleRequest(buildTestQuery("secret.example", protocol.TypeA), addr, "udp")
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	if got := spanAttrs(spans[0])["dns.qname"]; got != redactName("secret.example", config.RedactHash) {
+		t.Errorf("dns.qname = %q, want the hashed name", got)
+	}
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Attribute is a key/value tag of a span
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Span is a finished trace as handed to an Exporter. IDs are lower case
+// hex, 32 digits for the trace and 16 for the span, as OTLP expects.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Events     []Event
+}
+
+// Exporter receives the spans of finished traces. ExportSpan is called on
+// the request path and must not block.
+type Exporter interface {
+	ExportSpan(Span)
+}
+
+// SetExporter makes Export hand spans to e; nil turns exporting off. It is
+// meant to be called before the tracer is used.
+func (t *Tracer) SetExporter(e Exporter) {
+	t.exporter = e
+}
+
+// Exporting reports whether an exporter is set, so callers can skip
+// building attributes nobody reads
+func (t *Tracer) Exporting() bool {
+	return t.exporter != nil
+}
+
+// Export turns a finished trace into a span called name, ending now, and
+// hands it to the exporter. Without an exporter or trace it does nothing.
+func (t *Tracer) Export(trace *Trace, name string, attrs ...Attribute) {
+	if t.exporter == nil || trace == nil {
+		return
+	}
+
+	trace.mu.Lock()
+	events := append([]Event(nil), trace.Events...)
+	trace.mu.Unlock()
+
+	t.exporter.ExportSpan(Span{
+		TraceID:    randomHex(16),
+		SpanID:     randomHex(8),
+		Name:       name,
+		Start:      trace.StartTime,
+		End:        time.Now(),
+		Attributes: attrs,
+		Events:     events,
+	})
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryExporter keeps exported spans in memory, for tests and debugging
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+// ExportSpan records s
+func (m *MemoryExporter) ExportSpan(s Span) {
+	m.mu.Lock()
+	m.spans = append(m.spans, s)
+	m.mu.Unlock()
+}
+
+// Spans returns the spans exported so far, oldest first
+func (m *MemoryExporter) Spans() []Span {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Span(nil), m.spans...)
+}
@@ -0,0 +1,251 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// otlpBatchSize is the most spans sent in one request
+	otlpBatchSize = 512
+	// otlpQueueSize is how many spans wait for export before new ones are
+	// dropped
+	otlpQueueSize = 4096
+	// DefaultFlushInterval is how often an OTLPExporter sends a partial
+	// batch
+	DefaultFlushInterval = 5 * time.Second
+	otlpTimeout          = 10 * time.Second
+)
+
+// OTLP span kind and status codes
+const (
+	otlpKindServer  = 2
+	otlpStatusError = 2
+)
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector using
+// OTLP over HTTP with the JSON encoding. Spans are queued by ExportSpan
+// and sent from a background goroutine; when the queue is full new spans
+// are dropped rather than slowing down requests.
+type OTLPExporter struct {
+	url      string
+	service  string
+	client   *http.Client
+	queue    chan Span
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	dropped  atomic.Uint64
+	onError  func(error)
+	interval time.Duration
+}
+
+// NewOTLPExporter starts an exporter posting to the traces path below
+// endpoint, the base URL of OTEL_EXPORTER_OTLP_ENDPOINT. Spans are tagged
+// with service as service.name. onError, if not nil, is called for every
+// batch that could not be sent.
+func NewOTLPExporter(endpoint, service string, interval time.Duration, onError func(error)) *OTLPExporter {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	e := &OTLPExporter{
+		url:      strings.TrimRight(endpoint, "/") + "/v1/traces",
+		service:  service,
+		client:   &http.Client{Timeout: otlpTimeout},
+		queue:    make(chan Span, otlpQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		onError:  onError,
+		interval: interval,
+	}
+	go e.run()
+	return e
+}
+
+// ExportSpan queues s for sending, dropping it when the queue is full
+func (e *OTLPExporter) ExportSpan(s Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many spans were dropped because the queue was full
+func (e *OTLPExporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Close sends the queued spans and stops the exporter. Spans exported
+// afterwards are never sent.
+func (e *OTLPExporter) Close() {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]Span, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil && e.onError != nil {
+			e.onError(err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-e.queue:
+			if batch = append(batch, s); len(batch) == otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case s := <-e.queue:
+					if batch = append(batch, s); len(batch) == otlpBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts one batch of spans
+func (e *OTLPExporter) send(spans []Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("exporting %d spans: %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("exporting %d spans: %s", len(spans), resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/JSON request, limited to the fields the exporter fills in
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+// otlpTime formats t in nanoseconds; OTLP/JSON encodes 64 bit integers
+// as strings
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// request wraps spans in a single resource and scope. A span whose events
+// carry an error gets an error status with the first error as message.
+func (e *OTLPExporter) request(spans []Span) otlpRequest {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			Name:              s.Name,
+			Kind:              otlpKindServer,
+			StartTimeUnixNano: otlpTime(s.Start),
+			EndTimeUnixNano:   otlpTime(s.End),
+		}
+		for _, a := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpString(a.Key, a.Value))
+		}
+		for _, ev := range s.Events {
+			event := otlpEvent{TimeUnixNano: otlpTime(ev.Timestamp), Name: ev.Name}
+			if ev.Error != nil {
+				event.Attributes = []otlpKeyValue{otlpString("exception.message", ev.Error.Error())}
+				if span.Status.Code == 0 {
+					span.Status = otlpStatus{Code: otlpStatusError, Message: ev.Error.Error()}
+				}
+			}
+			span.Events = append(span.Events, event)
+		}
+		out[i] = span
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpString("service.name", e.service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/exiguus/ns-checker/dns_listener/tracing"}, Spans: out}},
+	}}}
+}
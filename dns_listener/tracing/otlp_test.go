@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracerWithoutExporter(t *testing.T) {
+	tr := New()
+	if tr.Exporting() {
+		t.Fatal("Exporting() = true without an exporter")
+	}
+	ctx := tr.StartTrace(context.Background())
+	tr.AddEvent(ctx, "request_start", nil)
+	// Must not panic
+	tr.Export(tr.Finish(ctx), "dns.query")
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		path string
+		reqs []otlpRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		mu.Lock()
+		path = r.URL.Path
+		reqs = append(reqs, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(srv.URL+"/", "ns-checker", time.Hour, func(err error) {
+		t.Errorf("export failed: %v", err)
+	})
+	tr := New()
+	tr.SetExporter(exp)
+
+	ctx := tr.StartTrace(context.Background())
+	tr.AddEvent(ctx, "request_start", nil)
+	tr.AddEvent(ctx, "validation_error", errors.New("bad query"))
+	tr.Export(tr.Finish(ctx), "dns.query", Attribute{Key: "dns.protocol", Value: "udp"})
+
+	// Close flushes the partial batch long before the interval
+	exp.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "/v1/traces" {
+		t.Errorf("posted to %q, want /v1/traces", path)
+	}
+	if len(reqs) != 1 || len(reqs[0].ResourceSpans) != 1 {
+		t.Fatalf("got %d requests, want one with one resource", len(reqs))
+	}
+	rs := reqs[0].ResourceSpans[0]
+	if attrs := rs.Resource.Attributes; len(attrs) != 1 || attrs[0].Value.StringValue != "ns-checker" {
+		t.Errorf("resource attributes = %+v, want service.name ns-checker", attrs)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "dns.query" || s.Kind != otlpKindServer || len(s.TraceID) != 32 || len(s.SpanID) != 16 {
+		t.Errorf("span = %+v", s)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Key != "dns.protocol" || s.Attributes[0].Value.StringValue != "udp" {
+		t.Errorf("attributes = %+v, want dns.protocol=udp", s.Attributes)
+	}
+	if len(s.Events) != 2 || s.Events[1].Name != "validation_error" || len(s.Events[1].Attributes) != 1 {
+		t.Errorf("events = %+v, want the error on validation_error", s.Events)
+	}
+	if s.Status.Code != otlpStatusError || s.Status.Message != "bad query" {
+		t.Errorf("status = %+v, want error bad query", s.Status)
+	}
+}
+
+func TestOTLPExporterDropsWhenFull(t *testing.T) {
+	// Without the run goroutine nothing drains the queue
+	exp := &OTLPExporter{queue: make(chan Span, 1)}
+	exp.ExportSpan(Span{})
+	exp.ExportSpan(Span{})
+	if got := exp.Dropped(); got != 1 {
+		t.Errorf("Dropped() = %d, want 1", got)
+	}
+}
@@ -2,7 +2,9 @@ package tracing
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,7 +22,8 @@ type Trace struct {
 }
 
 type Tracer struct {
-	traces sync.Map
+	traces   sync.Map
+	exporter Exporter
 }
 
 func New() *Tracer {
@@ -56,6 +59,22 @@ func (t *Tracer) AddEvent(ctx context.Context, name string, err error) {
 	}
 }
 
+// Finish stops tracking the trace started for ctx and returns it, or nil
+// when ctx carries no trace
+func (t *Tracer) Finish(ctx context.Context) *Trace {
+	traceID, ok := ctx.Value("trace_id").(string)
+	if !ok {
+		return nil
+	}
+	if trace, ok := t.traces.LoadAndDelete(traceID); ok {
+		return trace.(*Trace)
+	}
+	return nil
+}
+
+// traceSeq disambiguates traces started within the same nanosecond
+var traceSeq atomic.Uint64
+
 func generateTraceID() string {
-	return time.Now().Format("20060102150405.000000000")
+	return fmt.Sprintf("%s-%d", time.Now().Format("20060102150405.000000000"), traceSeq.Add(1))
 }
@@ -7,10 +7,17 @@ import (
 type Logger interface {
 	Write(string)
 	Error(msg string, err error)
-	LogRequest(protocol, client string, data []byte, err error)
+	LogRequest(protocol, client string, data, response []byte, err error)
 	Close()
 }
 
+// LogSink is a destination for formatted log entries. Each entry ends in a
+// newline and may span several lines.
+type LogSink interface {
+	WriteEntry(entry string) error
+	Close() error
+}
+
 type Request struct {
 	Data       []byte
 	ClientAddr string
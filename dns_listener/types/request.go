@@ -8,4 +8,11 @@ type Request struct {
 	Protocol   string
 	ClientAddr net.Addr
 	Data       []byte
+	Reply      chan<- Response // Receives the answer instead of Conn when set
+}
+
+// Response is the answer to a Request sent on its Reply channel
+type Response struct {
+	Data []byte
+	Err  error
 }
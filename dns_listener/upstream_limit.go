@@ -0,0 +1,95 @@
+package dns_listener
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// upstreamQueueWait is how long a cache miss waits for a free upstream
+// slot before it is answered with SERVFAIL
+const upstreamQueueWait = 100 * time.Millisecond
+
+// errUpstreamSaturated passes the failure to get an upstream slot through
+// the coalescing group
+var errUpstreamSaturated = errors.New("upstream saturated")
+
+// upstreamLimiter caps the number of concurrent upstream resolutions. A nil
+// limiter imposes no cap.
+type upstreamLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newUpstreamLimiter(max int, wait time.Duration) *upstreamLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &upstreamLimiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+// acquire takes a slot, waiting up to the queue wait for one to free up
+func (l *upstreamLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (l *upstreamLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// resolveUpstream runs the resolution step for a cache miss within the
+// in-flight cap. It reports false when no slot became free in time.
+func (d *DNSListener) resolveUpstream(query []byte) ([]byte, bool) {
+	if !d.upstream.acquire() {
+		return nil, false
+	}
+	defer d.upstream.release()
+
+	d.metrics.AddUpstreamInFlight(1)
+	defer d.metrics.AddUpstreamInFlight(-1)
+
+	return d.resolve(query), true
+}
+
+// resolveCoalesced runs resolveUpstream for a cache miss, letting
+// concurrent misses for the same question, sent upstream with the same
+// client subnet, share one resolution. Each query gets its own copy of the
+// answer under its ID and question.
+func (d *DNSListener) resolveCoalesced(query []byte, addr net.Addr) ([]byte, bool) {
+	upstreamQuery := d.forwardQuery(query, addr)
+	key := cacheKeyFromQuery(query) + subnetKey(upstreamQuery)
+	response, err, shared := d.inflight.do(key, func() ([]byte, error) {
+		response, ok := d.resolveUpstream(upstreamQuery)
+		if !ok {
+			return nil, errUpstreamSaturated
+		}
+		return response, nil
+	})
+	if err != nil {
+		return nil, false
+	}
+	if !shared || response == nil {
+		// The shared answer must stay untouched while waiters copy it
+		return append([]byte(nil), response...), true
+	}
+	d.metrics.RecordCoalesced()
+	return d.fromCache(query, response, 0), true
+}
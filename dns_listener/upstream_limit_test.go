@@ -0,0 +1,84 @@
+package dns_listener
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/config"
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestUpstreamInflightCap(t *testing.T) {
+	const limit = 2
+	d := newTestListener(t, &config.Config{MaxUpstreamInflight: limit})
+
+	var current, peak int32
+	stub := d.resolve
+	d.resolve = func(query []byte) []byte {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		if got := d.metrics.GetUpstreamInFlight(); got > limit {
+			t.Errorf("upstream_inflight = %d, want at most %d", got, limit)
+		}
+		time.Sleep(20 * time.Millisecond)
+		return stub(query)
+	}
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := buildTestQuery(fmt.Sprintf("miss%d.example", i), protocol.TypeA)
+			if _, err := d.HandleRequest(query, addr, "udp"); err != nil {
+				t.Errorf("HandleRequest() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak > limit {
+		t.Errorf("peak concurrent upstream queries = %d, want at most %d", peak, limit)
+	}
+	if got := d.metrics.GetUpstreamInFlight(); got != 0 {
+		t.Errorf("upstream_inflight = %d after all queries, want 0", got)
+	}
+}
+
+func TestUpstreamSaturatedServFail(t *testing.T) {
+	d := newTestListener(t, &config.Config{MaxUpstreamInflight: 1})
+
+	release := make(chan struct{})
+	stub := d.resolve
+	d.resolve = func(query []byte) []byte {
+		<-release
+		return stub(query)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+		d.HandleRequest(buildTestQuery("slow.example", protocol.TypeA), addr, "udp")
+	}()
+	for d.metrics.GetUpstreamInFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if rcode := queryRCode(t, d, "queued.example"); rcode != protocol.RCodeServFail {
+		t.Errorf("rcode = %v while saturated, want SERVFAIL", rcode)
+	}
+	close(release)
+	<-done
+}
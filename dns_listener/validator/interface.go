@@ -12,4 +12,6 @@ type ValidationStats struct {
 	TotalValidated   uint64
 	InvalidQueries   uint64
 	InvalidResponses uint64
+	OversizedQueries uint64 // queries over the size cap, also counted as invalid
+	ExcessQuestions  uint64 // queries over the question cap, also counted as invalid
 }
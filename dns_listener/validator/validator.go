@@ -14,25 +14,54 @@ var (
 	ErrInvalidQuestionCount = errors.New("invalid question count")
 	ErrMalformedQuestion    = errors.New("malformed question section")
 	ErrUnsupportedOpcode    = errors.New("unsupported opcode")
+	ErrMultipleQuestions    = errors.New("multiple questions not supported")
+	ErrLabelTooLong         = errors.New("DNS label longer than 63 octets")
+	ErrNameTooLong          = errors.New("DNS name longer than 255 octets")
+	ErrQueryTooLarge        = errors.New("DNS query exceeds the size limit")
+	ErrTooManyQuestions     = errors.New("question count exceeds the limit")
+)
+
+// RFC 1035 limits on a label and on a whole name in wire format
+const (
+	maxLabelLength = 63
+	maxNameLength  = 255
 )
 
 // DNSValidator implements MessageValidator interface
 type DNSValidator struct {
-	stats ValidationStats // Use ValidationStats from interface.go
+	stats        ValidationStats // Use ValidationStats from interface.go
+	maxQuestions int
+	maxQuerySize int
 }
 
-func New() *DNSValidator {
-	return &DNSValidator{}
+// New creates a validator rejecting queries with more than maxQuestions
+// questions or more than maxQuerySize bytes. A limit of 0 or less disables
+// that check.
+func New(maxQuestions, maxQuerySize int) *DNSValidator {
+	return &DNSValidator{maxQuestions: maxQuestions, maxQuerySize: maxQuerySize}
 }
 
 func (v *DNSValidator) ValidateQuery(data []byte) error {
 	atomic.AddUint64(&v.stats.TotalValidated, 1)
 
+	// The caps come first so abusive queries are dropped before any walk
+	if v.maxQuerySize > 0 && len(data) > v.maxQuerySize {
+		atomic.AddUint64(&v.stats.OversizedQueries, 1)
+		atomic.AddUint64(&v.stats.InvalidQueries, 1)
+		return ErrQueryTooLarge
+	}
+
 	if err := v.validateBasics(data); err != nil {
 		atomic.AddUint64(&v.stats.InvalidQueries, 1)
 		return err
 	}
 
+	if v.maxQuestions > 0 && int(data[4])<<8|int(data[5]) > v.maxQuestions {
+		atomic.AddUint64(&v.stats.ExcessQuestions, 1)
+		atomic.AddUint64(&v.stats.InvalidQueries, 1)
+		return ErrTooManyQuestions
+	}
+
 	// Validate opcode
 	opcode := (data[2] >> 3) & 0x0F
 	if opcode != 0 {
@@ -40,6 +69,12 @@ func (v *DNSValidator) ValidateQuery(data []byte) error {
 		return ErrUnsupportedOpcode
 	}
 
+	// Only single question queries are answered (RFC 9619)
+	if data[4] != 0 || data[5] > 1 {
+		atomic.AddUint64(&v.stats.InvalidQueries, 1)
+		return ErrMultipleQuestions
+	}
+
 	// Validate question section
 	if err := v.validateQuestions(data); err != nil {
 		atomic.AddUint64(&v.stats.InvalidQueries, 1)
@@ -82,13 +117,25 @@ func (v *DNSValidator) validateQuestions(data []byte) error {
 	questionCount := int(data[4])<<8 | int(data[5])
 
 	for i := 0; i < questionCount; i++ {
-		// Parse name
+		// Parse name. A query has no earlier name to point at, so a
+		// compression pointer is as malformed as a reserved label type.
+		nameLength := 0
 		for offset < len(data) {
 			length := int(data[offset])
+			nameLength += length + 1
+			if nameLength > maxNameLength {
+				return ErrNameTooLong
+			}
 			if length == 0 {
 				offset++
 				break
 			}
+			if length&0xC0 == 0xC0 {
+				return ErrMalformedQuestion
+			}
+			if length > maxLabelLength {
+				return ErrLabelTooLong
+			}
 			offset += length + 1
 			if offset >= len(data) {
 				return ErrMalformedQuestion
@@ -110,5 +157,7 @@ func (v *DNSValidator) GetStats() ValidationStats {
 		TotalValidated:   atomic.LoadUint64(&v.stats.TotalValidated),
 		InvalidQueries:   atomic.LoadUint64(&v.stats.InvalidQueries),
 		InvalidResponses: atomic.LoadUint64(&v.stats.InvalidResponses),
+		OversizedQueries: atomic.LoadUint64(&v.stats.OversizedQueries),
+		ExcessQuestions:  atomic.LoadUint64(&v.stats.ExcessQuestions),
 	}
 }
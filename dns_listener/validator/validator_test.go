@@ -1,9 +1,13 @@
 package validator
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
 
 func TestValidator(t *testing.T) {
-	v := New()
+	v := New(0, 0)
 
 	tests := []struct {
 		name    string
@@ -28,6 +32,20 @@ func TestValidator(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "multiple questions",
+			data: []byte{
+				0x00, 0x01, // ID
+				0x01, 0x00, // Flags
+				0x00, 0x02, // QDCOUNT
+				0x00, 0x00, // ANCOUNT
+				0x00, 0x00, // NSCOUNT
+				0x00, 0x00, // ARCOUNT
+				0x01, 'a', 0x00, 0x00, 0x01, 0x00, 0x01,
+				0x01, 'b', 0x00, 0x00, 0x01, 0x00, 0x01,
+			},
+			wantErr: true,
+		},
 		{
 			name:    "empty query",
 			data:    []byte{},
@@ -49,3 +67,77 @@ func TestValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateCaps(t *testing.T) {
+	overCount := query(append(label(1), 0))
+	overCount[5] = 3 // QDCOUNT, checked before the questions are walked
+	overSize := query(bytes.Join([][]byte{label(63), label(63), {0}}, nil))
+
+	v := New(2, 128)
+	if err := v.ValidateQuery(overCount); !errors.Is(err, ErrTooManyQuestions) {
+		t.Errorf("ValidateQuery(3 questions) error = %v, want %v", err, ErrTooManyQuestions)
+	}
+	if err := v.ValidateQuery(overSize); !errors.Is(err, ErrQueryTooLarge) {
+		t.Errorf("ValidateQuery(%d bytes) error = %v, want %v", len(overSize), err, ErrQueryTooLarge)
+	}
+	if err := v.ValidateQuery(query(append(label(63), 0))); err != nil {
+		t.Errorf("ValidateQuery() of a query within the caps error = %v", err)
+	}
+
+	stats := v.GetStats()
+	if stats.ExcessQuestions != 1 || stats.OversizedQueries != 1 || stats.InvalidQueries != 2 || stats.TotalValidated != 3 {
+		t.Errorf("stats = %+v, want one rejection of each kind out of 3", stats)
+	}
+
+	// Without caps the same queries reach the question checks
+	if err := New(0, 0).ValidateQuery(overSize); err != nil {
+		t.Errorf("ValidateQuery() without caps error = %v", err)
+	}
+}
+
+// query builds a single A question for the wire format name
+func query(name []byte) []byte {
+	data := []byte{0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	data = append(data, name...)
+	return append(data, 0x00, 0x01, 0x00, 0x01)
+}
+
+// label returns a wire format label of n letters
+func label(n int) []byte {
+	return append([]byte{byte(n)}, bytes.Repeat([]byte{'a'}, n)...)
+}
+
+func TestValidateNameLimits(t *testing.T) {
+	// Three 63 octet labels and one of 61 make a 255 octet name; one more
+	// octet in the last label makes it 256
+	name255 := bytes.Join([][]byte{label(63), label(63), label(63), label(61), {0}}, nil)
+	name256 := bytes.Join([][]byte{label(63), label(63), label(63), label(62), {0}}, nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"63 octet label", query(append(label(63), 0)), nil},
+		{"64 octet label", query(append(label(64), 0)), ErrLabelTooLong},
+		{"255 octet name", query(name255), nil},
+		{"256 octet name", query(name256), ErrNameTooLong},
+		{"compression pointer", query([]byte{0x01, 'a', 0xc0, 0x0c}), ErrMalformedQuestion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(0, 0)
+			if err := v.ValidateQuery(tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateQuery() error = %v, want %v", err, tt.want)
+			}
+			wantInvalid := uint64(0)
+			if tt.want != nil {
+				wantInvalid = 1
+			}
+			if got := v.GetStats().InvalidQueries; got != wantInvalid {
+				t.Errorf("InvalidQueries = %d, want %d", got, wantInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+// Package zone serves records from a simple master-file style zone.
+package zone
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// DefaultTTL applies to records without an explicit TTL or $TTL directive
+const DefaultTTL = 3600
+
+// Record is a single resource record with its RDATA in wire format
+type Record struct {
+	Name string
+	Type protocol.DNSType
+	TTL  uint32
+	Data []byte
+}
+
+// Zone is an immutable set of records indexed by owner name
+type Zone struct {
+	records map[string][]Record
+	// exists holds every owner name and its ancestors, so that empty
+	// non-terminals count as existing names (RFC 4592)
+	exists map[string]bool
+}
+
+// Parse reads records in a reduced RFC 1035 master file syntax:
+//
+//	$TTL 3600
+//	www.example.com.  300  IN  A      192.0.2.1
+//	example.com.           IN  AAAA   2001:db8::1
+//	alias.example.com.         CNAME  www.example.com.
+//	example.com.               TXT    "v=spf1 -all"
+//	example.com.  SOA  ns1.example.com. hostmaster.example.com. 1 3600 600 86400 300
+//
+// Names are absolute; the TTL and class columns are optional. Comments
+// start with a semicolon.
+func Parse(r io.Reader) (*Zone, error) {
+	z := &Zone{records: make(map[string][]Record), exists: make(map[string]bool)}
+	ttl := uint32(DefaultTTL)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := splitFields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(fields[0], "$TTL") {
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL expects one value", lineNum)
+			}
+			value, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid $TTL %q", lineNum, fields[1])
+			}
+			ttl = uint32(value)
+			continue
+		}
+
+		rec, err := parseRecord(fields, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		z.records[rec.Name] = append(z.records[rec.Name], rec)
+		for name := rec.Name; name != ""; name = parent(name) {
+			z.exists[name] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// Lookup returns the records of qtype owned by name. A CNAME at name is
+// returned for any other query type. Names that do not exist in the zone
+// are answered from the wildcard at their closest encloser (RFC 4592),
+// with the records renamed to name; exact names always take precedence.
+func (z *Zone) Lookup(name string, qtype protocol.DNSType) []Record {
+	if z == nil {
+		return nil
+	}
+
+	name = normalize(name)
+	if z.exists[name] {
+		return selectType(z.records[name], qtype)
+	}
+
+	wildcard, ok := z.wildcard(name)
+	if !ok {
+		return nil
+	}
+	records := selectType(z.records[wildcard], qtype)
+	if len(records) == 0 {
+		return nil
+	}
+	synthesized := make([]Record, len(records))
+	for i, rec := range records {
+		rec.Name = name
+		synthesized[i] = rec
+	}
+	return synthesized
+}
+
+// Exists reports whether name exists in the zone, either as an owner, an
+// empty non-terminal or through a wildcard
+func (z *Zone) Exists(name string) bool {
+	if z == nil {
+		return false
+	}
+	name = normalize(name)
+	if z.exists[name] {
+		return true
+	}
+	_, ok := z.wildcard(name)
+	return ok
+}
+
+// Owns reports whether name owns records in the zone, directly or through a
+// wildcard. Unlike Exists, names known only as ancestors of owners do not
+// count, so a zone without an SOA does not claim its parents up to the TLD.
+func (z *Zone) Owns(name string) bool {
+	if z == nil {
+		return false
+	}
+	name = normalize(name)
+	if len(z.records[name]) > 0 {
+		return true
+	}
+	if z.exists[name] {
+		return false
+	}
+	_, ok := z.wildcard(name)
+	return ok
+}
+
+// wildcard returns the wildcard owner directly below the closest encloser
+// of a name that does not exist, if the zone has one
+func (z *Zone) wildcard(name string) (string, bool) {
+	for encloser := parent(name); encloser != ""; encloser = parent(encloser) {
+		if !z.exists[encloser] {
+			continue
+		}
+		// Only the wildcard at the closest encloser applies
+		owner := "*." + encloser
+		_, ok := z.records[owner]
+		return owner, ok
+	}
+	return "", false
+}
+
+// SOA returns the SOA record of the zone containing name, found at name
+// or its closest ancestor owning one
+func (z *Zone) SOA(name string) (Record, bool) {
+	if z == nil {
+		return Record{}, false
+	}
+	for owner := normalize(name); owner != ""; owner = parent(owner) {
+		for _, rec := range z.records[owner] {
+			if rec.Type == protocol.TypeSOA {
+				return rec, true
+			}
+		}
+	}
+	return Record{}, false
+}
+
+// NegativeTTL returns the TTL for negative answers derived from an SOA
+// record: the lower of its own TTL and its MINIMUM field (RFC 2308)
+func NegativeTTL(soa Record) uint32 {
+	if len(soa.Data) < 4 {
+		return soa.TTL
+	}
+	minimum := binary.BigEndian.Uint32(soa.Data[len(soa.Data)-4:])
+	if minimum < soa.TTL {
+		return minimum
+	}
+	return soa.TTL
+}
+
+// selectType returns the records of qtype, or the CNAMEs when there are none
+func selectType(records []Record, qtype protocol.DNSType) []Record {
+	var matches, cnames []Record
+	for _, rec := range records {
+		switch {
+		case rec.Type == qtype:
+			matches = append(matches, rec)
+		case rec.Type == protocol.TypeCNAME:
+			cnames = append(cnames, rec)
+		}
+	}
+	if len(matches) == 0 {
+		return cnames
+	}
+	return matches
+}
+
+// Len returns the number of records
+func (z *Zone) Len() int {
+	if z == nil {
+		return 0
+	}
+	n := 0
+	for _, recs := range z.records {
+		n += len(recs)
+	}
+	return n
+}
+
+func parseRecord(fields []string, ttl uint32) (Record, error) {
+	rec := Record{Name: normalize(fields[0]), TTL: ttl}
+	rest := fields[1:]
+
+	if len(rest) > 0 {
+		if value, err := strconv.ParseUint(rest[0], 10, 32); err == nil {
+			rec.TTL = uint32(value)
+			rest = rest[1:]
+		}
+	}
+	if len(rest) > 0 && strings.EqualFold(rest[0], "IN") {
+		rest = rest[1:]
+	}
+	if len(rest) < 2 {
+		return Record{}, fmt.Errorf("expected type and data for %s", fields[0])
+	}
+
+	typeName, data := strings.ToUpper(rest[0]), rest[1:]
+	switch typeName {
+	case "A":
+		ip := net.ParseIP(data[0]).To4()
+		if ip == nil || len(data) != 1 {
+			return Record{}, fmt.Errorf("invalid A data %q", strings.Join(data, " "))
+		}
+		rec.Type, rec.Data = protocol.TypeA, ip
+	case "AAAA":
+		ip := net.ParseIP(data[0])
+		if ip == nil || ip.To4() != nil || len(data) != 1 {
+			return Record{}, fmt.Errorf("invalid AAAA data %q", strings.Join(data, " "))
+		}
+		rec.Type, rec.Data = protocol.TypeAAAA, ip.To16()
+	case "CNAME":
+		if len(data) != 1 {
+			return Record{}, fmt.Errorf("invalid CNAME data %q", strings.Join(data, " "))
+		}
+		rec.Type, rec.Data = protocol.TypeCNAME, protocol.AppendName(nil, normalize(data[0]))
+	case "SOA":
+		if len(data) != 7 {
+			return Record{}, fmt.Errorf("invalid SOA data %q", strings.Join(data, " "))
+		}
+		rec.Type = protocol.TypeSOA
+		rec.Data = protocol.AppendName(nil, normalize(data[0]))
+		rec.Data = protocol.AppendName(rec.Data, normalize(data[1]))
+		for _, field := range data[2:] {
+			value, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return Record{}, fmt.Errorf("invalid SOA value %q", field)
+			}
+			rec.Data = binary.BigEndian.AppendUint32(rec.Data, uint32(value))
+		}
+	case "TXT":
+		rec.Type = protocol.TypeTXT
+		for _, text := range data {
+			for len(text) > 255 {
+				rec.Data = append(append(rec.Data, 255), text[:255]...)
+				text = text[255:]
+			}
+			rec.Data = append(append(rec.Data, byte(len(text))), text...)
+		}
+	default:
+		return Record{}, fmt.Errorf("unsupported record type %s", rest[0])
+	}
+
+	return rec, nil
+}
+
+// splitFields splits a zone line into fields, dropping comments and keeping
+// quoted strings together without their quotes
+func splitFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes, inField := false, false
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inField = true
+		case inQuotes:
+			current.WriteRune(c)
+		case c == ';':
+			return appendField(fields, &current, inField)
+		case c == ' ' || c == '\t':
+			fields = appendField(fields, &current, inField)
+			inField = false
+		default:
+			current.WriteRune(c)
+			inField = true
+		}
+	}
+	return appendField(fields, &current, inField)
+}
+
+func appendField(fields []string, current *strings.Builder, inField bool) []string {
+	if inField {
+		fields = append(fields, current.String())
+	}
+	current.Reset()
+	return fields
+}
+
+// parent strips the first label of name, returning "" for a single label
+func parent(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
@@ -0,0 +1,183 @@
+package zone
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+const testZone = `
+; test zone
+$TTL 600
+www.example.com.    300 IN A     192.0.2.1
+www.example.com.        IN A     192.0.2.2
+example.com.               AAAA  2001:db8::1
+alias.example.com.         CNAME www.example.com.
+example.com.               TXT   "v=spf1 -all" ; trailing comment
+`
+
+func TestParseAndLookup(t *testing.T) {
+	z, err := Parse(strings.NewReader(testZone))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if z.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", z.Len())
+	}
+
+	a := z.Lookup("WWW.example.com.", protocol.TypeA)
+	if len(a) != 2 {
+		t.Fatalf("Lookup(A) = %d records, want 2", len(a))
+	}
+	if a[0].TTL != 300 || a[1].TTL != 600 {
+		t.Errorf("TTLs = %d, %d, want 300, 600", a[0].TTL, a[1].TTL)
+	}
+	if !net.IP(a[0].Data).Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("A data = %v", net.IP(a[0].Data))
+	}
+
+	if aaaa := z.Lookup("example.com", protocol.TypeAAAA); len(aaaa) != 1 || len(aaaa[0].Data) != 16 {
+		t.Errorf("Lookup(AAAA) = %+v", aaaa)
+	}
+
+	txt := z.Lookup("example.com", protocol.TypeTXT)
+	if len(txt) != 1 || string(txt[0].Data) != "\x0bv=spf1 -all" {
+		t.Errorf("Lookup(TXT) = %+v", txt)
+	}
+
+	cname := z.Lookup("alias.example.com", protocol.TypeA)
+	if len(cname) != 1 || cname[0].Type != protocol.TypeCNAME {
+		t.Errorf("Lookup(alias, A) = %+v, want CNAME", cname)
+	}
+
+	if got := z.Lookup("missing.example.com", protocol.TypeA); got != nil {
+		t.Errorf("Lookup(missing) = %+v, want nil", got)
+	}
+}
+
+func TestOwns(t *testing.T) {
+	z, err := Parse(strings.NewReader("*.wild.example.     A 192.0.2.99\nhost.sub.example.com. A 192.0.2.5\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"host.sub.example.com", true},
+		{"a.wild.example", true},
+		{"sub.example.com", false},
+		{"example.com", false},
+		{"com", false},
+		{"example.org", false},
+	}
+	for _, tt := range tests {
+		if got := z.Owns(tt.name); got != tt.want {
+			t.Errorf("Owns(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWildcardLookup(t *testing.T) {
+	const wildcardZone = `
+*.example.com.             A     192.0.2.99
+*.example.com.             TXT   "wild"
+www.example.com.           A     192.0.2.1
+mail.example.com.          TXT   "exact only"
+host.sub.example.com.      A     192.0.2.5
+`
+	z, err := Parse(strings.NewReader(wildcardZone))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype protocol.DNSType
+		want  string // A address, "" for no records
+	}{
+		{"exact name", "www.example.com", protocol.TypeA, "192.0.2.1"},
+		{"matched by wildcard", "anything.example.com", protocol.TypeA, "192.0.2.99"},
+		{"deeper name matched by wildcard", "a.b.example.com", protocol.TypeA, "192.0.2.99"},
+		{"exact name shadows wildcard", "mail.example.com", protocol.TypeA, ""},
+		{"empty non-terminal shadows wildcard", "sub.example.com", protocol.TypeA, ""},
+		{"closest encloser without wildcard", "other.sub.example.com", protocol.TypeA, ""},
+		{"outside the zone", "example.org", protocol.TypeA, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := z.Lookup(tt.qname, tt.qtype)
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("Lookup(%s) = %+v, want no records", tt.qname, got)
+				}
+				return
+			}
+			if len(got) != 1 || !net.IP(got[0].Data).Equal(net.ParseIP(tt.want)) {
+				t.Fatalf("Lookup(%s) = %+v, want %s", tt.qname, got, tt.want)
+			}
+			if got[0].Name != tt.qname {
+				t.Errorf("record name = %q, want synthesized %q", got[0].Name, tt.qname)
+			}
+		})
+	}
+}
+
+func TestSOA(t *testing.T) {
+	const soaZone = `
+example.com.  7200  SOA  ns1.example.com. hostmaster.example.com. 2024010101 3600 600 86400 300
+www.example.com.    A    192.0.2.1
+`
+	z, err := Parse(strings.NewReader(soaZone))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	soa := z.Lookup("example.com", protocol.TypeSOA)
+	if len(soa) != 1 {
+		t.Fatalf("Lookup(SOA) = %+v, want one record", soa)
+	}
+	mname, next, err := protocol.ReadName(soa[0].Data, 0)
+	if err != nil || mname != "ns1.example.com" {
+		t.Errorf("MNAME = %q, %v, want ns1.example.com", mname, err)
+	}
+	if rname, _, _ := protocol.ReadName(soa[0].Data, next); rname != "hostmaster.example.com" {
+		t.Errorf("RNAME = %q, want hostmaster.example.com", rname)
+	}
+
+	for _, name := range []string{"example.com", "www.example.com", "missing.example.com"} {
+		if got, ok := z.SOA(name); !ok || got.Name != "example.com" {
+			t.Errorf("SOA(%s) = %+v, %v, want the apex SOA", name, got, ok)
+		}
+	}
+	if _, ok := z.SOA("example.org"); ok {
+		t.Error("SOA(example.org) found, want none outside the zone")
+	}
+
+	if ttl := NegativeTTL(soa[0]); ttl != 300 {
+		t.Errorf("NegativeTTL() = %d, want MINIMUM 300", ttl)
+	}
+	soa[0].TTL = 60
+	if ttl := NegativeTTL(soa[0]); ttl != 60 {
+		t.Errorf("NegativeTTL() = %d, want SOA TTL 60", ttl)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"www.example.com. A 300.1.1.1",
+		"www.example.com. AAAA 192.0.2.1",
+		"www.example.com. MX 10 mail.example.com.",
+		"www.example.com. A",
+		"$TTL soon",
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", input)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package dns_typo_checker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+// dohCheck returns a DNS check that asks the DNS over HTTPS endpoint at
+// url for the NS records of a domain until ctx is done, like checkDNS does
+// through the system resolver
+func dohCheck(url string) DNSCheck {
+	// The lookup timeout comes with ctx, so the client sets none of its own
+	resolver := protocol.NewDoHResolver(url, 0)
+	return func(ctx context.Context, domain string) (bool, error) {
+		response, err := dohQuery(ctx, resolver, domain, protocol.TypeNS)
+		if err != nil {
+			return false, err
+		}
+		switch rcode := protocol.RCode(response[3] & 0x0F); rcode {
+		case protocol.RCodeNoError:
+		case protocol.RCodeNXDomain:
+			return false, nil
+		default:
+			return false, fmt.Errorf("DoH lookup of %s answered %v", domain, rcode)
+		}
+		n, err := protocol.CountAnswers(response, protocol.TypeNS)
+		return n > 0, err
+	}
+}
+
+// dohRecords returns a record lookup that asks the DNS over HTTPS
+// endpoint at url, like lookupRecords does through the system resolver
+func dohRecords(url string) RecordLookup {
+	resolver := protocol.NewDoHResolver(url, 0)
+	return func(ctx context.Context, domain string) Records {
+		var r Records
+		if response, err := dohQuery(ctx, resolver, domain, protocol.TypeNS); err == nil {
+			r.NS = answerHosts(response, protocol.TypeNS, 0)
+		}
+		if response, err := dohQuery(ctx, resolver, domain, protocol.TypeMX); err == nil {
+			// MX data starts with the 2 byte preference
+			r.MX = answerHosts(response, protocol.TypeMX, 2)
+		}
+		return r
+	}
+}
+
+// dohQuery asks resolver for the records of domain of type qtype until ctx
+// is done
+func dohQuery(ctx context.Context, resolver *protocol.DoHResolver, domain string, qtype protocol.DNSType) ([]byte, error) {
+	// RFC 8484 recommends ID 0 so that HTTP caches can share answers
+	query := []byte{0, 0, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	query = protocol.AppendName(query, domain)
+	query = append(query, byte(qtype>>8), byte(qtype), 0, 1)
+	return resolver.ResolveContext(ctx, query)
+}
+
+// answerHosts returns the host names in the answers of type rrType, which
+// follow skip bytes of their data. They end in a dot like the names the
+// system resolver returns.
+func answerHosts(response []byte, rrType protocol.DNSType, skip int) []string {
+	msg, err := protocol.Unmarshal(response)
+	if err != nil {
+		return nil
+	}
+	var hosts []string
+	for _, rec := range msg.Answers {
+		if rec.Type != rrType || len(rec.Data) <= skip {
+			continue
+		}
+		if host, _, err := protocol.ReadName(rec.Data, skip); err == nil {
+			hosts = append(hosts, host+".")
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,117 @@
+package dns_typo_checker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exiguus/ns-checker/dns_listener/protocol"
+)
+
+func TestDoHCheck(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+	CheckDNS = stubDNS(func(domain string) bool {
+		t.Errorf("CheckDNS(%s) called with a DoH endpoint set", domain)
+		return false
+	})
+	Whois = &mockWhois{}
+
+	// brand.net is registered, every other name is NXDOMAIN
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		q, err := protocol.ReadQuestion(query)
+		if err != nil || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad DoH request", http.StatusBadRequest)
+			return
+		}
+		b := protocol.NewResponseBuilder(query, protocol.ResponseOptions{RecursionAvailable: true})
+		if q.Name == "brand.net" && q.Type == protocol.TypeNS {
+			b.AddAnswer(b.Question(), protocol.TypeNS, protocol.ClassIN, 300, protocol.AppendName(nil, "ns1.parked.example"))
+		} else {
+			b.SetRCode(protocol.RCodeNXDomain)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b.Bytes())
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	summaries := RunWithOptions([]string{"brand.com"}, []string{"net"}, Options{OutputDir: tmpDir, DoHURL: server.URL})
+	if len(summaries) != 1 || summaries[0].Resolved != 1 {
+		t.Errorf("summaries = %+v, want one resolved typo", summaries)
+	}
+
+	details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Valid DNS found for typo: brand.net [tld]\n") {
+		t.Errorf("brand.net is not reported as registered:\n%s", data)
+	}
+}
+
+func TestDoHCheckHonoursContext(t *testing.T) {
+	// The endpoint never answers before the client gives up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := dohCheck(server.URL)(ctx, "brand.net")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("dohCheck() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dohCheck() took %v, want it to stop with ctx", elapsed)
+	}
+}
+
+func TestDoHRecords(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		b := protocol.NewResponseBuilder(query, protocol.ResponseOptions{RecursionAvailable: true})
+		switch q, _ := protocol.ReadQuestion(query); q.Type {
+		case protocol.TypeNS:
+			b.AddAnswer(b.Question(), protocol.TypeNS, protocol.ClassIN, 300, protocol.AppendName(nil, "ns1.parked.example"))
+		case protocol.TypeMX:
+			b.AddAnswer(b.Question(), protocol.TypeMX, protocol.ClassIN, 300, protocol.AppendName([]byte{0, 10}, "mx.parked.example"))
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b.Bytes())
+	}))
+	defer server.Close()
+
+	lookup := dohRecords(server.URL)
+	want := Records{NS: []string{"ns1.parked.example."}, MX: []string{"mx.parked.example."}}
+	if got := lookup(context.Background(), "brand.net"); !reflect.DeepEqual(got, want) {
+		t.Errorf("dohRecords() = %+v, want %+v", got, want)
+	}
+
+	// A cancelled lookup finds nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := lookup(ctx, "brand.net"); len(got.NS) != 0 || len(got.MX) != 0 {
+		t.Errorf("dohRecords() with a cancelled context = %+v, want no records", got)
+	}
+}
@@ -0,0 +1,235 @@
+package dns_typo_checker
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// referenceCandidates is GenerateCandidates as it was before the
+// allocation work, kept to check that the output did not change
+func referenceCandidates(domain string, commonTLDs []string) []Candidate {
+	name, tld, ok := strings.Cut(domain, ".")
+	if !ok {
+		return nil
+	}
+	domain = strings.ToLower(domain)
+
+	generate := map[string]func() []string{
+		"omission": func() []string {
+			var typos []string
+			for i := 0; i < len(name); i++ {
+				typos = append(typos, name[:i]+name[i+1:]+"."+tld)
+			}
+			return typos
+		},
+		"transposition": func() []string {
+			var typos []string
+			for i := 0; i < len(name)-1; i++ {
+				swapped := name[:i] + string(name[i+1]) + string(name[i]) + name[i+2:]
+				typos = append(typos, swapped+"."+tld)
+			}
+			return typos
+		},
+		"tld": func() []string {
+			var typos []string
+			for _, typoTLD := range commonTLDs {
+				if typoTLD != tld {
+					typos = append(typos, name+"."+typoTLD)
+				}
+			}
+			return typos
+		},
+		"homoglyph": func() []string {
+			return homoglyphs(name, tld, commonTLDs)
+		},
+		"keyboard": func() []string {
+			return keyboardAdjacent(name, tld, commonTLDs)
+		},
+		"insertion": func() []string {
+			return insertChar(name, tld, commonTLDs)
+		},
+		"repetition": func() []string {
+			return doubleChar(name, tld, commonTLDs)
+		},
+	}
+
+	var candidates []Candidate
+	index := make(map[string]int)
+	for _, strategy := range []string{"omission", "transposition", "tld", "homoglyph", "keyboard", "insertion", "repetition"} {
+		for _, typo := range generate[strategy]() {
+			typo = strings.ToLower(typo)
+			if typo == domain {
+				continue
+			}
+			i, seen := index[typo]
+			if !seen {
+				index[typo] = len(candidates)
+				candidates = append(candidates, Candidate{Domain: typo, Strategies: []string{strategy}})
+				continue
+			}
+			if !slices.Contains(candidates[i].Strategies, strategy) {
+				candidates[i].Strategies = append(candidates[i].Strategies, strategy)
+			}
+		}
+	}
+	return candidates
+}
+
+var generateInputs = []struct {
+	domain string
+	tlds   []string
+}{
+	{"example.com", []string{"com", "net", "org"}},
+	{"google.com", []string{"com", "net", "org", "ne", "co", "cm", "om", "de"}},
+	{"MixedCase.Example.ORG", []string{"org", "Net", "net"}},
+	{"a.io", []string{"io", "com"}},
+	{"internationalization-services.co.uk", []string{"com", "net", "org", "ne", "co", "cm", "om", "de"}},
+	{"nodot", []string{"com"}},
+}
+
+func TestGenerateCandidatesMatchesReference(t *testing.T) {
+	for _, in := range generateInputs {
+		got := GenerateCandidates(in.domain, in.tlds)
+		want := referenceCandidates(in.domain, in.tlds)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GenerateCandidates(%q) =\n%v\nwant\n%v", in.domain, got, want)
+		}
+	}
+}
+
+func BenchmarkGenerateCandidates(b *testing.B) {
+	domain := "internationalization-services.co.uk"
+	tlds := []string{"com", "net", "org", "ne", "co", "cm", "om", "de"}
+	b.Run("reference", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			referenceCandidates(domain, tlds)
+		}
+	})
+	b.Run("current", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GenerateCandidates(domain, tlds)
+		}
+	})
+}
+
+func TestPunycode(t *testing.T) {
+	tests := map[string]string{
+		"münchen": "mnchen-3ya",
+		"bücher":  "bcher-kva",
+		"пример":  "e1afmkfd",
+		"例え":      "r8jz45g",
+	}
+	for in, want := range tests {
+		if got := punycode(in); got != want {
+			t.Errorf("punycode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHomoglyphs(t *testing.T) {
+	typos := homoglyphs("Microsoft", "com", nil)
+	for _, want := range []string{"rnicrosoft.com", "micr0soft.com", "m1crosoft.com", "xn--micrsoft-qbh.com"} {
+		if !slices.Contains(typos, want) {
+			t.Errorf("homoglyphs(Microsoft) missing %s in %v", want, typos)
+		}
+	}
+	if got := homoglyphs("modern", "com", nil); !slices.Contains(got, "modem.com") {
+		t.Errorf("homoglyphs(modern) missing modem.com in %v", got)
+	}
+
+	// Multi-byte input is replaced on rune boundaries and encoded
+	for _, typo := range homoglyphs("bücher", "de", nil) {
+		if !strings.HasPrefix(typo, acePrefix) || typo == "xn--bcher-kva.de" {
+			t.Errorf("homoglyphs(bücher) = %s, want a punycode variant", typo)
+		}
+	}
+
+	if got := homoglyphs("xn--bcher-kva", "de", nil); len(got) != 0 {
+		t.Errorf("homoglyphs of a punycode name = %v, want none", got)
+	}
+
+	// Entries mapping to themselves never yield the original domain
+	defer func(table map[string][]string) { Homoglyphs = table }(Homoglyphs)
+	Homoglyphs = map[string][]string{"a": {"a", "4"}}
+	got := homoglyphs("aa", "com", nil)
+	if want := []string{"4a.com", "a4.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("homoglyphs(aa) = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateCandidatesHomoglyph(t *testing.T) {
+	for _, c := range GenerateCandidates("paypal.com", []string{"com"}) {
+		if c.Domain == "xn--pypal-4ve.com" {
+			if !slices.Contains(c.Strategies, "homoglyph") {
+				t.Errorf("%s strategies = %v, want homoglyph", c.Domain, c.Strategies)
+			}
+			return
+		}
+	}
+	t.Error("GenerateCandidates(paypal.com) missing xn--pypal-4ve.com")
+}
+
+func TestStrategyFuncs(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate func(name, tld string, commonTLDs []string) []string
+		in       string
+		want     []string
+	}{
+		{"omitChar", omitChar, "abc", []string{"bc.com", "ac.com", "ab.com"}},
+		{"swapAdjacent", swapAdjacent, "abc", []string{"bac.com", "acb.com"}},
+		{"tldSwap", tldSwap, "abc", []string{"abc.net", "abc.org"}},
+		{"keyboardAdjacent", keyboardAdjacent, "pl", []string{"ll.com", "ol.com", "0l.com", "pk.com", "po.com", "pp.com"}},
+		{"keyboardAdjacent without neighbours", keyboardAdjacent, "a-", []string{"q-.com", "w-.com", "s-.com", "z-.com"}},
+		{"insertChar", insertChar, "l", []string{"kl.com", "lk.com", "ol.com", "lo.com", "pl.com", "lp.com"}},
+		{"doubleChar", doubleChar, "ab", []string{"aab.com", "abb.com"}},
+		{"doubleChar multi-byte", doubleChar, "üb", []string{"üüb.com", "übb.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.generate(tt.in, "com", []string{"com", "net", "org"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s(%q) = %v, want %v", tt.name, tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectStrategies(t *testing.T) {
+	all, err := SelectStrategies(nil)
+	if err != nil || len(all) != len(Strategies) {
+		t.Errorf("SelectStrategies(nil) = %d strategies, %v, want all %d", len(all), err, len(Strategies))
+	}
+
+	selected, err := SelectStrategies([]string{"tld", "omission"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range selected {
+		names = append(names, s.Name)
+	}
+	if want := []string{"omission", "tld"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("SelectStrategies(tld, omission) = %v, want %v", names, want)
+	}
+
+	if _, err := SelectStrategies([]string{"omission", "bitsquatting"}); err == nil || !strings.Contains(err.Error(), `"bitsquatting"`) {
+		t.Errorf("SelectStrategies(bitsquatting) error = %v, want unknown strategy", err)
+	}
+}
+
+func TestRunStrategiesOption(t *testing.T) {
+	tmpDir := t.TempDir()
+	summaries := RunWithOptions([]string{"dry.test"}, []string{"net", "org"}, Options{OutputDir: tmpDir, DryRun: true, Strategies: []string{"tld"}})
+	if len(summaries) != 1 || summaries[0].Typos != 2 {
+		t.Errorf("summaries = %+v, want the 2 TLD typos", summaries)
+	}
+
+	if summaries := RunWithOptions([]string{"dry.test"}, nil, Options{OutputDir: tmpDir, DryRun: true, Strategies: []string{"fat-finger"}}); summaries != nil {
+		t.Errorf("unknown strategy ran with summaries %+v", summaries)
+	}
+}
@@ -0,0 +1,167 @@
+package dns_typo_checker
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Homoglyphs maps a character sequence to look-alikes that may replace it.
+// Keys and replacements may be any length, so "rn" can stand in for "m".
+// It is a variable so callers can extend it before a run.
+var Homoglyphs = map[string][]string{
+	"a":  {"а"}, // Cyrillic
+	"c":  {"с"}, // Cyrillic
+	"d":  {"cl"},
+	"e":  {"е"}, // Cyrillic
+	"i":  {"і", "1", "l"},
+	"l":  {"1", "i"},
+	"m":  {"rn"},
+	"o":  {"о", "0"}, // Cyrillic, zero
+	"p":  {"р"},      // Cyrillic
+	"rn": {"m"},
+	"s":  {"ѕ"}, // Cyrillic
+	"vv": {"w"},
+	"w":  {"vv"},
+	"x":  {"х"}, // Cyrillic
+	"y":  {"у"}, // Cyrillic
+	"0":  {"o"},
+	"1":  {"l"},
+}
+
+// homoglyphs replaces one sequence of name with each of its look-alikes.
+// Names with characters outside ASCII are returned in punycode, as they
+// are looked up in DNS. Names already in punycode are left alone.
+func homoglyphs(name, tld string, _ []string) []string {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, acePrefix) {
+		return nil
+	}
+
+	keys := make([]string, 0, len(Homoglyphs))
+	for key := range Homoglyphs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var typos []string
+	for i := range name { // i steps over whole runes
+		for _, key := range keys {
+			if key == "" || !strings.HasPrefix(name[i:], key) {
+				continue
+			}
+			for _, glyph := range Homoglyphs[key] {
+				if glyph == key {
+					continue
+				}
+				typos = append(typos, toASCII(name[:i]+glyph+name[i+len(key):])+"."+tld)
+			}
+		}
+	}
+	return typos
+}
+
+// acePrefix marks a punycode encoded label
+const acePrefix = "xn--"
+
+// toASCII returns label, or its punycode form with the ACE prefix when it
+// contains characters outside ASCII
+func toASCII(label string) string {
+	for i := 0; i < len(label); i++ {
+		if label[i] >= utf8.RuneSelf {
+			return acePrefix + punycode(label)
+		}
+	}
+	return label
+}
+
+// Punycode parameters from RFC 3492
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycode encodes s as described in RFC 3492
+func punycode(s string) string {
+	runes := []rune(s)
+	out := make([]byte, 0, 2*len(runes))
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for handled := basic; handled < len(runes); {
+		// The smallest code point not handled yet
+		m := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
@@ -0,0 +1,57 @@
+package dns_typo_checker
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// qwertyAdjacent lists the keys next to each letter and digit on a QWERTY
+// keyboard
+var qwertyAdjacent = map[byte]string{
+	'1': "2q", '2': "3wq1", '3': "4ew2", '4': "5re3", '5': "6tr4",
+	'6': "7yt5", '7': "8uy6", '8': "9iu7", '9': "0oi8", '0': "po9",
+	'q': "12wa", 'w': "3esaq2", 'e': "4rdsw3", 'r': "5tfde4", 't': "6ygfr5",
+	'y': "7uhgt6", 'u': "8ijhy7", 'i': "9okju8", 'o': "0plki9", 'p': "lo0",
+	'a': "qwsz", 's': "edxzaw", 'd': "rfcxse", 'f': "tgvcdr", 'g': "yhbvft",
+	'h': "ujnbgy", 'j': "ikmnhu", 'k': "olmji", 'l': "kop",
+	'z': "asx", 'x': "zsdc", 'c': "xdfv", 'v': "cfgb", 'b': "vghn",
+	'n': "bhjm", 'm': "njk",
+}
+
+// keyboardAdjacent replaces one character of name with a key next to it
+func keyboardAdjacent(name, tld string, _ []string) []string {
+	name = strings.ToLower(name)
+	var typos []string
+	for i := 0; i < len(name); i++ {
+		for _, key := range []byte(qwertyAdjacent[name[i]]) {
+			typos = append(typos, name[:i]+string(key)+name[i+1:]+"."+tld)
+		}
+	}
+	return typos
+}
+
+// insertChar adds a key next to one character of name before or after it,
+// as when both keys are hit at once
+func insertChar(name, tld string, _ []string) []string {
+	name = strings.ToLower(name)
+	var typos []string
+	for i := 0; i < len(name); i++ {
+		for _, key := range []byte(qwertyAdjacent[name[i]]) {
+			typos = append(typos,
+				name[:i]+string(key)+name[i:]+"."+tld,
+				name[:i+1]+string(key)+name[i+1:]+"."+tld)
+		}
+	}
+	return typos
+}
+
+// doubleChar repeats one character of name
+func doubleChar(name, tld string, _ []string) []string {
+	typos := make([]string, 0, utf8.RuneCountInString(name))
+	for i := 0; i < len(name); {
+		_, size := utf8.DecodeRuneInString(name[i:])
+		typos = append(typos, name[:i+size]+name[i:]+"."+tld)
+		i += size
+	}
+	return typos
+}
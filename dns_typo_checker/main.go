@@ -1,73 +1,535 @@
 package dns_typo_checker
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 )
 
-// GenerateTypoDomains creates a list of typo variations for a domain
-func GenerateTypoDomains(domain string, commonTLDs []string) []string {
-	typos := []string{}
-	domainParts := strings.Split(domain, ".")
-	if len(domainParts) < 2 {
-		return typos
+// DefaultFilePattern names the result files. {date} is the run date,
+// {run} is "_" followed by the run ID when one is set and {kind} is
+// "details", "not_registered" or, for a dry run, "candidates".
+const DefaultFilePattern = "{date}{run}_dns_typo_checker_{kind}.log"
+
+// DefaultWhoisTimeout bounds a single whois lookup
+const DefaultWhoisTimeout = 10 * time.Second
+
+// DefaultLookupTimeout bounds a single NS lookup
+const DefaultLookupTimeout = 3 * time.Second
+
+// DefaultLookupWorkers is the number of typos of a domain looked up at once
+// when TYPO_LOOKUP_WORKERS is not set
+const DefaultLookupWorkers = 20
+
+// ErrWhoisTimeout is returned when a whois lookup runs past its timeout
+var ErrWhoisTimeout = errors.New("whois timed out")
+
+// Options tunes a typo check run
+type Options struct {
+	// MaxDomains caps the number of target domains checked per run; zero
+	// checks them all
+	MaxDomains int
+	// OutputDir receives the result files; empty uses LOG_PATH or ./logs
+	OutputDir string
+	// FilePattern names the result files; empty uses DefaultFilePattern
+	FilePattern string
+	// RunID distinguishes the files of separate runs on the same day
+	RunID string
+	// WhoisTimeout bounds each whois lookup; zero uses DefaultWhoisTimeout
+	WhoisTimeout time.Duration
+	// LookupTimeout bounds each NS lookup; zero uses DefaultLookupTimeout
+	LookupTimeout time.Duration
+	// RequireWhois aborts the run when the whois command is not installed
+	// instead of skipping the WHOIS lookups
+	RequireWhois bool
+	// Parallel is the number of target domains checked at once; zero
+	// checks one at a time
+	Parallel int
+	// LookupWorkers is the number of typos of a domain looked up in DNS at
+	// once; zero looks them up one at a time. Results are still reported
+	// in candidate order.
+	LookupWorkers int
+	// DNSConcurrency and WhoisConcurrency cap the lookups running at once
+	// across all targets; zero leaves them uncapped
+	DNSConcurrency   int
+	WhoisConcurrency int
+	// Strategies names the typo strategies to apply; empty applies all of
+	// Strategies
+	Strategies []string
+	// PriorityTLDs are checked first when substituting the TLD and their
+	// registered matches are tagged in the output
+	PriorityTLDs []string
+	// WebhookURL receives each registered typo as a JSON POST; empty
+	// disables it
+	WebhookURL string
+	// DryRun writes the typo candidates of each domain to a "candidates"
+	// result file without any DNS or WHOIS lookups
+	DryRun bool
+	// DoHURL sends the DNS lookups to this DNS over HTTPS endpoint instead
+	// of the system resolver
+	DoHURL string
+	// Format adds a results file in FormatJSON or FormatCSV to the text
+	// logs; empty or FormatText writes only the text logs
+	Format string
+	// Stats, when set, collects the run's counters so they can be read
+	// during and after the run
+	Stats *Stats
+}
+
+// OptionsFromEnv reads run options from the environment: TYPO_MAX_DOMAINS,
+// TYPO_OUTPUT_DIR (falling back to LOG_PATH), TYPO_FILE_PATTERN,
+// TYPO_RUN_ID, TYPO_WHOIS_TIMEOUT, TYPO_LOOKUP_TIMEOUT,
+// TYPO_REQUIRE_WHOIS, TYPO_PARALLEL,
+// TYPO_LOOKUP_WORKERS (default DefaultLookupWorkers), TYPO_DNS_CONCURRENCY,
+// TYPO_WHOIS_CONCURRENCY, TYPO_STRATEGIES, TYPO_PRIORITY_TLDS, TYPO_WEBHOOK_URL,
+// TYPO_DRY_RUN, TYPO_DOH_URL and TYPO_FORMAT.
+func OptionsFromEnv() Options {
+	opts := Options{
+		OutputDir:     os.Getenv("TYPO_OUTPUT_DIR"),
+		FilePattern:   os.Getenv("TYPO_FILE_PATTERN"),
+		RunID:         os.Getenv("TYPO_RUN_ID"),
+		RequireWhois:  os.Getenv("TYPO_REQUIRE_WHOIS") == "true",
+		WebhookURL:    os.Getenv("TYPO_WEBHOOK_URL"),
+		DryRun:        os.Getenv("TYPO_DRY_RUN") == "true",
+		DoHURL:        os.Getenv("TYPO_DOH_URL"),
+		Format:        os.Getenv("TYPO_FORMAT"),
+		LookupWorkers: DefaultLookupWorkers,
 	}
+	for env, value := range map[string]*int{
+		"TYPO_MAX_DOMAINS":       &opts.MaxDomains,
+		"TYPO_PARALLEL":          &opts.Parallel,
+		"TYPO_LOOKUP_WORKERS":    &opts.LookupWorkers,
+		"TYPO_DNS_CONCURRENCY":   &opts.DNSConcurrency,
+		"TYPO_WHOIS_CONCURRENCY": &opts.WhoisConcurrency,
+	} {
+		if n, err := strconv.Atoi(os.Getenv(env)); err == nil && n > 0 {
+			*value = n
+		}
+	}
+	opts.Strategies = splitList(os.Getenv("TYPO_STRATEGIES"))
+	opts.PriorityTLDs = splitList(os.Getenv("TYPO_PRIORITY_TLDS"))
+	if timeout, err := time.ParseDuration(os.Getenv("TYPO_WHOIS_TIMEOUT")); err == nil && timeout > 0 {
+		opts.WhoisTimeout = timeout
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("TYPO_LOOKUP_TIMEOUT")); err == nil && timeout > 0 {
+		opts.LookupTimeout = timeout
+	}
+	return opts
+}
+
+// splitList splits a comma separated list, dropping blank entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (o Options) whoisTimeout() time.Duration {
+	if o.WhoisTimeout > 0 {
+		return o.WhoisTimeout
+	}
+	return DefaultWhoisTimeout
+}
+
+func (o Options) lookupTimeout() time.Duration {
+	if o.LookupTimeout > 0 {
+		return o.LookupTimeout
+	}
+	return DefaultLookupTimeout
+}
+
+// outputPath returns the path of the kind result file for a run on date
+func (o Options) outputPath(date, kind string) string {
+	dir := o.OutputDir
+	if dir == "" {
+		dir = os.Getenv("LOG_PATH")
+	}
+	if dir == "" {
+		dir = "./logs"
+	}
+	pattern := o.FilePattern
+	if pattern == "" {
+		pattern = DefaultFilePattern
+	}
+	run := ""
+	if o.RunID != "" {
+		run = "_" + o.RunID
+	}
+	name := strings.NewReplacer("{date}", date, "{run}", run, "{kind}", kind).Replace(pattern)
+	return filepath.Join(dir, name)
+}
+
+// selectDomains trims domains, drops blank entries and keeps at most max
+// of the rest. A max of zero keeps all. It also returns how many non-blank
+// domains there were.
+func selectDomains(domains []string, max int) ([]string, int) {
+	selected := make([]string, 0, len(domains))
+	total := 0
+	for _, domain := range domains {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		total++
+		if max == 0 || len(selected) < max {
+			selected = append(selected, domain)
+		}
+	}
+	return selected, total
+}
+
+// Strategy generates typos of a domain split into its first label and the
+// rest
+type Strategy struct {
+	Name     string
+	Generate func(name, tld string, commonTLDs []string) []string
+}
+
+// Strategies are the typo strategies applied by GenerateCandidates
+var Strategies = []Strategy{
+	{Name: "omission", Generate: omitChar},
+	{Name: "transposition", Generate: swapAdjacent},
+	{Name: "tld", Generate: tldSwap},
+	{Name: "homoglyph", Generate: homoglyphs},
+	{Name: "keyboard", Generate: keyboardAdjacent},
+	{Name: "insertion", Generate: insertChar},
+	{Name: "repetition", Generate: doubleChar},
+}
 
-	name := domainParts[0]
-	tld := strings.Join(domainParts[1:], ".")
+// SelectStrategies returns the Strategies named in names, in the order of
+// Strategies. No names selects them all.
+func SelectStrategies(names []string) ([]Strategy, error) {
+	if len(names) == 0 {
+		return Strategies, nil
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(Strategies, func(s Strategy) bool { return s.Name == name }) {
+			known := make([]string, 0, len(Strategies))
+			for _, s := range Strategies {
+				known = append(known, s.Name)
+			}
+			return nil, fmt.Errorf("unknown typo strategy %q, known strategies: %s", name, strings.Join(known, ", "))
+		}
+	}
+	selected := make([]Strategy, 0, len(names))
+	for _, s := range Strategies {
+		if slices.Contains(names, s.Name) {
+			selected = append(selected, s)
+		}
+	}
+	return selected, nil
+}
 
-	// Add common typos for the main domain name
+// omitChar drops one character of name
+func omitChar(name, tld string, _ []string) []string {
+	typos := make([]string, 0, len(name))
 	for i := 0; i < len(name); i++ {
-		// Omit a character
 		typos = append(typos, name[:i]+name[i+1:]+"."+tld)
+	}
+	return typos
+}
 
-		// Swap adjacent characters
-		if i < len(name)-1 {
-			swapped := name[:i] + string(name[i+1]) + string(name[i]) + name[i+2:]
-			typos = append(typos, swapped+"."+tld)
-		}
+// swapAdjacent swaps adjacent characters of name
+func swapAdjacent(name, tld string, _ []string) []string {
+	if len(name) < 2 {
+		return nil
+	}
+	typos := make([]string, 0, len(name)-1)
+	var b strings.Builder
+	for i := 0; i < len(name)-1; i++ {
+		b.Grow(len(name) + 1 + len(tld))
+		b.WriteString(name[:i])
+		b.WriteByte(name[i+1])
+		b.WriteByte(name[i])
+		b.WriteString(name[i+2:])
+		b.WriteByte('.')
+		b.WriteString(tld)
+		typos = append(typos, b.String())
+		b.Reset()
 	}
+	return typos
+}
 
-	// Add common TLD typos
+// tldSwap replaces the TLD with each of commonTLDs
+func tldSwap(name, tld string, commonTLDs []string) []string {
+	typos := make([]string, 0, len(commonTLDs))
 	for _, typoTLD := range commonTLDs {
 		if typoTLD != tld {
 			typos = append(typos, name+"."+typoTLD)
 		}
 	}
+	return typos
+}
 
+// Candidate is a typo domain with the strategies that produced it
+type Candidate struct {
+	Domain     string
+	Strategies []string
+}
+
+// GenerateCandidates applies every strategy to domain and merges the
+// results, so each typo appears once, in the order it was first produced.
+// Typos are lowercased, as DNS names are case-insensitive, and the domain
+// itself is never a candidate.
+func GenerateCandidates(domain string, commonTLDs []string) []Candidate {
+	return generateCandidates(domain, commonTLDs, Strategies)
+}
+
+// generateCandidates is GenerateCandidates with the given strategies
+func generateCandidates(domain string, commonTLDs []string, strategies []Strategy) []Candidate {
+	name, tld, ok := strings.Cut(domain, ".")
+	if !ok {
+		return nil
+	}
+	domain = strings.ToLower(domain)
+
+	// The built-in strategies yield about fifteen typos per character of
+	// name, most of them keyboard insertions, plus one per TLD
+	estimate := 15*len(name) + len(commonTLDs)
+	candidates := make([]Candidate, 0, estimate)
+	index := make(map[string]int, estimate)
+	for _, strategy := range strategies {
+		// Candidates share one single-name slice per strategy; its capacity
+		// of one makes a later append copy it
+		names := []string{strategy.Name}
+		for _, typo := range strategy.Generate(name, tld, commonTLDs) {
+			typo = strings.ToLower(typo)
+			if typo == domain {
+				continue
+			}
+			i, seen := index[typo]
+			if !seen {
+				index[typo] = len(candidates)
+				candidates = append(candidates, Candidate{Domain: typo, Strategies: names[:1:1]})
+				continue
+			}
+			if !slices.Contains(candidates[i].Strategies, strategy.Name) {
+				candidates[i].Strategies = append(candidates[i].Strategies, strategy.Name)
+			}
+		}
+	}
+	return candidates
+}
+
+// GenerateTypoDomains creates a list of typo variations for a domain
+func GenerateTypoDomains(domain string, commonTLDs []string) []string {
+	candidates := GenerateCandidates(domain, commonTLDs)
+	typos := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		typos = append(typos, candidate.Domain)
+	}
 	return typos
 }
 
+// prioritizeTypos moves the TLD substitutions of domain into one of
+// priorityTLDs to the front of candidates, keeping the order otherwise. It
+// returns how many candidates were moved.
+func prioritizeTypos(domain string, candidates []Candidate, priorityTLDs []string) ([]Candidate, int) {
+	name, _, _ := strings.Cut(domain, ".")
+	priority := make(map[string]bool, len(priorityTLDs))
+	for _, tld := range priorityTLDs {
+		priority[strings.ToLower(name+"."+tld)] = true
+	}
+
+	ordered := make([]Candidate, 0, len(candidates))
+	var rest []Candidate
+	for _, candidate := range candidates {
+		if priority[candidate.Domain] {
+			ordered = append(ordered, candidate)
+		} else {
+			rest = append(rest, candidate)
+		}
+	}
+	return append(ordered, rest...), len(ordered)
+}
+
+// withTLDs returns tlds followed by those of extra it lacks
+func withTLDs(tlds, extra []string) []string {
+	merged := append([]string(nil), tlds...)
+	for _, tld := range extra {
+		if !slices.Contains(merged, tld) {
+			merged = append(merged, tld)
+		}
+	}
+	return merged
+}
+
+// DNSCheck reports whether domain has NS records. An error means the
+// lookup itself failed, for example by timing out, and says nothing about
+// whether domain is registered.
+type DNSCheck func(ctx context.Context, domain string) (bool, error)
+
 // CheckDNS is a variable so it can be replaced in tests
-var CheckDNS = checkDNS
+var CheckDNS DNSCheck = checkDNS
 
-// checkDNS is the actual implementation
-func checkDNS(domain string) bool {
-	// Original implementation here
-	ns, err := net.LookupNS(domain)
-	return err == nil && len(ns) > 0
+// resolver dials nameservers with a timeout so that an unreachable one
+// fails the lookup instead of stalling it
+var resolver = &net.Resolver{
+	PreferGo: true,
+	Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		d := net.Dialer{Timeout: DefaultLookupTimeout}
+		return d.DialContext(ctx, network, address)
+	},
 }
 
-// GetDomainOwner uses the "whois" command to retrieve domain ownership information
-func GetDomainOwner(domain string) string {
-	cmd := exec.Command("whois", domain)
+// checkDNS looks up the NS records of domain until ctx is done
+func checkDNS(ctx context.Context, domain string) (bool, error) {
+	ns, err := resolver.LookupNS(ctx, domain)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(ns) > 0, nil
+}
+
+// WhoisClient looks up the registration data of a domain
+type WhoisClient interface {
+	Lookup(ctx context.Context, domain string) (string, error)
+	// Available returns an error when lookups cannot run at all
+	Available() error
+}
+
+// Whois is the client used for ownership lookups; like CheckDNS it is a
+// variable so it can be replaced in tests
+var Whois WhoisClient = ExecWhois{}
+
+// lookPath is a variable so it can be replaced in tests
+var lookPath = exec.LookPath
+
+// ExecWhois is the default WhoisClient. It runs the whois command.
+type ExecWhois struct {
+	Command string // program to run; empty uses "whois"
+}
+
+func (w ExecWhois) command() string {
+	if w.Command != "" {
+		return w.Command
+	}
+	return "whois"
+}
+
+// Available checks that the command is installed
+func (w ExecWhois) Available() error {
+	_, err := lookPath(w.command())
+	return err
+}
+
+// Lookup runs the command for domain until ctx is done. The command gets
+// its own process group so that on expiry any helpers it started are
+// killed along with it.
+func (w ExecWhois) Lookup(ctx context.Context, domain string) (string, error) {
+	cmd := exec.CommandContext(ctx, w.command(), domain)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 2 * time.Second
 	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", ErrWhoisTimeout
+	}
+	return string(output), err
+}
+
+// lookupOwner runs Whois for domain, giving up after timeout or when ctx
+// is done
+func lookupOwner(ctx context.Context, domain string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return Whois.Lookup(ctx, domain)
+}
+
+// GetDomainOwner retrieves domain ownership information through Whois
+func GetDomainOwner(domain string) string {
+	owner, err := lookupOwner(context.Background(), domain, DefaultWhoisTimeout)
 	if err != nil {
 		return fmt.Sprintf("Error retrieving WHOIS data for %s: %v", domain, err)
 	}
-	return string(output)
+	return owner
+}
+
+// DomainSummary aggregates the results for one target domain
+type DomainSummary struct {
+	Domain    string
+	Typos     int  // typo variants generated
+	Resolved  int  // variants with NS records
+	WithWhois int  // resolved variants with WHOIS data
+	Failed    int  // variants whose lookup failed or timed out
+	Partial   bool // the run was cancelled before all variants were checked
+}
+
+// writeSummary writes a table of summaries, most resolved lookalikes
+// first, followed by the totals
+func writeSummary(w io.Writer, summaries []DomainSummary) {
+	sorted := make([]DomainSummary, len(summaries))
+	copy(sorted, summaries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Resolved > sorted[j].Resolved
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Domain\tTypos\tResolved\tWHOIS\tFailed\t")
+	var total DomainSummary
+	for _, s := range sorted {
+		domain := s.Domain
+		if s.Partial {
+			domain += " (partial)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t\n", domain, s.Typos, s.Resolved, s.WithWhois, s.Failed)
+		total.Typos += s.Typos
+		total.Resolved += s.Resolved
+		total.WithWhois += s.WithWhois
+		total.Failed += s.Failed
+	}
+	fmt.Fprintf(tw, "Total\t%d\t%d\t%d\t%d\t\n", total.Typos, total.Resolved, total.WithWhois, total.Failed)
+	tw.Flush()
 }
 
+// Run checks domains for registered typo variants using options from the
+// environment. An interrupt stops the run early with partial results.
 func Run(domains []string, commonTLDs []string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	RunContext(ctx, domains, commonTLDs, OptionsFromEnv())
+}
+
+// RunWithOptions is Run with explicit options. It returns a summary per
+// checked domain.
+func RunWithOptions(domains []string, commonTLDs []string, opts Options) []DomainSummary {
+	return RunContext(context.Background(), domains, commonTLDs, opts)
+}
 
+// RunContext is RunWithOptions that stops when ctx is done. The typo being
+// checked is finished, the remaining ones are skipped and the result files
+// are completed with the summary of what was checked, marked partial.
+func RunContext(ctx context.Context, domains []string, commonTLDs []string, opts Options) []DomainSummary {
+	domains, total := selectDomains(domains, opts.MaxDomains)
 	if len(domains) == 0 {
 		fmt.Println("No domains provided for typo check")
-		return
+		return nil
+	}
+	if len(domains) < total {
+		fmt.Printf("Checking the first %d of %d domains (TYPO_MAX_DOMAINS)\n", len(domains), total)
 	}
 
 	if len(commonTLDs) == 0 {
@@ -75,61 +537,137 @@ func Run(domains []string, commonTLDs []string) {
 		commonTLDs = []string{"com", "net", "org", "ne", "co", "cm", "om", "de"}
 	}
 
-	// Use LOG_PATH environment variable if available
-	logPath := os.Getenv("LOG_PATH")
-	if logPath == "" {
-		logPath = "./logs"
+	strategies, err := SelectStrategies(opts.Strategies)
+	if err != nil {
+		fmt.Println("Error selecting typo strategies:", err)
+		return nil
+	}
+	format, err := opts.format()
+	if err != nil {
+		fmt.Println("Error selecting the result format:", err)
+		return nil
 	}
 
-	// Ensure log directory exists
-	if err := os.MkdirAll(logPath, 0755); err != nil {
-		fmt.Println("Error creating log directory:", err)
-		return
+	if opts.DryRun {
+		return dryRun(domains, commonTLDs, strategies, opts)
+	}
+
+	// Check for whois once rather than failing on every resolved typo
+	whoisErr := Whois.Available()
+	if whoisErr != nil && opts.RequireWhois {
+		fmt.Printf("WHOIS lookups are required but not available: %v\n", whoisErr)
+		return nil
 	}
 
 	currentDate := time.Now().Format("2006-01-02")
+	detailsLogPath := opts.outputPath(currentDate, "details")
+	noDNSLogPath := opts.outputPath(currentDate, "not_registered")
+	if detailsLogPath == noDNSLogPath {
+		fmt.Println("File pattern must contain {kind} to keep the result files apart")
+		return nil
+	}
+
+	// Ensure log directories exist
+	for _, dir := range []string{filepath.Dir(detailsLogPath), filepath.Dir(noDNSLogPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error creating log directory:", err)
+			return nil
+		}
+	}
 
 	// Open detailed log file
-	detailsLogPath := filepath.Join(logPath, currentDate+"_dns_typo_checker_details.log")
 	logFile, err := os.Create(detailsLogPath)
 	if err != nil {
 		fmt.Println("Error creating log file:", err)
-		return
+		return nil
 	}
 	defer logFile.Close()
 
 	// Open No DNS log file
-	noDNSLogPath := filepath.Join(logPath, currentDate+"_dns_typo_checker_not_registered.log")
 	noDNSLogFile, err := os.Create(noDNSLogPath)
 	if err != nil {
 		fmt.Println("Error creating log file:", err)
-		return
+		return nil
 	}
 	defer noDNSLogFile.Close()
 
 	fmt.Println("Searching for DNS typos...")
 	logFile.WriteString("Starting DNS typo checks\n")
+	if whoisErr != nil {
+		warning := fmt.Sprintf("Warning: %v, skipping WHOIS lookups\n", whoisErr)
+		fmt.Print(warning)
+		logFile.WriteString(warning)
+	}
 
-	for _, domain := range domains {
-		fmt.Printf("\nChecking typos for domain: %s\n", domain)
-		logFile.WriteString(fmt.Sprintf("\nChecking typos for domain: %s\n", domain))
-		typos := GenerateTypoDomains(domain, commonTLDs)
-		for _, typo := range typos {
-			if CheckDNS(typo) {
-				result := fmt.Sprintf("Valid DNS found for typo: %s\n", typo)
-				fmt.Print(result)
-				logFile.WriteString(result)
-				ownerInfo := GetDomainOwner(typo)
-				logFile.WriteString(fmt.Sprintf("Domain owner info for %s:\n%s\n", typo, ownerInfo))
-			} else {
-				result := fmt.Sprintf("No DNS record for: %s\n", typo)
-				fmt.Print(result)
-				logFile.WriteString(result)
-				noDNSLogFile.WriteString(result)
-			}
+	summaries := make([]DomainSummary, 0, len(domains))
+	var results []TypoResult
+	c := newChecker(commonTLDs, strategies, format, opts, whoisErr)
+	c.run(ctx, domains, func(r *targetResult) {
+		fmt.Print(r.console.String())
+		logFile.WriteString(r.details.String())
+		noDNSLogFile.WriteString(r.notRegistered.String())
+		summaries = append(summaries, r.summary)
+		results = append(results, r.results...)
+	})
+	if c.hook != nil {
+		report := c.hook.close()
+		fmt.Println(report)
+		logFile.WriteString(report + "\n")
+	}
+
+	if ctx.Err() != nil {
+		notice := "DNS typo check cancelled, results are partial"
+		fmt.Println(notice)
+		logFile.WriteString(notice + "\n")
+	}
+
+	fmt.Println("\nSummary:")
+	logFile.WriteString("\nSummary:\n")
+	writeSummary(io.MultiWriter(os.Stdout, logFile), summaries)
+	fmt.Fprintf(io.MultiWriter(os.Stdout, logFile), "Lookups: %v\n", c.stats)
+
+	if format != FormatText {
+		resultsPath := opts.resultsPath(currentDate, format)
+		if err := writeResults(resultsPath, format, results); err != nil {
+			fmt.Println("Error writing results file:", err)
+		} else {
+			fmt.Printf("Results written to %s\n", resultsPath)
 		}
 	}
 
-	fmt.Println("DNS typo check completed. Results written to dns_typo_checker.log")
+	fmt.Printf("DNS typo check completed. Results written to %s\n", detailsLogPath)
 	logFile.WriteString("DNS typo check completed.\n")
+	return summaries
+}
+
+// dryRun prints the typo candidates of each domain and writes them to the
+// candidates result file. It returns summaries with only the typo counts.
+func dryRun(domains []string, commonTLDs []string, strategies []Strategy, opts Options) []DomainSummary {
+	path := opts.outputPath(time.Now().Format("2006-01-02"), "candidates")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Println("Error creating log directory:", err)
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Error creating log file:", err)
+		return nil
+	}
+	defer file.Close()
+
+	out := io.MultiWriter(os.Stdout, file)
+	fmt.Fprintln(out, "Dry run: listing typo candidates without lookups")
+	tlds := withTLDs(commonTLDs, opts.PriorityTLDs)
+	summaries := make([]DomainSummary, 0, len(domains))
+	for _, domain := range domains {
+		candidates, _ := prioritizeTypos(domain, generateCandidates(domain, tlds, strategies), opts.PriorityTLDs)
+		fmt.Fprintf(out, "\nCandidates for domain: %s\n", domain)
+		for _, candidate := range candidates {
+			fmt.Fprintf(out, "%s [%s]\n", candidate.Domain, strings.Join(candidate.Strategies, ", "))
+		}
+		summaries = append(summaries, DomainSummary{Domain: domain, Typos: len(candidates)})
+	}
+
+	fmt.Printf("Dry run completed. Candidates written to %s\n", path)
+	return summaries
 }
@@ -1,10 +1,15 @@
 package dns_typo_checker
 
 import (
+	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mockDNSFunc is used to replace the real DNS lookup in tests
@@ -30,11 +35,19 @@ var mockDNSFunc = func(domain string) bool {
 	return validDomains[domain]
 }
 
+// stubDNS adapts a plain registration check to CheckDNS; its lookups never
+// fail
+func stubDNS(registered func(domain string) bool) DNSCheck {
+	return func(_ context.Context, domain string) (bool, error) {
+		return registered(domain), nil
+	}
+}
+
 func TestMain(m *testing.M) {
 	// Save original function
 	originalCheckDNS := CheckDNS
 	// Replace with mock for tests
-	CheckDNS = mockDNSFunc
+	CheckDNS = stubDNS(mockDNSFunc)
 	// Run tests
 	code := m.Run()
 	// Restore original function
@@ -42,6 +55,32 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// mockWhois answers lookups from canned records; other domains fail
+type mockWhois struct {
+	records map[string]string
+}
+
+func (m *mockWhois) Lookup(_ context.Context, domain string) (string, error) {
+	if record, ok := m.records[domain]; ok {
+		return record, nil
+	}
+	return "", errors.New("no whois data")
+}
+
+func (m *mockWhois) Available() error { return nil }
+
+// countingWhois counts lookups while reporting the exec client's
+// availability
+type countingWhois struct {
+	ExecWhois
+	calls int
+}
+
+func (c *countingWhois) Lookup(context.Context, string) (string, error) {
+	c.calls++
+	return "", nil
+}
+
 func TestGenerateTypoDomains(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -53,7 +92,7 @@ func TestGenerateTypoDomains(t *testing.T) {
 			name:       "Simple domain",
 			domain:     "example.com",
 			commonTLDs: []string{"com", "net", "org"},
-			expected:   15,
+			expected:   110,
 		},
 		{
 			name:       "Empty domain",
@@ -112,7 +151,7 @@ func TestCheckDNS(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := CheckDNS(tt.domain); got != tt.want {
+			if got, _ := CheckDNS(context.Background(), tt.domain); got != tt.want {
 				t.Errorf("CheckDNS() = %v, want %v", got, tt.want)
 			}
 		})
@@ -140,3 +179,313 @@ func TestRun(t *testing.T) {
 		t.Error("Expected log files were not created")
 	}
 }
+
+func TestRunSkipsBlanksAndCapsDomains(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Setenv("LOG_PATH", tmpDir)
+	defer os.Unsetenv("LOG_PATH")
+
+	input := filepath.Join(tmpDir, "domains.txt")
+	if err := os.WriteFile(input, []byte("one.test\n\n  \ntwo.test\nthree.test\n\nfour.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RunWithOptions(strings.Split(string(data), "\n"), []string{"net"}, Options{MaxDomains: 2})
+
+	details, err := filepath.Glob(filepath.Join(tmpDir, "*_dns_typo_checker_details.log"))
+	if err != nil || len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	log, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checked []string
+	for _, line := range strings.Split(string(log), "\n") {
+		if domain, ok := strings.CutPrefix(line, "Checking typos for domain: "); ok {
+			checked = append(checked, domain)
+		}
+	}
+	if strings.Join(checked, ",") != "one.test,two.test" {
+		t.Errorf("checked domains = %q, want the first two non-blank ones", checked)
+	}
+}
+
+func TestRunIDsSeparateOutputFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, run := range []string{"alpha", "beta"} {
+		RunWithOptions([]string{run + ".test"}, []string{"net"}, Options{
+			OutputDir: tmpDir,
+			RunID:     run,
+		})
+	}
+
+	date := time.Now().Format("2006-01-02")
+	for _, run := range []string{"alpha", "beta"} {
+		for _, kind := range []string{"details", "not_registered"} {
+			path := filepath.Join(tmpDir, date+"_"+run+"_dns_typo_checker_"+kind+".log")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("run %s: %v", run, err)
+				continue
+			}
+			if !strings.Contains(string(data), run+".") {
+				t.Errorf("%s does not mention the %s run's domain", filepath.Base(path), run)
+			}
+		}
+	}
+
+	// A pattern without {kind} would have both files clobber each other
+	custom := Options{OutputDir: filepath.Join(tmpDir, "custom"), FilePattern: "{run}-scan.log", RunID: "x"}
+	RunWithOptions([]string{"gamma.test"}, []string{"net"}, custom)
+	if _, err := os.Stat(filepath.Join(tmpDir, "custom", "_x-scan.log")); !os.IsNotExist(err) {
+		t.Errorf("pattern without {kind} wrote a file: %v", err)
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Every .net variant resolves; only those of alpha have WHOIS data
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+	CheckDNS = stubDNS(func(domain string) bool { return strings.HasSuffix(domain, ".net") })
+	Whois = &mockWhois{records: map[string]string{"alpha.net": "Registrant: test"}}
+
+	domains := []string{"beta.test", "alpha.test"}
+	summaries := RunWithOptions(domains, []string{"net", "org"}, Options{OutputDir: tmpDir})
+	if len(summaries) != len(domains) {
+		t.Fatalf("got %d summaries, want %d", len(summaries), len(domains))
+	}
+
+	for i, s := range summaries {
+		if s.Domain != domains[i] {
+			t.Errorf("summary %d is for %q, want %q", i, s.Domain, domains[i])
+		}
+		typos := GenerateTypoDomains(domains[i], []string{"net", "org"})
+		var resolved int
+		for _, typo := range typos {
+			if ok, _ := CheckDNS(context.Background(), typo); ok {
+				resolved++
+			}
+		}
+		if s.Typos != len(typos) || s.Resolved != resolved {
+			t.Errorf("%s: typos/resolved = %d/%d, want %d/%d", s.Domain, s.Typos, s.Resolved, len(typos), resolved)
+		}
+		wantWhois := 0
+		if s.Domain == "alpha.test" {
+			wantWhois = resolved
+		}
+		if s.WithWhois != wantWhois {
+			t.Errorf("%s: with WHOIS = %d, want %d", s.Domain, s.WithWhois, wantWhois)
+		}
+	}
+
+	details, err := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if err != nil || len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	if !strings.Contains(log, "\nSummary:\n") {
+		t.Fatalf("details log has no summary:\n%s", log)
+	}
+	total := summaries[0].Typos + summaries[1].Typos
+	if !strings.Contains(log, "Total") || !strings.Contains(log, strconv.Itoa(total)) {
+		t.Errorf("summary lacks the total of %d typos:\n%s", total, log)
+	}
+}
+
+func TestWhoisTimeout(t *testing.T) {
+	// The fake whois leaves a child holding its stdout, so the lookup only
+	// returns promptly if the whole process group is killed
+	script := filepath.Join(t.TempDir(), "whois")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 30 &\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(whois WhoisClient) { Whois = whois }(Whois)
+	Whois = ExecWhois{Command: script}
+
+	start := time.Now()
+	_, err := lookupOwner(context.Background(), "slow.test", 100*time.Millisecond)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrWhoisTimeout) {
+		t.Errorf("lookupOwner() error = %v, want %v", err, ErrWhoisTimeout)
+	}
+	if elapsed > time.Second {
+		t.Errorf("lookupOwner() took %v, want it killed shortly after the timeout", elapsed)
+	}
+}
+
+func TestRunWithoutWhoisBinary(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient, look func(string) (string, error)) {
+		CheckDNS, Whois, lookPath = check, whois, look
+	}(CheckDNS, Whois, lookPath)
+	CheckDNS = stubDNS(func(string) bool { return true })
+	lookPath = func(file string) (string, error) {
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+	client := &countingWhois{}
+	Whois = client
+
+	t.Run("skipped", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		summaries := RunWithOptions([]string{"nowhois.test"}, []string{"net"}, Options{OutputDir: tmpDir})
+		if client.calls != 0 {
+			t.Errorf("Whois called %d times without a whois binary", client.calls)
+		}
+		if len(summaries) != 1 || summaries[0].Resolved == 0 || summaries[0].WithWhois != 0 {
+			t.Errorf("summaries = %+v, want resolved typos without WHOIS data", summaries)
+		}
+
+		details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+		if len(details) != 1 {
+			t.Fatalf("details logs = %v, want one", details)
+		}
+		data, err := os.ReadFile(details[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		log := string(data)
+		warning := strings.Index(log, "skipping WHOIS lookups")
+		if warning == -1 || warning > strings.Index(log, "Checking typos for domain") {
+			t.Errorf("details log lacks an upfront WHOIS warning:\n%s", log)
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		summaries := RunWithOptions([]string{"nowhois.test"}, []string{"net"}, Options{OutputDir: tmpDir, RequireWhois: true})
+		if summaries != nil {
+			t.Errorf("summaries = %+v, want the run aborted", summaries)
+		}
+		if files, _ := os.ReadDir(tmpDir); len(files) != 0 {
+			t.Errorf("aborted run wrote %d files", len(files))
+		}
+	})
+}
+
+func TestRunWithMockWhois(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+	CheckDNS = stubDNS(func(domain string) bool { return domain == "mocked.net" })
+	Whois = &mockWhois{records: map[string]string{
+		"mocked.net": "Registrant Organization: Canned Holdings",
+	}}
+
+	tmpDir := t.TempDir()
+	RunWithOptions([]string{"mocked.test"}, []string{"net"}, Options{OutputDir: tmpDir})
+
+	details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Domain owner info for mocked.net:\nRegistrant Organization: Canned Holdings\n"
+	if !strings.Contains(string(data), want) {
+		t.Errorf("details log lacks the mocked WHOIS data %q:\n%s", want, data)
+	}
+	summary := "WHOIS summary for mocked.net: registered=true registrant=\"Canned Holdings\"\n"
+	if !strings.Contains(string(data), summary) {
+		t.Errorf("details log lacks the WHOIS summary %q:\n%s", summary, data)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+	dnsCalls := 0
+	CheckDNS = stubDNS(func(string) bool {
+		dnsCalls++
+		return true
+	})
+	client := &countingWhois{}
+	Whois = client
+
+	tmpDir := t.TempDir()
+	summaries := RunWithOptions([]string{"dry.test"}, []string{"net"}, Options{OutputDir: tmpDir, DryRun: true})
+	if dnsCalls != 0 || client.calls != 0 {
+		t.Errorf("dry run made %d DNS and %d WHOIS lookups, want none", dnsCalls, client.calls)
+	}
+	want := len(GenerateCandidates("dry.test", []string{"net"}))
+	if len(summaries) != 1 || summaries[0].Typos != want || summaries[0].Resolved != 0 {
+		t.Errorf("summaries = %+v, want %d typos and nothing resolved", summaries, want)
+	}
+
+	files, _ := os.ReadDir(tmpDir)
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), "_candidates.log") {
+		t.Fatalf("dry run wrote %v, want only the candidates file", files)
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Candidates for domain: dry.test\n", "dry.net [tld]\n", "ry.test [omission]\n"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("candidates file lacks %q:\n%s", line, data)
+		}
+	}
+}
+
+func TestGenerateCandidatesLowercase(t *testing.T) {
+	candidates := GenerateCandidates("GooGle.COM", []string{"com", "Net", "net"})
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if c.Domain != strings.ToLower(c.Domain) {
+			t.Errorf("candidate %s is not lowercase", c.Domain)
+		}
+		if seen[c.Domain] {
+			t.Errorf("candidate %s listed twice", c.Domain)
+		}
+		seen[c.Domain] = true
+	}
+	for _, want := range []string{"gogle.com", "ogogle.com", "google.net"} {
+		if !seen[want] {
+			t.Errorf("candidates lack %s: %v", want, candidates)
+		}
+	}
+	if seen["google.com"] {
+		t.Error("the domain itself is a candidate in lowercase")
+	}
+
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+	CheckDNS = stubDNS(func(domain string) bool {
+		if domain != strings.ToLower(domain) {
+			t.Errorf("CheckDNS(%s) with a mixed-case name", domain)
+		}
+		return false
+	})
+	Whois = &mockWhois{}
+
+	tmpDir := t.TempDir()
+	RunWithOptions([]string{"GooGle.COM"}, []string{"net"}, Options{OutputDir: tmpDir})
+	details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Checking typos for domain: GooGle.COM\n") {
+		t.Errorf("details log does not show the input as given:\n%s", data)
+	}
+}
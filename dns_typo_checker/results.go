@@ -0,0 +1,99 @@
+package dns_typo_checker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Result file formats. Text only writes the .log files; JSON and CSV add a
+// results file with one entry per checked typo.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// TypoResult is a checked typo as written to the results file
+type TypoResult struct {
+	Target     string   `json:"target"`
+	Typo       string   `json:"typo"`
+	Strategies []string `json:"strategies"`
+	Resolved   bool     `json:"resolved"`
+	// Records lists the types of the DNS records found, e.g. NS and MX
+	Records []string `json:"records"`
+	// Whois is the one-line summary of the parsed WHOIS answer
+	Whois string `json:"whois,omitempty"`
+	// Error is set when the DNS lookup failed
+	Error string `json:"error,omitempty"`
+}
+
+// Types returns the types of the records found
+func (r Records) Types() []string {
+	var types []string
+	if len(r.NS) > 0 {
+		types = append(types, "NS")
+	}
+	if len(r.MX) > 0 {
+		types = append(types, "MX")
+	}
+	return types
+}
+
+// format returns the results file format, FormatText when unset
+func (o Options) format() (string, error) {
+	switch o.Format {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON, FormatCSV:
+		return o.Format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, want %s, %s or %s", o.Format, FormatText, FormatJSON, FormatCSV)
+	}
+}
+
+// resultsPath is the path of the results file in format, the results
+// result file with its extension replaced by the format
+func (o Options) resultsPath(date, format string) string {
+	path := o.outputPath(date, "results")
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "." + format
+}
+
+// writeResults writes results to path as a JSON array or as CSV with a
+// header row
+func writeResults(path, format string, results []TypoResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if format == FormatJSON {
+		if results == nil {
+			results = []TypoResult{}
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"target", "typo", "strategies", "resolved", "records", "whois", "error"})
+	for _, r := range results {
+		w.Write([]string{
+			r.Target,
+			r.Typo,
+			strings.Join(r.Strategies, ";"),
+			strconv.FormatBool(r.Resolved),
+			strings.Join(r.Records, ";"),
+			r.Whois,
+			r.Error,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
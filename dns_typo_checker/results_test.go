@@ -0,0 +1,119 @@
+package dns_typo_checker
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// runFormat checks results.test with the TLD strategy against stubs:
+// results.net resolves with WHOIS data, results.org fails and results.io
+// is not registered. It returns the path of the results file.
+func runFormat(t *testing.T, format string) string {
+	t.Helper()
+	defer func(check DNSCheck, whois WhoisClient, lookup RecordLookup) {
+		CheckDNS, Whois, LookupRecords = check, whois, lookup
+	}(CheckDNS, Whois, LookupRecords)
+	CheckDNS = func(_ context.Context, domain string) (bool, error) {
+		if domain == "results.org" {
+			return false, errors.New("server misbehaving")
+		}
+		return domain == "results.net", nil
+	}
+	Whois = &mockWhois{records: map[string]string{
+		"results.net": "Registrar: Example Registrar\nName Server: ns1.results.net\n",
+	}}
+	LookupRecords = func(context.Context, string) Records {
+		return Records{NS: []string{"ns1.results.net"}, MX: []string{"mx.results.net"}}
+	}
+
+	tmpDir := t.TempDir()
+	RunWithOptions([]string{"results.test"}, []string{"net", "org", "io"}, Options{
+		OutputDir:  tmpDir,
+		Strategies: []string{"tld"},
+		Format:     format,
+	})
+	files, _ := filepath.Glob(filepath.Join(tmpDir, "*_results."+format))
+	if len(files) != 1 {
+		entries, _ := os.ReadDir(tmpDir)
+		t.Fatalf("results files = %v, want one in %v", files, entries)
+	}
+	return files[0]
+}
+
+func TestResultsJSON(t *testing.T) {
+	data, err := os.ReadFile(runFormat(t, FormatJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []TypoResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatalf("results are not a JSON array: %v\n%s", err, data)
+	}
+
+	want := []TypoResult{
+		{
+			Target:     "results.test",
+			Typo:       "results.net",
+			Strategies: []string{"tld"},
+			Resolved:   true,
+			Records:    []string{"NS", "MX"},
+			Whois:      `registered=true registrar="Example Registrar" ns=ns1.results.net`,
+		},
+		{
+			Target:     "results.test",
+			Typo:       "results.org",
+			Strategies: []string{"tld"},
+			Records:    []string{},
+			Error:      "server misbehaving",
+		},
+		{
+			Target:     "results.test",
+			Typo:       "results.io",
+			Strategies: []string{"tld"},
+			Records:    []string{},
+		},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v\nwant %+v", results, want)
+	}
+}
+
+func TestResultsCSV(t *testing.T) {
+	file, err := os.Open(runFormat(t, FormatCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"target", "typo", "strategies", "resolved", "records", "whois", "error"},
+		{"results.test", "results.net", "tld", "true", "NS;MX", `registered=true registrar="Example Registrar" ns=ns1.results.net`, ""},
+		{"results.test", "results.org", "tld", "false", "", "", "server misbehaving"},
+		{"results.test", "results.io", "tld", "false", "", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q\nwant %q", rows, want)
+	}
+}
+
+func TestResultsFormatText(t *testing.T) {
+	tmpDir := t.TempDir()
+	RunWithOptions([]string{"text.test"}, []string{"net"}, Options{OutputDir: tmpDir, Strategies: []string{"tld"}, Format: FormatText})
+	if files, _ := filepath.Glob(filepath.Join(tmpDir, "*_results.*")); len(files) != 0 {
+		t.Errorf("text format wrote %v", files)
+	}
+
+	if summaries := RunWithOptions([]string{"text.test"}, []string{"net"}, Options{OutputDir: tmpDir, Format: "xml"}); summaries != nil {
+		t.Errorf("unknown format ran with summaries %+v", summaries)
+	}
+}
@@ -0,0 +1,20 @@
+package dns_typo_checker
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Stats counts the lookups of a run. The workers update it atomically, so
+// it can be read while the run is in progress.
+type Stats struct {
+	Checked    atomic.Int64 // candidates looked up in DNS
+	Registered atomic.Int64 // candidates with NS records
+	Failed     atomic.Int64 // lookups that failed or timed out
+	Whois      atomic.Int64 // WHOIS lookups performed
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%d candidates checked, %d registered, %d failed, %d WHOIS lookups",
+		s.Checked.Load(), s.Registered.Load(), s.Failed.Load(), s.Whois.Load())
+}
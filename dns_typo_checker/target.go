@@ -0,0 +1,286 @@
+package dns_typo_checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// priorityTag marks registered typos in a priority TLD
+const priorityTag = "[PRIORITY TLD] "
+
+// limiter caps concurrent calls across all targets of a run. A nil limiter
+// imposes no cap.
+type limiter chan struct{}
+
+func newLimiter(max int) limiter {
+	if max <= 0 {
+		return nil
+	}
+	return make(limiter, max)
+}
+
+func (l limiter) do(fn func()) {
+	if l != nil {
+		l <- struct{}{}
+		defer func() { <-l }()
+	}
+	fn()
+}
+
+// targetResult holds the output for one target domain until it is merged
+// into the run's console output and result files
+type targetResult struct {
+	summary       DomainSummary
+	console       strings.Builder
+	details       strings.Builder
+	notRegistered strings.Builder
+	results       []TypoResult // collected for the JSON and CSV formats
+}
+
+// log writes line to the console and the details log
+func (r *targetResult) log(line string) {
+	r.console.WriteString(line)
+	r.details.WriteString(line)
+}
+
+// checker holds what the targets of one run share
+type checker struct {
+	tlds       []string
+	strategies []Strategy
+	format     string // results file format
+	opts       Options
+	whoisErr   error // set when WHOIS lookups are skipped
+	lookup     DNSCheck
+	records    RecordLookup
+	dns        limiter
+	whois      limiter
+	hook       *webhook // nil without a webhook URL
+	stats      *Stats
+}
+
+func newChecker(tlds []string, strategies []Strategy, format string, opts Options, whoisErr error) *checker {
+	lookup, records := CheckDNS, LookupRecords
+	if opts.DoHURL != "" {
+		lookup, records = dohCheck(opts.DoHURL), dohRecords(opts.DoHURL)
+	}
+	stats := opts.Stats
+	if stats == nil {
+		stats = &Stats{}
+	}
+	return &checker{
+		tlds:       withTLDs(tlds, opts.PriorityTLDs),
+		strategies: strategies,
+		format:     format,
+		opts:       opts,
+		whoisErr:   whoisErr,
+		lookup:     lookup,
+		records:    records,
+		dns:        newLimiter(opts.DNSConcurrency),
+		whois:      newLimiter(opts.WhoisConcurrency),
+		hook:       newWebhook(opts.WebhookURL),
+		stats:      stats,
+	}
+}
+
+// run checks domains, up to opts.Parallel at a time, and passes each
+// result to emit in input order. Once ctx is done no further targets are
+// started.
+func (c *checker) run(ctx context.Context, domains []string, emit func(*targetResult)) {
+	parallel := c.opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]chan *targetResult, len(domains))
+	for i := range results {
+		results[i] = make(chan *targetResult, 1)
+	}
+
+	// Start targets in order so earlier results are not held up behind
+	// later ones
+	go func() {
+		slots := make(chan struct{}, parallel)
+		for i, domain := range domains {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				for _, out := range results[i:] {
+					out <- nil
+				}
+				return
+			}
+			go func(domain string, out chan<- *targetResult) {
+				defer func() { <-slots }()
+				out <- c.check(ctx, domain)
+			}(domain, results[i])
+		}
+	}()
+
+	for _, out := range results {
+		if r := <-out; r != nil {
+			emit(r)
+		}
+	}
+}
+
+// lookupResult is the outcome of a candidate's DNS lookup
+type lookupResult struct {
+	registered bool
+	err        error
+	skipped    bool // ctx was done before the lookup completed
+}
+
+// lookupAll looks up candidates on up to opts.LookupWorkers goroutines.
+// The result of candidate i arrives on the i-th channel, so callers can
+// consume them in order while later lookups are still running. Once ctx is
+// done the remaining candidates are skipped.
+func (c *checker) lookupAll(ctx context.Context, candidates []Candidate) []chan lookupResult {
+	results := make([]chan lookupResult, len(candidates))
+	for i := range results {
+		results[i] = make(chan lookupResult, 1)
+	}
+
+	workers := c.opts.LookupWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(candidates) {
+		workers = len(candidates)
+	}
+
+	var next atomic.Int64
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := int(next.Add(1) - 1); i < len(candidates); i = int(next.Add(1) - 1) {
+				if ctx.Err() != nil {
+					results[i] <- lookupResult{skipped: true}
+					continue
+				}
+				var result lookupResult
+				c.dns.do(func() {
+					lookupCtx, cancel := context.WithTimeout(ctx, c.opts.lookupTimeout())
+					defer cancel()
+					result.registered, result.err = c.lookup(lookupCtx, candidates[i].Domain)
+				})
+				if result.err != nil && ctx.Err() != nil {
+					result.skipped = true
+				} else {
+					c.stats.Checked.Add(1)
+				}
+				results[i] <- result
+			}
+		}()
+	}
+	return results
+}
+
+// check looks up every typo of domain until ctx is done
+func (c *checker) check(ctx context.Context, domain string) *targetResult {
+	r := &targetResult{summary: DomainSummary{Domain: domain}}
+	r.log(fmt.Sprintf("\nChecking typos for domain: %s\n", domain))
+
+	candidates, priority := prioritizeTypos(domain, generateCandidates(domain, c.tlds, c.strategies), c.opts.PriorityTLDs)
+	r.summary.Typos = len(candidates)
+	lookups := c.lookupAll(ctx, candidates)
+	for i, candidate := range candidates {
+		result := <-lookups[i]
+		if result.skipped {
+			r.summary.Partial = true
+			r.log(fmt.Sprintf("Cancelled after %d of %d typos for domain: %s\n", i, len(candidates), domain))
+			break
+		}
+		typo := candidate.Domain
+		strategies := " [" + strings.Join(candidate.Strategies, ", ") + "]"
+		row := TypoResult{Target: domain, Typo: typo, Strategies: candidate.Strategies, Records: []string{}}
+
+		if result.err != nil {
+			// A failed lookup says nothing about registration, so it
+			// stays out of the not registered file
+			c.stats.Failed.Add(1)
+			r.summary.Failed++
+			r.log(fmt.Sprintf("DNS lookup failed for: %s%s: %v\n", typo, strategies, result.err))
+			row.Error = result.err.Error()
+			c.record(r, row)
+			continue
+		}
+		if !result.registered {
+			result := fmt.Sprintf("No DNS record for: %s%s\n", typo, strategies)
+			r.log(result)
+			r.notRegistered.WriteString(result)
+			c.record(r, row)
+			continue
+		}
+
+		r.summary.Resolved++
+		c.stats.Registered.Add(1)
+		tag := ""
+		if i < priority {
+			tag = priorityTag
+		}
+		r.log(fmt.Sprintf("%sValid DNS found for typo: %s%s\n", tag, typo, strategies))
+
+		finding := Finding{
+			Target:      domain,
+			Typo:        typo,
+			Strategies:  candidate.Strategies,
+			PriorityTLD: i < priority,
+		}
+		// Lookups finished before a cancellation are still reported, but
+		// without starting WHOIS lookups
+		if c.whoisErr == nil && ctx.Err() == nil {
+			finding.Whois, row.Whois = c.owner(ctx, r, typo)
+		}
+		if c.hook != nil || c.format != FormatText {
+			c.dns.do(func() {
+				lookupCtx, cancel := context.WithTimeout(ctx, c.opts.lookupTimeout())
+				defer cancel()
+				finding.Records = c.records(lookupCtx, typo)
+			})
+		}
+		if c.hook != nil {
+			c.hook.send(finding)
+		}
+		row.Resolved = true
+		if types := finding.Records.Types(); types != nil {
+			row.Records = types
+		}
+		c.record(r, row)
+	}
+	return r
+}
+
+// record keeps row for the results file, if one is written
+func (c *checker) record(r *targetResult, row TypoResult) {
+	if c.format != FormatText {
+		r.results = append(r.results, row)
+	}
+}
+
+// owner looks up the WHOIS data of typo and records it in r. It returns
+// the raw answer, or the error, and the summary of the parsed answer.
+func (c *checker) owner(ctx context.Context, r *targetResult, typo string) (string, string) {
+	var ownerInfo string
+	var err error
+	c.whois.do(func() { ownerInfo, err = lookupOwner(ctx, typo, c.opts.whoisTimeout()) })
+	c.stats.Whois.Add(1)
+	if errors.Is(err, ErrWhoisTimeout) {
+		ownerInfo = fmt.Sprintf("whois timed out for %s after %v", typo, c.opts.whoisTimeout())
+		r.console.WriteString(ownerInfo + "\n")
+	} else if err != nil {
+		ownerInfo = fmt.Sprintf("Error retrieving WHOIS data for %s: %v", typo, err)
+	} else {
+		r.summary.WithWhois++
+	}
+	r.details.WriteString(fmt.Sprintf("Domain owner info for %s:\n%s\n", typo, ownerInfo))
+	if err != nil {
+		return ownerInfo, ""
+	}
+	summary := ParseWhois(ownerInfo).String()
+	r.log(fmt.Sprintf("WHOIS summary for %s: %s\n", typo, summary))
+	return ownerInfo, summary
+}
@@ -0,0 +1,462 @@
+package dns_typo_checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// peakCounter records the highest number of concurrent calls it saw
+type peakCounter struct {
+	current, peak int32
+}
+
+func (p *peakCounter) enter() {
+	n := atomic.AddInt32(&p.current, 1)
+	for {
+		peak := atomic.LoadInt32(&p.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&p.peak, peak, n) {
+			return
+		}
+	}
+}
+
+func (p *peakCounter) leave() { atomic.AddInt32(&p.current, -1) }
+
+// slowWhois answers every lookup after a short delay, counting concurrency
+type slowWhois struct {
+	peakCounter
+}
+
+func (w *slowWhois) Lookup(_ context.Context, domain string) (string, error) {
+	w.enter()
+	defer w.leave()
+	time.Sleep(2 * time.Millisecond)
+	return "Registrant: " + domain, nil
+}
+
+func (w *slowWhois) Available() error { return nil }
+
+func TestParallelTargets(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+
+	var dns peakCounter
+	CheckDNS = stubDNS(func(domain string) bool {
+		dns.enter()
+		defer dns.leave()
+		time.Sleep(time.Millisecond)
+		return strings.HasSuffix(domain, ".net")
+	})
+	whois := &slowWhois{}
+	Whois = whois
+
+	domains := []string{"one.test", "two.test", "three.test", "four.test", "five.test"}
+	tlds := []string{"net", "org"}
+	read := func(dir, kind string) string {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(dir, "*_"+kind+".log"))
+		if len(files) != 1 {
+			t.Fatalf("%s logs = %v, want one", kind, files)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	serialDir := t.TempDir()
+	serial := RunWithOptions(domains, tlds, Options{OutputDir: serialDir})
+
+	parallelDir := t.TempDir()
+	parallel := RunWithOptions(domains, tlds, Options{
+		OutputDir:        parallelDir,
+		Parallel:         4,
+		DNSConcurrency:   2,
+		WhoisConcurrency: 1,
+	})
+
+	if len(parallel) != len(domains) {
+		t.Fatalf("got %d summaries, want %d", len(parallel), len(domains))
+	}
+	for i, s := range parallel {
+		if s != serial[i] {
+			t.Errorf("summary %d = %+v, want %+v as in a serial run", i, s, serial[i])
+		}
+	}
+
+	// Each target's lines stay together and in input order
+	for _, kind := range []string{"details", "not_registered"} {
+		if got, want := read(parallelDir, kind), read(serialDir, kind); got != want {
+			t.Errorf("parallel %s log differs from the serial one:\n%s\nwant:\n%s", kind, got, want)
+		}
+	}
+
+	if dns.peak > 2 {
+		t.Errorf("peak concurrent DNS lookups = %d, want at most 2", dns.peak)
+	}
+	if whois.peak > 1 {
+		t.Errorf("peak concurrent WHOIS lookups = %d, want at most 1", whois.peak)
+	}
+}
+
+func TestPriorityTLDs(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+	var checked []string
+	CheckDNS = stubDNS(func(domain string) bool {
+		checked = append(checked, domain)
+		return domain == "brand.xyz" || domain == "brand.net"
+	})
+	Whois = &mockWhois{}
+
+	// xyz is not among the common TLDs and is added for the run
+	tmpDir := t.TempDir()
+	RunWithOptions([]string{"brand.com"}, []string{"net", "org", "top"}, Options{
+		OutputDir:    tmpDir,
+		PriorityTLDs: []string{"top", "xyz"},
+	})
+
+	if len(checked) < 2 || checked[0] != "brand.top" || checked[1] != "brand.xyz" {
+		t.Errorf("checked %v, want brand.top and brand.xyz first", checked)
+	}
+
+	details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	if !strings.Contains(log, priorityTag+"Valid DNS found for typo: brand.xyz [tld]\n") {
+		t.Errorf("brand.xyz is not tagged as a priority TLD match:\n%s", log)
+	}
+	if !strings.Contains(log, "\nValid DNS found for typo: brand.net [tld]\n") {
+		t.Errorf("brand.net should be reported untagged:\n%s", log)
+	}
+}
+
+func TestOverlappingStrategiesCheckedOnce(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient, strategies []Strategy) {
+		CheckDNS, Whois, Strategies = check, whois, strategies
+	}(CheckDNS, Whois, Strategies)
+
+	// "doubled" repeats omissions of the double o and adds a typo that
+	// transposition also produces
+	Strategies = append(Strategies[:len(Strategies):len(Strategies)], Strategy{
+		Name: "doubled",
+		Generate: func(name, tld string, _ []string) []string {
+			return []string{"gogle." + tld, "gogle." + tld, "googel." + tld}
+		},
+	})
+
+	checks := make(map[string]int)
+	CheckDNS = stubDNS(func(domain string) bool {
+		checks[domain]++
+		return domain == "gogle.com"
+	})
+	Whois = &mockWhois{}
+
+	candidates := GenerateCandidates("google.com", nil)
+	strategies := make(map[string]string)
+	for _, c := range candidates {
+		if _, dup := strategies[c.Domain]; dup {
+			t.Errorf("candidate %s listed twice", c.Domain)
+		}
+		strategies[c.Domain] = strings.Join(c.Strategies, ",")
+	}
+	for domain, want := range map[string]string{
+		"gogle.com":  "omission,doubled",
+		"googel.com": "transposition,doubled",
+		"oogle.com":  "omission",
+	} {
+		if got := strategies[domain]; got != want {
+			t.Errorf("%s strategies = %q, want %q", domain, got, want)
+		}
+	}
+	if _, ok := strategies["google.com"]; ok {
+		t.Error("swapping the double o reproduced the domain itself as a candidate")
+	}
+
+	tmpDir := t.TempDir()
+	summaries := RunWithOptions([]string{"google.com"}, []string{"com"}, Options{OutputDir: tmpDir})
+	for domain, n := range checks {
+		if n != 1 {
+			t.Errorf("%s checked %d times, want once", domain, n)
+		}
+	}
+	if len(summaries) != 1 || summaries[0].Typos != len(candidates) {
+		t.Errorf("summaries = %+v, want %d typos", summaries, len(candidates))
+	}
+
+	details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Valid DNS found for typo: gogle.com [omission, doubled]\n"; !strings.Contains(string(data), want) {
+		t.Errorf("details log lacks %q:\n%s", want, data)
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+
+	var checks, registered atomic.Int64
+	CheckDNS = stubDNS(func(domain string) bool {
+		checks.Add(1)
+		if strings.HasSuffix(domain, ".net") {
+			registered.Add(1)
+			return true
+		}
+		return false
+	})
+	Whois = &slowWhois{}
+
+	stats := &Stats{}
+	summaries := RunWithOptions([]string{"one.test", "two.test", "three.test"}, []string{"net", "org"}, Options{
+		OutputDir: t.TempDir(),
+		Parallel:  3,
+		Stats:     stats,
+	})
+
+	var typos, resolved int64
+	for _, s := range summaries {
+		typos += int64(s.Typos)
+		resolved += int64(s.Resolved)
+	}
+	if got := stats.Checked.Load(); got != checks.Load() || got != typos {
+		t.Errorf("Checked = %d, want %d stubbed checks of %d typos", got, checks.Load(), typos)
+	}
+	if got := stats.Registered.Load(); got != registered.Load() || got != resolved {
+		t.Errorf("Registered = %d, want %d registered of %d resolved", got, registered.Load(), resolved)
+	}
+	if got := stats.Whois.Load(); got != registered.Load() {
+		t.Errorf("Whois = %d, want one lookup per registered typo (%d)", got, registered.Load())
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+
+	// Cancel the run from within the fifth lookup of the first domain
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var checks atomic.Int64
+	CheckDNS = stubDNS(func(domain string) bool {
+		if checks.Add(1) == 5 {
+			cancel()
+		}
+		return strings.HasSuffix(domain, ".net")
+	})
+	Whois = &mockWhois{}
+
+	tmpDir := t.TempDir()
+	stats := &Stats{}
+	domains := []string{"first.test", "second.test", "third.test"}
+	start := time.Now()
+	summaries := RunContext(ctx, domains, []string{"net", "org"}, Options{OutputDir: tmpDir, Stats: stats})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled run took %v", elapsed)
+	}
+
+	if len(summaries) != 1 {
+		t.Fatalf("summaries = %+v, want only the interrupted first domain", summaries)
+	}
+	s := summaries[0]
+	if s.Domain != "first.test" || !s.Partial {
+		t.Errorf("summary = %+v, want first.test marked partial", s)
+	}
+	if got := stats.Checked.Load(); got != 5 || got != checks.Load() {
+		t.Errorf("Checked = %d after %d lookups, want 5", got, checks.Load())
+	}
+	if s.Resolved != int(stats.Registered.Load()) {
+		t.Errorf("Resolved = %d, want the %d registered before cancelling", s.Resolved, stats.Registered.Load())
+	}
+
+	details, _ := filepath.Glob(filepath.Join(tmpDir, "*_details.log"))
+	if len(details) != 1 {
+		t.Fatalf("details logs = %v, want one", details)
+	}
+	data, err := os.ReadFile(details[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, want := range []string{
+		fmt.Sprintf("Cancelled after 5 of %d typos for domain: first.test\n", s.Typos),
+		"DNS typo check cancelled, results are partial\n",
+		"first.test (partial)",
+		"DNS typo check completed.\n",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("details log lacks %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "second.test") {
+		t.Errorf("details log mentions a domain started after cancelling:\n%s", log)
+	}
+}
+
+func TestLookupWorkers(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+
+	var mu sync.Mutex
+	checks := make(map[string]int)
+	var dns peakCounter
+	CheckDNS = stubDNS(func(domain string) bool {
+		dns.enter()
+		defer dns.leave()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		checks[domain]++
+		mu.Unlock()
+		return strings.HasPrefix(domain, "lookp") || strings.HasSuffix(domain, ".net")
+	})
+	Whois = &mockWhois{records: map[string]string{"lookup.net": "Registrant: test"}}
+
+	domains := []string{"lookup.test", "workers.test"}
+	tlds := []string{"net", "org", "com"}
+	read := func(dir string) string {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(dir, "*_details.log"))
+		if len(files) != 1 {
+			t.Fatalf("details logs = %v, want one", files)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	serialDir := t.TempDir()
+	serial := RunWithOptions(domains, tlds, Options{OutputDir: serialDir})
+	serialPeak := dns.peak
+	for domain := range checks {
+		delete(checks, domain)
+	}
+
+	concurrentDir := t.TempDir()
+	concurrent := RunWithOptions(domains, tlds, Options{OutputDir: concurrentDir, LookupWorkers: 8})
+
+	var want int
+	for _, domain := range domains {
+		for _, c := range GenerateCandidates(domain, tlds) {
+			want++
+			if n := checks[c.Domain]; n != 1 {
+				t.Errorf("%s checked %d times, want once", c.Domain, n)
+			}
+		}
+	}
+	if len(checks) != want {
+		t.Errorf("checked %d domains, want the %d candidates", len(checks), want)
+	}
+
+	for i, s := range concurrent {
+		if s != serial[i] {
+			t.Errorf("summary %d = %+v, want %+v as with serial lookups", i, s, serial[i])
+		}
+	}
+	if got, want := read(concurrentDir), read(serialDir); got != want {
+		t.Errorf("details log differs from the serial one:\n%s\nwant:\n%s", got, want)
+	}
+	if serialPeak != 1 || dns.peak < 2 || dns.peak > 8 {
+		t.Errorf("peak concurrent lookups = %d serial, %d with 8 workers", serialPeak, dns.peak)
+	}
+}
+
+func TestLookupFailures(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient) {
+		CheckDNS, Whois = check, whois
+	}(CheckDNS, Whois)
+
+	// brand.net hangs until the lookup times out and brand.org fails
+	CheckDNS = func(ctx context.Context, domain string) (bool, error) {
+		switch domain {
+		case "brand.net":
+			<-ctx.Done()
+			return false, ctx.Err()
+		case "brand.org":
+			return false, errors.New("server misbehaving")
+		}
+		return domain == "brnd.com", nil
+	}
+	Whois = &mockWhois{}
+
+	tmpDir := t.TempDir()
+	stats := &Stats{}
+	start := time.Now()
+	summaries := RunWithOptions([]string{"brand.com"}, []string{"net", "org"}, Options{
+		OutputDir:     tmpDir,
+		LookupTimeout: 20 * time.Millisecond,
+		Stats:         stats,
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("run with a hanging lookup took %v", elapsed)
+	}
+
+	if len(summaries) != 1 || summaries[0].Failed != 2 || summaries[0].Resolved != 1 {
+		t.Fatalf("summaries = %+v, want 2 failed and 1 resolved", summaries)
+	}
+	if stats.Failed.Load() != 2 {
+		t.Errorf("Stats.Failed = %d, want 2", stats.Failed.Load())
+	}
+
+	read := func(kind string) string {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(tmpDir, "*_"+kind+".log"))
+		if len(files) != 1 {
+			t.Fatalf("%s logs = %v, want one", kind, files)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	details, notRegistered := read("details"), read("not_registered")
+	for _, want := range []string{
+		"DNS lookup failed for: brand.net [tld]: context deadline exceeded\n",
+		"DNS lookup failed for: brand.org [tld]: server misbehaving\n",
+	} {
+		if !strings.Contains(details, want) {
+			t.Errorf("details log lacks %q:\n%s", want, details)
+		}
+	}
+	if strings.Contains(notRegistered, "brand.net") || strings.Contains(notRegistered, "brand.org") {
+		t.Errorf("failed lookups listed as not registered:\n%s", notRegistered)
+	}
+	if !strings.Contains(notRegistered, "No DNS record for: band.com [omission]\n") {
+		t.Errorf("not registered log lacks band.com:\n%s", notRegistered)
+	}
+}
+
+func TestCheckDNSHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if registered, err := checkDNS(ctx, "example.com"); registered || err == nil {
+		t.Errorf("checkDNS() with a done context = %v, %v, want a lookup error", registered, err)
+	}
+}
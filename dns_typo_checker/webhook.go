@@ -0,0 +1,162 @@
+package dns_typo_checker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// webhookAttempts is how often a finding is posted before giving up
+	webhookAttempts = 4
+	// webhookQueue is the number of findings waiting for delivery before
+	// further ones are dropped
+	webhookQueue = 1024
+)
+
+// webhookBackoff is the delay before the first retry; it doubles for each
+// further one. It is a variable so it can be shortened in tests.
+var webhookBackoff = time.Second
+
+// Records are the DNS records found for a registered typo
+type Records struct {
+	NS []string `json:"ns,omitempty"`
+	MX []string `json:"mx,omitempty"`
+}
+
+// Finding is a registered typo as posted to the webhook
+type Finding struct {
+	Target      string   `json:"target"`
+	Typo        string   `json:"typo"`
+	Strategies  []string `json:"strategies"`
+	PriorityTLD bool     `json:"priority_tld"`
+	Records     Records  `json:"records"`
+	Whois       string   `json:"whois,omitempty"`
+}
+
+// RecordLookup collects the NS and MX hosts of domain until ctx is done.
+// Records that cannot be looked up are left out.
+type RecordLookup func(ctx context.Context, domain string) Records
+
+// LookupRecords is a variable so it can be replaced in tests
+var LookupRecords RecordLookup = lookupRecords
+
+// lookupRecords collects the NS and MX hosts of domain through the system
+// resolver
+func lookupRecords(ctx context.Context, domain string) Records {
+	var r Records
+	if ns, err := resolver.LookupNS(ctx, domain); err == nil {
+		for _, n := range ns {
+			r.NS = append(r.NS, n.Host)
+		}
+	}
+	if mx, err := resolver.LookupMX(ctx, domain); err == nil {
+		for _, m := range mx {
+			r.MX = append(r.MX, m.Host)
+		}
+	}
+	return r
+}
+
+// webhook posts findings to a URL from a background goroutine so the scan
+// never waits on it
+type webhook struct {
+	url    string
+	client *http.Client
+	queue  chan Finding
+	done   chan struct{}
+
+	delivered, failed int
+	dropped           atomic.Int64
+	lastErr           error
+}
+
+// newWebhook starts a sender for url, or returns nil when url is empty
+func newWebhook(url string) *webhook {
+	if url == "" {
+		return nil
+	}
+	w := &webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Finding, webhookQueue),
+		done:   make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// send queues f for delivery. A full queue drops f rather than holding up
+// the scan.
+func (w *webhook) send(f Finding) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.queue <- f:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+func (w *webhook) loop() {
+	defer close(w.done)
+	for f := range w.queue {
+		if err := w.post(f); err != nil {
+			w.failed++
+			w.lastErr = err
+		} else {
+			w.delivered++
+		}
+	}
+}
+
+// post delivers f, retrying network errors and 5xx or 429 answers with
+// exponential backoff
+func (w *webhook) post(f Finding) error {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	delay := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.postOnce(body)
+		if err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (w *webhook) postOnce(body []byte) (retry bool, err error) {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook answered %s", resp.Status)
+}
+
+// close waits for the queued findings to be delivered and reports how
+// many were
+func (w *webhook) close() string {
+	close(w.queue)
+	<-w.done
+	report := fmt.Sprintf("Webhook: %d findings delivered, %d failed, %d dropped", w.delivered, w.failed, w.dropped.Load())
+	if w.lastErr != nil {
+		report += fmt.Sprintf(" (last error: %v)", w.lastErr)
+	}
+	return report
+}
@@ -0,0 +1,144 @@
+package dns_typo_checker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookFindings(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient, lookup RecordLookup, backoff time.Duration) {
+		CheckDNS, Whois, LookupRecords, webhookBackoff = check, whois, lookup, backoff
+	}(CheckDNS, Whois, LookupRecords, webhookBackoff)
+
+	CheckDNS = stubDNS(func(domain string) bool {
+		return domain == "brand.xyz" || domain == "brnd.com"
+	})
+	Whois = &mockWhois{}
+	LookupRecords = func(_ context.Context, domain string) Records {
+		return Records{NS: []string{"ns1." + domain + "."}, MX: []string{"mail." + domain + "."}}
+	}
+	webhookBackoff = time.Millisecond
+
+	// The first post fails so delivery has to be retried
+	var mu sync.Mutex
+	var findings []Finding
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posts++
+		if posts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var f Finding
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			t.Errorf("decoding finding: %v", err)
+		}
+		findings = append(findings, f)
+	}))
+	defer server.Close()
+
+	RunWithOptions([]string{"brand.com"}, []string{"com", "net"}, Options{
+		OutputDir:    t.TempDir(),
+		PriorityTLDs: []string{"xyz"},
+		WebhookURL:   server.URL,
+	})
+
+	// The run waits for pending deliveries before returning
+	mu.Lock()
+	defer mu.Unlock()
+	if len(findings) != 2 {
+		t.Fatalf("delivered %d findings in %d posts, want 2: %+v", len(findings), posts, findings)
+	}
+	byTypo := make(map[string]Finding)
+	for _, f := range findings {
+		byTypo[f.Typo] = f
+	}
+
+	priority, ok := byTypo["brand.xyz"]
+	if !ok || !priority.PriorityTLD || priority.Target != "brand.com" {
+		t.Errorf("brand.xyz finding = %+v, want a priority TLD match of brand.com", priority)
+	}
+	if !slices.Equal(priority.Records.MX, []string{"mail.brand.xyz."}) {
+		t.Errorf("brand.xyz MX = %v, want mail.brand.xyz.", priority.Records.MX)
+	}
+
+	omission, ok := byTypo["brnd.com"]
+	if !ok || omission.PriorityTLD || !slices.Equal(omission.Strategies, []string{"omission"}) {
+		t.Errorf("brnd.com finding = %+v, want an omission", omission)
+	}
+	if !slices.Equal(omission.Records.NS, []string{"ns1.brnd.com."}) {
+		t.Errorf("brnd.com NS = %v, want ns1.brnd.com.", omission.Records.NS)
+	}
+}
+
+func TestWebhookDoesNotStallScan(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	hook := newWebhook(server.URL)
+	start := time.Now()
+	for i := 0; i < webhookQueue+10; i++ {
+		hook.send(Finding{Typo: "typo.example"})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("queueing findings behind a stuck webhook took %v", elapsed)
+	}
+	close(release)
+
+	hook.close()
+	if dropped := hook.dropped.Load(); dropped == 0 {
+		t.Error("no findings were dropped with the queue full")
+	}
+	if hook.delivered+hook.failed+int(hook.dropped.Load()) != webhookQueue+10 {
+		t.Errorf("delivered %d, failed %d, dropped %d of %d findings",
+			hook.delivered, hook.failed, hook.dropped.Load(), webhookQueue+10)
+	}
+}
+
+func TestRecordLookupHonoursLookupTimeout(t *testing.T) {
+	defer func(check DNSCheck, whois WhoisClient, lookup RecordLookup) {
+		CheckDNS, Whois, LookupRecords = check, whois, lookup
+	}(CheckDNS, Whois, LookupRecords)
+	CheckDNS = stubDNS(func(domain string) bool { return domain == "brand.net" })
+	Whois = &mockWhois{}
+
+	// The lookup only returns once its context is done
+	var lookupErr error
+	LookupRecords = func(ctx context.Context, domain string) Records {
+		<-ctx.Done()
+		lookupErr = ctx.Err()
+		return Records{}
+	}
+
+	start := time.Now()
+	RunWithOptions([]string{"brand.com"}, []string{"net"}, Options{
+		OutputDir:     t.TempDir(),
+		Strategies:    []string{"tld"},
+		Format:        FormatJSON,
+		LookupTimeout: 50 * time.Millisecond,
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("run took %v with a 50ms lookup timeout", elapsed)
+	}
+	if !errors.Is(lookupErr, context.DeadlineExceeded) {
+		t.Errorf("record lookup ended with %v, want context.DeadlineExceeded", lookupErr)
+	}
+}
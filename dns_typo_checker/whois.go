@@ -0,0 +1,226 @@
+package dns_typo_checker
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WhoisRecord holds the fields parsed from a WHOIS answer. Fields missing
+// from the answer are left empty.
+type WhoisRecord struct {
+	// Registered is false for empty answers and "no match" style answers
+	Registered  bool
+	Registrar   string
+	Registrant  string // registrant organisation
+	Created     time.Time
+	Expires     time.Time
+	NameServers []string
+}
+
+// whoisKeys maps the lowercased labels used by the registries to fields
+var whoisKeys = map[string]string{
+	"registrar":                              "registrar",
+	"registrar name":                         "registrar",
+	"sponsoring registrar":                   "registrar",
+	"registrant":                             "registrant",
+	"registrant organization":                "registrant",
+	"registrant organisation":                "registrant",
+	"org":                                    "registrant",
+	"creation date":                          "created",
+	"created":                                "created",
+	"created on":                             "created",
+	"registered on":                          "created",
+	"registration time":                      "created",
+	"domain registration date":               "created",
+	"registry expiry date":                   "expires",
+	"registrar registration expiration date": "expires",
+	"expiry date":                            "expires",
+	"expiration date":                        "expires",
+	"expiration time":                        "expires",
+	"expires":                                "expires",
+	"expires on":                             "expires",
+	"paid-till":                              "expires",
+	"name server":                            "ns",
+	"name servers":                           "ns",
+	"nameserver":                             "ns",
+	"nameservers":                            "ns",
+	"nserver":                                "ns",
+}
+
+// whoisNotFound are phrases of answers for unregistered domains
+var whoisNotFound = []string{
+	"no match",
+	"not found",
+	"no entries found",
+	"no data found",
+	"no object found",
+	"status: free",
+	"status: available",
+}
+
+// whoisDates are the date layouts tried, most common first
+var whoisDates = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02-Jan-2006",
+	"2006.01.02",
+	"2006/01/02",
+	"02.01.2006",
+}
+
+// ParseWhois extracts the registration data from a raw WHOIS answer. It
+// reads "Label: value" lines, as well as labels followed by indented value
+// lines as used by some registries, and keeps the first value of each
+// field. Empty answers and "no match" answers without any of the fields
+// give a zero record.
+func ParseWhois(raw string) WhoisRecord {
+	var record WhoisRecord
+	lines := strings.Split(raw, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '%' || line[0] == '#' || strings.HasPrefix(line, ">>>") {
+			continue
+		}
+		field, value := whoisField(line)
+		if field == "" {
+			continue
+		}
+
+		// A label without a value is followed by its values, one per line
+		// indented below it, up to the next blank line. Anything else means
+		// the value is missing, as in gTLD answers with redacted fields.
+		values := []string{value}
+		if value == "" {
+			values = values[:0]
+			labelIndent := indent(lines[i])
+			for i+1 < len(lines) && indent(lines[i+1]) > labelIndent {
+				next := strings.TrimSpace(lines[i+1])
+				if next == "" {
+					break
+				}
+				if known, _ := whoisField(next); known != "" {
+					break
+				}
+				i++
+				values = append(values, next)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		record.set(field, values)
+	}
+
+	if record.empty() {
+		lower := strings.ToLower(raw)
+		for _, phrase := range whoisNotFound {
+			if strings.Contains(lower, phrase) {
+				return record
+			}
+		}
+	}
+	record.Registered = strings.TrimSpace(raw) != ""
+	return record
+}
+
+// whoisField returns the field and trimmed value of a "Label: value" line,
+// or an empty field for lines without a known label
+func whoisField(line string) (field, value string) {
+	label, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", ""
+	}
+	return whoisKeys[strings.ToLower(strings.TrimSpace(label))], strings.TrimSpace(value)
+}
+
+// indent returns the number of leading blanks of line
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func (r WhoisRecord) empty() bool {
+	return r.Registrar == "" && r.Registrant == "" && r.Created.IsZero() &&
+		r.Expires.IsZero() && len(r.NameServers) == 0
+}
+
+// set stores values in field unless it already holds one
+func (r *WhoisRecord) set(field string, values []string) {
+	switch field {
+	case "registrar":
+		if r.Registrar == "" {
+			r.Registrar = values[0]
+		}
+	case "registrant":
+		if r.Registrant == "" {
+			r.Registrant = values[0]
+		}
+	case "created":
+		if r.Created.IsZero() {
+			r.Created = parseWhoisDate(values[0])
+		}
+	case "expires":
+		if r.Expires.IsZero() {
+			r.Expires = parseWhoisDate(values[0])
+		}
+	case "ns":
+		for _, value := range values {
+			// Some registries list the address after the host
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				continue
+			}
+			host := strings.TrimSuffix(strings.ToLower(fields[0]), ".")
+			if !slices.Contains(r.NameServers, host) {
+				r.NameServers = append(r.NameServers, host)
+			}
+		}
+	}
+}
+
+// parseWhoisDate parses value, or its first word, with one of whoisDates
+func parseWhoisDate(value string) time.Time {
+	candidates := []string{value}
+	if fields := strings.Fields(value); len(fields) > 1 {
+		candidates = append(candidates, fields[0])
+	}
+	for _, candidate := range candidates {
+		for _, layout := range whoisDates {
+			if t, err := time.Parse(layout, candidate); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// String returns the record as one line of key=value pairs, leaving out
+// empty fields
+func (r WhoisRecord) String() string {
+	if !r.Registered {
+		return "registered=false"
+	}
+	pairs := []string{"registered=true"}
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	add("registrar", r.Registrar)
+	add("registrant", r.Registrant)
+	if !r.Created.IsZero() {
+		add("created", r.Created.Format("2006-01-02"))
+	}
+	if !r.Expires.IsZero() {
+		add("expires", r.Expires.Format("2006-01-02"))
+	}
+	add("ns", strings.Join(r.NameServers, ","))
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,153 @@
+package dns_typo_checker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const whoisCom = `   Domain Name: GOOGLE.COM
+   Registry Domain ID: 2138514_DOMAIN_COM-VRSN
+   Registrar WHOIS Server: whois.markmonitor.com
+   Registrar URL: http://www.markmonitor.com
+   Updated Date: 2019-09-09T15:39:04Z
+   Creation Date: 1997-09-15T04:00:00Z
+   Registry Expiry Date: 2028-09-14T04:00:00Z
+   Registrar: MarkMonitor Inc.
+   Name Server: NS1.GOOGLE.COM
+   Name Server: NS2.GOOGLE.COM
+>>> Last update of whois database: 2024-05-01T10:00:00Z <<<
+
+Domain Name: google.com
+Registrar: MarkMonitor, Inc.
+Registrant Organization: Google LLC
+Name Server: ns1.google.com
+Name Server: ns3.google.com
+`
+
+const whoisUK = `
+    Domain name:
+        google.co.uk
+
+    Registrant:
+        Google LLC
+
+    Registrar:
+        Markmonitor Inc. t/a MarkMonitor Inc. [Tag = MARKMONITOR]
+        URL: https://www.markmonitor.com
+
+    Relevant dates:
+        Registered on: 14-Feb-1999
+        Expiry date:  14-Feb-2025
+        Last updated:  13-Jan-2024
+
+    Name servers:
+        ns1.google.com
+        ns2.google.com
+
+    WHOIS lookup made at 10:00:00 01-May-2024
+`
+
+// whoisRedacted has the empty, unindented values of gTLD answers with
+// redacted registrant data
+const whoisRedacted = `Domain Name: EXAMPLE-SHOP.COM
+Registrar: Example Registrar, LLC
+Registrant Organization:
+Registrant State/Province: CA
+Registrant Country: US
+Name Server:
+Name Server: NS1.EXAMPLE-SHOP.COM
+Name Server: NS2.EXAMPLE-SHOP.COM
+`
+
+const whoisDE = `% Restricted rights.
+%
+% Terms and Conditions of Use
+
+Domain: google.de
+Nserver: ns1.google.com
+Nserver: ns2.google.com
+Status: connect
+Changed: 2018-03-12T21:44:25+01:00
+`
+
+const whoisRU = `% TCI Whois Service. Terms of use:
+
+domain:        GOOGLE.RU
+nserver:       ns1.google.com.
+nserver:       ns2.google.com. 216.239.34.10
+state:         REGISTERED, DELEGATED, VERIFIED
+org:           Google LLC
+registrar:     RU-CENTER-RU
+created:       2004-03-03T21:00:00Z
+paid-till:     2025-03-04T21:00:00Z
+source:        TCI
+`
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestParseWhois(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want WhoisRecord
+	}{
+		{"com", whoisCom, WhoisRecord{
+			Registered:  true,
+			Registrar:   "MarkMonitor Inc.",
+			Registrant:  "Google LLC",
+			Created:     time.Date(1997, 9, 15, 4, 0, 0, 0, time.UTC),
+			Expires:     time.Date(2028, 9, 14, 4, 0, 0, 0, time.UTC),
+			NameServers: []string{"ns1.google.com", "ns2.google.com", "ns3.google.com"},
+		}},
+		{"uk", whoisUK, WhoisRecord{
+			Registered:  true,
+			Registrar:   "Markmonitor Inc. t/a MarkMonitor Inc. [Tag = MARKMONITOR]",
+			Registrant:  "Google LLC",
+			Created:     date("1999-02-14"),
+			Expires:     date("2025-02-14"),
+			NameServers: []string{"ns1.google.com", "ns2.google.com"},
+		}},
+		{"redacted", whoisRedacted, WhoisRecord{
+			Registered:  true,
+			Registrar:   "Example Registrar, LLC",
+			NameServers: []string{"ns1.example-shop.com", "ns2.example-shop.com"},
+		}},
+		{"de", whoisDE, WhoisRecord{
+			Registered:  true,
+			NameServers: []string{"ns1.google.com", "ns2.google.com"},
+		}},
+		{"ru", whoisRU, WhoisRecord{
+			Registered:  true,
+			Registrar:   "RU-CENTER-RU",
+			Registrant:  "Google LLC",
+			Created:     time.Date(2004, 3, 3, 21, 0, 0, 0, time.UTC),
+			Expires:     time.Date(2025, 3, 4, 21, 0, 0, 0, time.UTC),
+			NameServers: []string{"ns1.google.com", "ns2.google.com"},
+		}},
+		{"com no match", "No match for \"EXAMPLE-FREE.COM\".\n>>> Last update of whois database: 2024-05-01T10:00:00Z <<<\n", WhoisRecord{}},
+		{"de free", "Domain: example-free.de\nStatus: free\n", WhoisRecord{}},
+		{"not found", "%% NOT FOUND\n", WhoisRecord{}},
+		{"empty", "  \n", WhoisRecord{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseWhois(tt.raw)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWhois() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhoisRecordString(t *testing.T) {
+	if got := ParseWhois(whoisRU).String(); got != `registered=true registrar=RU-CENTER-RU registrant="Google LLC" created=2004-03-03 expires=2025-03-04 ns=ns1.google.com,ns2.google.com` {
+		t.Errorf("String() = %s", got)
+	}
+	if got := (WhoisRecord{}).String(); got != "registered=false" {
+		t.Errorf("zero String() = %s, want registered=false", got)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -12,6 +13,57 @@ import (
 	"github.com/exiguus/ns-checker/dns_typo_checker"
 )
 
+// typoDomainsFile lists the domains checked by the check command
+var typoDomainsFile = "typo-tlds.txt"
+
+// runTypoCheck is replaced in tests
+var runTypoCheck = dns_typo_checker.RunContext
+
+// loadDomains reads one domain per line from path. Lines are trimmed;
+// blank lines are dropped and lines that are not domain names are
+// reported and skipped.
+func loadDomains(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []string
+	for i, line := range strings.Split(string(data), "\n") {
+		domain := strings.TrimSpace(line)
+		if domain == "" {
+			continue
+		}
+		if !isDomain(domain) {
+			fmt.Printf("Skipping %s line %d: %q is not a domain name\n", path, i+1, domain)
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// isDomain reports whether s is a name with at least two labels made of
+// letters, digits and inner hyphens
+func isDomain(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	labels := strings.Split(s, ".")
+	if len(s) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func runCommand(args []string) int {
 	if len(args) < 2 {
 		fmt.Println("Usage: ns-checker <?option> <?arg>")
@@ -23,20 +75,56 @@ func runCommand(args []string) int {
 		fmt.Println("Usage: ns-checker <?option> <?arg>")
 		fmt.Println("Options:")
 		fmt.Println("  help - Display this help message")
-		fmt.Println("  check - Check for typo domains")
+		fmt.Println("  check <?--timeout d> <?--strategies list> <?--format f> - Check for typo domains")
+		fmt.Println("    - --timeout bounds each DNS lookup, e.g. 5s (default 3s).")
+		fmt.Println("    - --strategies selects the typo strategies, e.g. omission,keyboard (default all).")
+		fmt.Println("    - --format json or csv adds a results file to the text logs (default text).")
 		fmt.Println("  listen <?port> - Start DNS listener on specified port.")
 		fmt.Println("    - Default port is 25053.")
 		fmt.Println("    - The port is optional.")
 		return 0
 	case "check":
-		NSTLDs, err := os.ReadFile("typo-tlds.txt")
+		flags := flag.NewFlagSet("check", flag.ContinueOnError)
+		timeout := flags.Duration("timeout", 0, "bound each DNS lookup (default 3s)")
+		strategies := flags.String("strategies", "", "comma separated typo strategies (default all)")
+		format := flags.String("format", "", "results file format: text, json or csv (default text)")
+		if err := flags.Parse(args[2:]); err != nil {
+			return 1
+		}
+
+		domains, err := loadDomains(typoDomainsFile)
 		if err != nil {
 			fmt.Printf("Error reading file: %v\n", err)
 			return 1
 		}
-		domains := strings.Split(string(NSTLDs), "\n")
+		opts := dns_typo_checker.OptionsFromEnv()
+		if *timeout > 0 {
+			opts.LookupTimeout = *timeout
+		}
+		if *strategies != "" {
+			opts.Strategies = nil
+			for _, name := range strings.Split(*strategies, ",") {
+				opts.Strategies = append(opts.Strategies, strings.TrimSpace(name))
+			}
+			if _, err := dns_typo_checker.SelectStrategies(opts.Strategies); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+		}
+		switch *format {
+		case "":
+		case dns_typo_checker.FormatText, dns_typo_checker.FormatJSON, dns_typo_checker.FormatCSV:
+			opts.Format = *format
+		default:
+			fmt.Printf("Invalid format %q, use text, json or csv\n", *format)
+			return 1
+		}
+
+		// An interrupt ends the run early with partial results
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 		commonTLDs := []string{"com", "net", "org", "ne", "co", "cm", "om", "de"}
-		dns_typo_checker.Run(domains, commonTLDs)
+		runTypoCheck(ctx, domains, commonTLDs, opts)
 		return 0
 	case "listen":
 		port := "25353" // Default port
@@ -49,23 +137,9 @@ func runCommand(args []string) int {
 			}
 		}
 
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-		errChan := make(chan error, 1)
-		go func() {
-			dns_listener.Run(port)
-		}()
-
-		select {
-		case err := <-errChan:
-			if err != nil {
-				fmt.Printf("DNS listener error: %v\n", err)
-				return 1
-			}
-		case sig := <-sigChan:
-			fmt.Printf("\nReceived signal %v, shutting down...\n", sig)
-		}
+		// The listener shuts down gracefully on SIGINT and SIGTERM,
+		// answering the queries in flight, and Run returns once it has
+		dns_listener.Run(port)
 		return 0
 	default:
 		fmt.Println("Invalid option. Use 'help' for usage.")
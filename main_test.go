@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/exiguus/ns-checker/dns_typo_checker"
 	_ "github.com/exiguus/ns-checker/internal/testinit"
 )
 
@@ -41,3 +47,110 @@ func TestRunCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckFiltersDomainLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	content := "google.com\n\n   \n  cloudflare.com \t\nnot a domain\nlocalhost\n-bad.com\nakam.net\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origFile, origRun := typoDomainsFile, runTypoCheck
+	defer func() { typoDomainsFile, runTypoCheck = origFile, origRun }()
+
+	var got []string
+	typoDomainsFile = path
+	runTypoCheck = func(_ context.Context, domains []string, _ []string, _ dns_typo_checker.Options) []dns_typo_checker.DomainSummary {
+		got = domains
+		return nil
+	}
+
+	if code := runCommand([]string{"ns-checker", "check"}); code != 0 {
+		t.Fatalf("runCommand(check) = %d, want 0", code)
+	}
+	if want := "google.com,cloudflare.com,akam.net"; strings.Join(got, ",") != want {
+		t.Errorf("domains passed to Run = %q, want %s", got, want)
+	}
+}
+
+func TestCheckTimeoutFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("google.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origFile, origRun := typoDomainsFile, runTypoCheck
+	defer func() { typoDomainsFile, runTypoCheck = origFile, origRun }()
+
+	var got time.Duration
+	typoDomainsFile = path
+	runTypoCheck = func(_ context.Context, _ []string, _ []string, opts dns_typo_checker.Options) []dns_typo_checker.DomainSummary {
+		got = opts.LookupTimeout
+		return nil
+	}
+
+	if code := runCommand([]string{"ns-checker", "check", "--timeout", "750ms"}); code != 0 {
+		t.Fatalf("runCommand(check --timeout) = %d, want 0", code)
+	}
+	if got != 750*time.Millisecond {
+		t.Errorf("LookupTimeout = %v, want 750ms", got)
+	}
+	if code := runCommand([]string{"ns-checker", "check", "--timeout", "soon"}); code != 1 {
+		t.Errorf("runCommand(check --timeout soon) = %d, want 1", code)
+	}
+}
+
+func TestCheckStrategiesFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("google.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origFile, origRun := typoDomainsFile, runTypoCheck
+	defer func() { typoDomainsFile, runTypoCheck = origFile, origRun }()
+
+	var got []string
+	calls := 0
+	typoDomainsFile = path
+	runTypoCheck = func(_ context.Context, _ []string, _ []string, opts dns_typo_checker.Options) []dns_typo_checker.DomainSummary {
+		got = opts.Strategies
+		calls++
+		return nil
+	}
+
+	if code := runCommand([]string{"ns-checker", "check", "--strategies", "omission, keyboard"}); code != 0 {
+		t.Fatalf("runCommand(check --strategies) = %d, want 0", code)
+	}
+	if want := []string{"omission", "keyboard"}; !slices.Equal(got, want) {
+		t.Errorf("Strategies = %v, want %v", got, want)
+	}
+	if code := runCommand([]string{"ns-checker", "check", "--strategies", "omission,nope"}); code != 1 || calls != 1 {
+		t.Errorf("runCommand(check --strategies omission,nope) = %d after %d runs, want 1 without a run", code, calls)
+	}
+}
+
+func TestCheckFormatFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("google.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origFile, origRun := typoDomainsFile, runTypoCheck
+	defer func() { typoDomainsFile, runTypoCheck = origFile, origRun }()
+
+	var got string
+	typoDomainsFile = path
+	runTypoCheck = func(_ context.Context, _ []string, _ []string, opts dns_typo_checker.Options) []dns_typo_checker.DomainSummary {
+		got = opts.Format
+		return nil
+	}
+
+	for _, format := range []string{"json", "csv", "text"} {
+		if code := runCommand([]string{"ns-checker", "check", "--format", format}); code != 0 || got != format {
+			t.Errorf("runCommand(check --format %s) = %d with Format %q", format, code, got)
+		}
+	}
+	if code := runCommand([]string{"ns-checker", "check", "--format", "xml"}); code != 1 {
+		t.Errorf("runCommand(check --format xml) = %d, want 1", code)
+	}
+}